@@ -262,6 +262,11 @@ type Agent struct {
 	// attempts.
 	retryJoinCh chan error
 
+	// primaryGatewaysReloadCh carries an updated primary_gateways list
+	// from a config reload to the fallback discovery loop so the change
+	// takes effect without waiting for the next scheduled pass.
+	primaryGatewaysReloadCh chan []string
+
 	// endpoints maps unique RPC endpoint names to common ones
 	// to allow overriding of RPC handlers since the golang
 	// net/rpc server does not allow this.
@@ -328,25 +333,26 @@ func New(c *config.RuntimeConfig, logger hclog.InterceptLogger) (*Agent, error)
 	}
 
 	a := Agent{
-		config:           c,
-		checkReapAfter:   make(map[structs.CheckID]time.Duration),
-		checkMonitors:    make(map[structs.CheckID]*checks.CheckMonitor),
-		checkTTLs:        make(map[structs.CheckID]*checks.CheckTTL),
-		checkHTTPs:       make(map[structs.CheckID]*checks.CheckHTTP),
-		checkTCPs:        make(map[structs.CheckID]*checks.CheckTCP),
-		checkGRPCs:       make(map[structs.CheckID]*checks.CheckGRPC),
-		checkDockers:     make(map[structs.CheckID]*checks.CheckDocker),
-		checkAliases:     make(map[structs.CheckID]*checks.CheckAlias),
-		eventCh:          make(chan serf.UserEvent, 1024),
-		eventBuf:         make([]*UserEvent, 256),
-		joinLANNotifier:  &systemd.Notifier{},
-		reloadCh:         make(chan chan error),
-		retryJoinCh:      make(chan error),
-		shutdownCh:       make(chan struct{}),
-		InterruptStartCh: make(chan struct{}),
-		endpoints:        make(map[string]string),
-		tokens:           new(token.Store),
-		logger:           logger,
+		config:                  c,
+		checkReapAfter:          make(map[structs.CheckID]time.Duration),
+		checkMonitors:           make(map[structs.CheckID]*checks.CheckMonitor),
+		checkTTLs:               make(map[structs.CheckID]*checks.CheckTTL),
+		checkHTTPs:              make(map[structs.CheckID]*checks.CheckHTTP),
+		checkTCPs:               make(map[structs.CheckID]*checks.CheckTCP),
+		checkGRPCs:              make(map[structs.CheckID]*checks.CheckGRPC),
+		checkDockers:            make(map[structs.CheckID]*checks.CheckDocker),
+		checkAliases:            make(map[structs.CheckID]*checks.CheckAlias),
+		eventCh:                 make(chan serf.UserEvent, 1024),
+		eventBuf:                make([]*UserEvent, 256),
+		joinLANNotifier:         &systemd.Notifier{},
+		reloadCh:                make(chan chan error),
+		retryJoinCh:             make(chan error),
+		primaryGatewaysReloadCh: make(chan []string, 1),
+		shutdownCh:              make(chan struct{}),
+		InterruptStartCh:        make(chan struct{}),
+		endpoints:               make(map[string]string),
+		tokens:                  new(token.Store),
+		logger:                  logger,
 	}
 	a.serviceManager = NewServiceManager(&a)
 
@@ -580,6 +586,14 @@ func (a *Agent) Start() error {
 		go a.retryJoinWAN()
 	}
 
+	// Maintain a node-level health check mirroring this server's ability to
+	// reach mesh gateways for the primary datacenter.
+	if a.config.ServerMode &&
+		a.config.ConnectMeshGatewayWANFederationEnabled &&
+		a.config.ConnectMeshGatewayWANFederationHealthCheckEnabled {
+		go a.runWANFederationGatewayCheck()
+	}
+
 	return nil
 }
 
@@ -1358,6 +1372,7 @@ func (a *Agent) consulConfig() (*consul.Config, error) {
 	if a.config.ConnectEnabled {
 		base.ConnectEnabled = true
 		base.ConnectMeshGatewayWANFederationEnabled = a.config.ConnectMeshGatewayWANFederationEnabled
+		base.GatewaySelectionMode = a.config.ConnectMeshGatewayWANFederationSelectionPolicy
 
 		// Allow config to specify cluster_id provided it's a valid UUID. This is
 		// meant only for tests where a deterministic ID makes fixtures much simpler
@@ -1935,6 +1950,123 @@ func (a *Agent) RefreshPrimaryGatewayFallbackAddresses(addrs []string) error {
 	return fmt.Errorf("Must be a server to track mesh gateways in the primary datacenter")
 }
 
+// WANFederationStatus returns a point-in-time summary of the mesh gateway WAN
+// federation machinery, or nil for client agents and servers that do not have
+// it enabled.
+func (a *Agent) WANFederationStatus() *consul.WANFederationStatus {
+	if srv, ok := a.delegate.(*consul.Server); ok {
+		return srv.WANFederationStatus()
+	}
+	return nil
+}
+
+// wanfedRefreshStaleThreshold is how long the gateway locator may go without
+// a successful refresh before the availability check degrades to warning,
+// surfacing a stuck or perpetually erroring refresh loop.
+const wanfedRefreshStaleThreshold = 5 * time.Minute
+
+// runWANFederationGatewayCheck maintains the synthetic mesh gateway
+// availability health check on this server's node registration, driven by
+// the gateway locator's address change subscription: passing while primary
+// mesh gateways are known via federation state, warning while only fallback
+// addresses are in use, and critical when both are empty.
+func (a *Agent) runWANFederationGatewayCheck() {
+	srv, ok := a.delegate.(*consul.Server)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-a.shutdownCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	updateCh := srv.SubscribeMeshGatewayAddresses(ctx)
+	if updateCh == nil {
+		return
+	}
+
+	// The subscription only fires on address changes, so re-evaluate on a
+	// timer as well: refresh loop liveness can degrade without any change
+	// to the addresses themselves.
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	var last *consul.GatewayAddressSnapshot
+	registered := false
+	for {
+		select {
+		case snap, ok := <-updateCh:
+			if !ok {
+				return
+			}
+			last = &snap
+		case <-ticker.C:
+			if last == nil {
+				continue
+			}
+		case <-ctx.Done():
+			return
+		}
+
+		status, output := wanfedGatewayCheckStatus(last, a.wanfedRefreshStaleness(srv))
+		if !registered {
+			check := &structs.HealthCheck{
+				Node:    a.config.NodeName,
+				CheckID: structs.WANFedGatewayAvailCheckID,
+				Name:    "Mesh Gateway Availability",
+				Notes:   "Reflects whether this server knows of any mesh gateways usable for reaching the primary datacenter.",
+				Status:  status,
+				Output:  output,
+				Type:    "wanfed",
+			}
+			if err := a.State.AddCheck(check, ""); err != nil {
+				a.logger.Error("failed to register mesh gateway availability check", "error", err)
+				continue
+			}
+			registered = true
+			continue
+		}
+		a.State.UpdateCheck(structs.NewCheckID(structs.WANFedGatewayAvailCheckID, nil), status, output)
+	}
+}
+
+// wanfedRefreshStaleness returns how long ago the server's gateway locator
+// last refreshed successfully, or zero while it has never succeeded (startup
+// is covered by the address-based status instead).
+func (a *Agent) wanfedRefreshStaleness(srv *consul.Server) time.Duration {
+	st := srv.WANFederationStatus()
+	if st == nil || st.LastSuccessfulRefresh.IsZero() {
+		return 0
+	}
+	return time.Since(st.LastSuccessfulRefresh)
+}
+
+// wanfedGatewayCheckStatus collapses a gateway address snapshot into a check
+// status and human-readable output.
+func wanfedGatewayCheckStatus(snap *consul.GatewayAddressSnapshot, sinceLastRefresh time.Duration) (status, output string) {
+	switch {
+	case len(snap.PrimaryGateways) > 0:
+		if sinceLastRefresh > wanfedRefreshStaleThreshold {
+			return api.HealthWarning,
+				fmt.Sprintf("mesh gateway addresses are known but the locator has not refreshed successfully in %s", sinceLastRefresh.Round(time.Second))
+		}
+		return api.HealthPassing,
+			fmt.Sprintf("%d primary mesh gateways known via federation state", len(snap.PrimaryGateways))
+	case len(snap.FallbackAddresses) > 0:
+		return api.HealthWarning,
+			fmt.Sprintf("no primary mesh gateways known via federation state; relying on %d fallback addresses", len(snap.FallbackAddresses))
+	default:
+		return api.HealthCritical,
+			"no mesh gateway addresses are known for reaching the primary datacenter"
+	}
+}
+
 // ForceLeave is used to remove a failed node from the cluster
 func (a *Agent) ForceLeave(node string, prune bool) (err error) {
 	a.logger.Info("Force leaving node", "node", node)
@@ -4122,6 +4254,32 @@ func (a *Agent) ReloadConfig(newCfg *config.RuntimeConfig) error {
 
 	a.State.SetDiscardCheckOutput(newCfg.DiscardCheckOutput)
 
+	// Make a changed primary_gateways list take effect without waiting for
+	// the next scheduled fallback discovery pass. As with
+	// ConfigEntryBootstrap above, the in place modification is safe since
+	// reloads serialize on the stateLock.
+	if !lib.StringSliceEqual(a.config.PrimaryGateways, newCfg.PrimaryGateways) {
+		// Reject a broken replacement list outright rather than losing the
+		// previously working set to it.
+		if err := validatePrimaryGatewayEntries(newCfg.PrimaryGateways); err != nil {
+			return fmt.Errorf("Failed reloading primary gateways: %s", err)
+		}
+		a.logger.Info("Reloaded primary gateway addresses",
+			"primary_gateways", strings.Join(newCfg.PrimaryGateways, " "),
+		)
+		a.config.PrimaryGateways = newCfg.PrimaryGateways
+		select {
+		case a.primaryGatewaysReloadCh <- newCfg.PrimaryGateways:
+		default:
+			// replace the pending unread list
+			select {
+			case <-a.primaryGatewaysReloadCh:
+			default:
+			}
+			a.primaryGatewaysReloadCh <- newCfg.PrimaryGateways
+		}
+	}
+
 	return nil
 }
 
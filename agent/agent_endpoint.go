@@ -14,6 +14,7 @@ import (
 
 	"github.com/hashicorp/consul/acl"
 	cachetype "github.com/hashicorp/consul/agent/cache-types"
+	"github.com/hashicorp/consul/agent/consul"
 	"github.com/hashicorp/consul/agent/debug"
 	"github.com/hashicorp/consul/agent/structs"
 	token_store "github.com/hashicorp/consul/agent/token"
@@ -38,6 +39,10 @@ type Self struct {
 	Member      serf.Member
 	Stats       map[string]map[string]string
 	Meta        map[string]string
+
+	// WANFederation is only present on servers with WAN federation via mesh
+	// gateways enabled; client agents and other deployments omit it.
+	WANFederation *consul.WANFederationStatus `json:",omitempty"`
 }
 
 func (s *HTTPServer) AgentSelf(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
@@ -76,12 +81,13 @@ func (s *HTTPServer) AgentSelf(resp http.ResponseWriter, req *http.Request) (int
 		Version:    s.agent.config.Version,
 	}
 	return Self{
-		Config:      config,
-		DebugConfig: s.agent.config.Sanitized(),
-		Coord:       cs[s.agent.config.SegmentName],
-		Member:      s.agent.LocalMember(),
-		Stats:       s.agent.Stats(),
-		Meta:        s.agent.State.Metadata(),
+		Config:        config,
+		DebugConfig:   s.agent.config.Sanitized(),
+		Coord:         cs[s.agent.config.SegmentName],
+		Member:        s.agent.LocalMember(),
+		Stats:         s.agent.Stats(),
+		Meta:          s.agent.State.Metadata(),
+		WANFederation: s.agent.WANFederationStatus(),
 	}, nil
 }
 
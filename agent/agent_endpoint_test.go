@@ -1241,6 +1241,12 @@ func TestAgent_Self(t *testing.T) {
 	if !reflect.DeepEqual(a.config.NodeMeta, val.Meta) {
 		t.Fatalf("meta fields are not equal: %v != %v", a.config.NodeMeta, val.Meta)
 	}
+
+	// WAN federation via mesh gateways is not enabled, so the section is
+	// omitted entirely.
+	if val.WANFederation != nil {
+		t.Fatalf("expected no wan federation status, got: %+v", val.WANFederation)
+	}
 }
 
 func TestAgent_Self_ACLDeny(t *testing.T) {
@@ -23,6 +23,7 @@ import (
 	"github.com/hashicorp/consul/agent/checks"
 	"github.com/hashicorp/consul/agent/config"
 	"github.com/hashicorp/consul/agent/connect"
+	"github.com/hashicorp/consul/agent/consul"
 	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/ipaddr"
@@ -4398,3 +4399,65 @@ func TestAgent_JoinWAN_viaMeshGateway(t *testing.T) {
 		}
 	}
 }
+
+func TestAgent_WANFederationGatewayCheck(t *testing.T) {
+	t.Parallel()
+
+	a := NewTestAgent(t, `
+		primary_datacenter = "dc1"
+		connect {
+			enabled = true
+			enable_mesh_gateway_wan_federation = true
+		}
+	`)
+	defer a.Shutdown()
+
+	testrpc.WaitForLeader(t, a.RPC, "dc1")
+
+	checkID := structs.NewCheckID(structs.WANFedGatewayAvailCheckID, nil)
+
+	// With no gateways known and no fallback addresses the check settles
+	// at critical.
+	retry.Run(t, func(r *retry.R) {
+		check := a.State.Check(checkID)
+		if check == nil {
+			r.Fatal("mesh gateway availability check not registered yet")
+		}
+		require.Equal(r, api.HealthCritical, check.Status)
+	})
+
+	// Providing fallback addresses promotes the check to warning: there is
+	// a path to the primary, but not one learned via federation state.
+	require.NoError(t, a.RefreshPrimaryGatewayFallbackAddresses([]string{"127.0.0.1:9999"}))
+
+	retry.Run(t, func(r *retry.R) {
+		check := a.State.Check(checkID)
+		require.NotNil(r, check)
+		require.Equal(r, api.HealthWarning, check.Status)
+	})
+}
+
+func TestWANFedGatewayCheckStatus(t *testing.T) {
+	t.Parallel()
+
+	status, _ := wanfedGatewayCheckStatus(&consul.GatewayAddressSnapshot{
+		PrimaryGateways:   []string{"1.2.3.4:443"},
+		FallbackAddresses: []string{"5.6.7.8:443"},
+	}, 0)
+	require.Equal(t, api.HealthPassing, status)
+
+	status, _ = wanfedGatewayCheckStatus(&consul.GatewayAddressSnapshot{
+		FallbackAddresses: []string{"5.6.7.8:443"},
+	}, 0)
+	require.Equal(t, api.HealthWarning, status)
+
+	status, _ = wanfedGatewayCheckStatus(&consul.GatewayAddressSnapshot{}, 0)
+	require.Equal(t, api.HealthCritical, status)
+
+	// A stale refresh loop degrades an otherwise passing check to warning.
+	status, output := wanfedGatewayCheckStatus(&consul.GatewayAddressSnapshot{
+		PrimaryGateways: []string{"1.2.3.4:443"},
+	}, 10*time.Minute)
+	require.Equal(t, api.HealthWarning, status)
+	require.Contains(t, output, "has not refreshed successfully")
+}
@@ -37,9 +37,9 @@ import (
 //
 // The sources are merged in the following order:
 //
-//  * default configuration
-//  * config files in alphabetical order
-//  * command line arguments
+//   - default configuration
+//   - config files in alphabetical order
+//   - command line arguments
 //
 // The config sources are merged sequentially and later values
 // overwrite previously set values. Slice values are merged by
@@ -625,6 +625,10 @@ func (b *Builder) Build() (rt RuntimeConfig, err error) {
 	if connectMeshGatewayWANFederationEnabled && !connectEnabled {
 		return RuntimeConfig{}, fmt.Errorf("'connect.enable_mesh_gateway_wan_federation=true' requires 'connect.enabled=true'")
 	}
+	connectMeshGatewayWANFederationSelectionPolicy := b.stringVal(c.Connect.MeshGatewayWANFederationSelectionPolicy)
+	if err := consul.ValidateGatewaySelectionPolicy(connectMeshGatewayWANFederationSelectionPolicy); err != nil {
+		return RuntimeConfig{}, fmt.Errorf("'connect.mesh_gateway_wan_federation_selection_policy' invalid: %s", err)
+	}
 	if connectCAConfig != nil {
 		lib.TranslateKeys(connectCAConfig, map[string]string{
 			// Consul CA config
@@ -885,111 +889,116 @@ func (b *Builder) Build() (rt RuntimeConfig, err error) {
 		ConnectCAProvider:                      connectCAProvider,
 		ConnectCAConfig:                        connectCAConfig,
 		ConnectMeshGatewayWANFederationEnabled: connectMeshGatewayWANFederationEnabled,
-		ConnectSidecarMinPort:                  sidecarMinPort,
-		ConnectSidecarMaxPort:                  sidecarMaxPort,
-		ExposeMinPort:                          exposeMinPort,
-		ExposeMaxPort:                          exposeMaxPort,
-		DataDir:                                b.stringVal(c.DataDir),
-		Datacenter:                             datacenter,
-		DefaultQueryTime:                       b.durationVal("default_query_time", c.DefaultQueryTime),
-		DevMode:                                b.boolVal(b.Flags.DevMode),
-		DisableAnonymousSignature:              b.boolVal(c.DisableAnonymousSignature),
-		DisableCoordinates:                     b.boolVal(c.DisableCoordinates),
-		DisableHostNodeID:                      b.boolVal(c.DisableHostNodeID),
-		DisableHTTPUnprintableCharFilter:       b.boolVal(c.DisableHTTPUnprintableCharFilter),
-		DisableKeyringFile:                     b.boolVal(c.DisableKeyringFile),
-		DisableRemoteExec:                      b.boolVal(c.DisableRemoteExec),
-		DisableUpdateCheck:                     b.boolVal(c.DisableUpdateCheck),
-		DiscardCheckOutput:                     b.boolVal(c.DiscardCheckOutput),
-		DiscoveryMaxStale:                      b.durationVal("discovery_max_stale", c.DiscoveryMaxStale),
-		EnableAgentTLSForChecks:                b.boolVal(c.EnableAgentTLSForChecks),
-		EnableCentralServiceConfig:             b.boolVal(c.EnableCentralServiceConfig),
-		EnableDebug:                            b.boolVal(c.EnableDebug),
-		EnableRemoteScriptChecks:               enableRemoteScriptChecks,
-		EnableLocalScriptChecks:                enableLocalScriptChecks,
-		EnableSyslog:                           b.boolVal(c.EnableSyslog),
-		EnableUI:                               b.boolVal(c.UI),
-		EncryptKey:                             b.stringVal(c.EncryptKey),
-		EncryptVerifyIncoming:                  b.boolVal(c.EncryptVerifyIncoming),
-		EncryptVerifyOutgoing:                  b.boolVal(c.EncryptVerifyOutgoing),
-		GRPCPort:                               grpcPort,
-		GRPCAddrs:                              grpcAddrs,
-		HTTPMaxConnsPerClient:                  b.intVal(c.Limits.HTTPMaxConnsPerClient),
-		HTTPSHandshakeTimeout:                  b.durationVal("limits.https_handshake_timeout", c.Limits.HTTPSHandshakeTimeout),
-		KeyFile:                                b.stringVal(c.KeyFile),
-		KVMaxValueSize:                         b.uint64Val(c.Limits.KVMaxValueSize),
-		LeaveDrainTime:                         b.durationVal("performance.leave_drain_time", c.Performance.LeaveDrainTime),
-		LeaveOnTerm:                            leaveOnTerm,
-		LogLevel:                               b.stringVal(c.LogLevel),
-		LogJSON:                                b.boolVal(c.LogJSON),
-		LogFile:                                b.stringVal(c.LogFile),
-		LogRotateBytes:                         b.intVal(c.LogRotateBytes),
-		LogRotateDuration:                      b.durationVal("log_rotate_duration", c.LogRotateDuration),
-		LogRotateMaxFiles:                      b.intVal(c.LogRotateMaxFiles),
-		MaxQueryTime:                           b.durationVal("max_query_time", c.MaxQueryTime),
-		NodeID:                                 types.NodeID(b.stringVal(c.NodeID)),
-		NodeMeta:                               c.NodeMeta,
-		NodeName:                               b.nodeName(c.NodeName),
-		NonVotingServer:                        b.boolVal(c.NonVotingServer),
-		PidFile:                                b.stringVal(c.PidFile),
-		PrimaryDatacenter:                      primaryDatacenter,
-		PrimaryGateways:                        b.expandAllOptionalAddrs("primary_gateways", c.PrimaryGateways),
-		PrimaryGatewaysInterval:                b.durationVal("primary_gateways_interval", c.PrimaryGatewaysInterval),
-		RPCAdvertiseAddr:                       rpcAdvertiseAddr,
-		RPCBindAddr:                            rpcBindAddr,
-		RPCHandshakeTimeout:                    b.durationVal("limits.rpc_handshake_timeout", c.Limits.RPCHandshakeTimeout),
-		RPCHoldTimeout:                         b.durationVal("performance.rpc_hold_timeout", c.Performance.RPCHoldTimeout),
-		RPCMaxBurst:                            b.intVal(c.Limits.RPCMaxBurst),
-		RPCMaxConnsPerClient:                   b.intVal(c.Limits.RPCMaxConnsPerClient),
-		RPCProtocol:                            b.intVal(c.RPCProtocol),
-		RPCRateLimit:                           rate.Limit(b.float64Val(c.Limits.RPCRate)),
-		RaftProtocol:                           b.intVal(c.RaftProtocol),
-		RaftSnapshotThreshold:                  b.intVal(c.RaftSnapshotThreshold),
-		RaftSnapshotInterval:                   b.durationVal("raft_snapshot_interval", c.RaftSnapshotInterval),
-		RaftTrailingLogs:                       b.intVal(c.RaftTrailingLogs),
-		ReconnectTimeoutLAN:                    b.durationVal("reconnect_timeout", c.ReconnectTimeoutLAN),
-		ReconnectTimeoutWAN:                    b.durationVal("reconnect_timeout_wan", c.ReconnectTimeoutWAN),
-		RejoinAfterLeave:                       b.boolVal(c.RejoinAfterLeave),
-		RetryJoinIntervalLAN:                   b.durationVal("retry_interval", c.RetryJoinIntervalLAN),
-		RetryJoinIntervalWAN:                   b.durationVal("retry_interval_wan", c.RetryJoinIntervalWAN),
-		RetryJoinLAN:                           b.expandAllOptionalAddrs("retry_join", c.RetryJoinLAN),
-		RetryJoinMaxAttemptsLAN:                b.intVal(c.RetryJoinMaxAttemptsLAN),
-		RetryJoinMaxAttemptsWAN:                b.intVal(c.RetryJoinMaxAttemptsWAN),
-		RetryJoinWAN:                           b.expandAllOptionalAddrs("retry_join_wan", c.RetryJoinWAN),
-		SegmentName:                            b.stringVal(c.SegmentName),
-		Segments:                               segments,
-		SerfAdvertiseAddrLAN:                   serfAdvertiseAddrLAN,
-		SerfAdvertiseAddrWAN:                   serfAdvertiseAddrWAN,
-		SerfBindAddrLAN:                        serfBindAddrLAN,
-		SerfBindAddrWAN:                        serfBindAddrWAN,
-		SerfPortLAN:                            serfPortLAN,
-		SerfPortWAN:                            serfPortWAN,
-		ServerMode:                             b.boolVal(c.ServerMode),
-		ServerName:                             b.stringVal(c.ServerName),
-		ServerPort:                             serverPort,
-		Services:                               services,
-		SessionTTLMin:                          b.durationVal("session_ttl_min", c.SessionTTLMin),
-		SkipLeaveOnInt:                         skipLeaveOnInt,
-		StartJoinAddrsLAN:                      b.expandAllOptionalAddrs("start_join", c.StartJoinAddrsLAN),
-		StartJoinAddrsWAN:                      b.expandAllOptionalAddrs("start_join_wan", c.StartJoinAddrsWAN),
-		SyslogFacility:                         b.stringVal(c.SyslogFacility),
-		TLSCipherSuites:                        b.tlsCipherSuites("tls_cipher_suites", c.TLSCipherSuites),
-		TLSMinVersion:                          b.stringVal(c.TLSMinVersion),
-		TLSPreferServerCipherSuites:            b.boolVal(c.TLSPreferServerCipherSuites),
-		TaggedAddresses:                        c.TaggedAddresses,
-		TranslateWANAddrs:                      b.boolVal(c.TranslateWANAddrs),
-		TxnMaxReqLen:                           b.uint64Val(c.Limits.TxnMaxReqLen),
-		UIDir:                                  b.stringVal(c.UIDir),
-		UIContentPath:                          UIPathBuilder(b.stringVal(c.UIContentPath)),
-		UnixSocketGroup:                        b.stringVal(c.UnixSocket.Group),
-		UnixSocketMode:                         b.stringVal(c.UnixSocket.Mode),
-		UnixSocketUser:                         b.stringVal(c.UnixSocket.User),
-		VerifyIncoming:                         b.boolVal(c.VerifyIncoming),
-		VerifyIncomingHTTPS:                    b.boolVal(c.VerifyIncomingHTTPS),
-		VerifyIncomingRPC:                      b.boolVal(c.VerifyIncomingRPC),
-		VerifyOutgoing:                         verifyOutgoing,
-		VerifyServerHostname:                   verifyServerName,
-		Watches:                                c.Watches,
+		ConnectMeshGatewayWANFederationHealthCheckEnabled: b.boolValWithDefault(c.Connect.MeshGatewayWANFederationHealthCheck, true),
+		ConnectMeshGatewayWANFederationSelectionPolicy:    connectMeshGatewayWANFederationSelectionPolicy,
+		ConnectSidecarMinPort:                             sidecarMinPort,
+		ConnectSidecarMaxPort:                             sidecarMaxPort,
+		ExposeMinPort:                                     exposeMinPort,
+		ExposeMaxPort:                                     exposeMaxPort,
+		DataDir:                                           b.stringVal(c.DataDir),
+		Datacenter:                                        datacenter,
+		DefaultQueryTime:                                  b.durationVal("default_query_time", c.DefaultQueryTime),
+		DevMode:                                           b.boolVal(b.Flags.DevMode),
+		DisableAnonymousSignature:                         b.boolVal(c.DisableAnonymousSignature),
+		DisableCoordinates:                                b.boolVal(c.DisableCoordinates),
+		DisableHostNodeID:                                 b.boolVal(c.DisableHostNodeID),
+		DisableHTTPUnprintableCharFilter:                  b.boolVal(c.DisableHTTPUnprintableCharFilter),
+		DisableKeyringFile:                                b.boolVal(c.DisableKeyringFile),
+		DisableRemoteExec:                                 b.boolVal(c.DisableRemoteExec),
+		DisableUpdateCheck:                                b.boolVal(c.DisableUpdateCheck),
+		DiscardCheckOutput:                                b.boolVal(c.DiscardCheckOutput),
+		DiscoveryMaxStale:                                 b.durationVal("discovery_max_stale", c.DiscoveryMaxStale),
+		EnableAgentTLSForChecks:                           b.boolVal(c.EnableAgentTLSForChecks),
+		EnableCentralServiceConfig:                        b.boolVal(c.EnableCentralServiceConfig),
+		EnableDebug:                                       b.boolVal(c.EnableDebug),
+		EnableRemoteScriptChecks:                          enableRemoteScriptChecks,
+		EnableLocalScriptChecks:                           enableLocalScriptChecks,
+		EnableSyslog:                                      b.boolVal(c.EnableSyslog),
+		EnableUI:                                          b.boolVal(c.UI),
+		EncryptKey:                                        b.stringVal(c.EncryptKey),
+		EncryptVerifyIncoming:                             b.boolVal(c.EncryptVerifyIncoming),
+		EncryptVerifyOutgoing:                             b.boolVal(c.EncryptVerifyOutgoing),
+		GRPCPort:                                          grpcPort,
+		GRPCAddrs:                                         grpcAddrs,
+		HTTPMaxConnsPerClient:                             b.intVal(c.Limits.HTTPMaxConnsPerClient),
+		HTTPSHandshakeTimeout:                             b.durationVal("limits.https_handshake_timeout", c.Limits.HTTPSHandshakeTimeout),
+		KeyFile:                                           b.stringVal(c.KeyFile),
+		KVMaxValueSize:                                    b.uint64Val(c.Limits.KVMaxValueSize),
+		LeaveDrainTime:                                    b.durationVal("performance.leave_drain_time", c.Performance.LeaveDrainTime),
+		LeaveOnTerm:                                       leaveOnTerm,
+		LogLevel:                                          b.stringVal(c.LogLevel),
+		LogJSON:                                           b.boolVal(c.LogJSON),
+		LogFile:                                           b.stringVal(c.LogFile),
+		LogRotateBytes:                                    b.intVal(c.LogRotateBytes),
+		LogRotateDuration:                                 b.durationVal("log_rotate_duration", c.LogRotateDuration),
+		LogRotateMaxFiles:                                 b.intVal(c.LogRotateMaxFiles),
+		MaxQueryTime:                                      b.durationVal("max_query_time", c.MaxQueryTime),
+		NodeID:                                            types.NodeID(b.stringVal(c.NodeID)),
+		NodeMeta:                                          c.NodeMeta,
+		NodeName:                                          b.nodeName(c.NodeName),
+		NonVotingServer:                                   b.boolVal(c.NonVotingServer),
+		PidFile:                                           b.stringVal(c.PidFile),
+		PrimaryDatacenter:                                 primaryDatacenter,
+		PrimaryGateways:                                   b.expandAllOptionalAddrs("primary_gateways", c.PrimaryGateways),
+		PrimaryGatewaysInterval:                           b.durationVal("primary_gateways_interval", c.PrimaryGatewaysInterval),
+		PrimaryGatewaysPort:                               b.intVal(c.PrimaryGatewaysPort),
+		PrimaryGatewaysExec:                               c.PrimaryGatewaysExec,
+		PrimaryGatewaysExecTimeout:                        b.durationVal("primary_gateways_exec_timeout", c.PrimaryGatewaysExecTimeout),
+		RPCAdvertiseAddr:                                  rpcAdvertiseAddr,
+		RPCBindAddr:                                       rpcBindAddr,
+		RPCHandshakeTimeout:                               b.durationVal("limits.rpc_handshake_timeout", c.Limits.RPCHandshakeTimeout),
+		RPCHoldTimeout:                                    b.durationVal("performance.rpc_hold_timeout", c.Performance.RPCHoldTimeout),
+		RPCMaxBurst:                                       b.intVal(c.Limits.RPCMaxBurst),
+		RPCMaxConnsPerClient:                              b.intVal(c.Limits.RPCMaxConnsPerClient),
+		RPCProtocol:                                       b.intVal(c.RPCProtocol),
+		RPCRateLimit:                                      rate.Limit(b.float64Val(c.Limits.RPCRate)),
+		RaftProtocol:                                      b.intVal(c.RaftProtocol),
+		RaftSnapshotThreshold:                             b.intVal(c.RaftSnapshotThreshold),
+		RaftSnapshotInterval:                              b.durationVal("raft_snapshot_interval", c.RaftSnapshotInterval),
+		RaftTrailingLogs:                                  b.intVal(c.RaftTrailingLogs),
+		ReconnectTimeoutLAN:                               b.durationVal("reconnect_timeout", c.ReconnectTimeoutLAN),
+		ReconnectTimeoutWAN:                               b.durationVal("reconnect_timeout_wan", c.ReconnectTimeoutWAN),
+		RejoinAfterLeave:                                  b.boolVal(c.RejoinAfterLeave),
+		RetryJoinIntervalLAN:                              b.durationVal("retry_interval", c.RetryJoinIntervalLAN),
+		RetryJoinIntervalWAN:                              b.durationVal("retry_interval_wan", c.RetryJoinIntervalWAN),
+		RetryJoinLAN:                                      b.expandAllOptionalAddrs("retry_join", c.RetryJoinLAN),
+		RetryJoinMaxAttemptsLAN:                           b.intVal(c.RetryJoinMaxAttemptsLAN),
+		RetryJoinMaxAttemptsWAN:                           b.intVal(c.RetryJoinMaxAttemptsWAN),
+		RetryJoinWAN:                                      b.expandAllOptionalAddrs("retry_join_wan", c.RetryJoinWAN),
+		SegmentName:                                       b.stringVal(c.SegmentName),
+		Segments:                                          segments,
+		SerfAdvertiseAddrLAN:                              serfAdvertiseAddrLAN,
+		SerfAdvertiseAddrWAN:                              serfAdvertiseAddrWAN,
+		SerfBindAddrLAN:                                   serfBindAddrLAN,
+		SerfBindAddrWAN:                                   serfBindAddrWAN,
+		SerfPortLAN:                                       serfPortLAN,
+		SerfPortWAN:                                       serfPortWAN,
+		ServerMode:                                        b.boolVal(c.ServerMode),
+		ServerName:                                        b.stringVal(c.ServerName),
+		ServerPort:                                        serverPort,
+		Services:                                          services,
+		SessionTTLMin:                                     b.durationVal("session_ttl_min", c.SessionTTLMin),
+		SkipLeaveOnInt:                                    skipLeaveOnInt,
+		StartJoinAddrsLAN:                                 b.expandAllOptionalAddrs("start_join", c.StartJoinAddrsLAN),
+		StartJoinAddrsWAN:                                 b.expandAllOptionalAddrs("start_join_wan", c.StartJoinAddrsWAN),
+		SyslogFacility:                                    b.stringVal(c.SyslogFacility),
+		TLSCipherSuites:                                   b.tlsCipherSuites("tls_cipher_suites", c.TLSCipherSuites),
+		TLSMinVersion:                                     b.stringVal(c.TLSMinVersion),
+		TLSPreferServerCipherSuites:                       b.boolVal(c.TLSPreferServerCipherSuites),
+		TaggedAddresses:                                   c.TaggedAddresses,
+		TranslateWANAddrs:                                 b.boolVal(c.TranslateWANAddrs),
+		TxnMaxReqLen:                                      b.uint64Val(c.Limits.TxnMaxReqLen),
+		UIDir:                                             b.stringVal(c.UIDir),
+		UIContentPath:                                     UIPathBuilder(b.stringVal(c.UIContentPath)),
+		UnixSocketGroup:                                   b.stringVal(c.UnixSocket.Group),
+		UnixSocketMode:                                    b.stringVal(c.UnixSocket.Mode),
+		UnixSocketUser:                                    b.stringVal(c.UnixSocket.User),
+		VerifyIncoming:                                    b.boolVal(c.VerifyIncoming),
+		VerifyIncomingHTTPS:                               b.boolVal(c.VerifyIncomingHTTPS),
+		VerifyIncomingRPC:                                 b.boolVal(c.VerifyIncomingRPC),
+		VerifyOutgoing:                                    verifyOutgoing,
+		VerifyServerHostname:                              verifyServerName,
+		Watches:                                           c.Watches,
 	}
 
 	if entCfg, err := b.BuildEnterpriseRuntimeConfig(&c); err != nil {
@@ -1141,6 +1150,31 @@ func (b *Builder) Validate(rt RuntimeConfig) error {
 		if rt.PrimaryDatacenter == rt.Datacenter {
 			return fmt.Errorf("'primary_gateways' should only be configured in a secondary datacenter")
 		}
+		invalid := 0
+		for _, addr := range rt.PrimaryGateways {
+			// go-discover and SRV entries are resolved at runtime
+			if strings.Contains(addr, "provider=") || strings.HasPrefix(addr, "srv+") {
+				continue
+			}
+			if err := lib.ValidateDialAddressOptionalPort(addr); err != nil {
+				invalid++
+				b.warn("skipping invalid 'primary_gateways' entry %q: %s", addr, err)
+			}
+		}
+		if invalid == len(rt.PrimaryGateways) {
+			return fmt.Errorf("'primary_gateways' contains no valid entries")
+		}
+	}
+	if len(rt.PrimaryGatewaysExec) > 0 {
+		if !rt.ServerMode {
+			return fmt.Errorf("'primary_gateways_exec' requires 'server = true'")
+		}
+		if rt.PrimaryDatacenter == rt.Datacenter {
+			return fmt.Errorf("'primary_gateways_exec' should only be configured in a secondary datacenter")
+		}
+		if !rt.EnableLocalScriptChecks {
+			return fmt.Errorf("'primary_gateways_exec' requires 'enable_script_checks' or 'enable_local_script_checks' to be set")
+		}
 	}
 
 	// Check the data dir for signs of an un-migrated Consul 0.5.x or older
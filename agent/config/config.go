@@ -256,6 +256,9 @@ type Config struct {
 	PrimaryDatacenter                *string                  `json:"primary_datacenter,omitempty" hcl:"primary_datacenter" mapstructure:"primary_datacenter"`
 	PrimaryGateways                  []string                 `json:"primary_gateways" hcl:"primary_gateways" mapstructure:"primary_gateways"`
 	PrimaryGatewaysInterval          *string                  `json:"primary_gateways_interval,omitempty" hcl:"primary_gateways_interval" mapstructure:"primary_gateways_interval"`
+	PrimaryGatewaysPort              *int                     `json:"primary_gateways_port,omitempty" hcl:"primary_gateways_port" mapstructure:"primary_gateways_port"`
+	PrimaryGatewaysExec              []string                 `json:"primary_gateways_exec,omitempty" hcl:"primary_gateways_exec" mapstructure:"primary_gateways_exec"`
+	PrimaryGatewaysExecTimeout       *string                  `json:"primary_gateways_exec_timeout,omitempty" hcl:"primary_gateways_exec_timeout" mapstructure:"primary_gateways_exec_timeout"`
 	RPCProtocol                      *int                     `json:"protocol,omitempty" hcl:"protocol" mapstructure:"protocol"`
 	RaftProtocol                     *int                     `json:"raft_protocol,omitempty" hcl:"raft_protocol" mapstructure:"raft_protocol"`
 	RaftSnapshotThreshold            *int                     `json:"raft_snapshot_threshold,omitempty" hcl:"raft_snapshot_threshold" mapstructure:"raft_snapshot_threshold"`
@@ -604,10 +607,12 @@ type AutoEncrypt struct {
 type Connect struct {
 	// Enabled opts the agent into connect. It should be set on all clients and
 	// servers in a cluster for correct connect operation.
-	Enabled                         *bool                  `json:"enabled,omitempty" hcl:"enabled" mapstructure:"enabled"`
-	CAProvider                      *string                `json:"ca_provider,omitempty" hcl:"ca_provider" mapstructure:"ca_provider"`
-	CAConfig                        map[string]interface{} `json:"ca_config,omitempty" hcl:"ca_config" mapstructure:"ca_config"`
-	MeshGatewayWANFederationEnabled *bool                  `json:"enable_mesh_gateway_wan_federation" hcl:"enable_mesh_gateway_wan_federation" mapstructure:"enable_mesh_gateway_wan_federation"`
+	Enabled                                 *bool                  `json:"enabled,omitempty" hcl:"enabled" mapstructure:"enabled"`
+	CAProvider                              *string                `json:"ca_provider,omitempty" hcl:"ca_provider" mapstructure:"ca_provider"`
+	CAConfig                                map[string]interface{} `json:"ca_config,omitempty" hcl:"ca_config" mapstructure:"ca_config"`
+	MeshGatewayWANFederationEnabled         *bool                  `json:"enable_mesh_gateway_wan_federation" hcl:"enable_mesh_gateway_wan_federation" mapstructure:"enable_mesh_gateway_wan_federation"`
+	MeshGatewayWANFederationHealthCheck     *bool                  `json:"enable_mesh_gateway_wan_federation_health_check,omitempty" hcl:"enable_mesh_gateway_wan_federation_health_check" mapstructure:"enable_mesh_gateway_wan_federation_health_check"`
+	MeshGatewayWANFederationSelectionPolicy *string                `json:"mesh_gateway_wan_federation_selection_policy,omitempty" hcl:"mesh_gateway_wan_federation_selection_policy" mapstructure:"mesh_gateway_wan_federation_selection_policy"`
 }
 
 // SOA is the configuration of SOA for DNS
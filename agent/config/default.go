@@ -64,7 +64,9 @@ func DefaultSource() Source {
 		encrypt_verify_outgoing = true
 		log_level = "INFO"
 		max_query_time = "600s"
+		primary_gateways_exec_timeout = "30s"
 		primary_gateways_interval = "30s"
+		primary_gateways_port = 8443
 		protocol =  2
 		retry_interval = "30s"
 		retry_interval_wan = "30s"
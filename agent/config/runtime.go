@@ -573,6 +573,18 @@ type RuntimeConfig struct {
 	// datacenters should exclusively traverse mesh gateways.
 	ConnectMeshGatewayWANFederationEnabled bool
 
+	// ConnectMeshGatewayWANFederationHealthCheckEnabled determines if servers
+	// with wan federation via mesh gateways enabled maintain a synthetic
+	// node-level health check reflecting whether any path to the primary
+	// datacenter is known. Defaults to true; primary-datacenter servers,
+	// where the check carries no signal, may turn it off.
+	ConnectMeshGatewayWANFederationHealthCheckEnabled bool
+
+	// ConnectMeshGatewayWANFederationSelectionPolicy controls how servers
+	// pick among the known mesh gateways when forwarding wan-federated
+	// traffic. An empty string selects the default policy.
+	ConnectMeshGatewayWANFederationSelectionPolicy string
+
 	// ConnectTestCALeafRootChangeSpread is used to control how long the CA leaf
 	// cache with spread CSRs over when a root change occurs. For now we don't
 	// expose this in public config intentionally but could later with a rename.
@@ -946,6 +958,28 @@ type RuntimeConfig struct {
 	// hcl: primary_gateways_interval = "duration"
 	PrimaryGatewaysInterval time.Duration
 
+	// PrimaryGatewaysPort is the port appended to addresses returned by
+	// cloud auto-join discovery of the primary's mesh gateways, since the
+	// providers only hand back bare IPs. The default is 8443.
+	//
+	// hcl: primary_gateways_port = int
+	PrimaryGatewaysPort int
+
+	// PrimaryGatewaysExec is an optional executable, plus arguments, run on
+	// every fallback discovery pass to look up the primary's mesh gateways
+	// from sources neither DNS nor cloud auto-join can reach. The command
+	// prints one host:port per line on stdout; a non-zero exit keeps the
+	// previous answer. Requires script checks to be enabled.
+	//
+	// hcl: primary_gateways_exec = []string
+	PrimaryGatewaysExec []string
+
+	// PrimaryGatewaysExecTimeout bounds each run of PrimaryGatewaysExec.
+	// The default is 30s.
+	//
+	// hcl: primary_gateways_exec_timeout = "duration"
+	PrimaryGatewaysExecTimeout time.Duration
+
 	// RPCAdvertiseAddr is the TCP address Consul advertises for its RPC endpoint.
 	// By default this is the bind address on the default RPC Server port. If the
 	// advertise address is specified then it is used.
@@ -2978,6 +2978,25 @@ func TestConfigFlagsAndEdgecases(t *testing.T) {
 			`},
 			err: "'connect.enable_mesh_gateway_wan_federation=true' requires 'connect.enabled=true'",
 		},
+		{
+			desc: "connect.mesh_gateway_wan_federation_selection_policy invalid",
+			args: []string{
+				`-data-dir=` + dataDir,
+			},
+			json: []string{`{
+			  "connect": {
+				"enabled": true,
+				"mesh_gateway_wan_federation_selection_policy": "fancy"
+			  }
+			}`},
+			hcl: []string{`
+			  connect {
+			    enabled = true
+			    mesh_gateway_wan_federation_selection_policy = "fancy"
+			  }
+			`},
+			err: `'connect.mesh_gateway_wan_federation_selection_policy' invalid: unsupported gateway selection policy: "fancy"`,
+		},
 		{
 			desc: "connect.enable_mesh_gateway_wan_federation cannot use -join-wan",
 			args: []string{
@@ -3108,6 +3127,80 @@ func TestConfigFlagsAndEdgecases(t *testing.T) {
 			`},
 			err: "'primary_gateways' should only be configured in a secondary datacenter",
 		},
+		{
+			desc: "primary_gateways with no valid entries",
+			args: []string{
+				`-data-dir=` + dataDir,
+			},
+			json: []string{`{
+			  "server": true,
+			  "primary_datacenter": "one",
+			  "datacenter": "two",
+			  "primary_gateways": [ "10.0.0.300:443", "gateway..example.com:443" ]
+			}`},
+			hcl: []string{`
+			  server = true
+			  primary_datacenter = "one"
+			  datacenter = "two"
+			  primary_gateways = [ "10.0.0.300:443", "gateway..example.com:443" ]
+			`},
+			warns: []string{
+				`skipping invalid 'primary_gateways' entry "10.0.0.300:443": invalid ip address "10.0.0.300"`,
+				`skipping invalid 'primary_gateways' entry "gateway..example.com:443": malformed hostname "gateway..example.com"`,
+			},
+			err: "'primary_gateways' contains no valid entries",
+		},
+		{
+			desc: "primary_gateways keeps valid entries and warns about invalid ones",
+			args: []string{
+				`-data-dir=` + dataDir,
+			},
+			json: []string{`{
+			  "server": true,
+			  "primary_datacenter": "one",
+			  "datacenter": "two",
+			  "primary_gateways": [ "10.0.0.5:443", "10.0.0.300:443" ]
+			}`},
+			hcl: []string{`
+			  server = true
+			  primary_datacenter = "one"
+			  datacenter = "two"
+			  primary_gateways = [ "10.0.0.5:443", "10.0.0.300:443" ]
+			`},
+			warns: []string{
+				`skipping invalid 'primary_gateways' entry "10.0.0.300:443": invalid ip address "10.0.0.300"`,
+			},
+			patch: func(rt *RuntimeConfig) {
+				rt.DataDir = dataDir
+				rt.Datacenter = "two"
+				rt.PrimaryDatacenter = "one"
+				rt.ACLDatacenter = "one"
+				rt.PrimaryGateways = []string{"10.0.0.5:443", "10.0.0.300:443"}
+				// server things
+				rt.ServerMode = true
+				rt.LeaveOnTerm = false
+				rt.SkipLeaveOnInt = true
+			},
+		},
+		{
+			desc: "primary_gateways_exec requires script checks",
+			args: []string{
+				`-data-dir=` + dataDir,
+			},
+			json: []string{`{
+			  "server": true,
+			  "primary_datacenter": "one",
+			  "datacenter": "two",
+			  "primary_gateways_exec": [ "/usr/local/bin/lookup-gateways" ]
+			}`},
+			hcl: []string{`
+			  server = true
+			  primary_datacenter = "one"
+			  datacenter = "two"
+			  primary_gateways_exec = [ "/usr/local/bin/lookup-gateways" ]
+			`},
+			err: "'primary_gateways_exec' requires 'enable_script_checks' or 'enable_local_script_checks' to be set",
+		},
 		{
 			desc: "connect.enable_mesh_gateway_wan_federation in secondary with primary_gateways configured",
 			args: []string{
@@ -3875,14 +3968,13 @@ func testConfig(t *testing.T, tests []configTest, dataDir string) {
 // To aid populating the fields the following bash functions can be used
 // to generate random strings and ints:
 //
-//   random-int() { echo $RANDOM }
-//   random-string() { base64 /dev/urandom | tr -d '/+' | fold -w ${1:-32} | head -n 1 }
+//	random-int() { echo $RANDOM }
+//	random-string() { base64 /dev/urandom | tr -d '/+' | fold -w ${1:-32} | head -n 1 }
 //
 // To generate a random string of length 8 run the following command in
 // a terminal:
 //
-//   random-string 8
-//
+//	random-string 8
 func TestFullConfig(t *testing.T) {
 	dataDir := testutil.TempDir(t, "consul")
 	defer os.RemoveAll(dataDir)
@@ -4066,6 +4158,7 @@ func TestFullConfig(t *testing.T) {
 					"csr_max_concurrent": 2
 				},
 				"enable_mesh_gateway_wan_federation": false,
+				"enable_mesh_gateway_wan_federation_health_check": false,
 				"enabled": true
 			},
 			"gossip_lan" : {
@@ -4176,6 +4269,9 @@ func TestFullConfig(t *testing.T) {
 			"primary_datacenter": "ejtmd43d",
 			"primary_gateways": [ "aej8eeZo", "roh2KahS" ],
 			"primary_gateways_interval": "18866s",
+			"primary_gateways_port": 27015,
+			"primary_gateways_exec": [ "/bin/jahth4Ah", "--dc", "ejtmd43d" ],
+			"primary_gateways_exec_timeout": "8298s",
 			"raft_protocol": 19016,
 			"raft_snapshot_threshold": 16384,
 			"raft_snapshot_interval": "30s",
@@ -4700,6 +4796,7 @@ func TestFullConfig(t *testing.T) {
 					csr_max_concurrent = 2.0
 				}
 				enable_mesh_gateway_wan_federation = false
+				enable_mesh_gateway_wan_federation_health_check = false
 				enabled = true
 			}
 			gossip_lan {
@@ -4812,6 +4909,9 @@ func TestFullConfig(t *testing.T) {
 			primary_datacenter = "ejtmd43d"
 			primary_gateways = [ "aej8eeZo", "roh2KahS" ]
 			primary_gateways_interval = "18866s"
+			primary_gateways_port = 27015
+			primary_gateways_exec = [ "/bin/jahth4Ah", "--dc", "ejtmd43d" ]
+			primary_gateways_exec_timeout = "8298s"
 			raft_protocol = 19016
 			raft_snapshot_threshold = 16384
 			raft_snapshot_interval = "30s"
@@ -5426,97 +5526,101 @@ func TestFullConfig(t *testing.T) {
 			"CSRMaxPerSecond":     float64(100),
 			"CSRMaxConcurrent":    float64(2),
 		},
-		ConnectMeshGatewayWANFederationEnabled: false,
-		DNSAddrs:                               []net.Addr{tcpAddr("93.95.95.81:7001"), udpAddr("93.95.95.81:7001")},
-		DNSARecordLimit:                        29907,
-		DNSAllowStale:                          true,
-		DNSDisableCompression:                  true,
-		DNSDomain:                              "7W1xXSqd",
-		DNSAltDomain:                           "1789hsd",
-		DNSEnableTruncate:                      true,
-		DNSMaxStale:                            29685 * time.Second,
-		DNSNodeTTL:                             7084 * time.Second,
-		DNSOnlyPassing:                         true,
-		DNSPort:                                7001,
-		DNSRecursorTimeout:                     4427 * time.Second,
-		DNSRecursors:                           []string{"63.38.39.58", "92.49.18.18"},
-		DNSSOA:                                 RuntimeSOAConfig{Refresh: 3600, Retry: 600, Expire: 86400, Minttl: 0},
-		DNSServiceTTL:                          map[string]time.Duration{"*": 32030 * time.Second},
-		DNSUDPAnswerLimit:                      29909,
-		DNSNodeMetaTXT:                         true,
-		DNSUseCache:                            true,
-		DNSCacheMaxAge:                         5 * time.Minute,
-		DataDir:                                dataDir,
-		Datacenter:                             "rzo029wg",
-		DefaultQueryTime:                       16743 * time.Second,
-		DevMode:                                true,
-		DisableAnonymousSignature:              true,
-		DisableCoordinates:                     true,
-		DisableHostNodeID:                      true,
-		DisableHTTPUnprintableCharFilter:       true,
-		DisableKeyringFile:                     true,
-		DisableRemoteExec:                      true,
-		DisableUpdateCheck:                     true,
-		DiscardCheckOutput:                     true,
-		DiscoveryMaxStale:                      5 * time.Second,
-		EnableAgentTLSForChecks:                true,
-		EnableCentralServiceConfig:             true,
-		EnableDebug:                            true,
-		EnableRemoteScriptChecks:               true,
-		EnableLocalScriptChecks:                true,
-		EnableSyslog:                           true,
-		EnableUI:                               true,
-		EncryptKey:                             "A4wELWqH",
-		EncryptVerifyIncoming:                  true,
-		EncryptVerifyOutgoing:                  true,
-		GRPCPort:                               4881,
-		GRPCAddrs:                              []net.Addr{tcpAddr("32.31.61.91:4881")},
-		HTTPAddrs:                              []net.Addr{tcpAddr("83.39.91.39:7999")},
-		HTTPBlockEndpoints:                     []string{"RBvAFcGD", "fWOWFznh"},
-		AllowWriteHTTPFrom:                     []*net.IPNet{cidr("127.0.0.0/8"), cidr("22.33.44.55/32"), cidr("0.0.0.0/0")},
-		HTTPPort:                               7999,
-		HTTPResponseHeaders:                    map[string]string{"M6TKa9NP": "xjuxjOzQ", "JRCrHZed": "rl0mTx81"},
-		HTTPSAddrs:                             []net.Addr{tcpAddr("95.17.17.19:15127")},
-		HTTPMaxConnsPerClient:                  100,
-		HTTPSHandshakeTimeout:                  2391 * time.Millisecond,
-		HTTPSPort:                              15127,
-		KeyFile:                                "IEkkwgIA",
-		KVMaxValueSize:                         1234567800000000,
-		LeaveDrainTime:                         8265 * time.Second,
-		LeaveOnTerm:                            true,
-		LogLevel:                               "k1zo9Spt",
-		LogJSON:                                true,
-		MaxQueryTime:                           18237 * time.Second,
-		NodeID:                                 types.NodeID("AsUIlw99"),
-		NodeMeta:                               map[string]string{"5mgGQMBk": "mJLtVMSG", "A7ynFMJB": "0Nx6RGab"},
-		NodeName:                               "otlLxGaI",
-		NonVotingServer:                        true,
-		PidFile:                                "43xN80Km",
-		PrimaryDatacenter:                      "ejtmd43d",
-		PrimaryGateways:                        []string{"aej8eeZo", "roh2KahS"},
-		PrimaryGatewaysInterval:                18866 * time.Second,
-		RPCAdvertiseAddr:                       tcpAddr("17.99.29.16:3757"),
-		RPCBindAddr:                            tcpAddr("16.99.34.17:3757"),
-		RPCHandshakeTimeout:                    1932 * time.Millisecond,
-		RPCHoldTimeout:                         15707 * time.Second,
-		RPCProtocol:                            30793,
-		RPCRateLimit:                           12029.43,
-		RPCMaxBurst:                            44848,
-		RPCMaxConnsPerClient:                   2954,
-		RaftProtocol:                           19016,
-		RaftSnapshotThreshold:                  16384,
-		RaftSnapshotInterval:                   30 * time.Second,
-		RaftTrailingLogs:                       83749,
-		ReconnectTimeoutLAN:                    23739 * time.Second,
-		ReconnectTimeoutWAN:                    26694 * time.Second,
-		RejoinAfterLeave:                       true,
-		RetryJoinIntervalLAN:                   8067 * time.Second,
-		RetryJoinIntervalWAN:                   28866 * time.Second,
-		RetryJoinLAN:                           []string{"pbsSFY7U", "l0qLtWij"},
-		RetryJoinMaxAttemptsLAN:                913,
-		RetryJoinMaxAttemptsWAN:                23160,
-		RetryJoinWAN:                           []string{"PFsR02Ye", "rJdQIhER"},
-		SegmentName:                            "BC2NhTDi",
+		ConnectMeshGatewayWANFederationEnabled:            false,
+		ConnectMeshGatewayWANFederationHealthCheckEnabled: false,
+		DNSAddrs:                         []net.Addr{tcpAddr("93.95.95.81:7001"), udpAddr("93.95.95.81:7001")},
+		DNSARecordLimit:                  29907,
+		DNSAllowStale:                    true,
+		DNSDisableCompression:            true,
+		DNSDomain:                        "7W1xXSqd",
+		DNSAltDomain:                     "1789hsd",
+		DNSEnableTruncate:                true,
+		DNSMaxStale:                      29685 * time.Second,
+		DNSNodeTTL:                       7084 * time.Second,
+		DNSOnlyPassing:                   true,
+		DNSPort:                          7001,
+		DNSRecursorTimeout:               4427 * time.Second,
+		DNSRecursors:                     []string{"63.38.39.58", "92.49.18.18"},
+		DNSSOA:                           RuntimeSOAConfig{Refresh: 3600, Retry: 600, Expire: 86400, Minttl: 0},
+		DNSServiceTTL:                    map[string]time.Duration{"*": 32030 * time.Second},
+		DNSUDPAnswerLimit:                29909,
+		DNSNodeMetaTXT:                   true,
+		DNSUseCache:                      true,
+		DNSCacheMaxAge:                   5 * time.Minute,
+		DataDir:                          dataDir,
+		Datacenter:                       "rzo029wg",
+		DefaultQueryTime:                 16743 * time.Second,
+		DevMode:                          true,
+		DisableAnonymousSignature:        true,
+		DisableCoordinates:               true,
+		DisableHostNodeID:                true,
+		DisableHTTPUnprintableCharFilter: true,
+		DisableKeyringFile:               true,
+		DisableRemoteExec:                true,
+		DisableUpdateCheck:               true,
+		DiscardCheckOutput:               true,
+		DiscoveryMaxStale:                5 * time.Second,
+		EnableAgentTLSForChecks:          true,
+		EnableCentralServiceConfig:       true,
+		EnableDebug:                      true,
+		EnableRemoteScriptChecks:         true,
+		EnableLocalScriptChecks:          true,
+		EnableSyslog:                     true,
+		EnableUI:                         true,
+		EncryptKey:                       "A4wELWqH",
+		EncryptVerifyIncoming:            true,
+		EncryptVerifyOutgoing:            true,
+		GRPCPort:                         4881,
+		GRPCAddrs:                        []net.Addr{tcpAddr("32.31.61.91:4881")},
+		HTTPAddrs:                        []net.Addr{tcpAddr("83.39.91.39:7999")},
+		HTTPBlockEndpoints:               []string{"RBvAFcGD", "fWOWFznh"},
+		AllowWriteHTTPFrom:               []*net.IPNet{cidr("127.0.0.0/8"), cidr("22.33.44.55/32"), cidr("0.0.0.0/0")},
+		HTTPPort:                         7999,
+		HTTPResponseHeaders:              map[string]string{"M6TKa9NP": "xjuxjOzQ", "JRCrHZed": "rl0mTx81"},
+		HTTPSAddrs:                       []net.Addr{tcpAddr("95.17.17.19:15127")},
+		HTTPMaxConnsPerClient:            100,
+		HTTPSHandshakeTimeout:            2391 * time.Millisecond,
+		HTTPSPort:                        15127,
+		KeyFile:                          "IEkkwgIA",
+		KVMaxValueSize:                   1234567800000000,
+		LeaveDrainTime:                   8265 * time.Second,
+		LeaveOnTerm:                      true,
+		LogLevel:                         "k1zo9Spt",
+		LogJSON:                          true,
+		MaxQueryTime:                     18237 * time.Second,
+		NodeID:                           types.NodeID("AsUIlw99"),
+		NodeMeta:                         map[string]string{"5mgGQMBk": "mJLtVMSG", "A7ynFMJB": "0Nx6RGab"},
+		NodeName:                         "otlLxGaI",
+		NonVotingServer:                  true,
+		PidFile:                          "43xN80Km",
+		PrimaryDatacenter:                "ejtmd43d",
+		PrimaryGateways:                  []string{"aej8eeZo", "roh2KahS"},
+		PrimaryGatewaysInterval:          18866 * time.Second,
+		PrimaryGatewaysPort:              27015,
+		PrimaryGatewaysExec:              []string{"/bin/jahth4Ah", "--dc", "ejtmd43d"},
+		PrimaryGatewaysExecTimeout:       8298 * time.Second,
+		RPCAdvertiseAddr:                 tcpAddr("17.99.29.16:3757"),
+		RPCBindAddr:                      tcpAddr("16.99.34.17:3757"),
+		RPCHandshakeTimeout:              1932 * time.Millisecond,
+		RPCHoldTimeout:                   15707 * time.Second,
+		RPCProtocol:                      30793,
+		RPCRateLimit:                     12029.43,
+		RPCMaxBurst:                      44848,
+		RPCMaxConnsPerClient:             2954,
+		RaftProtocol:                     19016,
+		RaftSnapshotThreshold:            16384,
+		RaftSnapshotInterval:             30 * time.Second,
+		RaftTrailingLogs:                 83749,
+		ReconnectTimeoutLAN:              23739 * time.Second,
+		ReconnectTimeoutWAN:              26694 * time.Second,
+		RejoinAfterLeave:                 true,
+		RetryJoinIntervalLAN:             8067 * time.Second,
+		RetryJoinIntervalWAN:             28866 * time.Second,
+		RetryJoinLAN:                     []string{"pbsSFY7U", "l0qLtWij"},
+		RetryJoinMaxAttemptsLAN:          913,
+		RetryJoinMaxAttemptsWAN:          23160,
+		RetryJoinWAN:                     []string{"PFsR02Ye", "rJdQIhER"},
+		SegmentName:                      "BC2NhTDi",
 		Segments: []structs.NetworkSegment{
 			{
 				Name:        "PExYMe2E",
@@ -6147,9 +6251,10 @@ func parseCIDR(t *testing.T, cidr string) *net.IPNet {
 
 func TestSanitize(t *testing.T) {
 	rt := RuntimeConfig{
-		BindAddr:             &net.IPAddr{IP: net.ParseIP("127.0.0.1")},
-		CheckOutputMaxSize:   checks.DefaultBufSize,
-		SerfAdvertiseAddrLAN: &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 5678},
+		BindAddr:           &net.IPAddr{IP: net.ParseIP("127.0.0.1")},
+		CheckOutputMaxSize: checks.DefaultBufSize,
+		ConnectMeshGatewayWANFederationHealthCheckEnabled: true,
+		SerfAdvertiseAddrLAN:                              &net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 5678},
 		DNSAddrs: []net.Addr{
 			&net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 5678},
 			&net.UDPAddr{IP: net.ParseIP("1.2.3.4"), Port: 5678},
@@ -6276,6 +6381,8 @@ func TestSanitize(t *testing.T) {
 		"ConnectCAProvider": "",
 		"ConnectEnabled": false,
 		"ConnectMeshGatewayWANFederationEnabled": false,
+		"ConnectMeshGatewayWANFederationHealthCheckEnabled": true,
+		"ConnectMeshGatewayWANFederationSelectionPolicy": "",
 		"ConnectSidecarMaxPort": 0,
 		"ConnectSidecarMinPort": 0,
 		"ConnectTestCALeafRootChangeSpread": "0s",
@@ -6386,6 +6493,9 @@ func TestSanitize(t *testing.T) {
 			"pmgw_foo=bar pmgw_key=baz pmgw_secret=boom pmgw_bang=bar"
 		],
 		"PrimaryGatewaysInterval": "0s",
+		"PrimaryGatewaysPort": 0,
+		"PrimaryGatewaysExec": [],
+		"PrimaryGatewaysExecTimeout": "0s",
 		"RPCAdvertiseAddr": "",
 		"RPCBindAddr": "",
 		"RPCHandshakeTimeout": "0s",
@@ -9,6 +9,7 @@ import (
 
 	"github.com/hashicorp/consul/agent/checks"
 	"github.com/hashicorp/consul/agent/consul/autopilot"
+	"github.com/hashicorp/consul/agent/consul/wanfed"
 	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/lib"
 	"github.com/hashicorp/consul/tlsutil"
@@ -454,10 +455,262 @@ type Config struct {
 	// datacenters should exclusively traverse mesh gateways.
 	ConnectMeshGatewayWANFederationEnabled bool
 
+	// GatewaySelectionMode controls how a mesh gateway is selected when
+	// forwarding wan-federated traffic. See GatewaySelectionMode* for the
+	// valid values. Defaults to GatewaySelectionModeWeighted when unset.
+	GatewaySelectionMode string
+
+	// GatewayFailureCooldown is how long a mesh gateway address is
+	// deprioritized for transit after a reported dial failure. Defaults to
+	// defaultGatewayFailureCooldown when unset.
+	GatewayFailureCooldown time.Duration
+
+	// GatewayBreakerThreshold is how many consecutive dial failures open a
+	// mesh gateway's circuit breaker, excluding it from transit picks until
+	// a probe succeeds. Defaults to defaultGatewayBreakerThreshold when
+	// unset.
+	GatewayBreakerThreshold int
+
+	// GatewayBreakerCooldown is how long an open mesh gateway circuit
+	// breaker waits before allowing a half-open probe. Defaults to
+	// defaultGatewayBreakerCooldown when unset.
+	GatewayBreakerCooldown time.Duration
+
+	// GatewayLocalityMetaKey is the node meta key (e.g. "zone") consulted
+	// to determine which locality a mesh gateway lives in.
+	GatewayLocalityMetaKey string
+
+	// GatewayLocality is this server's own locality value. When set along
+	// with GatewayLocalityMetaKey, gateway selection prefers gateways in
+	// the same locality and falls back to the full list when none are
+	// healthy.
+	GatewayLocality string
+
+	// GatewayWarningMode controls whether mesh gateways with warning checks
+	// are eligible for wanfed transit. Defaults to GatewayWarningModeAllow
+	// when unset.
+	GatewayWarningMode string
+
+	// GatewayWarningWeightPercent is the selection weight mesh gateways with
+	// warning checks retain, as a percentage of their registered weight, when
+	// GatewayWarningMode is GatewayWarningModeDeprioritize. Defaults to
+	// defaultGatewayWarningWeightPercent when unset.
+	GatewayWarningWeightPercent int
+
+	// GatewayCheckScope controls which critical checks exclude a mesh
+	// gateway from wanfed transit. See GatewayCheckScope* for the valid
+	// values. Defaults to GatewayCheckScopeAll when unset.
+	GatewayCheckScope string
+
+	// GatewayFederationStateStaleThreshold is how old the primary
+	// datacenter's replicated federation state may grow before the gateway
+	// locator warns that replication has likely stalled. Defaults to
+	// defaultGatewayFederationStateStaleThreshold when unset; negative
+	// disables the warning.
+	GatewayFederationStateStaleThreshold time.Duration
+
+	// GatewayPoolIdleTimeout is how long idle wanfed tunnel connections
+	// stay pooled for reuse before being closed. Zero uses
+	// wanfed.GossipPacketMaxIdleTime.
+	GatewayPoolIdleTimeout time.Duration
+
+	// GatewayPoolMaxIdleConnsPerKey bounds the idle wanfed tunnel
+	// connections retained per destination. Zero uses
+	// wanfed.DefaultMaxIdleConnsPerKey; negative removes the bound.
+	GatewayPoolMaxIdleConnsPerKey int
+
+	// GatewayTunnelKeepaliveInterval overrides the TCP keepalive period on
+	// wanfed tunnel connections, so tunnels crossing load balancers that
+	// silently drop idle connections get noticed and torn down proactively.
+	// Zero keeps the operating system default.
+	GatewayTunnelKeepaliveInterval time.Duration
+
+	// GatewayResolveHostnames makes the gateway locator resolve
+	// hostname-valued gateway addresses to an IP at pick time, so the
+	// dialer never depends on DNS at connect time. Resolution failures
+	// fall back to dialing the hostname itself.
+	GatewayResolveHostnames bool
+
+	// GatewayFallbackOnlyModeTimeout is how long the gateway locator
+	// tolerates a continuously uninitialized local raft state before
+	// publishing the configured fallback addresses as the primary gateway
+	// list and firing its ready latch. Defaults to
+	// defaultGatewayFallbackOnlyModeTimeout when unset; negative disables
+	// the degradation.
+	GatewayFallbackOnlyModeTimeout time.Duration
+
+	// GatewayUpdateCoalesceWindow is how long the gateway locator lingers
+	// after a blocking query wakeup so that a burst of federation state
+	// writes is applied as one recompute. Defaults to
+	// defaultGatewayUpdateCoalesceWindow when unset; negative disables
+	// coalescing.
+	GatewayUpdateCoalesceWindow time.Duration
+
+	// GatewayMetricsInterval is how often the per-datacenter mesh gateway
+	// count gauges are re-emitted when the federation states are not
+	// changing. Zero or negative disables the gauges.
+	GatewayMetricsInterval time.Duration
+
+	// GatewayPickMetricAddrLabelEnabled adds the picked gateway address as
+	// a label on the consul.wanfed.pick_gateway counter. Off by default
+	// since the label multiplies the counter's cardinality by the number of
+	// known gateways.
+	GatewayPickMetricAddrLabelEnabled bool
+
+	// GatewayDialMetricAddrLabelEnabled adds the dialed gateway address as
+	// a label on the consul.wanfed.dial.* metrics, off by default for the
+	// same cardinality reasons as GatewayPickMetricAddrLabelEnabled.
+	GatewayDialMetricAddrLabelEnabled bool
+
+	// GatewayStreamMultiplexEnabled multiplexes outgoing wanfed gossip
+	// streams over shared long-lived gateway tunnels with yamux, instead of
+	// dialing one tunnel per stream. Destinations whose servers do not
+	// speak the multiplexed protocol automatically fall back to
+	// one-connection-per-stream.
+	GatewayStreamMultiplexEnabled bool
+
+	// GatewayTLSServerNames overrides, per destination datacenter, the TLS
+	// server name presented when dialing through a mesh gateway, for
+	// topologies where a shared gateway routes on a custom SNI. Datacenters
+	// absent from the map use the standard computed name.
+	GatewayTLSServerNames map[string]string
+
+	// GatewayDialRetryMaxTime and GatewayDialRetryMaxAttempts bound the
+	// retry budget for dials through mesh gateways, covering both RPC
+	// forwarding and gossip stream dials. Zero uses the defaults in
+	// agent/pool; an attempt cap of one disables retrying.
+	GatewayDialRetryMaxTime     time.Duration
+	GatewayDialRetryMaxAttempts int
+
+	// GatewayPickDebugSampleRate logs one in this many gateway picks at
+	// debug level with the full candidate list, for diagnosing skewed pick
+	// distribution without drowning the logs. Zero or negative disables
+	// sampling.
+	GatewayPickDebugSampleRate int
+
+	// GatewayTracer, when set, receives spans for locator refreshes and for
+	// dials through mesh gateways, so embedders running distributed tracing
+	// can see the wanfed path. Nil means tracing is a no-op.
+	GatewayTracer wanfed.Tracer
+
+	// GatewayRetryInitialBackoff, GatewayRetryBackoffMultiplier,
+	// GatewayRetryMaxBackoff, and GatewayRetryBackoffJitter tune how the
+	// locator backs off between failed refreshes, and so how quickly it
+	// recovers once the state store is answering again. Unset values keep
+	// the default schedule (2s doubling up to 256s, no jitter).
+	GatewayRetryInitialBackoff    time.Duration
+	GatewayRetryBackoffMultiplier float64
+	GatewayRetryMaxBackoff        time.Duration
+	GatewayRetryBackoffJitter     float64
+
+	// GatewayMaxQueryTime caps how long one of the locator's blocking
+	// federation state fetches may wait: shorter bounds how long shutdown
+	// or a forced refresh can lag behind a parked query, longer reduces
+	// wakeups. Zero uses the server's default query time, and values above
+	// MaxQueryTime are clamped to it.
+	GatewayMaxQueryTime time.Duration
+
+	// GatewayFallbackProbeEnabled turns on background TCP reachability
+	// probing of the primary gateway fallback addresses so that selection
+	// steers around dead hosts while operating purely from discovered
+	// addresses.
+	GatewayFallbackProbeEnabled bool
+
+	// GatewayFallbackProbeInterval is how often the fallback addresses are
+	// probed. Defaults to defaultGatewayFallbackProbeInterval when unset.
+	GatewayFallbackProbeInterval time.Duration
+
+	// GatewayFallbackProbeTimeout bounds each probe's TCP dial. Defaults
+	// to defaultGatewayFallbackProbeTimeout when unset.
+	GatewayFallbackProbeTimeout time.Duration
+
+	// GatewayCacheTTL is how old the mesh gateway addresses persisted to
+	// the data dir may be before they are ignored at startup. Defaults to
+	// defaultGatewayCacheTTL when unset.
+	GatewayCacheTTL time.Duration
+
+	// GatewayPreferLocalNode opts gateway selection into preferring a
+	// healthy mesh gateway registered on this server's own node, for
+	// deployments that co-locate a gateway on each server.
+	GatewayPreferLocalNode bool
+
+	// GatewayProtocolVersion is the wanfed transit protocol version this
+	// server speaks. Mesh gateways advertising an incompatible protocol
+	// range are never selected for transit. Defaults to
+	// defaultGatewayProtocolVersion when unset.
+	GatewayProtocolVersion int
+
+	// GatewayAddressOverrides maps a datacenter name to a fixed list of
+	// mesh gateway addresses to use for that datacenter, ignoring whatever
+	// the catalog advertises. Useful when a datacenter's mesh gateways sit
+	// behind a load balancer with a stable VIP.
+	GatewayAddressOverrides map[string][]string
+
+	// GatewayTagFilter restricts wanfed transit to mesh gateways registered
+	// with this service tag, for deployments whose gateways serve multiple
+	// roles. Empty means no tag filtering.
+	GatewayTagFilter string
+
+	// GatewayGossipTagFilter splits wanfed transit into traffic classes:
+	// tunneled gossip sticks to gateways registered with this service tag
+	// while forwarded RPCs load-balance over the rest, decoupling the
+	// classes' failure and congestion behavior. Empty keeps gossip and RPC
+	// sharing the same gateways.
+	GatewayGossipTagFilter string
+
+	// GatewayAddressFamily controls which address family is dialed for mesh
+	// gateways advertising both IPv4 and IPv6 tagged addresses. See
+	// GatewayAddressFamily* for the valid values; empty means use the
+	// gateway's best address as-is.
+	GatewayAddressFamily string
+
+	// GatewayUseWANAddressForLocalGateways makes the locator render local
+	// mesh gateway addresses from their WAN-facing best address instead of
+	// the LAN address, for servers running in a separate network from the
+	// workload LAN where the gateways' LAN addresses are unroutable.
+	GatewayUseWANAddressForLocalGateways bool
+
+	// GatewayMaxPerDatacenter caps how many healthy mesh gateways the
+	// locator tracks per datacenter, for datacenters running very large
+	// autoscaled gateway fleets. Each server keeps its own stable subset so
+	// the fleet still covers all gateways collectively. Zero means
+	// unlimited.
+	GatewayMaxPerDatacenter int
+
 	// DisableFederationStateAntiEntropy solely exists for use in unit tests to
 	// disable a background routine.
 	DisableFederationStateAntiEntropy bool
 
+	// FederationStateAntiEntropyInterval is the longest the anti-entropy
+	// routine waits for a mesh gateway catalog change before re-verifying
+	// the published federation state anyway. Each wait is randomly staggered
+	// so secondaries do not re-verify in lockstep. Zero or negative uses the
+	// default.
+	FederationStateAntiEntropyInterval time.Duration
+
+	// FederationStateAntiEntropyDebounce is how long the anti-entropy
+	// routine waits after noticing a mesh gateway change before publishing
+	// the updated dump, so rapidly flapping health checks coalesce into a
+	// single Raft write. Zero or negative publishes immediately.
+	FederationStateAntiEntropyDebounce time.Duration
+
+	// FederationStateGatewayValidationWarnOnly downgrades the mesh gateway
+	// address validation performed on federation state writes from a hard
+	// rejection to a logged warning, as an emergency escape hatch should a
+	// datacenter need to ship a technically invalid registration anyway.
+	FederationStateGatewayValidationWarnOnly bool
+
+	// DisableFederationStatePruning is a kill switch for the primary's
+	// leader routine that deletes federation states for datacenters no
+	// longer in the WAN pool.
+	DisableFederationStatePruning bool
+
+	// FederationStatePruneGracePeriod is how long a datacenter must be
+	// continuously absent from the WAN pool before its federation state is
+	// pruned, protecting partitioned datacenters from deletion. Zero prunes
+	// on the first absent observation.
+	FederationStatePruneGracePeriod time.Duration
+
 	// CAConfig is used to apply the initial Connect CA configuration when
 	// bootstrapping.
 	CAConfig *structs.CAConfiguration
@@ -555,6 +808,8 @@ func DefaultConfig() *Config {
 		FederationStateReplicationRate:       1,
 		FederationStateReplicationBurst:      5,
 		FederationStateReplicationApplyLimit: 100, // ops / sec
+		FederationStateAntiEntropyDebounce:   500 * time.Millisecond,
+		GatewayMetricsInterval:               time.Minute,
 		TombstoneTTL:                         15 * time.Minute,
 		TombstoneTTLGranularity:              30 * time.Second,
 		SessionTTLMin:                        10 * time.Second,
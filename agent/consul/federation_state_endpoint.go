@@ -8,6 +8,7 @@ import (
 	"github.com/hashicorp/consul/acl"
 	"github.com/hashicorp/consul/agent/consul/state"
 	"github.com/hashicorp/consul/agent/structs"
+	bexpr "github.com/hashicorp/go-bexpr"
 	memdb "github.com/hashicorp/go-memdb"
 )
 
@@ -36,17 +37,36 @@ func (c *FederationState) Apply(args *structs.FederationStateRequest, reply *boo
 		return acl.ErrPermissionDenied
 	}
 
-	if args.State == nil || args.State.Datacenter == "" {
-		return fmt.Errorf("invalid request: missing federation state datacenter")
-	}
-
 	switch args.Op {
 	case structs.FederationStateUpsert:
+		if args.State == nil || args.State.Datacenter == "" {
+			return fmt.Errorf("invalid request: missing federation state datacenter")
+		}
+		if err := c.validateGateways(args.State); err != nil {
+			return err
+		}
 		if args.State.UpdatedAt.IsZero() {
 			args.State.UpdatedAt = time.Now().UTC()
 		}
+	case structs.FederationStateBatchUpsert:
+		if len(args.States) == 0 {
+			return fmt.Errorf("invalid request: missing federation states to upsert")
+		}
+		for _, state := range args.States {
+			if state.Datacenter == "" {
+				return fmt.Errorf("invalid request: missing federation state datacenter")
+			}
+			if err := c.validateGateways(state); err != nil {
+				return err
+			}
+			if state.UpdatedAt.IsZero() {
+				state.UpdatedAt = time.Now().UTC()
+			}
+		}
 	case structs.FederationStateDelete:
-		// No validation required.
+		if args.State == nil || args.State.Datacenter == "" {
+			return fmt.Errorf("invalid request: missing federation state datacenter")
+		}
 	default:
 		return fmt.Errorf("Invalid federation state operation: %v", args.Op)
 	}
@@ -65,6 +85,24 @@ func (c *FederationState) Apply(args *structs.FederationStateRequest, reply *boo
 	return nil
 }
 
+// validateGateways applies the mesh gateway address validation to an incoming
+// federation state write, honoring the warn-only escape hatch so operators
+// can still push an invalid-looking state in an emergency.
+func (c *FederationState) validateGateways(state *structs.FederationState) error {
+	err := state.ValidateMeshGateways()
+	if err == nil {
+		return nil
+	}
+	if c.srv.config.FederationStateGatewayValidationWarnOnly {
+		c.srv.logger.Warn("accepting federation state with invalid mesh gateway addresses",
+			"datacenter", state.Datacenter,
+			"error", err,
+		)
+		return nil
+	}
+	return fmt.Errorf("invalid federation state for datacenter %q: %v", state.Datacenter, err)
+}
+
 func (c *FederationState) Get(args *structs.FederationStateQuery, reply *structs.FederationStateResponse) error {
 	if done, err := c.srv.forward("FederationState.Get", args, args, reply); done {
 		return err
@@ -100,8 +138,9 @@ func (c *FederationState) Get(args *structs.FederationStateQuery, reply *structs
 }
 
 // List is the endpoint meant to be used by consul servers performing
-// replication.
-func (c *FederationState) List(args *structs.DCSpecificRequest, reply *structs.IndexedFederationStates) error {
+// replication. Pagination is opt-in: replication and the gateway locator
+// leave Limit unset and receive the full list.
+func (c *FederationState) List(args *structs.FederationStateListRequest, reply *structs.IndexedFederationStates) error {
 	if done, err := c.srv.forward("FederationState.List", args, args, reply); done {
 		return err
 	}
@@ -116,6 +155,11 @@ func (c *FederationState) List(args *structs.DCSpecificRequest, reply *structs.I
 		return acl.ErrPermissionDenied
 	}
 
+	filter, err := bexpr.CreateFilter(args.Filter, nil, reply.States)
+	if err != nil {
+		return err
+	}
+
 	return c.srv.blockingQuery(
 		&args.QueryOptions,
 		&reply.QueryMeta,
@@ -125,6 +169,26 @@ func (c *FederationState) List(args *structs.DCSpecificRequest, reply *structs.I
 				return err
 			}
 
+			raw, err := filter.Execute(fedStates)
+			if err != nil {
+				return err
+			}
+			fedStates = raw.([]*structs.FederationState)
+
+			// Paginate. The states come out of memdb ordered by datacenter
+			// name, so the token selects a stable resume point even when
+			// entries were added or removed since the previous page.
+			reply.NextToken = ""
+			if args.NextToken != "" {
+				for len(fedStates) > 0 && fedStates[0].Datacenter <= args.NextToken {
+					fedStates = fedStates[1:]
+				}
+			}
+			if args.Limit > 0 && len(fedStates) > args.Limit {
+				fedStates = fedStates[:args.Limit]
+				reply.NextToken = fedStates[len(fedStates)-1].Datacenter
+			}
+
 			if len(fedStates) == 0 {
 				fedStates = []*structs.FederationState{}
 			}
@@ -136,6 +200,29 @@ func (c *FederationState) List(args *structs.DCSpecificRequest, reply *structs.I
 		})
 }
 
+// ReplicationStatus is used to retrieve the current federation state
+// replication status for a datacenter. The replication bookkeeping lives on
+// the leader, so the request is forwarded there; it is not forwarded to the
+// primary, since each secondary has its own replication state to report.
+func (c *FederationState) ReplicationStatus(args *structs.DCSpecificRequest,
+	reply *structs.FederationStateReplicationStatus) error {
+	// This must be sent to the leader, so we fix the args since we are
+	// re-using a structure where we don't support all the options.
+	args.RequireConsistent = true
+	args.AllowStale = false
+	if done, err := c.srv.forward("FederationState.ReplicationStatus", args, args, reply); done {
+		return err
+	}
+	defer metrics.MeasureSince([]string{"federation_state", "replication_status"}, time.Now())
+
+	// There's no ACL token required here since this doesn't leak any
+	// sensitive information, and we don't want people to have to use
+	// management tokens if they are querying this via a health check.
+
+	*reply = c.srv.federationStateReplicationStatus()
+	return nil
+}
+
 // ListMeshGateways is the endpoint meant to be used by proxies only interested
 // in the discovery info for dialing mesh gateways. Analogous to catalog
 // endpoints.
@@ -99,6 +99,146 @@ func TestFederationState_Apply_Upsert(t *testing.T) {
 	require.Equal(t, updated, fedState2)
 }
 
+func TestFederationState_Apply_BatchUpsert(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.DisableFederationStateAntiEntropy = true
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	codec := rpcClient(t, s1)
+	defer codec.Close()
+
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	newFedState := func(dc, ip string) *structs.FederationState {
+		return &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", ip, 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+			UpdatedAt: time.Now().UTC(),
+		}
+	}
+
+	states := structs.FederationStates{
+		newFedState("dc2", "1.2.3.4"),
+		newFedState("dc3", "5.6.7.8"),
+	}
+
+	args := structs.FederationStateRequest{
+		Op:     structs.FederationStateBatchUpsert,
+		States: states,
+	}
+	out := false
+	require.NoError(t, msgpackrpc.CallWithCodec(codec, "FederationState.Apply", &args, &out))
+	require.True(t, out)
+
+	// Both entries exist and went through raft as one log entry, so they
+	// carry the same index.
+	state := s1.fsm.State()
+	_, fedState2, err := state.FederationStateGet(nil, "dc2")
+	require.NoError(t, err)
+	require.NotNil(t, fedState2)
+	_, fedState3, err := state.FederationStateGet(nil, "dc3")
+	require.NoError(t, err)
+	require.NotNil(t, fedState3)
+	require.Equal(t, fedState2.ModifyIndex, fedState3.ModifyIndex)
+
+	zeroFedStateIndexes(t, fedState2)
+	zeroFedStateIndexes(t, fedState3)
+	require.Equal(t, states[0], fedState2)
+	require.Equal(t, states[1], fedState3)
+
+	// An empty batch is rejected.
+	args = structs.FederationStateRequest{
+		Op: structs.FederationStateBatchUpsert,
+	}
+	require.Error(t, msgpackrpc.CallWithCodec(codec, "FederationState.Apply", &args, &out))
+
+	// As is a batch containing a state without a datacenter.
+	args = structs.FederationStateRequest{
+		Op:     structs.FederationStateBatchUpsert,
+		States: structs.FederationStates{{}},
+	}
+	require.Error(t, msgpackrpc.CallWithCodec(codec, "FederationState.Apply", &args, &out))
+}
+
+func TestFederationState_Apply_Upsert_InvalidGateways(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.DisableFederationStateAntiEntropy = true
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	codec := rpcClient(t, s1)
+	defer codec.Close()
+
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	makeArgs := func(csn structs.CheckServiceNode) structs.FederationStateRequest {
+		return structs.FederationStateRequest{
+			Op: structs.FederationStateUpsert,
+			State: &structs.FederationState{
+				Datacenter:   "dc2",
+				MeshGateways: []structs.CheckServiceNode{csn},
+				UpdatedAt:    time.Now().UTC(),
+			},
+		}
+	}
+
+	t.Run("empty address is rejected naming the node", func(t *testing.T) {
+		noAddr := newTestMeshGatewayNode(
+			"dc2", "gateway1", "", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+		)
+		args := makeArgs(noAddr)
+		out := false
+		err := msgpackrpc.CallWithCodec(codec, "FederationState.Apply", &args, &out)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `node "gateway1"`)
+	})
+
+	t.Run("invalid port is rejected naming the node", func(t *testing.T) {
+		noPort := newTestMeshGatewayNode(
+			"dc2", "gateway2", "1.2.3.4", 0, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+		)
+		args := makeArgs(noPort)
+		out := false
+		err := msgpackrpc.CallWithCodec(codec, "FederationState.Apply", &args, &out)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `node "gateway2"`)
+	})
+
+	t.Run("warn-only escape hatch lets the write through", func(t *testing.T) {
+		dir2, s2 := testServerWithConfig(t, func(c *Config) {
+			c.DisableFederationStateAntiEntropy = true
+			c.FederationStateGatewayValidationWarnOnly = true
+		})
+		defer os.RemoveAll(dir2)
+		defer s2.Shutdown()
+		codec2 := rpcClient(t, s2)
+		defer codec2.Close()
+
+		testrpc.WaitForLeader(t, s2.RPC, "dc1")
+
+		noAddr := newTestMeshGatewayNode(
+			"dc2", "gateway1", "", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+		)
+		args := makeArgs(noAddr)
+		out := false
+		require.NoError(t, msgpackrpc.CallWithCodec(codec2, "FederationState.Apply", &args, &out))
+		require.True(t, out)
+
+		_, fedState, err := s2.fsm.State().FederationStateGet(nil, "dc2")
+		require.NoError(t, err)
+		require.NotNil(t, fedState)
+	})
+}
+
 func TestFederationState_Apply_Upsert_ACLDeny(t *testing.T) {
 	t.Parallel()
 
@@ -370,6 +510,56 @@ func TestFederationState_List(t *testing.T) {
 
 		require.Equal(t, expectedMeshGateways.DatacenterNodes, out.DatacenterNodes)
 	})
+	t.Run("List with filter", func(t *testing.T) {
+		args := structs.DCSpecificRequest{
+			Datacenter: "dc1",
+			QueryOptions: structs.QueryOptions{
+				Filter: `Datacenter == "dc2"`,
+			},
+		}
+		var out structs.IndexedFederationStates
+		require.NoError(t, msgpackrpc.CallWithCodec(codec, "FederationState.List", &args, &out))
+
+		require.Len(t, out.States, 1)
+		zeroFedStateIndexes(t, out.States[0])
+		require.Equal(t, expected.States[1], out.States[0])
+	})
+	t.Run("List with nested filter", func(t *testing.T) {
+		args := structs.DCSpecificRequest{
+			Datacenter: "dc1",
+			QueryOptions: structs.QueryOptions{
+				Filter: `MeshGateways.Node.Node == "gateway2" and Datacenter == "dc1"`,
+			},
+		}
+		var out structs.IndexedFederationStates
+		require.NoError(t, msgpackrpc.CallWithCodec(codec, "FederationState.List", &args, &out))
+
+		require.Len(t, out.States, 1)
+		require.Equal(t, "dc1", out.States[0].Datacenter)
+	})
+	t.Run("List with matching-nothing filter", func(t *testing.T) {
+		args := structs.DCSpecificRequest{
+			Datacenter: "dc1",
+			QueryOptions: structs.QueryOptions{
+				Filter: `Datacenter == "dc9"`,
+			},
+		}
+		var out structs.IndexedFederationStates
+		require.NoError(t, msgpackrpc.CallWithCodec(codec, "FederationState.List", &args, &out))
+
+		require.Empty(t, out.States)
+	})
+	t.Run("List with invalid filter", func(t *testing.T) {
+		args := structs.DCSpecificRequest{
+			Datacenter: "dc1",
+			QueryOptions: structs.QueryOptions{
+				Filter: `NotARealField == `,
+			},
+		}
+		var out structs.IndexedFederationStates
+		err := msgpackrpc.CallWithCodec(codec, "FederationState.List", &args, &out)
+		require.Error(t, err)
+	})
 }
 
 func TestFederationState_List_ACLDeny(t *testing.T) {
@@ -801,6 +991,96 @@ func newTestMeshGatewayNode(
 	}
 }
 
+func TestFederationState_List_Pagination(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.DisableFederationStateAntiEntropy = true
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	codec := rpcClient(t, s1)
+	defer codec.Close()
+
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	upsert := func(t *testing.T, dc string) {
+		federationStateUpsert(t, codec, "", &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+			UpdatedAt: time.Now().UTC(),
+		})
+	}
+	for _, dc := range []string{"dc1", "dc2", "dc3", "dc4", "dc5"} {
+		upsert(t, dc)
+	}
+
+	listPage := func(t *testing.T, limit int, token string) ([]string, string) {
+		t.Helper()
+		args := structs.FederationStateListRequest{
+			Datacenter: "dc1",
+			Limit:      limit,
+			NextToken:  token,
+		}
+		var out structs.IndexedFederationStates
+		require.NoError(t, msgpackrpc.CallWithCodec(codec, "FederationState.List", &args, &out))
+		var dcs []string
+		for _, fs := range out.States {
+			dcs = append(dcs, fs.Datacenter)
+		}
+		return dcs, out.NextToken
+	}
+
+	t.Run("walk the pages", func(t *testing.T) {
+		dcs, token := listPage(t, 2, "")
+		require.Equal(t, []string{"dc1", "dc2"}, dcs)
+		require.Equal(t, "dc2", token)
+
+		dcs, token = listPage(t, 2, token)
+		require.Equal(t, []string{"dc3", "dc4"}, dcs)
+		require.Equal(t, "dc4", token)
+
+		dcs, token = listPage(t, 2, token)
+		require.Equal(t, []string{"dc5"}, dcs)
+		require.Empty(t, token)
+	})
+
+	t.Run("limit without truncation yields no token", func(t *testing.T) {
+		dcs, token := listPage(t, 10, "")
+		require.Len(t, dcs, 5)
+		require.Empty(t, token)
+	})
+
+	t.Run("entries changing between pages", func(t *testing.T) {
+		dcs, token := listPage(t, 2, "")
+		require.Equal(t, []string{"dc1", "dc2"}, dcs)
+		require.Equal(t, "dc2", token)
+
+		// Remove an entry that would have started the next page and add one
+		// that sorts into it. The name-keyed token resumes cleanly: nothing
+		// is duplicated and nothing still present is skipped.
+		arg := structs.FederationStateRequest{
+			Op:    structs.FederationStateDelete,
+			State: &structs.FederationState{Datacenter: "dc3"},
+		}
+		out := false
+		require.NoError(t, msgpackrpc.CallWithCodec(codec, "FederationState.Apply", &arg, &out))
+		upsert(t, "dc2a")
+
+		dcs, token = listPage(t, 2, token)
+		require.Equal(t, []string{"dc2a", "dc4"}, dcs)
+		require.Equal(t, "dc4", token)
+
+		dcs, token = listPage(t, 2, token)
+		require.Equal(t, []string{"dc5"}, dcs)
+		require.Empty(t, token)
+	})
+}
+
 func federationStateUpsert(t *testing.T, codec rpc.ClientCodec, token string, fedState *structs.FederationState) {
 	dup := *fedState
 	fedState2 := &dup
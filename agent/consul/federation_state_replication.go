@@ -4,13 +4,20 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"sync/atomic"
 	"time"
 
+	metrics "github.com/armon/go-metrics"
 	"github.com/hashicorp/consul/agent/structs"
 )
 
 type FederationStateReplicator struct {
 	srv *Server
+
+	// lastPrimaryIndex is the primary's federation state index as of the
+	// most recent fetch, accessed atomically; the replication status RPC
+	// reads it to report lag.
+	lastPrimaryIndex uint64
 }
 
 var _ IndexReplicatorDelegate = (*FederationStateReplicator)(nil)
@@ -26,7 +33,7 @@ func (r *FederationStateReplicator) MetricName() string { return "federation-sta
 
 // FetchRemote implements IndexReplicatorDelegate.
 func (r *FederationStateReplicator) FetchRemote(lastRemoteIndex uint64) (int, interface{}, uint64, error) {
-	req := structs.DCSpecificRequest{
+	req := structs.FederationStateListRequest{
 		Datacenter: r.srv.config.PrimaryDatacenter,
 		QueryOptions: structs.QueryOptions{
 			AllowStale:    true,
@@ -42,9 +49,53 @@ func (r *FederationStateReplicator) FetchRemote(lastRemoteIndex uint64) (int, in
 
 	states := []*structs.FederationState(response.States)
 
+	atomic.StoreUint64(&r.lastPrimaryIndex, response.QueryMeta.Index)
+
+	// Surface replication lag so operators can tell how stale this
+	// datacenter's view of the primary's mesh gateways is. The applied index
+	// still reflects the previous round here, which is exactly the lag the
+	// fetch just observed.
+	if applied := r.srv.federationStateReplicator.Index(); response.QueryMeta.Index >= applied {
+		metrics.SetGauge([]string{"leader", "replication", "federation-state", "lag_indexes"},
+			float32(response.QueryMeta.Index-applied))
+	}
+	if last := r.srv.federationStateReplicator.LastSuccess(); !last.IsZero() {
+		metrics.SetGauge([]string{"leader", "replication", "federation-state", "lag_seconds"},
+			float32(time.Since(last).Seconds()))
+	}
+
 	return len(response.States), states, response.QueryMeta.Index, nil
 }
 
+// PrimaryIndex returns the primary's federation state index as of the most
+// recent fetch.
+func (r *FederationStateReplicator) PrimaryIndex() uint64 {
+	return atomic.LoadUint64(&r.lastPrimaryIndex)
+}
+
+// federationStateReplicationStatus assembles the current replication status
+// for this datacenter. In the primary datacenter the status is reported as
+// disabled, since the primary is the source of truth and replicates nothing.
+func (s *Server) federationStateReplicationStatus() structs.FederationStateReplicationStatus {
+	var status structs.FederationStateReplicationStatus
+	if s.config.PrimaryDatacenter == "" || s.config.PrimaryDatacenter == s.config.Datacenter {
+		return status
+	}
+
+	status.Enabled = true
+	status.SourceDatacenter = s.config.PrimaryDatacenter
+	status.ReplicatedIndex = s.federationStateReplicator.Index()
+	status.PrimaryIndex = s.federationStateReplicatorDelegate.PrimaryIndex()
+	status.LastSuccess = s.federationStateReplicator.LastSuccess()
+	status.LastError = s.federationStateReplicator.LastError()
+
+	if s.gatewayLocator != nil {
+		status.PrimaryGatewaysActive, status.PrimaryGatewaysUpdated = s.gatewayLocator.PrimaryGatewayView()
+	}
+
+	return status
+}
+
 // FetchLocal implements IndexReplicatorDelegate.
 func (r *FederationStateReplicator) FetchLocal() (int, interface{}, error) {
 	_, local, err := r.srv.fsm.State().FederationStateList(nil)
@@ -156,6 +207,12 @@ func (r *FederationStateReplicator) PerformDeletions(ctx context.Context, deleti
 	return false, nil
 }
 
+// federationStateReplicationBatchSize is how many federation state upserts
+// are applied in a single raft log entry during replication, so a mass
+// update (every secondary re-dumping its gateways at once) does not become a
+// burst of small raft writes.
+const federationStateReplicationBatchSize = 32
+
 // PerformUpdates implements IndexReplicatorDelegate.
 func (r *FederationStateReplicator) PerformUpdates(ctx context.Context, updatesRaw interface{}) (exit bool, err error) {
 	updates, ok := updatesRaw.([]*structs.FederationState)
@@ -166,17 +223,32 @@ func (r *FederationStateReplicator) PerformUpdates(ctx context.Context, updatesR
 	ticker := time.NewTicker(time.Second / time.Duration(r.srv.config.FederationStateReplicationApplyLimit))
 	defer ticker.Stop()
 
-	for i, state := range updates {
-		dup := *state // lightweight copy
-		state2 := &dup
+	for start := 0; start < len(updates); start += federationStateReplicationBatchSize {
+		end := start + federationStateReplicationBatchSize
+		if end > len(updates) {
+			end = len(updates)
+		}
+
+		batch := make(structs.FederationStates, 0, end-start)
+		for _, state := range updates[start:end] {
+			dup := *state // lightweight copy
+			state2 := &dup
+
+			// Keep track of the raft modify index at the primary
+			state2.PrimaryModifyIndex = state.ModifyIndex
 
-		// Keep track of the raft modify index at the primary
-		state2.PrimaryModifyIndex = state.ModifyIndex
+			batch = append(batch, state2)
+		}
 
 		req := structs.FederationStateRequest{
-			Op:         structs.FederationStateUpsert,
 			Datacenter: r.srv.config.Datacenter,
-			State:      state2,
+		}
+		if len(batch) == 1 {
+			req.Op = structs.FederationStateUpsert
+			req.State = batch[0]
+		} else {
+			req.Op = structs.FederationStateBatchUpsert
+			req.States = batch
 		}
 
 		resp, err := r.srv.raftApply(structs.FederationStateRequestType, &req)
@@ -187,7 +259,7 @@ func (r *FederationStateReplicator) PerformUpdates(ctx context.Context, updatesR
 			return false, respErr
 		}
 
-		if i < len(updates)-1 {
+		if end < len(updates) {
 			select {
 			case <-ctx.Done():
 				return true, nil
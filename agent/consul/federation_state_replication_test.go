@@ -148,3 +148,63 @@ func TestReplication_FederationStates(t *testing.T) {
 		checkSame(r)
 	})
 }
+
+func TestReplication_FederationStates_ReplicationStatus(t *testing.T) {
+	t.Parallel()
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+		c.DisableFederationStateAntiEntropy = true
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	dir2, s2 := testServerWithConfig(t, func(c *Config) {
+		c.Datacenter = "dc2"
+		c.PrimaryDatacenter = "dc1"
+		c.FederationStateReplicationRate = 100
+		c.FederationStateReplicationBurst = 100
+		c.FederationStateReplicationApplyLimit = 1000000
+		c.DisableFederationStateAntiEntropy = true
+	})
+	testrpc.WaitForLeader(t, s2.RPC, "dc2")
+	defer os.RemoveAll(dir2)
+	defer s2.Shutdown()
+
+	// Try to join.
+	joinWAN(t, s2, s1)
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+	testrpc.WaitForLeader(t, s1.RPC, "dc2")
+
+	// The primary is the source of truth and reports replication as disabled.
+	var status structs.FederationStateReplicationStatus
+	require.NoError(t, s1.RPC("FederationState.ReplicationStatus", &structs.DCSpecificRequest{Datacenter: "dc1"}, &status))
+	require.False(t, status.Enabled)
+
+	// Seed a federation state so a replication round has something to do.
+	arg := structs.FederationStateRequest{
+		Datacenter: "dc1",
+		Op:         structs.FederationStateUpsert,
+		State: &structs.FederationState{
+			Datacenter: "alt-dc1",
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					"alt-dc1", "gateway1", "1.2.3.4", 443, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+			UpdatedAt: time.Now().UTC(),
+		},
+	}
+	out := false
+	require.NoError(t, s1.RPC("FederationState.Apply", &arg, &out))
+
+	retry.Run(t, func(r *retry.R) {
+		var status structs.FederationStateReplicationStatus
+		require.NoError(r, s2.RPC("FederationState.ReplicationStatus", &structs.DCSpecificRequest{Datacenter: "dc2"}, &status))
+		require.True(r, status.Enabled)
+		require.Equal(r, "dc1", status.SourceDatacenter)
+		require.True(r, status.ReplicatedIndex > 0)
+		require.True(r, status.PrimaryIndex >= status.ReplicatedIndex)
+		require.False(r, status.LastSuccess.IsZero())
+	})
+}
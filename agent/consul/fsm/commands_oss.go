@@ -554,10 +554,34 @@ func (c *FSM) applyFederationStateOperation(buf []byte, index uint64) interface{
 	case structs.FederationStateUpsert:
 		defer metrics.MeasureSinceWithLabels([]string{"fsm", "federation_state", req.State.Datacenter}, time.Now(),
 			[]metrics.Label{{Name: "op", Value: "upsert"}})
+		// Writes arriving via replication bypass the RPC-level validation,
+		// so flag (but still apply, to stay deterministic) anything the RPC
+		// would have rejected.
+		if err := req.State.ValidateMeshGateways(); err != nil {
+			c.logger.Warn("persisting federation state with invalid mesh gateway addresses",
+				"datacenter", req.State.Datacenter,
+				"error", err,
+			)
+		}
 		if err := c.state.FederationStateSet(index, req.State); err != nil {
 			return err
 		}
 		return true
+	case structs.FederationStateBatchUpsert:
+		defer metrics.MeasureSinceWithLabels([]string{"fsm", "federation_state", "batch"}, time.Now(),
+			[]metrics.Label{{Name: "op", Value: "batch-upsert"}})
+		for _, state := range req.States {
+			if err := state.ValidateMeshGateways(); err != nil {
+				c.logger.Warn("persisting federation state with invalid mesh gateway addresses",
+					"datacenter", state.Datacenter,
+					"error", err,
+				)
+			}
+		}
+		if err := c.state.FederationStateBatchSet(index, req.States); err != nil {
+			return err
+		}
+		return true
 	case structs.FederationStateDelete:
 		defer metrics.MeasureSinceWithLabels([]string{"fsm", "federation_state", req.State.Datacenter}, time.Now(),
 			[]metrics.Label{{Name: "op", Value: "delete"}})
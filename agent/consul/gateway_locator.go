@@ -1,20 +1,39 @@
 package consul
 
 import (
+	"context"
+	crand "crypto/rand"
+	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"math"
+	"math/big"
 	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
 	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	metrics "github.com/armon/go-metrics"
 	"github.com/hashicorp/consul/agent/consul/state"
+	"github.com/hashicorp/consul/agent/consul/wanfed"
 	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/ipaddr"
 	"github.com/hashicorp/consul/lib"
+	"github.com/hashicorp/consul/lib/file"
 	"github.com/hashicorp/consul/logging"
 	"github.com/hashicorp/go-hclog"
 	memdb "github.com/hashicorp/go-memdb"
+	"golang.org/x/time/rate"
 )
 
 // GatewayLocator assists in selecting an appropriate mesh gateway when wan
@@ -36,155 +55,3499 @@ import (
 // gateway to ultimately forward the request through a remote mesh gateway to
 // reach its destination.
 type GatewayLocator struct {
-	logger            hclog.Logger
+	logger hclog.Logger
+
+	// runErrLogger throttles the recurring error line from the Run loop so
+	// a long state store outage does not emit it every backoff iteration.
+	runErrLogger *logging.ThrottledLogger
+
+	// tracer receives spans around refreshes and gateway picks; defaults to
+	// a no-op implementation when no tracer was injected.
+	tracer wanfed.Tracer
+
+	// backoff is the retry schedule used between failed refreshes in Run.
+	backoff backoffPolicy
+
+	// maxQueryTime caps one blocking federation state fetch; zero leaves
+	// the server's default query time in charge.
+	maxQueryTime time.Duration
+
+	// coalesceWindow is how long a refresh lingers after its blocking query
+	// wakes so that a burst of federation state writes (a rolling restart
+	// of the gateways, say) collapses into one recompute instead of one per
+	// index advance. Zero disables coalescing.
+	coalesceWindow time.Duration
+
+	// resolveHostnames makes picks resolve hostname-valued gateway
+	// addresses to an IP before handing them to the dialer; lookupHost is
+	// the resolver used for that, swappable in tests.
+	resolveHostnames bool
+	lookupHost       func(host string) ([]string, error)
+
+	// fallbackOnlyTimeout is how long Run tolerates continuous
+	// errGatewayLocalStateNotInitialized before degrading to fallback-only
+	// mode; fallbackOnlyOnce makes that degradation (and its warn log)
+	// happen at most once. Zero disables the degradation.
+	fallbackOnlyTimeout time.Duration
+	fallbackOnlyOnce    sync.Once
+
 	srv               serverDelegate
 	datacenter        string // THIS dc
 	primaryDatacenter string
 
+	// selectionMode controls how pickGateway chooses among the known
+	// gateways. See GatewaySelectionMode* for the valid values.
+	selectionMode string
+
+	// nodeName is this server's own catalog node name, and preferLocalNode
+	// opts gateway selection into preferring a healthy gateway registered
+	// on that node, avoiding an extra network hop in datacenters that
+	// co-locate a mesh gateway on each server node.
+	nodeName        string
+	preferLocalNode bool
+
+	// useWANAddrsForLocal makes the local gateway list render WAN-facing
+	// addresses, for servers that cannot route to the gateways' LAN
+	// addresses from where they run.
+	useWANAddrsForLocal bool
+
+	// segment is the network segment this server is part of. When set, the
+	// local gateway addresses are rendered from the gateway's tagged
+	// address for that segment when one is registered, since the
+	// default LAN address may not be reachable across segments.
+	segment string
+
+	// localityMetaKey is the node meta key consulted to determine which
+	// locality (e.g. availability zone) a gateway lives in, and locality is
+	// this server's own value for it. When both are set pickGateway prefers
+	// gateways in the same locality as the server.
+	localityMetaKey string
+	locality        string
+
+	// warningMode controls whether gateways with warning checks are
+	// eligible for selection. See GatewayWarningMode* for the valid values.
+	// warningWeightPercent is the scaled-down selection weight warning
+	// gateways retain under GatewayWarningModeDeprioritize.
+	warningMode          string
+	warningWeightPercent int
+
+	// checkScope controls which critical checks exclude a gateway from
+	// selection. See GatewayCheckScope* for the valid values.
+	checkScope string
+
+	// staleThreshold is how old the primary datacenter's federation state
+	// may grow before updateFromState warns about stalled replication.
+	staleThreshold time.Duration
+
+	// metricsInterval is how often the per-datacenter mesh gateway count
+	// gauges are re-emitted even when nothing changes; negative disables
+	// the timer.
+	metricsInterval time.Duration
+
+	// pickMetricAddrLabel adds the picked address as a label on the
+	// pick_gateway counter; off by default for cardinality reasons.
+	pickMetricAddrLabel bool
+
+	// pickDebugSampleN logs every Nth pick at debug level with the full
+	// candidate list; zero disables sampling. pickDebugCounter is bumped
+	// atomically on every pick while sampling is on.
+	pickDebugSampleN int
+	pickDebugCounter uint64
+
+	// recentAddrSets tracks when each distinct primary/local address set
+	// was last observed, so a flapping gateway toggling between the same
+	// few sets does not spam the "new cached locations" log cluster-wide.
+	// Guarded by gatewaysLock.
+	recentAddrSets map[string]time.Time
+
+	// maxPerDC caps how many gateways updateFromState retains per list,
+	// and shuffleSeed is this server's stable seed used both for the
+	// shuffled round-robin walk and for choosing which subset to keep when
+	// truncating, so different servers keep different subsets.
+	maxPerDC    int
+	shuffleSeed uint64
+
+	// addressFamily, when non-empty, controls which address family is used
+	// for gateways advertising both IPv4 and IPv6 addresses. See
+	// GatewayAddressFamily* for the valid values.
+	addressFamily string
+
+	// gossipTagFilter, when non-empty, splits the gateways into traffic
+	// classes: gossip transit sticks to gateways registered with this tag
+	// and RPC transit load-balances over the rest. Empty keeps the classes
+	// shared. See the gatewayTrafficClass constants.
+	gossipTagFilter string
+
+	// tagFilter, when non-empty, restricts selection to gateways registered
+	// with that service tag, for deployments whose gateways serve multiple
+	// roles.
+	tagFilter string
+
+	// protocolVersion is the wanfed transit protocol version this server
+	// speaks. Gateways whose advertised protocol range (via the
+	// consul-wan-federation-protocol service meta) does not include it are
+	// never selected.
+	protocolVersion int
+
+	// rand is this locator's private random source, seeded from crypto/rand
+	// at construction so that freshly started servers do not all make the
+	// same sequence of "random" picks, and so that heavy RPC forwarding does
+	// not contend on the math/rand global lock. Guarded by randLock since
+	// rand.Rand is not safe for concurrent use.
+	randLock sync.Mutex
+	rand     *rand.Rand
+
+	// rotation counters used when selectionMode is
+	// GatewaySelectionModeRoundRobin; accessed atomically and reset whenever
+	// updateFromState replaces the corresponding address list.
+	primaryRotor uint64
+	localRotor   uint64
+
+	// primaryPolicy and localPolicy choose one gateway from the candidate
+	// entries for their respective lists. They are separate instances so
+	// that stateful policies (like round-robin) never bleed rotation state
+	// between the primary and local candidate sets.
+	primaryPolicy selectionPolicy
+	localPolicy   selectionPolicy
+
 	// these ONLY contain ones that have the wanfed:1 meta
 	gatewaysLock    sync.Mutex
 	primaryGateways []string // WAN addrs
 	localGateways   []string // LAN addrs
 
+	// selection candidates aligned with the address lists above, carrying
+	// the catalog context (health, weight, node meta) that selection
+	// policies consume; precomputed at update time.
+	primaryGatewayEntries []gatewayEntry
+	localGatewayEntries   []gatewayEntry
+
+	// when each of the lists above was last replaced, for ListGateways.
+	primaryGatewaysUpdated time.Time
+	localGatewaysUpdated   time.Time
+
+	// provenance of the lists above: the raft index each was derived from
+	// and which source last set it. Guarded by gatewaysLock.
+	primaryListMeta gatewayListMeta
+	localListMeta   gatewayListMeta
+
+	// when the primary datacenter's federation state itself was last
+	// updated, as carried on the replicated entry; zero until one has been
+	// observed. Guarded by gatewaysLock.
+	primaryFedStateUpdatedAt time.Time
+
+	// lastRefreshAttempt, lastSuccessfulRefresh, and
+	// consecutiveRefreshErrors track the refresh loop's liveness. They are
+	// updated on every runOnce pass even when nothing changed, so a quiet
+	// loop is distinguishable from a stuck one. Guarded by gatewaysLock.
+	lastRefreshAttempt       time.Time
+	lastSuccessfulRefresh    time.Time
+	consecutiveRefreshErrors int
+
+	// lastFetchedIndex is the raft index of the most recent federation
+	// state fetch that the cached lists are based on. Written by the
+	// locator's own goroutine and read atomically from pick paths for
+	// trace logging.
+	lastFetchedIndex uint64
+
+	// when each gateway list last transitioned to empty after having held
+	// addresses; zero while a list is non-empty or has never been
+	// populated. Guarded by gatewaysLock.
+	primaryEmptiedAt time.Time
+	localEmptiedAt   time.Time
+
+	// subsets of the entries above restricted to gateways in the same
+	// locality as this server; only populated when locality preference is
+	// configured.
+	primarySameZoneEntries []gatewayEntry
+	localSameZoneEntries   []gatewayEntry
+
+	// failureCooldown controls how long a gateway address reported via
+	// MarkGatewayFailed is deprioritized before being eligible again.
+	failureCooldown time.Duration
+
+	// failedGateways tracks the most recent reported dial failure per
+	// gateway address. Entries expire after failureCooldown and are dropped
+	// when updateFromState no longer sees the address.
+	failedLock     sync.Mutex
+	failedGateways map[string]time.Time
+
+	// breakerThreshold is how many consecutive dial failures open a
+	// gateway's breaker; breakerCooldown is how long an open breaker waits
+	// before allowing a half-open probe.
+	breakerThreshold int
+	breakerCooldown  time.Duration
+
+	// breakers tracks a circuit breaker per gateway address, fed by
+	// MarkGatewayFailed and MarkGatewaySucceeded.
+	breakerLock sync.Mutex
+	breakers    map[string]*gatewayBreaker
+
+	// lastPicked remembers the address most recently handed out per
+	// destination class (primary vs local) so that consecutive random
+	// draws avoid returning the same gateway twice in a row while
+	// alternatives exist. Only consulted for the random and weighted
+	// selection modes; round-robin never repeats on its own and affinity
+	// repeats deliberately.
+	lastPickedLock    sync.Mutex
+	lastPickedPrimary string
+	lastPickedLocal   string
+
+	// addressOverrides maps a datacenter name to a fixed list of gateway
+	// addresses that take precedence over anything derived from the
+	// catalog, for datacenters whose mesh gateways sit behind a stable
+	// load balancer VIP. Replaceable at runtime on config reload.
+	overridesLock    sync.Mutex
+	addressOverrides map[string][]string
+
+	// lastGood remembers the address most recently reported as successful
+	// per destination class, consulted when selectionMode is
+	// GatewaySelectionModeLastGood. Cleared when the address leaves the
+	// healthy set or a dial failure is reported for it.
+	lastGoodLock    sync.Mutex
+	lastGoodPrimary string
+	lastGoodLocal   string
+
+	// gatewayConns tracks the number of outstanding transit connections per
+	// gateway address, reported by the connection pool via IncGatewayConns
+	// and DecGatewayConns. Entries are dropped when updateFromState no
+	// longer sees the address.
+	connsLock    sync.Mutex
+	gatewayConns map[string]int
+
+	// affinity remembers the gateway address last handed out per
+	// destination datacenter when selectionMode is
+	// GatewaySelectionModeAffinity. Entries are dropped when the address
+	// leaves the healthy set or a dial failure is reported for it.
+	affinityLock sync.Mutex
+	affinity     map[string]string
+
 	// primaryMeshGatewayDiscoveredAddresses is the current fallback addresses
 	// for the mesh gateways in the primary datacenter.
 	primaryMeshGatewayDiscoveredAddresses     []string
 	primaryMeshGatewayDiscoveredAddressesLock sync.Mutex
 
+	// primaryFallbackUpdated is when the fallback addresses last changed;
+	// guarded by primaryMeshGatewayDiscoveredAddressesLock.
+	primaryFallbackUpdated time.Time
+
+	// cacheFilePath is where the last known gateway addresses are
+	// persisted across restarts; empty (dev mode) disables persistence.
+	cacheFilePath string
+
+	// cacheTTL is how old the persisted addresses may be before they are
+	// ignored at startup.
+	cacheTTL time.Duration
+
+	// persistedPrimaryGateways and persistedLocalGateways hold the last
+	// known non-empty address lists, either loaded from cacheFilePath at
+	// startup or refreshed by updateFromState. They form a selection tier
+	// between replicated federation state and the configured fallback
+	// addresses; guarded by gatewaysLock.
+	persistedPrimaryGateways []string
+	persistedLocalGateways   []string
+
+	// fallbackProbe* control the optional background TCP prober for the
+	// fallback addresses; see Config.GatewayFallbackProbe*.
+	fallbackProbeEnabled  bool
+	fallbackProbeInterval time.Duration
+	fallbackProbeTimeout  time.Duration
+
+	// fallbackUnreachable marks fallback addresses that failed their most
+	// recent reachability probe; guarded by
+	// primaryMeshGatewayDiscoveredAddressesLock.
+	fallbackUnreachable map[string]bool
+
+	// probeDialFn overrides the TCP dial used by the fallback prober, for
+	// tests.
+	probeDialFn func(addr string, timeout time.Duration) error
+
 	// This will be closed the FIRST time we get some gateways populated
 	primaryGatewaysReadyCh   chan struct{}
 	primaryGatewaysReadyOnce sync.Once
+
+	// runStartedAt is when Run began, used to measure how long a freshly
+	// started server waits for its first primary mesh gateways. Written
+	// once at the top of Run and read from the Run goroutine and the
+	// ready-wait warning loop, which Run starts afterwards.
+	runStartedAt time.Time
+
+	// primaryReady is a re-armable version of the latch above: true while at
+	// least one primary mesh gateway is known via federation state, and false
+	// again should they all disappear. primaryReadyWatchers holds the
+	// subscriber channels registered by WatchPrimaryGatewayReadiness, each
+	// buffered to one coalesced value.
+	primaryReadyLock     sync.Mutex
+	primaryReady         bool
+	primaryReadyWatchers []chan bool
+
+	// addrUpdateCh is closed and replaced whenever any of the gateway or
+	// fallback address lists change, to promptly wake anyone blocked in
+	// PickGatewayContext.
+	addrUpdateLock sync.Mutex
+	addrUpdateCh   chan struct{}
+
+	// forceRefreshCh carries at most one queued ForceRefresh request for the
+	// Run loop to pick up.
+	forceRefreshCh chan struct{}
+
+	// localStatePresent tracks whether a federation state entry for this
+	// server's own datacenter has ever been observed, and
+	// localStateMissingCh carries at most one queued repair signal for when
+	// an observed entry disappears again.
+	localStateLock      sync.Mutex
+	localStatePresent   bool
+	localStateMissingCh chan struct{}
+
+	// doneCh is closed when Run has fully exited, so that shutdown can wait
+	// for the goroutine rather than leaking it.
+	doneCh chan struct{}
+}
+
+const (
+	// gatewayTrafficClassGossip marks picks for tunneled gossip traffic:
+	// tiny, latency-sensitive packets. With a gossip tag filter configured
+	// these stick to the designated gateway subset.
+	gatewayTrafficClassGossip = "gossip"
+
+	// gatewayTrafficClassRPC marks picks for forwarded RPCs:
+	// throughput-heavy streams. With a gossip tag filter configured these
+	// avoid the gossip-designated subset.
+	gatewayTrafficClassRPC = "rpc"
+)
+
+const (
+	// GatewaySelectionModeRandom picks a gateway uniformly at random on each
+	// call, ignoring registered service weights.
+	GatewaySelectionModeRandom = "random"
+
+	// GatewaySelectionModeWeighted picks a gateway at random biased by the
+	// registered service weights. This is the default; with uniform weights
+	// it behaves identically to GatewaySelectionModeRandom.
+	GatewaySelectionModeWeighted = "weighted"
+
+	// GatewaySelectionModeRoundRobin rotates through the sorted address list
+	// so that consecutive picks for the same destination spread evenly.
+	GatewaySelectionModeRoundRobin = "round_robin"
+
+	// GatewaySelectionModeAffinity remembers the gateway last handed out per
+	// destination datacenter and keeps returning it until it leaves the
+	// healthy set or a dial failure is reported for it, preserving
+	// long-lived multiplexed connections.
+	GatewaySelectionModeAffinity = "affinity"
+
+	// GatewaySelectionModeLeastConns picks among the gateways carrying the
+	// fewest outstanding transit connections as reported by the connection
+	// pool, breaking ties randomly.
+	GatewaySelectionModeLeastConns = "least_conns"
+
+	// GatewaySelectionModeLastGood keeps returning the gateway most
+	// recently reported as successful via ReportGatewaySuccess while it
+	// remains healthy, falling back to a weighted random pick until a
+	// success has been observed.
+	GatewaySelectionModeLastGood = "prefer_last_good"
+
+	// GatewaySelectionModeShuffledRoundRobin walks a per-server
+	// deterministic permutation of the gateway list (seeded by this
+	// server's node ID) round-robin, so the servers of a cluster start at
+	// different offsets and collectively spread load across all gateways
+	// instead of independently making the same random choices.
+	GatewaySelectionModeShuffledRoundRobin = "shuffled_round_robin"
+)
+
+// ValidateGatewayTagFilter checks that the provided gateway service tag
+// filter is usable: tags containing whitespace cannot be registered and
+// would silently filter every gateway out. The empty string is allowed and
+// means "no tag filtering".
+func ValidateGatewayTagFilter(tag string) error {
+	if strings.ContainsAny(tag, " \t\r\n") {
+		return fmt.Errorf("gateway tag filter must not contain whitespace: %q", tag)
+	}
+	return nil
+}
+
+// ValidateGatewaySelectionPolicy checks that the provided gateway selection
+// policy name is one this server knows how to build, so that a typo fails
+// config validation at startup instead of silently selecting the default.
+// The empty string is allowed and means "use the default".
+func ValidateGatewaySelectionPolicy(name string) error {
+	switch name {
+	case "",
+		GatewaySelectionModeRandom,
+		GatewaySelectionModeWeighted,
+		GatewaySelectionModeRoundRobin,
+		GatewaySelectionModeAffinity,
+		GatewaySelectionModeLeastConns,
+		GatewaySelectionModeLastGood,
+		GatewaySelectionModeShuffledRoundRobin:
+		return nil
+	default:
+		return fmt.Errorf("unsupported gateway selection policy: %q", name)
+	}
+}
+
+// gatewayEntry describes one candidate mesh gateway handed to a
+// selectionPolicy, carrying enough catalog context for policies to make
+// richer decisions than a bare address allows.
+type gatewayEntry struct {
+	addr     string
+	node     string // catalog node name the gateway is registered on
+	health   string // api.HealthPassing or api.HealthWarning
+	weight   int
+	nodeMeta map[string]string
+	tags     []string // registered service tags, for traffic class filtering
+
+	// addrV4 and addrV6 are the gateway's per-family tagged addresses when
+	// it registered any, so that an address family preference can be
+	// applied at pick time. Either may be empty.
+	addrV4 string
+	addrV6 string
+
+	// maxConns is the maximum number of concurrent transit connections the
+	// gateway advertised via its service meta; 0 means unlimited.
+	maxConns int
+
+	// instances is the number of catalog instances collapsed into this
+	// address, for gateways sharing one externally visible host:port (such
+	// as behind a load balancer). Zero and one both mean a single instance.
+	instances int
+}
+
+// selectionPolicy chooses one gateway from a candidate list. Implementations
+// may keep internal state (such as a rotation counter), so the locator uses a
+// separate instance per address list.
+type selectionPolicy interface {
+	Pick(addrs []gatewayEntry) string
+}
+
+// randomSelectionPolicy picks uniformly at random, ignoring weights.
+type randomSelectionPolicy struct {
+	intn func(n int) int
+}
+
+func (p randomSelectionPolicy) Pick(addrs []gatewayEntry) string {
+	switch len(addrs) {
+	case 0:
+		return ""
+	case 1:
+		return addrs[0].addr
+	default:
+		return addrs[p.intn(len(addrs))].addr
+	}
+}
+
+// weightedSelectionPolicy picks at random biased by the entries' selection
+// weights, degrading to a uniform pick when no weights are usable.
+type weightedSelectionPolicy struct {
+	intn func(n int) int
+}
+
+func (p weightedSelectionPolicy) Pick(addrs []gatewayEntry) string {
+	switch len(addrs) {
+	case 0:
+		return ""
+	case 1:
+		return addrs[0].addr
+	}
+
+	total := 0
+	for _, e := range addrs {
+		total += e.weight
+	}
+	if total <= 0 {
+		return addrs[p.intn(len(addrs))].addr
+	}
+
+	r := p.intn(total)
+	for _, e := range addrs {
+		r -= e.weight
+		if r < 0 {
+			return e.addr
+		}
+	}
+	return addrs[len(addrs)-1].addr
+}
+
+// roundRobinSelectionPolicy rotates through the sorted candidate list using a
+// locator-owned counter so that updateFromState can reset the rotation when
+// the list is replaced. The counter may race with such a replacement, so the
+// index is always taken modulo the current length to avoid indexing out of
+// range when the list shrinks.
+type roundRobinSelectionPolicy struct {
+	rotor *uint64
+}
+
+func (p *roundRobinSelectionPolicy) Pick(addrs []gatewayEntry) string {
+	switch len(addrs) {
+	case 0:
+		return ""
+	case 1:
+		return addrs[0].addr
+	}
+
+	idx := (atomic.AddUint64(p.rotor, 1) - 1) % uint64(len(addrs))
+	return addrs[idx].addr
+}
+
+// leastConnsSelectionPolicy picks among the entries with the fewest
+// outstanding transit connections, breaking ties randomly. Gateways the pool
+// has never reported about count as zero.
+type leastConnsSelectionPolicy struct {
+	conns func(addr string) int
+	intn  func(n int) int
+}
+
+func (p leastConnsSelectionPolicy) Pick(addrs []gatewayEntry) string {
+	switch len(addrs) {
+	case 0:
+		return ""
+	case 1:
+		return addrs[0].addr
+	}
+
+	var (
+		least    []gatewayEntry
+		minConns int
+	)
+	for i, e := range addrs {
+		n := p.conns(e.addr)
+		switch {
+		case i == 0 || n < minConns:
+			least = append(least[:0], e)
+			minConns = n
+		case n == minConns:
+			least = append(least, e)
+		}
+	}
+
+	if len(least) == 1 {
+		return least[0].addr
+	}
+	return least[p.intn(len(least))].addr
+}
+
+// shuffledRoundRobinSelectionPolicy walks a deterministic per-server
+// permutation of the candidate list using a locator-owned counter. The
+// permutation orders addresses by a hash of the server seed and the address,
+// so each server walks its own stable order, and adding or removing a gateway
+// never reorders the survivors relative to each other — only the newcomer is
+// spliced in — which keeps connection churn minimal when the set changes.
+type shuffledRoundRobinSelectionPolicy struct {
+	seed  uint64
+	rotor *uint64
+}
+
+func (p *shuffledRoundRobinSelectionPolicy) Pick(addrs []gatewayEntry) string {
+	switch len(addrs) {
+	case 0:
+		return ""
+	case 1:
+		return addrs[0].addr
+	}
+
+	type scored struct {
+		addr  string
+		score uint64
+	}
+	perm := make([]scored, 0, len(addrs))
+	for _, e := range addrs {
+		h := fnv.New64a()
+		var seedBytes [8]byte
+		binary.BigEndian.PutUint64(seedBytes[:], p.seed)
+		h.Write(seedBytes[:])
+		h.Write([]byte(e.addr))
+		perm = append(perm, scored{addr: e.addr, score: h.Sum64()})
+	}
+	sort.Slice(perm, func(i, j int) bool {
+		if perm[i].score != perm[j].score {
+			return perm[i].score < perm[j].score
+		}
+		return perm[i].addr < perm[j].addr
+	})
+
+	idx := (atomic.AddUint64(p.rotor, 1) - 1) % uint64(len(perm))
+	return perm[idx].addr
+}
+
+// gatewayShuffleSeed derives the per-server permutation seed for
+// GatewaySelectionModeShuffledRoundRobin from the server's node ID, falling
+// back to the node name for servers that predate stable node IDs.
+func gatewayShuffleSeed(config *Config) uint64 {
+	key := string(config.NodeID)
+	if key == "" {
+		key = config.NodeName
+	}
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64()
+}
+
+const (
+	// GatewayAddressFamilyPreferIPv4 dials a gateway's IPv4 address when it
+	// registered one and falls back to whatever else it advertised.
+	GatewayAddressFamilyPreferIPv4 = "prefer_ipv4"
+
+	// GatewayAddressFamilyPreferIPv6 dials a gateway's IPv6 address when it
+	// registered one and falls back to whatever else it advertised.
+	GatewayAddressFamilyPreferIPv6 = "prefer_ipv6"
+
+	// GatewayAddressFamilyRequireIPv4 only dials IPv4 addresses; gateways
+	// without one are excluded from selection entirely.
+	GatewayAddressFamilyRequireIPv4 = "require_ipv4"
+
+	// GatewayAddressFamilyRequireIPv6 only dials IPv6 addresses; gateways
+	// without one are excluded from selection entirely.
+	GatewayAddressFamilyRequireIPv6 = "require_ipv6"
+)
+
+const (
+	// GatewayWarningModeAllow treats gateways with warning checks the same
+	// as passing ones. This is the default.
+	GatewayWarningModeAllow = "allow"
+
+	// GatewayWarningModePreferPassing excludes gateways with warning checks
+	// whenever at least one fully passing gateway exists in the same
+	// datacenter list, so a list that is entirely warning is never filtered
+	// down to zero.
+	GatewayWarningModePreferPassing = "prefer_passing"
+
+	// GatewayWarningModeExclude always excludes gateways with warning
+	// checks, even when that leaves no gateways for a datacenter.
+	GatewayWarningModeExclude = "exclude"
+
+	// GatewayWarningModeDeprioritize keeps gateways with warning checks
+	// selectable but scales their selection weight down to
+	// GatewayWarningWeightPercent of their registered weight, in the same
+	// spirit as DNS SRV weight degradation. A list that is entirely warning
+	// serves at full weight.
+	GatewayWarningModeDeprioritize = "deprioritize"
+)
+
+// defaultGatewayWarningWeightPercent is the selection weight warning gateways
+// retain under GatewayWarningModeDeprioritize when no percentage is
+// configured.
+const defaultGatewayWarningWeightPercent = 10
+
+// defaultGatewayFailureCooldown is how long a gateway address reported as
+// failed is avoided when no cooldown is configured.
+const defaultGatewayFailureCooldown = 30 * time.Second
+
+// gatewayUpdateLogDampeningWindow is how recently a gateway address set must
+// have been logged for a change back to it to be considered a flap and have
+// its log line suppressed.
+const gatewayUpdateLogDampeningWindow = 30 * time.Second
+
+// defaultGatewayFederationStateStaleThreshold is how old the primary
+// datacenter's federation state may grow before updateFromState warns that
+// replication has likely stalled.
+const defaultGatewayFederationStateStaleThreshold = time.Hour
+
+// defaultGatewayUpdateCoalesceWindow is how long a refresh lingers after its
+// blocking query wakes before recomputing, so a burst of federation state
+// writes lands as a single update.
+const defaultGatewayUpdateCoalesceWindow = time.Second
+
+// gatewayLocalStateReadyPollInterval is how often the ready-watch loop
+// rechecks the leadership/raft-contact precondition so a refresh can be
+// forced the moment it flips to satisfied.
+const gatewayLocalStateReadyPollInterval = 250 * time.Millisecond
+
+// defaultGatewayFallbackOnlyModeTimeout is how long the Run loop tolerates a
+// continuously uninitialized local raft state before degrading to the
+// configured fallback addresses.
+const defaultGatewayFallbackOnlyModeTimeout = 2 * time.Minute
+
+// defaultGatewayFallbackProbeInterval is how often the fallback prober
+// re-checks reachability when no interval is configured.
+const defaultGatewayFallbackProbeInterval = 30 * time.Second
+
+// defaultGatewayFallbackProbeTimeout bounds each fallback reachability probe
+// when no timeout is configured.
+const defaultGatewayFallbackProbeTimeout = 3 * time.Second
+
+// gatewayCacheFileName is the file under the data dir where the locator
+// persists its last known mesh gateway addresses across restarts.
+const gatewayCacheFileName = "wanfed-mesh-gateways.json"
+
+// defaultGatewayCacheTTL is how old the persisted gateway addresses may be
+// before they are ignored at startup.
+const defaultGatewayCacheTTL = 7 * 24 * time.Hour
+
+const (
+	// GatewayCheckScopeAll excludes a mesh gateway from wanfed transit when
+	// ANY of its associated checks is critical, including unrelated
+	// node-level checks. This is the default, matching historical behavior.
+	GatewayCheckScopeAll = "all"
+
+	// GatewayCheckScopeService only considers the built-in serfHealth check
+	// and checks bound to the gateway service itself, so an unrelated
+	// critical node check (e.g. a disk alert) does not remove a functional
+	// gateway from rotation.
+	GatewayCheckScopeService = "service"
+)
+
+// defaultGatewayProtocolVersion is the wanfed transit protocol version
+// assumed for servers and gateways that do not advertise one.
+const defaultGatewayProtocolVersion = 1
+
+const (
+	// defaultGatewayBreakerThreshold is how many consecutive dial failures
+	// open a gateway's circuit breaker when no threshold is configured.
+	defaultGatewayBreakerThreshold = 5
+
+	// defaultGatewayBreakerCooldown is how long an OPEN breaker waits before
+	// allowing a HALF-OPEN probe when no cooldown is configured.
+	defaultGatewayBreakerCooldown = 1 * time.Minute
+)
+
+type gatewayBreakerState int
+
+const (
+	breakerClosed gatewayBreakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// gatewayBreaker holds the per-address circuit breaker bookkeeping. After
+// enough consecutive dial failures the breaker opens and the address is
+// excluded from picks; once the cooldown passes a single probe pick is
+// allowed through, and its outcome either closes or re-opens the breaker.
+type gatewayBreaker struct {
+	state               gatewayBreakerState
+	consecutiveFailures int
+	lastFailure         time.Time
+	probeStarted        time.Time
+}
+
+// GatewayFailureCounts returns the consecutive dial failure count per
+// gateway address as tracked by the circuit breakers, for operator debug
+// tooling. Addresses without recent failures are absent.
+func (g *GatewayLocator) GatewayFailureCounts() map[string]int {
+	g.breakerLock.Lock()
+	defer g.breakerLock.Unlock()
+
+	out := make(map[string]int, len(g.breakers))
+	for addr, b := range g.breakers {
+		if b.consecutiveFailures > 0 {
+			out[addr] = b.consecutiveFailures
+		}
+	}
+	return out
 }
 
 // PrimaryMeshGatewayAddressesReadyCh returns a channel that will be closed
 // when federation state replication ships back at least one primary mesh
-// gateway (not via fallback config).
+// gateway, or when the locator degrades to fallback-only mode because the
+// local state never initialized. The channel only latches the first
+// transition; callers that need to learn when the primary gateways later
+// disappear again should use WatchPrimaryGatewayReadiness instead.
 func (g *GatewayLocator) PrimaryMeshGatewayAddressesReadyCh() <-chan struct{} {
 	return g.primaryGatewaysReadyCh
 }
 
-// PickGateway returns the address for a gateway suitable for reaching the
-// provided datacenter.
-func (g *GatewayLocator) PickGateway(dc string) string {
-	item := g.pickGateway(dc == g.primaryDatacenter)
-	g.logger.Trace("picking gateway for transit", "gateway", item, "source_datacenter", g.datacenter, "dest_datacenter", dc)
-	return item
+// WatchPrimaryGatewayReadiness returns a channel reporting whether at least
+// one primary mesh gateway is known via federation state. The current state
+// is delivered immediately and a value is sent on every transition in either
+// direction, so unlike PrimaryMeshGatewayAddressesReadyCh a consumer also
+// learns when the primary gateways disappear again. Values coalesce when the
+// consumer is slow: intermediate flaps may be dropped but the latest state is
+// always delivered. The channel is closed when the context is cancelled.
+func (g *GatewayLocator) WatchPrimaryGatewayReadiness(ctx context.Context) <-chan bool {
+	ch := make(chan bool, 1)
+
+	g.primaryReadyLock.Lock()
+	g.primaryReadyWatchers = append(g.primaryReadyWatchers, ch)
+	ch <- g.primaryReady
+	g.primaryReadyLock.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		g.primaryReadyLock.Lock()
+		for i, w := range g.primaryReadyWatchers {
+			if w == ch {
+				g.primaryReadyWatchers = append(g.primaryReadyWatchers[:i], g.primaryReadyWatchers[i+1:]...)
+				break
+			}
+		}
+		g.primaryReadyLock.Unlock()
+		close(ch)
+	}()
+
+	return ch
 }
 
-func (g *GatewayLocator) pickGateway(primary bool) string {
-	addrs := g.listGateways(primary)
-	return getRandomItem(addrs)
+// GatewayAddressSnapshot carries the effective gateway address sets delivered
+// to Subscribe watchers.
+type GatewayAddressSnapshot struct {
+	// PrimaryGateways are the mesh gateway addresses for the primary
+	// datacenter known via federation state.
+	PrimaryGateways []string
+
+	// LocalGateways are the mesh gateway addresses for this server's own
+	// datacenter known via federation state.
+	LocalGateways []string
+
+	// FallbackAddresses are the discovered or configured fallback
+	// addresses for the primary datacenter.
+	FallbackAddresses []string
 }
 
-func (g *GatewayLocator) listGateways(primary bool) []string {
-	g.gatewaysLock.Lock()
-	defer g.gatewaysLock.Unlock()
+func (s *GatewayAddressSnapshot) sameAs(o *GatewayAddressSnapshot) bool {
+	return lib.StringSliceEqual(s.PrimaryGateways, o.PrimaryGateways) &&
+		lib.StringSliceEqual(s.LocalGateways, o.LocalGateways) &&
+		lib.StringSliceEqual(s.FallbackAddresses, o.FallbackAddresses)
+}
 
-	var addrs []string
-	if primary {
-		addrs = g.primaryGateways
-	} else {
-		addrs = g.localGateways
-	}
+// Subscribe returns a channel that carries a snapshot of the effective
+// gateway address sets whenever updateFromState or
+// RefreshPrimaryGatewayFallbackAddresses actually changes them, so consumers
+// that cache addresses (the router, the gossip transport) can react to
+// changes instead of polling PickGateway. The current snapshot is delivered
+// immediately. Values coalesce when the consumer is slow: intermediate
+// updates may be dropped but the latest snapshot is always delivered, and a
+// send never blocks the locator. The channel is closed when the context is
+// cancelled.
+func (g *GatewayLocator) Subscribe(ctx context.Context) <-chan GatewayAddressSnapshot {
+	out := make(chan GatewayAddressSnapshot, 1)
+
+	go func() {
+		defer close(out)
+
+		var last *GatewayAddressSnapshot
+		for {
+			// Grab the notification channel before snapshotting so a
+			// change racing the snapshot still wakes the next loop.
+			updateCh := g.addrUpdateNotifyCh()
 
-	if primary && len(addrs) == 0 {
-		addrs = g.PrimaryGatewayFallbackAddresses()
+			snap := g.snapshotAddresses()
+			if last == nil || !snap.sameAs(last) {
+				select {
+				case out <- snap:
+				default:
+					// replace the pending unread snapshot
+					select {
+					case <-out:
+					default:
+					}
+					out <- snap
+				}
+				last = &snap
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-updateCh:
+			}
+		}
+	}()
+
+	return out
+}
+
+// snapshotAddresses returns a copy of the effective gateway address sets.
+func (g *GatewayLocator) snapshotAddresses() GatewayAddressSnapshot {
+	g.gatewaysLock.Lock()
+	snap := GatewayAddressSnapshot{
+		PrimaryGateways: append([]string(nil), g.primaryGateways...),
+		LocalGateways:   append([]string(nil), g.localGateways...),
 	}
+	g.gatewaysLock.Unlock()
 
-	return addrs
+	snap.FallbackAddresses = g.PrimaryGatewayFallbackAddresses()
+	return snap
 }
 
-// RefreshPrimaryGatewayFallbackAddresses is used to update the list of current
-// fallback addresses for locating mesh gateways in the primary datacenter.
-func (g *GatewayLocator) RefreshPrimaryGatewayFallbackAddresses(addrs []string) {
-	sort.Strings(addrs)
+// setPrimaryReady records the readiness state and notifies watchers on a
+// transition. Sends never block: each watcher channel holds one value, and a
+// pending unread value is replaced so the watcher always sees the latest
+// state.
+func (g *GatewayLocator) setPrimaryReady(ready bool) {
+	g.primaryReadyLock.Lock()
+	defer g.primaryReadyLock.Unlock()
+	if g.primaryReady == ready {
+		return
+	}
+	g.primaryReady = ready
+	for _, w := range g.primaryReadyWatchers {
+		select {
+		case w <- ready:
+		default:
+			select {
+			case <-w:
+			default:
+			}
+			w <- ready
+		}
+	}
+}
 
-	g.primaryMeshGatewayDiscoveredAddressesLock.Lock()
-	defer g.primaryMeshGatewayDiscoveredAddressesLock.Unlock()
+// NoMeshGatewaysAvailableError is returned when no mesh gateway addresses
+// are known for a destination datacenter.
+type NoMeshGatewaysAvailableError struct {
+	// Datacenter is the destination the pick was attempted for.
+	Datacenter string
 
-	if !lib.StringSliceEqual(addrs, g.primaryMeshGatewayDiscoveredAddresses) {
-		g.primaryMeshGatewayDiscoveredAddresses = addrs
-		g.logger.Info("updated fallback list of primary mesh gateways", "mesh_gateways", addrs)
+	// FallbackEmpty indicates that the configured fallback addresses for
+	// the primary datacenter were also empty.
+	FallbackEmpty bool
+}
+
+func (e NoMeshGatewaysAvailableError) Error() string {
+	if e.FallbackEmpty {
+		return fmt.Sprintf("no mesh gateway available to reach %s: fallback addresses are also empty", e.Datacenter)
 	}
+	return fmt.Sprintf("no mesh gateway available to reach %s", e.Datacenter)
 }
 
-// PrimaryGatewayFallbackAddresses returns the current set of discovered
-// fallback addresses for the mesh gateways in the primary datacenter.
-func (g *GatewayLocator) PrimaryGatewayFallbackAddresses() []string {
-	g.primaryMeshGatewayDiscoveredAddressesLock.Lock()
-	defer g.primaryMeshGatewayDiscoveredAddressesLock.Unlock()
+// PickedGateway carries the catalog context for an address handed out by
+// PickGatewayDetailed, so that transit error logs can identify the gateway
+// instance rather than just its address.
+type PickedGateway struct {
+	// Addr is the host:port to dial; empty when no gateway is available.
+	Addr string
 
-	out := make([]string, len(g.primaryMeshGatewayDiscoveredAddresses))
-	copy(out, g.primaryMeshGatewayDiscoveredAddresses)
-	return out
+	// NodeName is the catalog node the gateway is registered on. Empty for
+	// fallback and override addresses, which have no catalog data.
+	NodeName string
+
+	// Datacenter is the datacenter the gateway provides transit into.
+	Datacenter string
+
+	// FromFallback is true when the address came from the configured
+	// fallback addresses for the primary datacenter rather than from
+	// replicated federation state.
+	FromFallback bool
+
+	// CandidateCount is how many gateway addresses were eligible when the
+	// pick was made.
+	CandidateCount int
 }
 
-func getRandomItem(items []string) string {
-	switch len(items) {
-	case 0:
-		return ""
-	case 1:
-		return items[0]
-	default:
-		idx := int(rand.Int31n(int32(len(items))))
-		return items[idx]
+// PickGateway returns the address for a gateway suitable for reaching the
+// provided datacenter.
+func (g *GatewayLocator) PickGateway(dc string) string {
+	return g.PickGatewayDetailed(dc).Addr
+}
+
+// dialPrimary reports whether reaching the provided datacenter should use the
+// primary gateway list. A server that is itself in the primary datacenter
+// serves such requests from its local list instead: the two lists cover the
+// same gateways there, and only a genuine secondary should ever substitute
+// the configured primary fallback addresses.
+func (g *GatewayLocator) dialPrimary(dc string) bool {
+	return dc == g.primaryDatacenter && g.datacenter != g.primaryDatacenter
+}
+
+// PickGatewayDetailed is like PickGateway but returns the gateway's catalog
+// context along with the address, so that callers logging a failed dial can
+// identify which gateway instance the address belonged to and whether it was
+// a fallback address.
+func (g *GatewayLocator) PickGatewayDetailed(dc string) PickedGateway {
+	primary := g.dialPrimary(dc)
+	picked := g.pickGatewayDetailed(dc, primary)
+	g.tracePick(dc, picked)
+	updated, meta := g.pickedProvenance(primary, picked.FromFallback)
+	g.logger.Trace("picking gateway for transit",
+		"gateway", picked.Addr,
+		"gateway_node", picked.NodeName,
+		"source_datacenter", g.datacenter,
+		"dest_datacenter", dc,
+		"from_fallback", picked.FromFallback,
+		"override", len(g.overrideAddrs(primary)) > 0,
+		"candidates", picked.CandidateCount,
+		"policy", g.selectionMode,
+		"list_source", meta.source,
+		"list_updated", updated,
+		"raft_index", meta.raftIndex,
+	)
+	return picked
+}
+
+// tracePick emits a span for a single gateway pick so that traces of the
+// transit path show which gateway was chosen and from how many candidates.
+func (g *GatewayLocator) tracePick(dc string, picked PickedGateway) {
+	span := g.tracer.StartSpan("wanfed.gateway.pick")
+	span.SetAttribute("destination_datacenter", dc)
+	span.SetAttribute("gateway", picked.Addr)
+	span.SetAttribute("candidates", picked.CandidateCount)
+	span.SetAttribute("from_fallback", picked.FromFallback)
+	span.SetAttribute("policy", g.selectionMode)
+	if picked.Addr == "" {
+		span.SetError(NoMeshGatewaysAvailableError{Datacenter: dc})
+	}
+	span.End()
+}
+
+// pickedProvenance resolves the provenance to log for a pick: the list's
+// recorded provenance, unless fallback substitution happened, which is not a
+// state of the cached list itself.
+func (g *GatewayLocator) pickedProvenance(primary, fromFallback bool) (time.Time, gatewayListMeta) {
+	if fromFallback {
+		g.primaryMeshGatewayDiscoveredAddressesLock.Lock()
+		updated := g.primaryFallbackUpdated
+		g.primaryMeshGatewayDiscoveredAddressesLock.Unlock()
+		return updated, gatewayListMeta{source: GatewayListSourceFallback}
+	}
+	return g.listProvenance(primary)
+}
+
+func (g *GatewayLocator) pickGatewayDetailed(dc string, primary bool) PickedGateway {
+	return g.pickGatewayDetailedClass(dc, primary, "")
+}
+
+func (g *GatewayLocator) pickGatewayDetailedClass(dc string, primary bool, class string) PickedGateway {
+	entries, fromFallback := g.listGatewayEntries(primary)
+	entries = g.filterEntriesForClass(entries, class)
+	addr := g.pickFromEntries(dc, primary, entries)
+	g.reportGatewayPick(dc, primary, addr)
+	g.maybeDebugSamplePick(dc, addr, fromFallback, entries)
+	if addr == "" {
+		return PickedGateway{CandidateCount: len(entries)}
+	}
+
+	picked := PickedGateway{
+		Addr:           addr,
+		Datacenter:     g.datacenter,
+		FromFallback:   fromFallback,
+		CandidateCount: len(entries),
+	}
+	if primary {
+		picked.Datacenter = g.primaryDatacenter
+	}
+	for _, e := range entries {
+		if e.addr == addr {
+			picked.NodeName = e.node
+			break
+		}
+	}
+	picked.Addr = g.maybeResolveHostname(picked.Addr)
+	return picked
+}
+
+// maybeResolveHostname swaps a hostname-valued pick for one of its resolved
+// IPs, chosen at random so repeated picks spread across the records, when
+// hostname resolution is configured. Resolution failures hand back the
+// hostname itself; the dialer can still try its own lookup.
+func (g *GatewayLocator) maybeResolveHostname(addr string) string {
+	if !g.resolveHostnames || addr == "" {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return addr
+	}
+	ips, err := g.lookupHost(host)
+	if err != nil || len(ips) == 0 {
+		g.logger.Warn("failed to resolve mesh gateway hostname; dialing it unresolved",
+			"hostname", host,
+			"error", err,
+		)
+		return addr
+	}
+	return net.JoinHostPort(ips[g.randIntn(len(ips))], port)
+}
+
+// maybeDebugSamplePick logs every Nth pick at debug level with the full
+// candidate list when sampling is configured. Sampling keeps the line usable
+// for diagnosing skewed pick distribution in production without logging
+// every transit decision.
+func (g *GatewayLocator) maybeDebugSamplePick(dc, addr string, fromFallback bool, entries []gatewayEntry) {
+	if g.pickDebugSampleN <= 0 {
+		return
+	}
+	if atomic.AddUint64(&g.pickDebugCounter, 1)%uint64(g.pickDebugSampleN) != 0 {
+		return
+	}
+	g.logger.Debug("sampled mesh gateway pick",
+		"gateway", addr,
+		"source_datacenter", g.datacenter,
+		"dest_datacenter", dc,
+		"from_fallback", fromFallback,
+		"policy", g.selectionMode,
+		"candidates", formatGatewayAddrsForLog(entries),
+		"raft_index", atomic.LoadUint64(&g.lastFetchedIndex),
+	)
+}
+
+// pickGatewayMetricName is preallocated because reportGatewayPick sits on
+// the transit hot path.
+var pickGatewayMetricName = []string{"wanfed", "pick_gateway"}
+
+// reportGatewayPick counts one gateway selection, labeled by the destination
+// datacenter, which list served it, and whether the pick came back empty.
+// The picked address itself is only attached when pickMetricAddrLabel opted
+// in, since it multiplies the series cardinality by the gateway count.
+func (g *GatewayLocator) reportGatewayPick(dc string, primary bool, addr string) {
+	list := "local"
+	if primary {
+		list = "primary"
+	}
+	labels := make([]metrics.Label, 3, 4)
+	labels[0] = metrics.Label{Name: "datacenter", Value: dc}
+	labels[1] = metrics.Label{Name: "list", Value: list}
+	labels[2] = metrics.Label{Name: "empty", Value: strconv.FormatBool(addr == "")}
+	if g.pickMetricAddrLabel && addr != "" {
+		labels = append(labels, metrics.Label{Name: "gateway", Value: addr})
+	}
+	metrics.IncrCounterWithLabels(pickGatewayMetricName, 1, labels)
+}
+
+// PickGatewayErr is like PickGateway but returns a descriptive
+// NoMeshGatewaysAvailableError instead of an empty string when no gateway is
+// known, so that transit callers can surface something better than a generic
+// dial failure.
+func (g *GatewayLocator) PickGatewayErr(dc string) (string, error) {
+	return g.pickGatewayErrClass(dc, "")
+}
+
+// PickGatewayErrForGossip and PickGatewayErrForRPC are PickGatewayErr
+// variants that tag the pick with a traffic class. With a gossip tag filter
+// configured, gossip picks stick to the designated gateway subset and RPC
+// picks load-balance over the rest; without one they behave identically to
+// PickGatewayErr.
+func (g *GatewayLocator) PickGatewayErrForGossip(dc string) (string, error) {
+	return g.pickGatewayErrClass(dc, gatewayTrafficClassGossip)
+}
+
+func (g *GatewayLocator) PickGatewayErrForRPC(dc string) (string, error) {
+	return g.pickGatewayErrClass(dc, gatewayTrafficClassRPC)
+}
+
+func (g *GatewayLocator) pickGatewayErrClass(dc, class string) (string, error) {
+	primary := g.dialPrimary(dc)
+
+	picked := g.pickGatewayDetailedClass(dc, primary, class)
+	g.tracePick(dc, picked)
+	if picked.Addr == "" {
+		err := NoMeshGatewaysAvailableError{Datacenter: dc}
+		if primary {
+			err.FallbackEmpty = len(g.PrimaryGatewayFallbackAddresses()) == 0
+		}
+		return "", err
+	}
+
+	updated, meta := g.pickedProvenance(primary, picked.FromFallback)
+	g.logger.Trace("picking gateway for transit",
+		"gateway", picked.Addr,
+		"gateway_node", picked.NodeName,
+		"source_datacenter", g.datacenter,
+		"dest_datacenter", dc,
+		"from_fallback", picked.FromFallback,
+		"override", len(g.overrideAddrs(primary)) > 0,
+		"candidates", picked.CandidateCount,
+		"policy", g.selectionMode,
+		"traffic_class", class,
+		"list_source", meta.source,
+		"list_updated", updated,
+		"raft_index", meta.raftIndex,
+	)
+	return picked.Addr, nil
+}
+
+// PickGatewayContext is like PickGateway except that it blocks until either a
+// usable gateway address exists for the destination datacenter or the context
+// is cancelled. It wakes promptly when updateFromState or
+// RefreshPrimaryGatewayFallbackAddresses lands new addresses rather than
+// polling, which matters during secondary bootstrap when neither federation
+// state nor fallback addresses have arrived yet.
+func (g *GatewayLocator) PickGatewayContext(ctx context.Context, dc string) (string, error) {
+	primary := g.dialPrimary(dc)
+	for {
+		// Grab the notification channel before checking so that an update
+		// landing between the check and the select cannot be missed.
+		ch := g.addrUpdateNotifyCh()
+
+		if item := g.pickGateway(dc, primary); item != "" {
+			g.logger.Trace("picking gateway for transit", "gateway", item, "source_datacenter", g.datacenter, "dest_datacenter", dc)
+			return item, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-ch:
+		}
+	}
+}
+
+// PickGatewayFor returns the address of a gateway suitable for reaching the
+// provided datacenter, chosen by rendezvous (highest-random-weight) hashing
+// over the healthy addresses keyed by the caller-supplied string (typically
+// the destination server's node name). Repeated calls with the same key keep
+// returning the same gateway so the remote side can reuse connections, the
+// choice is unaffected by unrelated gateways being added or removed, and
+// when the chosen gateway disappears the hash gracefully lands on one of the
+// remaining addresses.
+func (g *GatewayLocator) PickGatewayFor(dc, key string) string {
+	addrs := g.listGateways(g.dialPrimary(dc))
+	item := getRendezvousItem(addrs, key)
+	g.logger.Trace("picking gateway for transit", "gateway", item, "source_datacenter", g.datacenter, "dest_datacenter", dc, "key", key)
+	return item
+}
+
+func getRendezvousItem(items []string, key string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	}
+
+	var (
+		best      string
+		bestScore uint64
+	)
+	for _, item := range items {
+		h := fnv.New64a()
+		h.Write([]byte(item))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		if score := h.Sum64(); best == "" || score > bestScore {
+			best = item
+			bestScore = score
+		}
+	}
+	return best
+}
+
+// notifyAddrUpdate wakes anyone blocked in PickGatewayContext by closing and
+// replacing the shared notification channel.
+func (g *GatewayLocator) notifyAddrUpdate() {
+	g.addrUpdateLock.Lock()
+	defer g.addrUpdateLock.Unlock()
+	close(g.addrUpdateCh)
+	g.addrUpdateCh = make(chan struct{})
+}
+
+func (g *GatewayLocator) addrUpdateNotifyCh() <-chan struct{} {
+	g.addrUpdateLock.Lock()
+	defer g.addrUpdateLock.Unlock()
+	return g.addrUpdateCh
+}
+
+// PickGateways returns the addresses of up to n distinct gateways suitable
+// for reaching the provided datacenter, in preference order, so that callers
+// can iterate candidates when a dial fails rather than re-picking and
+// possibly getting the same dead gateway back. Fewer than n addresses are
+// returned when not enough gateways are known.
+//
+// In round-robin mode the ordering is a deterministic rotation of the sorted
+// address list, which is also the mode to use when tests need predictable
+// output.
+func (g *GatewayLocator) PickGateways(dc string, n int) []string {
+	primary := g.dialPrimary(dc)
+
+	addrs := g.listGateways(primary)
+	if n > len(addrs) {
+		n = len(addrs)
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	var items []string
+	if g.selectionMode == GatewaySelectionModeRoundRobin {
+		rotor := &g.localRotor
+		if primary {
+			rotor = &g.primaryRotor
+		}
+		start := int((atomic.AddUint64(rotor, 1) - 1) % uint64(len(addrs)))
+
+		items = make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			items = append(items, addrs[(start+i)%len(addrs)])
+		}
+	} else {
+		shuffled := make([]string, len(addrs))
+		copy(shuffled, addrs)
+		g.randShuffle(shuffled)
+		items = shuffled[:n]
+	}
+
+	g.logger.Trace("picking gateways for transit", "gateways", items, "source_datacenter", g.datacenter, "dest_datacenter", dc)
+	return items
+}
+
+// PickGatewayExcluding is like PickGateway but removes the provided addresses
+// from the candidate set before selection, for retry loops that must not be
+// handed back the address that just failed. The exclusion applies after the
+// primary-fallback substitution, so retries also rotate through fallback
+// addresses. If every candidate is excluded the full set is used; retrying an
+// excluded gateway beats returning nothing.
+func (g *GatewayLocator) PickGatewayExcluding(dc string, exclude []string) string {
+	if len(exclude) == 0 {
+		return g.PickGateway(dc)
+	}
+
+	primary := g.dialPrimary(dc)
+	entries, _ := g.listGatewayEntries(primary)
+
+	filtered := make([]gatewayEntry, 0, len(entries))
+	for _, e := range entries {
+		if !lib.StrContains(exclude, e.addr) {
+			filtered = append(filtered, e)
+		}
+	}
+	if len(filtered) > 0 {
+		entries = filtered
+	}
+
+	item := g.pickFromEntries(dc, primary, entries)
+	g.logger.Trace("picking gateway for transit",
+		"gateway", item,
+		"source_datacenter", g.datacenter,
+		"dest_datacenter", dc,
+		"excluded", exclude,
+	)
+	return item
+}
+
+func (g *GatewayLocator) pickGateway(dc string, primary bool) string {
+	entries, _ := g.listGatewayEntries(primary)
+	return g.maybeResolveHostname(g.pickFromEntries(dc, primary, entries))
+}
+
+func (g *GatewayLocator) pickFromEntries(dc string, primary bool, entries []gatewayEntry) string {
+	if g.selectionMode == GatewaySelectionModeAffinity {
+		return g.getAffinityItem(dc, entries)
+	}
+
+	policy := g.localPolicy
+	if primary {
+		policy = g.primaryPolicy
+	}
+
+	switch g.selectionMode {
+	case GatewaySelectionModeRandom, GatewaySelectionModeWeighted:
+		return g.pickWithoutImmediateRepeat(primary, entries, policy)
+	case GatewaySelectionModeLastGood:
+		return g.getLastGoodItem(primary, entries, policy)
+	default:
+		return policy.Pick(entries)
+	}
+}
+
+// getLastGoodItem returns the address most recently reported as successful
+// for the destination class when it is still a valid candidate, and otherwise
+// defers to the provided policy. The last-good pointer is only ever set by
+// ReportGatewaySuccess, so a fallback pick here does not claim the slot.
+func (g *GatewayLocator) getLastGoodItem(primary bool, entries []gatewayEntry, policy selectionPolicy) string {
+	g.lastGoodLock.Lock()
+	lastGood := g.lastGoodLocal
+	if primary {
+		lastGood = g.lastGoodPrimary
+	}
+	g.lastGoodLock.Unlock()
+
+	if lastGood != "" {
+		for _, e := range entries {
+			if e.addr == lastGood {
+				return lastGood
+			}
+		}
+	}
+	return policy.Pick(entries)
+}
+
+// ReportGatewaySuccess records that a transit dial through the provided
+// gateway address succeeded. Beyond clearing failure tracking (see
+// MarkGatewaySucceeded) this remembers the address as the last known-good
+// gateway for its list, which the prefer_last_good selection mode consults.
+func (g *GatewayLocator) ReportGatewaySuccess(addr string) {
+	if addr == "" {
+		return
+	}
+
+	g.MarkGatewaySucceeded(addr)
+
+	g.gatewaysLock.Lock()
+	inPrimary := lib.StrContains(g.primaryGateways, addr)
+	inLocal := lib.StrContains(g.localGateways, addr)
+	g.gatewaysLock.Unlock()
+
+	g.lastGoodLock.Lock()
+	defer g.lastGoodLock.Unlock()
+	if inPrimary || !inLocal {
+		// fallback and override addresses are not in either list; treat
+		// them as primary since that is where fallback addresses apply
+		g.lastGoodPrimary = addr
+	}
+	if inLocal {
+		g.lastGoodLocal = addr
+	}
+}
+
+// pickWithoutImmediateRepeat draws from the candidates via the provided
+// policy, excluding the address handed out by the previous draw for the same
+// destination class when more than one candidate exists. This keeps a random
+// draw from returning the same gateway back-to-back, which matters most when
+// the caller is retrying after a failure.
+func (g *GatewayLocator) pickWithoutImmediateRepeat(primary bool, entries []gatewayEntry, policy selectionPolicy) string {
+	g.lastPickedLock.Lock()
+	defer g.lastPickedLock.Unlock()
+
+	last := &g.lastPickedLocal
+	if primary {
+		last = &g.lastPickedPrimary
+	}
+
+	candidates := entries
+	if len(entries) > 1 && *last != "" {
+		filtered := make([]gatewayEntry, 0, len(entries))
+		for _, e := range entries {
+			if e.addr != *last {
+				filtered = append(filtered, e)
+			}
+		}
+		if len(filtered) > 0 {
+			candidates = filtered
+		}
+	}
+
+	item := policy.Pick(candidates)
+	*last = item
+	return item
+}
+
+// getAffinityItem returns the remembered gateway for the destination
+// datacenter as long as it is still a valid candidate, and otherwise picks a
+// new one and remembers it.
+func (g *GatewayLocator) getAffinityItem(dc string, entries []gatewayEntry) string {
+	g.affinityLock.Lock()
+	defer g.affinityLock.Unlock()
+
+	if remembered, ok := g.affinity[dc]; ok {
+		for _, e := range entries {
+			if e.addr == remembered {
+				return remembered
+			}
+		}
+		delete(g.affinity, dc)
+	}
+
+	addr := weightedSelectionPolicy{intn: g.randIntn}.Pick(entries)
+	if addr != "" {
+		if g.affinity == nil {
+			g.affinity = make(map[string]string)
+		}
+		g.affinity[dc] = addr
+	}
+	return addr
+}
+
+// GatewayAffinity returns a copy of the current affinity table mapping
+// destination datacenters to the gateway address last handed out for them.
+// It is exposed for tests and troubleshooting.
+func (g *GatewayLocator) GatewayAffinity() map[string]string {
+	g.affinityLock.Lock()
+	defer g.affinityLock.Unlock()
+
+	out := make(map[string]string, len(g.affinity))
+	for dc, addr := range g.affinity {
+		out[dc] = addr
+	}
+	return out
+}
+
+func (g *GatewayLocator) listGateways(primary bool) []string {
+	entries, _ := g.listGatewayEntries(primary)
+	return gatewayAddrs(entries)
+}
+
+// GatewayInfo describes one mesh gateway the locator currently knows about,
+// for surfacing through operator endpoints and debug tooling.
+type GatewayInfo struct {
+	// Address is the host:port the locator would dial for this gateway.
+	Address string
+
+	// Datacenter is the datacenter the gateway provides transit into.
+	Datacenter string
+
+	// NodeName is the catalog node the gateway is registered on. Empty for
+	// addresses that did not come from the catalog.
+	NodeName string
+
+	// Health is the gateway's collapsed health status (api.HealthPassing or
+	// api.HealthWarning); critical gateways are never retained.
+	Health string
+
+	// FromFederationState is true when the address was derived from
+	// replicated federation state, and false when it came from the
+	// configured fallback addresses for the primary datacenter.
+	FromFederationState bool
+
+	// LastUpdated is when the list containing this gateway was last
+	// replaced.
+	LastUpdated time.Time
+
+	// Source names where the list containing this gateway came from: one
+	// of the GatewayListSource constants.
+	Source string
+
+	// RaftIndex is the raft index the list was derived from; zero for
+	// sources with no raft provenance (fallback, persisted cache).
+	RaftIndex uint64
+}
+
+// The provenance values exposed through GatewayInfo.Source and the operator
+// endpoint.
+const (
+	GatewayListSourceFederationState = "federation-state"
+	GatewayListSourceFallback        = "fallback"
+	GatewayListSourcePersistedCache  = "persisted-cache"
+)
+
+// gatewayListMeta records the provenance of a cached gateway list: the raft
+// index the addresses were derived from and which source last set them.
+type gatewayListMeta struct {
+	raftIndex uint64
+	source    string
+}
+
+// listProvenance returns the provenance of the requested list along with
+// when it last changed.
+func (g *GatewayLocator) listProvenance(primary bool) (time.Time, gatewayListMeta) {
+	g.gatewaysLock.Lock()
+	defer g.gatewaysLock.Unlock()
+	if primary {
+		return g.primaryGatewaysUpdated, g.primaryListMeta
+	}
+	return g.localGatewaysUpdated, g.localListMeta
+}
+
+// ListGateways returns a snapshot of the mesh gateways the locator currently
+// believes are usable for reaching the provided datacenter, before any
+// runtime failure or locality filtering is applied. The returned slice is a
+// copy; mutating it has no effect on the locator. Only this server's own
+// datacenter and the primary datacenter are known, so any other datacenter
+// yields nil.
+func (g *GatewayLocator) ListGateways(dc string) []GatewayInfo {
+	primary := dc == g.primaryDatacenter
+	if !primary && dc != g.datacenter {
+		return nil
+	}
+
+	g.gatewaysLock.Lock()
+	entries := g.localGatewayEntries
+	updated := g.localGatewaysUpdated
+	meta := g.localListMeta
+	if primary {
+		entries = g.primaryGatewayEntries
+		updated = g.primaryGatewaysUpdated
+		meta = g.primaryListMeta
+	}
+
+	out := make([]GatewayInfo, 0, len(entries))
+	for _, e := range entries {
+		out = append(out, GatewayInfo{
+			Address:             e.addr,
+			Datacenter:          dc,
+			NodeName:            e.node,
+			Health:              e.health,
+			FromFederationState: true,
+			LastUpdated:         updated,
+			Source:              meta.source,
+			RaftIndex:           meta.raftIndex,
+		})
+	}
+	g.gatewaysLock.Unlock()
+
+	if primary && len(out) == 0 {
+		g.primaryMeshGatewayDiscoveredAddressesLock.Lock()
+		for _, addr := range g.primaryMeshGatewayDiscoveredAddresses {
+			health := api.HealthPassing
+			if g.fallbackUnreachable[addr] {
+				// flagged by the reachability prober
+				health = api.HealthWarning
+			}
+			out = append(out, GatewayInfo{
+				Address:     addr,
+				Datacenter:  dc,
+				Health:      health,
+				LastUpdated: g.primaryFallbackUpdated,
+				Source:      GatewayListSourceFallback,
+			})
+		}
+		g.primaryMeshGatewayDiscoveredAddressesLock.Unlock()
+	}
+
+	return out
+}
+
+// listGatewayEntries returns the current selection candidates for the
+// requested list. The second return value is true when the entries came from
+// the configured primary fallback addresses rather than federation state.
+func (g *GatewayLocator) listGatewayEntries(primary bool) ([]gatewayEntry, bool) {
+	if addrs := g.overrideAddrs(primary); len(addrs) > 0 {
+		// overrides are used verbatim; the catalog-derived lists are
+		// ignored entirely while one is configured
+		entries := entriesFromAddrs(addrs)
+		entries = applyAddressFamilyPreference(entries, g.addressFamily)
+		entries = g.filterRecentlyFailed(entries)
+		return g.filterOpenBreakers(entries), false
+	}
+
+	g.gatewaysLock.Lock()
+
+	var entries []gatewayEntry
+	if primary {
+		entries = g.primaryGatewayEntries
+		if len(g.primarySameZoneEntries) > 0 {
+			entries = g.primarySameZoneEntries
+		}
+		if len(entries) == 0 {
+			// degrade gracefully if only the bare address list is populated
+			entries = entriesFromAddrs(g.primaryGateways)
+		}
+		if len(entries) == 0 {
+			// last known addresses persisted across restarts
+			entries = entriesFromAddrs(g.persistedPrimaryGateways)
+		}
+	} else {
+		entries = g.localGatewayEntries
+		if len(g.localSameZoneEntries) > 0 {
+			entries = g.localSameZoneEntries
+		}
+		if len(entries) == 0 {
+			entries = entriesFromAddrs(g.localGateways)
+		}
+		if len(entries) == 0 {
+			// last known addresses persisted across restarts
+			entries = entriesFromAddrs(g.persistedLocalGateways)
+		}
+	}
+	g.gatewaysLock.Unlock()
+
+	fromFallback := false
+	if primary && len(entries) == 0 {
+		// fallback addresses have no catalog data behind them
+		entries = entriesFromAddrs(g.preferReachableFallbackAddrs(g.PrimaryGatewayFallbackAddresses()))
+		fromFallback = len(entries) > 0
+	}
+
+	entries = applyAddressFamilyPreference(entries, g.addressFamily)
+	entries = g.filterRecentlyFailed(entries)
+	entries = g.filterOpenBreakers(entries)
+	entries = g.filterSaturatedGateways(entries)
+	return g.preferLocalNodeEntries(entries), fromFallback
+}
+
+// filterSaturatedGateways removes gateways whose outstanding transit
+// connection count has reached their advertised capacity (the wanfed
+// max-conns service meta). Gateways advertising no capacity are never
+// considered saturated. If every gateway with known capacity is saturated the
+// original list is returned unchanged and a warning is logged; an overloaded
+// gateway still beats no gateway.
+func (g *GatewayLocator) filterSaturatedGateways(entries []gatewayEntry) []gatewayEntry {
+	if len(entries) < 2 {
+		return entries
+	}
+
+	anyLimited := false
+	filtered := make([]gatewayEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.maxConns > 0 {
+			anyLimited = true
+			if g.gatewayConnCount(e.addr) >= e.maxConns {
+				continue
+			}
+		}
+		filtered = append(filtered, e)
+	}
+
+	if len(filtered) == 0 {
+		g.logger.Warn("all mesh gateways are at their advertised wanfed connection capacity; selecting among them anyway")
+		return entries
+	}
+	if anyLimited {
+		return filtered
+	}
+	return entries
+}
+
+// preferLocalNodeEntries narrows the candidates to gateways registered on
+// this server's own catalog node when that preference is enabled and at
+// least one such gateway survived the health and failure filters. A
+// co-located gateway that is critical or recently failed never reaches this
+// point, so normal selection applies for it.
+func (g *GatewayLocator) preferLocalNodeEntries(entries []gatewayEntry) []gatewayEntry {
+	if !g.preferLocalNode || g.nodeName == "" {
+		return entries
+	}
+
+	same := make([]gatewayEntry, 0, 1)
+	for _, e := range entries {
+		if e.node == g.nodeName {
+			same = append(same, e)
+		}
+	}
+	if len(same) == 0 {
+		return entries
+	}
+	return same
+}
+
+// MarkGatewayFailed records that a transit dial through the provided gateway
+// address failed, so that subsequent picks deprioritize the address for the
+// configured cooldown window while alternatives exist.
+func (g *GatewayLocator) MarkGatewayFailed(addr string, err error) {
+	if addr == "" {
+		return
+	}
+
+	g.failedLock.Lock()
+	if g.failedGateways == nil {
+		g.failedGateways = make(map[string]time.Time)
+	}
+	g.failedGateways[addr] = time.Now()
+	g.failedLock.Unlock()
+
+	g.recordBreakerFailure(addr)
+
+	g.affinityLock.Lock()
+	for dc, remembered := range g.affinity {
+		if remembered == addr {
+			delete(g.affinity, dc)
+		}
+	}
+	g.affinityLock.Unlock()
+
+	g.lastGoodLock.Lock()
+	if g.lastGoodPrimary == addr {
+		g.lastGoodPrimary = ""
+	}
+	if g.lastGoodLocal == addr {
+		g.lastGoodLocal = ""
+	}
+	g.lastGoodLock.Unlock()
+
+	g.logger.Warn("marking mesh gateway as recently failed for transit",
+		"gateway", addr,
+		"error", err,
+		"cooldown", g.failureCooldown.String(),
+	)
+}
+
+// MarkGatewaySucceeded records that a transit dial through the provided
+// gateway address succeeded, clearing any failure record and closing the
+// address's circuit breaker.
+func (g *GatewayLocator) MarkGatewaySucceeded(addr string) {
+	if addr == "" {
+		return
+	}
+
+	g.failedLock.Lock()
+	delete(g.failedGateways, addr)
+	g.failedLock.Unlock()
+
+	g.breakerLock.Lock()
+	defer g.breakerLock.Unlock()
+
+	b, ok := g.breakers[addr]
+	if !ok {
+		return
+	}
+	if b.state == breakerHalfOpen {
+		metrics.IncrCounterWithLabels([]string{"wanfed", "gateway", "breaker", "close"}, 1,
+			[]metrics.Label{{Name: "gateway", Value: addr}})
+		g.logger.Info("mesh gateway circuit breaker closed", "gateway", addr)
+	}
+	delete(g.breakers, addr)
+}
+
+// IncGatewayConns records that a transit connection through the provided
+// gateway address was established. The connection pool calls this so that the
+// least-connections selection mode can steer new connections toward lightly
+// loaded gateways.
+func (g *GatewayLocator) IncGatewayConns(addr string) {
+	if addr == "" {
+		return
+	}
+
+	g.connsLock.Lock()
+	defer g.connsLock.Unlock()
+
+	if g.gatewayConns == nil {
+		g.gatewayConns = make(map[string]int)
+	}
+	g.gatewayConns[addr]++
+}
+
+// DecGatewayConns records that a transit connection through the provided
+// gateway address was closed.
+func (g *GatewayLocator) DecGatewayConns(addr string) {
+	if addr == "" {
+		return
+	}
+
+	g.connsLock.Lock()
+	defer g.connsLock.Unlock()
+
+	if n, ok := g.gatewayConns[addr]; ok {
+		if n <= 1 {
+			delete(g.gatewayConns, addr)
+		} else {
+			g.gatewayConns[addr] = n - 1
+		}
+	}
+}
+
+// gatewayConnCount returns the number of outstanding transit connections
+// reported for the provided gateway address.
+func (g *GatewayLocator) gatewayConnCount(addr string) int {
+	g.connsLock.Lock()
+	defer g.connsLock.Unlock()
+	return g.gatewayConns[addr]
+}
+
+// recordBreakerFailure advances the circuit breaker for the provided address
+// in response to a reported dial failure.
+func (g *GatewayLocator) recordBreakerFailure(addr string) {
+	g.breakerLock.Lock()
+	defer g.breakerLock.Unlock()
+
+	if g.breakers == nil {
+		g.breakers = make(map[string]*gatewayBreaker)
+	}
+	b, ok := g.breakers[addr]
+	if !ok {
+		b = &gatewayBreaker{}
+		g.breakers[addr] = b
+	}
+
+	b.consecutiveFailures++
+	b.lastFailure = time.Now()
+
+	switch b.state {
+	case breakerHalfOpen:
+		// the probe failed; re-open
+		b.state = breakerOpen
+		b.probeStarted = time.Time{}
+		metrics.IncrCounterWithLabels([]string{"wanfed", "gateway", "breaker", "open"}, 1,
+			[]metrics.Label{{Name: "gateway", Value: addr}})
+		g.logger.Warn("mesh gateway circuit breaker re-opened after failed probe", "gateway", addr)
+	case breakerClosed:
+		if b.consecutiveFailures >= g.breakerThreshold {
+			b.state = breakerOpen
+			metrics.IncrCounterWithLabels([]string{"wanfed", "gateway", "breaker", "open"}, 1,
+				[]metrics.Label{{Name: "gateway", Value: addr}})
+			g.logger.Warn("mesh gateway circuit breaker opened",
+				"gateway", addr,
+				"consecutive_failures", b.consecutiveFailures,
+			)
+		}
+	}
+}
+
+// filterOpenBreakers removes addresses whose circuit breaker is OPEN from the
+// candidate list, transitioning breakers to HALF-OPEN (and letting exactly
+// one probe pick through) once their cooldown has passed. If every candidate
+// is excluded the original list is returned unchanged.
+func (g *GatewayLocator) filterOpenBreakers(entries []gatewayEntry) []gatewayEntry {
+	g.breakerLock.Lock()
+	defer g.breakerLock.Unlock()
+
+	if len(g.breakers) == 0 || len(entries) < 2 {
+		return entries
+	}
+
+	now := time.Now()
+
+	permitted := func(addr string) bool {
+		b, ok := g.breakers[addr]
+		if !ok || b.state == breakerClosed {
+			return true
+		}
+
+		if b.state == breakerOpen {
+			if now.Sub(b.lastFailure) < g.breakerCooldown {
+				return false
+			}
+			b.state = breakerHalfOpen
+			b.probeStarted = now
+			metrics.IncrCounterWithLabels([]string{"wanfed", "gateway", "breaker", "half-open"}, 1,
+				[]metrics.Label{{Name: "gateway", Value: addr}})
+			g.logger.Info("mesh gateway circuit breaker half-open; allowing one probe", "gateway", addr)
+			return true
+		}
+
+		// HALF-OPEN: only one outstanding probe is allowed, but if the
+		// outcome of a probe is never reported allow another after the
+		// cooldown rather than starving the address forever.
+		if now.Sub(b.probeStarted) >= g.breakerCooldown {
+			b.probeStarted = now
+			return true
+		}
+		return false
+	}
+
+	filtered := make([]gatewayEntry, 0, len(entries))
+	for _, e := range entries {
+		if permitted(e.addr) {
+			filtered = append(filtered, e)
+		}
+	}
+
+	if len(filtered) == 0 {
+		return entries
+	}
+	return filtered
+}
+
+// filterRecentlyFailed removes addresses recorded by MarkGatewayFailed from
+// the candidate list. If every candidate recently failed the original list is
+// returned unchanged; retrying a failed gateway beats returning nothing.
+func (g *GatewayLocator) filterRecentlyFailed(entries []gatewayEntry) []gatewayEntry {
+	g.failedLock.Lock()
+	defer g.failedLock.Unlock()
+
+	if len(g.failedGateways) == 0 || len(entries) < 2 {
+		return entries
+	}
+
+	now := time.Now()
+	for addr, failedAt := range g.failedGateways {
+		if now.Sub(failedAt) > g.failureCooldown {
+			delete(g.failedGateways, addr)
+		}
+	}
+	if len(g.failedGateways) == 0 {
+		return entries
+	}
+
+	filtered := make([]gatewayEntry, 0, len(entries))
+	for _, e := range entries {
+		if _, failed := g.failedGateways[e.addr]; failed {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+
+	if len(filtered) == 0 {
+		return entries
+	}
+	return filtered
+}
+
+// clearFailedGatewaysLocked drops failure records and circuit breakers for
+// addresses that are no longer present in either rendered list. A gateway
+// that goes critical falls out of the lists entirely, so by the time its
+// health flips back and it reappears the stale records have already been
+// discarded.
+//
+// The caller must hold gatewaysLock.
+func (g *GatewayLocator) clearFailedGatewaysLocked() {
+	known := make(map[string]struct{}, len(g.primaryGateways)+len(g.localGateways))
+	for _, addr := range g.primaryGateways {
+		known[addr] = struct{}{}
+	}
+	for _, addr := range g.localGateways {
+		known[addr] = struct{}{}
+	}
+
+	g.failedLock.Lock()
+	for addr := range g.failedGateways {
+		if _, ok := known[addr]; !ok {
+			delete(g.failedGateways, addr)
+		}
+	}
+	g.failedLock.Unlock()
+
+	g.breakerLock.Lock()
+	for addr := range g.breakers {
+		if _, ok := known[addr]; !ok {
+			delete(g.breakers, addr)
+		}
+	}
+	g.breakerLock.Unlock()
+
+	g.affinityLock.Lock()
+	for dc, addr := range g.affinity {
+		if _, ok := known[addr]; !ok {
+			delete(g.affinity, dc)
+		}
+	}
+	g.affinityLock.Unlock()
+
+	g.connsLock.Lock()
+	for addr := range g.gatewayConns {
+		if _, ok := known[addr]; !ok {
+			delete(g.gatewayConns, addr)
+		}
+	}
+	g.connsLock.Unlock()
+
+	g.lastGoodLock.Lock()
+	if _, ok := known[g.lastGoodPrimary]; !ok {
+		g.lastGoodPrimary = ""
+	}
+	if _, ok := known[g.lastGoodLocal]; !ok {
+		g.lastGoodLocal = ""
+	}
+	g.lastGoodLock.Unlock()
+}
+
+// SetGatewayAddressOverrides replaces the static per-datacenter gateway
+// address overrides, such as during a config reload. Overrides that newly
+// take effect are logged so operators can tell the catalog is being ignored
+// for those datacenters.
+func (g *GatewayLocator) SetGatewayAddressOverrides(overrides map[string][]string) {
+	copied := make(map[string][]string, len(overrides))
+	for dc, addrs := range overrides {
+		if len(addrs) == 0 {
+			continue
+		}
+		dup := make([]string, len(addrs))
+		copy(dup, addrs)
+		sort.Strings(dup)
+		copied[dc] = dup
+	}
+
+	g.overridesLock.Lock()
+	changed := len(copied) != len(g.addressOverrides)
+	if !changed {
+		for dc, addrs := range copied {
+			if !lib.StringSliceEqual(addrs, g.addressOverrides[dc]) {
+				changed = true
+				break
+			}
+		}
+	}
+	g.addressOverrides = copied
+	g.overridesLock.Unlock()
+
+	if !changed {
+		return
+	}
+
+	for dc, addrs := range copied {
+		g.logger.Info("using static mesh gateway addresses for datacenter",
+			"datacenter", dc,
+			"mesh_gateways", addrs,
+		)
+	}
+	g.notifyAddrUpdate()
+}
+
+// overrideAddrs returns the configured static addresses for the datacenter
+// backing the requested list, if any.
+func (g *GatewayLocator) overrideAddrs(primary bool) []string {
+	dc := g.datacenter
+	if primary {
+		dc = g.primaryDatacenter
+	}
+
+	g.overridesLock.Lock()
+	defer g.overridesLock.Unlock()
+	return g.addressOverrides[dc]
+}
+
+// RefreshPrimaryGatewayFallbackAddresses is used to update the list of current
+// fallback addresses for locating mesh gateways in the primary datacenter.
+// Malformed host:port strings are rejected with an error log rather than
+// stored, since a garbage fallback address would only surface later as a
+// confusing dial failure.
+func (g *GatewayLocator) RefreshPrimaryGatewayFallbackAddresses(addrs []string) {
+	valid := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if err := validateGatewayAddr(addr); err != nil {
+			g.logger.Error("ignoring malformed primary mesh gateway fallback address",
+				"address", addr,
+				"error", err,
+			)
+			continue
+		}
+		valid = append(valid, addr)
+	}
+	addrs = valid
+
+	sort.Strings(addrs)
+
+	g.primaryMeshGatewayDiscoveredAddressesLock.Lock()
+	defer g.primaryMeshGatewayDiscoveredAddressesLock.Unlock()
+
+	if !lib.StringSliceEqual(addrs, g.primaryMeshGatewayDiscoveredAddresses) {
+		added, removed := diffGatewayAddrs(g.primaryMeshGatewayDiscoveredAddresses, addrs)
+		g.primaryMeshGatewayDiscoveredAddresses = addrs
+		g.primaryFallbackUpdated = time.Now()
+		g.logger.Info("updated fallback list of primary mesh gateways",
+			"added", added,
+			"removed", removed,
+		)
+		g.logger.Debug("current fallback list of primary mesh gateways", "mesh_gateways", addrs)
+		g.notifyAddrUpdate()
+	}
+
+	reportFallbackGatewayGauge(len(addrs))
+}
+
+// PrimaryGatewayFallbackAddresses returns the current set of discovered
+// fallback addresses for the mesh gateways in the primary datacenter.
+func (g *GatewayLocator) PrimaryGatewayFallbackAddresses() []string {
+	g.primaryMeshGatewayDiscoveredAddressesLock.Lock()
+	defer g.primaryMeshGatewayDiscoveredAddressesLock.Unlock()
+
+	out := make([]string, len(g.primaryMeshGatewayDiscoveredAddresses))
+	copy(out, g.primaryMeshGatewayDiscoveredAddresses)
+	return out
+}
+
+// persistedGatewayAddresses is the JSON payload stored in the gateway cache
+// file under the data dir.
+type persistedGatewayAddresses struct {
+	PrimaryGateways []string `json:",omitempty"`
+	LocalGateways   []string `json:",omitempty"`
+	UpdatedAt       time.Time
+}
+
+// loadPersistedGatewayAddresses seeds the locator's last-known address tier
+// from the gateway cache file, if one exists. After a full restart of a
+// secondary's servers this is the only way to reach the primary without a
+// configured fallback list, since federation state replication itself needs a
+// gateway to tunnel through. Corrupt or stale files are ignored with a
+// warning.
+func (g *GatewayLocator) loadPersistedGatewayAddresses() {
+	if g.cacheFilePath == "" {
+		return
+	}
+
+	buf, err := ioutil.ReadFile(g.cacheFilePath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			g.logger.Warn("ignoring unreadable mesh gateway cache file",
+				"path", g.cacheFilePath,
+				"error", err,
+			)
+		}
+		return
+	}
+
+	var p persistedGatewayAddresses
+	if err := json.Unmarshal(buf, &p); err != nil {
+		g.logger.Warn("ignoring corrupt mesh gateway cache file",
+			"path", g.cacheFilePath,
+			"error", err,
+		)
+		return
+	}
+	if age := time.Since(p.UpdatedAt); age > g.cacheTTL {
+		g.logger.Warn("ignoring stale mesh gateway cache file",
+			"path", g.cacheFilePath,
+			"age", age,
+		)
+		return
+	}
+
+	g.gatewaysLock.Lock()
+	g.persistedPrimaryGateways = p.PrimaryGateways
+	g.persistedLocalGateways = p.LocalGateways
+	// Until fresh federation state arrives, anything served from these
+	// addresses traces back to the cache file.
+	if len(p.PrimaryGateways) > 0 {
+		g.primaryListMeta = gatewayListMeta{source: GatewayListSourcePersistedCache}
+	}
+	if len(p.LocalGateways) > 0 {
+		g.localListMeta = gatewayListMeta{source: GatewayListSourcePersistedCache}
+	}
+	g.gatewaysLock.Unlock()
+
+	if len(p.PrimaryGateways) > 0 || len(p.LocalGateways) > 0 {
+		g.logger.Info("loaded last known mesh gateway addresses",
+			"primary", len(p.PrimaryGateways),
+			"local", len(p.LocalGateways),
+		)
+		g.notifyAddrUpdate()
+	}
+}
+
+// persistGatewayAddressesLocked writes the last known non-empty gateway
+// address lists to the cache file so a restarted server can dial out before
+// federation state replication catches up. Persistence failures only warn:
+// the cache is an optimization, not a source of truth.
+func (g *GatewayLocator) persistGatewayAddressesLocked() {
+	if g.cacheFilePath == "" {
+		return
+	}
+
+	p := persistedGatewayAddresses{
+		PrimaryGateways: g.persistedPrimaryGateways,
+		LocalGateways:   g.persistedLocalGateways,
+		UpdatedAt:       time.Now().UTC(),
+	}
+	if len(p.PrimaryGateways) == 0 && len(p.LocalGateways) == 0 {
+		return
+	}
+
+	buf, err := json.Marshal(&p)
+	if err != nil {
+		g.logger.Warn("failed to encode mesh gateway cache file", "error", err)
+		return
+	}
+	if err := file.WriteAtomic(g.cacheFilePath, buf); err != nil {
+		g.logger.Warn("failed to persist mesh gateway addresses",
+			"path", g.cacheFilePath,
+			"error", err,
+		)
+	}
+}
+
+// runFallbackProbeLoop periodically TCP-probes the primary gateway fallback
+// addresses so that selection can steer around dead hosts while operating
+// purely from discovered addresses. Only started when
+// Config.GatewayFallbackProbeEnabled is set.
+func (g *GatewayLocator) runFallbackProbeLoop(stopCh <-chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(g.fallbackProbeInterval):
+		}
+		g.probeFallbackAddrs()
+	}
+}
+
+// probeFallbackAddrs performs one reachability pass over the current fallback
+// addresses, recording which of them failed a short TCP dial. Transitions are
+// logged; steady state is quiet.
+func (g *GatewayLocator) probeFallbackAddrs() {
+	addrs := g.PrimaryGatewayFallbackAddresses()
+
+	results := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		results[addr] = g.probeGatewayAddr(addr) != nil
+	}
+
+	g.primaryMeshGatewayDiscoveredAddressesLock.Lock()
+	prev := g.fallbackUnreachable
+	g.fallbackUnreachable = results
+	g.primaryMeshGatewayDiscoveredAddressesLock.Unlock()
+
+	for _, addr := range addrs {
+		if results[addr] == prev[addr] {
+			continue
+		}
+		if results[addr] {
+			g.logger.Warn("primary mesh gateway fallback address failed reachability probe",
+				"address", addr,
+			)
+		} else {
+			g.logger.Info("primary mesh gateway fallback address is reachable again",
+				"address", addr,
+			)
+		}
+	}
+}
+
+func (g *GatewayLocator) probeGatewayAddr(addr string) error {
+	if g.probeDialFn != nil {
+		return g.probeDialFn(addr, g.fallbackProbeTimeout)
+	}
+	conn, err := net.DialTimeout("tcp", addr, g.fallbackProbeTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// preferReachableFallbackAddrs filters the fallback address list down to the
+// addresses that passed their most recent TCP reachability probe. When the
+// prober is disabled, has not run yet, or found nothing reachable the list is
+// returned unchanged: an unprobed or unreachable address still beats none.
+func (g *GatewayLocator) preferReachableFallbackAddrs(addrs []string) []string {
+	if !g.fallbackProbeEnabled || len(addrs) < 2 {
+		return addrs
+	}
+
+	g.primaryMeshGatewayDiscoveredAddressesLock.Lock()
+	defer g.primaryMeshGatewayDiscoveredAddressesLock.Unlock()
+
+	if len(g.fallbackUnreachable) == 0 {
+		return addrs
+	}
+
+	reachable := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if !g.fallbackUnreachable[addr] {
+			reachable = append(reachable, addr)
+		}
+	}
+	if len(reachable) == 0 {
+		return addrs
+	}
+	return reachable
+}
+
+// diffGatewayAddrs returns the addresses present only in next (added) and
+// only in prev (removed), each sorted, so refresh logs can show what actually
+// changed rather than two full lists to eyeball.
+func diffGatewayAddrs(prev, next []string) (added, removed []string) {
+	prevSet := make(map[string]struct{}, len(prev))
+	for _, addr := range prev {
+		prevSet[addr] = struct{}{}
+	}
+	nextSet := make(map[string]struct{}, len(next))
+	for _, addr := range next {
+		nextSet[addr] = struct{}{}
+	}
+
+	for addr := range nextSet {
+		if _, ok := prevSet[addr]; !ok {
+			added = append(added, addr)
+		}
+	}
+	for addr := range prevSet {
+		if _, ok := nextSet[addr]; !ok {
+			removed = append(removed, addr)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
+
+// validateGatewayAddr checks that an externally supplied gateway address is a
+// dialable host:port, rejecting out-of-range ports, failed IP literals, and
+// hostnames that can never resolve.
+func validateGatewayAddr(addr string) error {
+	return lib.ValidateDialAddress(addr)
+}
+
+// randIntn returns a random int in [0, n) from the locator's private source.
+func (g *GatewayLocator) randIntn(n int) int {
+	g.randLock.Lock()
+	defer g.randLock.Unlock()
+	return g.rand.Intn(n)
+}
+
+// randShuffle shuffles the provided slice using the locator's private source.
+func (g *GatewayLocator) randShuffle(items []string) {
+	g.randLock.Lock()
+	defer g.randLock.Unlock()
+	g.rand.Shuffle(len(items), func(i, j int) {
+		items[i], items[j] = items[j], items[i]
+	})
+}
+
+type serverDelegate interface {
+	blockingQuery(queryOpts structs.QueryOptionsCompat, queryMeta structs.QueryMetaCompat, fn queryFn) error
+	PrimaryGatewayFallbackAddresses() []string
+	IsLeader() bool
+	LeaderLastContact() time.Time
+}
+
+func NewGatewayLocator(
+	logger hclog.Logger,
+	srv serverDelegate,
+	config *Config,
+) *GatewayLocator {
+	return newGatewayLocator(logger, srv, config, nil)
+}
+
+// newGatewayLocator is like NewGatewayLocator but additionally accepts the
+// random source used for gateway selection, so that tests can verify the
+// selection distribution deterministically. A nil source means "seed one
+// from crypto/rand".
+func newGatewayLocator(
+	logger hclog.Logger,
+	srv serverDelegate,
+	config *Config,
+	randSource rand.Source,
+) *GatewayLocator {
+	if randSource == nil {
+		randSource = newGatewaySelectionRandSource()
+	}
+
+	selectionMode := config.GatewaySelectionMode
+	if selectionMode == "" {
+		selectionMode = GatewaySelectionModeWeighted
+	}
+
+	failureCooldown := config.GatewayFailureCooldown
+	if failureCooldown <= 0 {
+		failureCooldown = defaultGatewayFailureCooldown
+	}
+
+	breakerThreshold := config.GatewayBreakerThreshold
+	if breakerThreshold <= 0 {
+		breakerThreshold = defaultGatewayBreakerThreshold
+	}
+
+	breakerCooldown := config.GatewayBreakerCooldown
+	if breakerCooldown <= 0 {
+		breakerCooldown = defaultGatewayBreakerCooldown
+	}
+
+	warningMode := config.GatewayWarningMode
+	if warningMode == "" {
+		warningMode = GatewayWarningModeAllow
+	}
+
+	warningWeightPercent := config.GatewayWarningWeightPercent
+	if warningWeightPercent <= 0 {
+		warningWeightPercent = defaultGatewayWarningWeightPercent
+	}
+
+	protocolVersion := config.GatewayProtocolVersion
+	if protocolVersion <= 0 {
+		protocolVersion = defaultGatewayProtocolVersion
+	}
+
+	checkScope := config.GatewayCheckScope
+	if checkScope == "" {
+		checkScope = GatewayCheckScopeAll
+	}
+
+	staleThreshold := config.GatewayFederationStateStaleThreshold
+	if staleThreshold == 0 {
+		staleThreshold = defaultGatewayFederationStateStaleThreshold
+	}
+
+	probeInterval := config.GatewayFallbackProbeInterval
+	if probeInterval <= 0 {
+		probeInterval = defaultGatewayFallbackProbeInterval
+	}
+
+	probeTimeout := config.GatewayFallbackProbeTimeout
+	if probeTimeout <= 0 {
+		probeTimeout = defaultGatewayFallbackProbeTimeout
+	}
+
+	cacheTTL := config.GatewayCacheTTL
+	if cacheTTL <= 0 {
+		cacheTTL = defaultGatewayCacheTTL
+	}
+
+	var cacheFilePath string
+	if config.DataDir != "" {
+		cacheFilePath = filepath.Join(config.DataDir, gatewayCacheFileName)
+	}
+
+	locatorLogger := logger.Named(logging.GatewayLocator)
+
+	tracer := config.GatewayTracer
+	if tracer == nil {
+		tracer = wanfed.NoopTracer{}
+	}
+
+	maxQueryTime := config.GatewayMaxQueryTime
+	if maxQueryTime < 0 {
+		maxQueryTime = 0
+	}
+	if config.MaxQueryTime > 0 && maxQueryTime > config.MaxQueryTime {
+		// blockingQuery would clamp this anyway; doing it here keeps the
+		// effective value inspectable.
+		maxQueryTime = config.MaxQueryTime
+	}
+
+	coalesceWindow := config.GatewayUpdateCoalesceWindow
+	if coalesceWindow == 0 {
+		coalesceWindow = defaultGatewayUpdateCoalesceWindow
+	} else if coalesceWindow < 0 {
+		coalesceWindow = 0
+	}
+
+	fallbackOnlyTimeout := config.GatewayFallbackOnlyModeTimeout
+	if fallbackOnlyTimeout == 0 {
+		fallbackOnlyTimeout = defaultGatewayFallbackOnlyModeTimeout
+	} else if fallbackOnlyTimeout < 0 {
+		fallbackOnlyTimeout = 0
+	}
+
+	backoff := defaultBackoffPolicy()
+	if config.GatewayRetryInitialBackoff > 0 {
+		backoff.initial = config.GatewayRetryInitialBackoff
+	}
+	if config.GatewayRetryBackoffMultiplier > 0 {
+		backoff.multiplier = config.GatewayRetryBackoffMultiplier
+	}
+	if config.GatewayRetryMaxBackoff > 0 {
+		backoff.max = config.GatewayRetryMaxBackoff
+	}
+	if config.GatewayRetryBackoffJitter > 0 {
+		backoff.jitter = config.GatewayRetryBackoffJitter
+	}
+
+	g := &GatewayLocator{
+		logger:                 locatorLogger,
+		runErrLogger:           logging.NewThrottledLogger(locatorLogger, gatewayRunErrorLogWindow),
+		tracer:                 tracer,
+		backoff:                backoff,
+		maxQueryTime:           maxQueryTime,
+		coalesceWindow:         coalesceWindow,
+		fallbackOnlyTimeout:    fallbackOnlyTimeout,
+		resolveHostnames:       config.GatewayResolveHostnames,
+		lookupHost:             net.LookupHost,
+		srv:                    srv,
+		datacenter:             config.Datacenter,
+		primaryDatacenter:      config.PrimaryDatacenter,
+		nodeName:               config.NodeName,
+		preferLocalNode:        config.GatewayPreferLocalNode,
+		useWANAddrsForLocal:    config.GatewayUseWANAddressForLocalGateways,
+		segment:                config.Segment,
+		selectionMode:          selectionMode,
+		addressFamily:          config.GatewayAddressFamily,
+		maxPerDC:               config.GatewayMaxPerDatacenter,
+		shuffleSeed:            gatewayShuffleSeed(config),
+		tagFilter:              config.GatewayTagFilter,
+		gossipTagFilter:        config.GatewayGossipTagFilter,
+		localityMetaKey:        config.GatewayLocalityMetaKey,
+		locality:               config.GatewayLocality,
+		warningMode:            warningMode,
+		warningWeightPercent:   warningWeightPercent,
+		staleThreshold:         staleThreshold,
+		metricsInterval:        config.GatewayMetricsInterval,
+		pickMetricAddrLabel:    config.GatewayPickMetricAddrLabelEnabled,
+		pickDebugSampleN:       config.GatewayPickDebugSampleRate,
+		fallbackProbeEnabled:   config.GatewayFallbackProbeEnabled,
+		fallbackProbeInterval:  probeInterval,
+		fallbackProbeTimeout:   probeTimeout,
+		cacheFilePath:          cacheFilePath,
+		cacheTTL:               cacheTTL,
+		checkScope:             checkScope,
+		protocolVersion:        protocolVersion,
+		failureCooldown:        failureCooldown,
+		breakerThreshold:       breakerThreshold,
+		breakerCooldown:        breakerCooldown,
+		rand:                   rand.New(randSource),
+		primaryGatewaysReadyCh: make(chan struct{}),
+		addrUpdateCh:           make(chan struct{}),
+		forceRefreshCh:         make(chan struct{}, 1),
+		localStateMissingCh:    make(chan struct{}, 1),
+		doneCh:                 make(chan struct{}),
+	}
+
+	if len(config.GatewayAddressOverrides) > 0 {
+		g.SetGatewayAddressOverrides(config.GatewayAddressOverrides)
+	}
+
+	if g.useWANAddrsForLocal {
+		g.logger.Info("using WAN addresses to dial local mesh gateways")
+	}
+
+	switch selectionMode {
+	case GatewaySelectionModeRandom:
+		g.primaryPolicy = randomSelectionPolicy{intn: g.randIntn}
+		g.localPolicy = randomSelectionPolicy{intn: g.randIntn}
+	case GatewaySelectionModeRoundRobin:
+		g.primaryPolicy = &roundRobinSelectionPolicy{rotor: &g.primaryRotor}
+		g.localPolicy = &roundRobinSelectionPolicy{rotor: &g.localRotor}
+	case GatewaySelectionModeLeastConns:
+		g.primaryPolicy = leastConnsSelectionPolicy{conns: g.gatewayConnCount, intn: g.randIntn}
+		g.localPolicy = leastConnsSelectionPolicy{conns: g.gatewayConnCount, intn: g.randIntn}
+	case GatewaySelectionModeShuffledRoundRobin:
+		g.primaryPolicy = &shuffledRoundRobinSelectionPolicy{seed: g.shuffleSeed, rotor: &g.primaryRotor}
+		g.localPolicy = &shuffledRoundRobinSelectionPolicy{seed: g.shuffleSeed, rotor: &g.localRotor}
+	default:
+		// weighted; affinity mode uses this as its fallback pick as well
+		g.primaryPolicy = weightedSelectionPolicy{intn: g.randIntn}
+		g.localPolicy = weightedSelectionPolicy{intn: g.randIntn}
+	}
+
+	return g
+}
+
+// newGatewaySelectionRandSource returns a rand.Source seeded from crypto/rand
+// in the same spirit as lib.SeedMathRand, falling back to the clock if the
+// secure source is unavailable.
+func newGatewaySelectionRandSource() rand.Source {
+	n, err := crand.Int(crand.Reader, big.NewInt(math.MaxInt64))
+	if err != nil {
+		return rand.NewSource(time.Now().UTC().UnixNano())
+	}
+	return rand.NewSource(n.Int64())
+}
+
+var errGatewayLocalStateNotInitialized = errors.New("local state not initialized")
+
+// ForceRefresh makes the Run loop re-query the federation state immediately,
+// interrupting any backoff sleep and dropping the blocking query index so the
+// next fetch returns at once rather than waiting for a state change. It is
+// safe to call concurrently and before Run has started: the request is queued
+// and honored by the next loop iteration.
+func (g *GatewayLocator) ForceRefresh() {
+	select {
+	case g.forceRefreshCh <- struct{}{}:
+	default:
+		// a refresh is already queued
+	}
+}
+
+// Run is an open-coded variant of retryLoopBackoff so that ForceRefresh can
+// interrupt the backoff sleep; the rate limiting and backoff behavior on
+// errors are the same. Cancelling the context stops the loop promptly, even
+// mid-blocking-query.
+//
+// TODO(wanfed): once a streaming backend exists, publish federation state
+// changes to a stream topic from the FSM apply path (with a snapshot handler
+// fed from FederationStateList) and have this loop consume the subscription
+// instead of polling, falling back to blocking queries when streaming is
+// disabled.
+func (g *GatewayLocator) Run(ctx context.Context) {
+	defer close(g.doneCh)
+	g.runStartedAt = time.Now()
+	go g.runReadyWaitWarnings(ctx.Done())
+	go g.runLocalStateReadyWatch(ctx.Done())
+	if g.metricsInterval > 0 {
+		go g.runCensusLoop(ctx.Done())
+	}
+	if g.fallbackProbeEnabled {
+		go g.runFallbackProbeLoop(ctx.Done())
+	}
+	g.loadPersistedGatewayAddresses()
+
+	var lastFetchIndex uint64
+	var retryWait time.Duration
+	var notInitializedSince time.Time
+	limiter := rate.NewLimiter(loopRateLimit, retryBucketSize)
+	for {
+		// Rate limit how often we run the loop
+		if err := limiter.Wait(ctx); err != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		// A forced refresh queued while we were busy drops the query index
+		// so the fetch below returns immediately instead of blocking.
+		select {
+		case <-g.forceRefreshCh:
+			lastFetchIndex = 0
+		default:
+		}
+
+		retryWait = g.backoff.next(retryWait)
+
+		idx, err := g.runOnce(ctx, lastFetchIndex)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			if errors.Is(err, errGatewayLocalStateNotInitialized) {
+				if notInitializedSince.IsZero() {
+					notInitializedSince = time.Now()
+				}
+				if stuckFor := time.Since(notInitializedSince); g.fallbackOnlyTimeout > 0 && stuckFor >= g.fallbackOnlyTimeout {
+					g.enterFallbackOnlyMode(stuckFor)
+				}
+			} else {
+				notInitializedSince = time.Time{}
+				g.runErrLogger.Error("error tracking primary and local mesh gateways", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-g.forceRefreshCh:
+				lastFetchIndex = 0
+			case <-time.After(g.backoff.jittered(retryWait)):
+			}
+			continue
+		}
+
+		// Reset the backoff after a successful run.
+		notInitializedSince = time.Time{}
+		retryWait = 0
+		lastFetchIndex = idx
+	}
+}
+
+// RunWithStopCh is a channel-based wrapper around Run for callers that hold a
+// shutdown channel rather than a context.
+func (g *GatewayLocator) RunWithStopCh(stopCh <-chan struct{}) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	g.Run(ctx)
+}
+
+// WaitForDone blocks until Run has fully exited or the context expires,
+// returning the context's error in the latter case. Callers should cancel
+// Run's context (or close its stop channel) first; WaitForDone does not
+// signal the loop to stop.
+func (g *GatewayLocator) WaitForDone(ctx context.Context) error {
+	select {
+	case <-g.doneCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// hasCachedGateways reports whether any primary or local mesh gateway
+// addresses are currently cached.
+func (g *GatewayLocator) hasCachedGateways() bool {
+	g.gatewaysLock.Lock()
+	defer g.gatewaysLock.Unlock()
+	return len(g.primaryGateways) > 0 || len(g.localGateways) > 0
+}
+
+func (g *GatewayLocator) runOnce(ctx context.Context, lastFetchIndex uint64) (_ uint64, retErr error) {
+	span := g.tracer.StartSpan("wanfed.locator.refresh")
+	span.SetAttribute("datacenter", g.datacenter)
+	span.SetAttribute("primary_datacenter", g.primaryDatacenter)
+
+	g.gatewaysLock.Lock()
+	g.lastRefreshAttempt = time.Now()
+	g.gatewaysLock.Unlock()
+
+	defer func() {
+		g.gatewaysLock.Lock()
+		if retErr != nil {
+			g.consecutiveRefreshErrors++
+		} else {
+			g.lastSuccessfulRefresh = time.Now()
+			g.consecutiveRefreshErrors = 0
+		}
+		g.gatewaysLock.Unlock()
+
+		if retErr != nil {
+			span.SetAttribute("error_class", wanfed.ErrorClass(retErr))
+			span.SetError(retErr)
+		}
+		span.End()
+	}()
+
+	if err := g.checkLocalStateIsReady(); err != nil {
+		if errors.Is(err, errGatewayLocalStateNotInitialized) {
+			metrics.IncrCounter([]string{"wanfed", "locator", "state_not_initialized"}, 1)
+		}
+		return 0, err
+	}
+
+	// NOTE: we can't do RPC here because we won't have a token so we'll just
+	// mostly assume that our FSM is caught up enough to answer locally.  If
+	// this has drifted it's no different than a cache that drifts or an
+	// inconsistent read.
+	queryOpts := &structs.QueryOptions{
+		MinQueryIndex:     lastFetchIndex,
+		RequireConsistent: false,
+		MaxQueryTime:      g.maxQueryTime,
+	}
+
+	// Only the local and primary datacenters' entries are ever used, so only
+	// watch those rather than waking on every other datacenter's gateway
+	// churn.
+	dcs := []string{g.datacenter}
+	if g.primaryDatacenter != g.datacenter {
+		dcs = append(dcs, g.primaryDatacenter)
+	}
+
+	var (
+		results   []*structs.FederationState
+		queryMeta structs.QueryMeta
+	)
+	queryStart := time.Now()
+	err := g.srv.blockingQuery(
+		queryOpts,
+		&queryMeta,
+		func(ws memdb.WatchSet, state *state.Store) error {
+			// Wake the blocking query when the caller's context is cancelled
+			// so shutdown does not wait out the query's max wait time. The
+			// watch set is nil on the non-blocking fast path.
+			if ws != nil {
+				ws.Add(ctx.Done())
+			}
+
+			// Get the existing stored version of this config that has replicated down.
+			// We could phone home to get this but that would incur extra WAN traffic
+			// when we already have enough information locally to figure it out
+			// (assuming that our replicator is still functioning).
+			idx, all, err := state.FederationStateBatchGet(ws, dcs)
+			if err != nil {
+				return err
+			}
+
+			queryMeta.Index = idx
+			results = all
+
+			return nil
+		})
+	metrics.MeasureSince([]string{"wanfed", "locator", "query"}, queryStart)
+	if err != nil {
+		return 0, err
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	// A wakeup usually means the gateways are churning (a rolling restart
+	// advances the index many times per second), so linger briefly and fold
+	// any further writes into one recompute from the freshest data. The
+	// very first answer and the bootstrap case (no gateways cached yet) are
+	// exempt: those need to land immediately.
+	if g.coalesceWindow > 0 && lastFetchIndex > 0 && g.hasCachedGateways() {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(g.coalesceWindow):
+		}
+
+		var latestMeta structs.QueryMeta
+		err := g.srv.blockingQuery(
+			&structs.QueryOptions{RequireConsistent: false},
+			&latestMeta,
+			func(ws memdb.WatchSet, state *state.Store) error {
+				idx, all, err := state.FederationStateBatchGet(ws, dcs)
+				if err != nil {
+					return err
+				}
+				latestMeta.Index = idx
+				results = all
+				return nil
+			})
+		if err != nil {
+			return 0, err
+		}
+		if latestMeta.Index > queryMeta.Index {
+			queryMeta.Index = latestMeta.Index
+		}
+	}
+
+	// If the index ever goes backwards (e.g. after a snapshot restore or
+	// disaster recovery) the next blocking query would otherwise wait for an
+	// index that may never be reached again, freezing the gateway view. Hand
+	// back a zero index so the loop resynchronizes immediately.
+	nextFetchIndex := queryMeta.Index
+	if nextFetchIndex < lastFetchIndex {
+		g.logger.Warn("federation state index moved backwards, resetting the watch index",
+			"from", lastFetchIndex,
+			"to", nextFetchIndex,
+		)
+		nextFetchIndex = 0
+	}
+
+	// Classify the wakeup: most blocking-query returns are expected to be
+	// index churn that does not move the cached gateway lists.
+	metrics.IncrCounter([]string{"wanfed", "locator", "wakeups"}, 1)
+
+	atomic.StoreUint64(&g.lastFetchedIndex, queryMeta.Index)
+	changed := g.updateFromState(results)
+	if changed {
+		metrics.IncrCounter([]string{"wanfed", "locator", "updates"}, 1)
+	}
+	span.SetAttribute("raft_index", queryMeta.Index)
+	span.SetAttribute("changed", changed)
+
+	return nextFetchIndex, nil
+}
+
+// enterFallbackOnlyMode is the escape hatch for a server whose local raft
+// state never initializes, e.g. a single-server secondary that cannot yet
+// reach the primary: it publishes the configured fallback addresses as the
+// primary gateway list and fires the ready latch so consumers stop waiting,
+// while the Run loop keeps retrying the real query in the background. It
+// takes effect at most once; fresh federation state simply overwrites the
+// published list whenever it finally arrives.
+func (g *GatewayLocator) enterFallbackOnlyMode(stuckFor time.Duration) {
+	g.fallbackOnlyOnce.Do(func() {
+		addrs := g.srv.PrimaryGatewayFallbackAddresses()
+
+		g.logger.Warn("local raft state has not initialized; proceeding in fallback-only mode using the configured primary gateway addresses",
+			"stuck_for", stuckFor,
+			"fallback_addresses", len(addrs),
+		)
+
+		if len(addrs) > 0 {
+			sorted := make([]string, len(addrs))
+			copy(sorted, addrs)
+			sort.Strings(sorted)
+
+			g.gatewaysLock.Lock()
+			if len(g.primaryGateways) == 0 {
+				g.primaryGateways = sorted
+				g.primaryGatewaysUpdated = time.Now()
+				g.primaryListMeta = gatewayListMeta{source: GatewayListSourceFallback}
+			}
+			g.gatewaysLock.Unlock()
+			g.notifyAddrUpdate()
+		}
+
+		g.primaryGatewaysReadyOnce.Do(func() {
+			close(g.primaryGatewaysReadyCh)
+		})
+	})
+}
+
+// runLocalStateReadyWatch polls the leadership/raft-contact precondition that
+// checkLocalStateIsReady enforces, and forces an immediate refresh when it
+// flips to satisfied instead of leaving the Run loop to wait out its error
+// backoff. This shortens the window where a freshly started secondary has no
+// gateway view. The check is two cheap delegate reads, so the watch just runs
+// for the locator's whole life and also catches leadership being lost and
+// later re-established.
+func (g *GatewayLocator) runLocalStateReadyWatch(stopCh <-chan struct{}) {
+	ready := g.checkLocalStateIsReady() == nil
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(gatewayLocalStateReadyPollInterval):
+		}
+
+		nowReady := g.checkLocalStateIsReady() == nil
+		if nowReady && !ready {
+			g.logger.Debug("local raft state became ready, refreshing mesh gateways now")
+			g.ForceRefresh()
+		}
+		ready = nowReady
+	}
+}
+
+// checkLocalStateIsReady is inlined a bit from (*Server).forward(). We need to
+// wait until our own state machine is safe to read from.
+func (g *GatewayLocator) checkLocalStateIsReady() error {
+	// Check if we can allow a stale read, ensure our local DB is initialized
+	if !g.srv.LeaderLastContact().IsZero() {
+		return nil // the raft leader talked to us
+	}
+
+	if g.srv.IsLeader() {
+		return nil // we are the leader
+	}
+
+	return errGatewayLocalStateNotInitialized
+}
+
+// updateFromState digests a batch of federation states into the cached
+// gateway lists and reports whether either list actually changed.
+func (g *GatewayLocator) updateFromState(results []*structs.FederationState) bool {
+	g.reportFederationStateAges(time.Now(), results)
+
+	var (
+		local            structs.CheckServiceNodes
+		primary          structs.CheckServiceNodes
+		primaryUpdatedAt time.Time
+		sawLocalState    bool
+	)
+	for _, config := range results {
+		retained, allTagFiltered := retainGateways(config.MeshGateways, g.warningMode, g.checkScope, g.tagFilter)
+		if allTagFiltered {
+			g.logger.Warn("service tag filter eliminated all mesh gateways for datacenter",
+				"datacenter", config.Datacenter,
+				"tag", g.tagFilter,
+			)
+		}
+
+		retained, allDraining := filterDrainingGateways(retained)
+		if allDraining {
+			g.logger.Warn("all mesh gateways for datacenter are marked as draining; keeping them eligible for transit",
+				"datacenter", config.Datacenter,
+			)
+		}
+
+		retained, allIncompatible := filterProtocolIncompatibleGateways(retained, g.protocolVersion)
+		if allIncompatible {
+			// Unlike draining gateways, incompatible ones cannot be used at
+			// all, so the list really does go empty here.
+			g.logger.Error("no mesh gateways for datacenter support a wanfed protocol version compatible with this server",
+				"datacenter", config.Datacenter,
+				"server_protocol_version", g.protocolVersion,
+			)
+		}
+		for _, csn := range retained {
+			if _, err := gatewayPortOverride(csn); err != nil {
+				// the gateway is kept; its catalog port is used instead
+				g.logger.Warn("ignoring invalid wanfed port override on mesh gateway",
+					"datacenter", config.Datacenter,
+					"node", csn.Node.Node,
+					"value", csn.Service.Meta[structs.MetaWANFederationPortKey],
+				)
+			}
+		}
+
+		if config.Datacenter == g.datacenter {
+			sawLocalState = true
+			local = retained
+		}
+		// NOT else-if because conditionals are not mutually exclusive
+		if config.Datacenter == g.primaryDatacenter {
+			primary = retained
+			primaryUpdatedAt = config.UpdatedAt
+		}
+	}
+
+	g.noteLocalFederationState(sawLocalState)
+
+	primaryEntries := renderGatewayEntries(g.logger, primary, true, "")
+	localEntries := renderGatewayEntries(g.logger, local, g.useWANAddrsForLocal, g.segment)
+
+	if g.warningMode == GatewayWarningModeDeprioritize {
+		deprioritizeWarningEntries(primaryEntries, g.warningWeightPercent)
+		deprioritizeWarningEntries(localEntries, g.warningWeightPercent)
+	}
+
+	primaryTotal := len(primaryEntries)
+	localTotal := len(localEntries)
+	if g.maxPerDC > 0 {
+		primaryEntries = truncateGatewayEntries(primaryEntries, g.maxPerDC, g.shuffleSeed)
+		localEntries = truncateGatewayEntries(localEntries, g.maxPerDC, g.shuffleSeed)
+	}
+
+	primaryAddrs := gatewayAddrs(primaryEntries)
+	localAddrs := gatewayAddrs(localEntries)
+
+	var primarySameZoneEntries, localSameZoneEntries []gatewayEntry
+	if g.localityMetaKey != "" && g.locality != "" {
+		primarySameZoneEntries = filterSameZoneEntries(primaryEntries, g.localityMetaKey, g.locality)
+		localSameZoneEntries = filterSameZoneEntries(localEntries, g.localityMetaKey, g.locality)
+	}
+
+	g.gatewaysLock.Lock()
+	defer g.gatewaysLock.Unlock()
+
+	now := time.Now()
+
+	changed := false
+	var primaryAdded, primaryRemoved, localAdded, localRemoved []string
+	if !lib.StringSliceEqual(g.primaryGateways, primaryAddrs) {
+		primaryAdded, primaryRemoved = diffGatewayAddrs(g.primaryGateways, primaryAddrs)
+		g.noteListTransitionLocked("primary", g.primaryGateways, primaryAddrs, &g.primaryEmptiedAt, now)
+		g.primaryGateways = primaryAddrs
+		g.primaryGatewaysUpdated = now
+		g.primaryListMeta = gatewayListMeta{
+			raftIndex: atomic.LoadUint64(&g.lastFetchedIndex),
+			source:    GatewayListSourceFederationState,
+		}
+		atomic.StoreUint64(&g.primaryRotor, 0)
+		changed = true
+	}
+	g.primaryGatewayEntries = primaryEntries
+	if !lib.StringSliceEqual(g.localGateways, localAddrs) {
+		localAdded, localRemoved = diffGatewayAddrs(g.localGateways, localAddrs)
+		g.noteListTransitionLocked("local", g.localGateways, localAddrs, &g.localEmptiedAt, now)
+		g.localGateways = localAddrs
+		g.localGatewaysUpdated = now
+		g.localListMeta = gatewayListMeta{
+			raftIndex: atomic.LoadUint64(&g.lastFetchedIndex),
+			source:    GatewayListSourceFederationState,
+		}
+		atomic.StoreUint64(&g.localRotor, 0)
+		changed = true
+	}
+	g.localGatewayEntries = localEntries
+	g.primarySameZoneEntries = primarySameZoneEntries
+	g.localSameZoneEntries = localSameZoneEntries
+	g.primaryFedStateUpdatedAt = primaryUpdatedAt
+
+	g.clearFailedGatewaysLocked()
+
+	if changed {
+		metrics.IncrCounter([]string{"wanfed", "gateway", "location_updates"}, 1)
+		if g.shouldLogAddrUpdateLocked(primaryAddrs, localAddrs, now) {
+			g.logger.Info(
+				"new cached locations of mesh gateways",
+				"primary_added", primaryAdded,
+				"primary_removed", primaryRemoved,
+				"local_added", localAdded,
+				"local_removed", localRemoved,
+				"segment", g.segment,
+			)
+			g.logger.Debug(
+				"full cached locations of mesh gateways",
+				"primary", formatGatewayAddrsForLog(primaryEntries),
+				"local", formatGatewayAddrsForLog(localEntries),
+			)
+			if g.maxPerDC > 0 && (primaryTotal > g.maxPerDC || localTotal > g.maxPerDC) {
+				g.logger.Info("tracking a stable subset of mesh gateways per configured limit",
+					"limit", g.maxPerDC,
+					"primary_shown", len(primaryAddrs),
+					"primary_total", primaryTotal,
+					"local_shown", len(localAddrs),
+					"local_total", localTotal,
+				)
+			}
+		} else {
+			metrics.IncrCounter([]string{"wanfed", "gateway", "location_updates", "suppressed"}, 1)
+		}
+		g.notifyAddrUpdate()
+
+		if len(g.primaryGateways) > 0 {
+			g.persistedPrimaryGateways = g.primaryGateways
+		}
+		if len(g.localGateways) > 0 {
+			g.persistedLocalGateways = g.localGateways
+		}
+		g.persistGatewayAddressesLocked()
+	}
+
+	reportCatalogGatewayGauges(len(primaryAddrs), len(localAddrs))
+
+	g.setPrimaryReady(len(g.primaryGateways) > 0)
+	if len(g.primaryGateways) > 0 {
+		g.primaryGatewaysReadyOnce.Do(func() {
+			close(g.primaryGatewaysReadyCh)
+			g.reportPrimaryGatewaysReady()
+		})
+	}
+
+	return changed
+}
+
+// reportPrimaryGatewaysReady records how long after Run started the first
+// primary mesh gateways arrived via federation state replication, which is
+// the interesting duration when debugging a slow secondary bootstrap. Runs
+// at most once, from inside the ready latch.
+func (g *GatewayLocator) reportPrimaryGatewaysReady() {
+	if g.runStartedAt.IsZero() {
+		// Run never started; tests drive updateFromState directly.
+		return
+	}
+	elapsed := time.Since(g.runStartedAt)
+	metrics.SetGauge([]string{"wanfed", "primary_gateways", "ready_duration_seconds"},
+		float32(elapsed.Seconds()))
+	g.logger.Info("primary mesh gateways received via federation state replication",
+		"elapsed", elapsed,
+		"used_fallback_in_interim", len(g.PrimaryGatewayFallbackAddresses()) > 0,
+	)
+}
+
+const (
+	// gatewayReadyWarnInitialInterval is how long after Run starts the
+	// first "still waiting" warning is logged; the interval then doubles
+	// per warning up to gatewayReadyWarnMaxInterval.
+	gatewayReadyWarnInitialInterval = 15 * time.Second
+	gatewayReadyWarnMaxInterval     = 5 * time.Minute
+
+	// gatewayRunErrorLogWindow is how often the Run loop's recurring error
+	// line repeats while the same failure persists; see runErrLogger.
+	gatewayRunErrorLogWindow = time.Minute
+)
+
+// runReadyWaitWarnings periodically logs a warning for as long as no primary
+// mesh gateways have arrived via federation state replication, so a stalled
+// secondary bootstrap is visible without debug logging. The warnings back
+// off since a long wait usually means a human is already involved.
+func (g *GatewayLocator) runReadyWaitWarnings(stopCh <-chan struct{}) {
+	wait := gatewayReadyWarnInitialInterval
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-g.primaryGatewaysReadyCh:
+			return
+		case <-time.After(wait):
+		}
+
+		g.logger.Warn("still waiting for primary mesh gateways from federation state replication",
+			"elapsed", time.Since(g.runStartedAt),
+			"fallback_addresses", len(g.PrimaryGatewayFallbackAddresses()),
+		)
+
+		if wait < gatewayReadyWarnMaxInterval {
+			wait *= 2
+		}
+	}
+}
+
+// noteLocalFederationState tracks whether a federation state entry exists for
+// this server's own datacenter. An entry that was present and then disappears
+// (operator error, a restore from an old snapshot) silently empties the local
+// gateway list and half-breaks wanfed transit until the periodic mesh gateway
+// dump runs again, so the disappearance is logged at error level and a repair
+// signal is queued for the leader's anti-entropy routine to re-publish
+// immediately. Absence before the first publication is normal during
+// bootstrap and is not reported.
+func (g *GatewayLocator) noteLocalFederationState(present bool) {
+	g.localStateLock.Lock()
+	defer g.localStateLock.Unlock()
+
+	if present {
+		g.localStatePresent = true
+		return
+	}
+	if !g.localStatePresent {
+		return
+	}
+	g.localStatePresent = false
+
+	g.logger.Error("federation state for this datacenter is missing; requesting an immediate mesh gateway dump to repair it",
+		"datacenter", g.datacenter,
+	)
+	select {
+	case g.localStateMissingCh <- struct{}{}:
+	default:
+		// a repair signal is already queued
+	}
+}
+
+// PrimaryGatewayView reports how many primary mesh gateway addresses are
+// currently tracked and when that list last changed, for the federation state
+// replication status RPC.
+func (g *GatewayLocator) PrimaryGatewayView() (count int, updated time.Time) {
+	g.gatewaysLock.Lock()
+	defer g.gatewaysLock.Unlock()
+	return len(g.primaryGateways), g.primaryGatewaysUpdated
+}
+
+// WANFederationStatus is a point-in-time summary of the mesh gateway WAN
+// federation machinery on one server, surfaced through the agent's self
+// endpoint.
+type WANFederationStatus struct {
+	// Enabled is true when WAN federation via mesh gateways is configured
+	// on this server.
+	Enabled bool
+
+	// PrimaryDatacenter is the datacenter the locator dials through the
+	// primary gateway list.
+	PrimaryDatacenter string
+
+	// LocalGatewayCount and PrimaryGatewayCount are the sizes of the
+	// currently tracked gateway lists, including any fallback-derived
+	// primary addresses.
+	LocalGatewayCount   int
+	PrimaryGatewayCount int
+
+	// PrimaryGatewaysReady is true once at least one primary mesh gateway
+	// has arrived via federation state replication rather than fallback
+	// discovery.
+	PrimaryGatewaysReady bool
+
+	// PrimaryFederationStateAge is how long ago the primary datacenter's
+	// federation state was updated, rounded to the second. Empty until an
+	// entry for the primary datacenter has been observed.
+	PrimaryFederationStateAge string
+
+	// SelectionPolicy is the gateway selection policy in use.
+	SelectionPolicy string
+
+	// LastRefreshAttempt and LastSuccessfulRefresh report the refresh
+	// loop's liveness: both advance on every pass, even ones that change
+	// nothing, so a stuck loop shows up as stale timestamps. Zero until the
+	// loop has run.
+	LastRefreshAttempt    time.Time
+	LastSuccessfulRefresh time.Time
+
+	// ConsecutiveRefreshErrors is how many refresh passes in a row have
+	// failed; zero while the loop is healthy.
+	ConsecutiveRefreshErrors int
+}
+
+// Status returns a point-in-time summary of the locator's state for the
+// agent's self endpoint.
+func (g *GatewayLocator) Status() WANFederationStatus {
+	status := WANFederationStatus{
+		Enabled:           true,
+		PrimaryDatacenter: g.primaryDatacenter,
+		SelectionPolicy:   g.selectionMode,
+	}
+
+	g.gatewaysLock.Lock()
+	status.LocalGatewayCount = len(g.localGateways)
+	status.PrimaryGatewayCount = len(g.primaryGateways)
+	status.LastRefreshAttempt = g.lastRefreshAttempt
+	status.LastSuccessfulRefresh = g.lastSuccessfulRefresh
+	status.ConsecutiveRefreshErrors = g.consecutiveRefreshErrors
+	updatedAt := g.primaryFedStateUpdatedAt
+	g.gatewaysLock.Unlock()
+
+	if !updatedAt.IsZero() {
+		age := time.Since(updatedAt)
+		if age < 0 {
+			// tolerate clock skew between datacenters
+			age = 0
+		}
+		status.PrimaryFederationStateAge = age.Round(time.Second).String()
+	}
+
+	select {
+	case <-g.primaryGatewaysReadyCh:
+		status.PrimaryGatewaysReady = true
+	default:
+	}
+
+	return status
+}
+
+// RefreshLiveness reports when the refresh loop last attempted and last
+// completed a pass, plus how many passes in a row have failed.
+func (g *GatewayLocator) RefreshLiveness() (lastAttempt, lastSuccess time.Time, consecutiveErrors int) {
+	g.gatewaysLock.Lock()
+	defer g.gatewaysLock.Unlock()
+	return g.lastRefreshAttempt, g.lastSuccessfulRefresh, g.consecutiveRefreshErrors
+}
+
+// emitRefreshLivenessGauge publishes how long ago the refresh loop last
+// completed successfully. It runs from the census loop so a wedged refresh
+// goroutine still gets reported.
+func (g *GatewayLocator) emitRefreshLivenessGauge() {
+	g.gatewaysLock.Lock()
+	lastSuccess := g.lastSuccessfulRefresh
+	g.gatewaysLock.Unlock()
+
+	if lastSuccess.IsZero() {
+		return
+	}
+	metrics.SetGauge(
+		[]string{"wanfed", "locator", "seconds_since_success"},
+		float32(time.Since(lastSuccess).Seconds()),
+	)
+}
+
+// LocalFederationStateMissingCh returns a channel carrying a coalesced signal
+// whenever an observed federation state entry for this server's own datacenter
+// disappears. The leader's federation state anti-entropy routine consumes it
+// to re-publish the mesh gateway dump immediately instead of waiting on its
+// timer.
+func (g *GatewayLocator) LocalFederationStateMissingCh() <-chan struct{} {
+	return g.localStateMissingCh
+}
+
+// reportFederationStateAges emits a staleness gauge per datacenter from the
+// UpdatedAt carried on each replicated federation state, and warns when the
+// primary datacenter's entry has gone unrefreshed past the configured
+// threshold: a stalled replicator means the mesh gateway view here can drift
+// arbitrarily far from reality before RPC forwarding visibly fails.
+func (g *GatewayLocator) reportFederationStateAges(now time.Time, results []*structs.FederationState) {
+	for _, fs := range results {
+		age, ok := federationStateAge(now, fs)
+		if !ok {
+			continue
+		}
+		metrics.SetGaugeWithLabels([]string{"wanfed", "federation_state", "age_seconds"},
+			float32(age.Seconds()),
+			[]metrics.Label{{Name: "datacenter", Value: fs.Datacenter}})
+
+		if fs.Datacenter == g.primaryDatacenter && g.staleThreshold > 0 && age > g.staleThreshold {
+			g.logger.Warn("federation state for the primary datacenter is stale; mesh gateway locations may be out of date",
+				"datacenter", fs.Datacenter,
+				"age", age.Round(time.Second),
+				"threshold", g.staleThreshold,
+			)
+		}
+	}
+}
+
+// federationStateAge returns how long ago the federation state was updated,
+// clamped at zero to tolerate clock skew between datacenters. The second
+// return value is false when the state carries no update time.
+func federationStateAge(now time.Time, fs *structs.FederationState) (time.Duration, bool) {
+	if fs.UpdatedAt.IsZero() {
+		return 0, false
+	}
+	age := now.Sub(fs.UpdatedAt)
+	if age < 0 {
+		age = 0
+	}
+	return age, true
+}
+
+// noteListTransitionLocked detects a gateway list draining to empty and its
+// later recovery, logging and counting both. The emptied transition requires
+// previously known addresses, so lists that simply start out empty during
+// startup never fire; the recovery transition requires a recorded emptied
+// time for the same reason. Callers must hold gatewaysLock.
+func (g *GatewayLocator) noteListTransitionLocked(list string, prev, next []string, emptiedAt *time.Time, now time.Time) {
+	switch {
+	case len(prev) > 0 && len(next) == 0:
+		*emptiedAt = now
+		metrics.IncrCounterWithLabels([]string{"wanfed", "mesh_gateways", "emptied"}, 1,
+			[]metrics.Label{{Name: "list", Value: list}})
+		g.logger.Warn("no mesh gateways are left in list",
+			"list", list,
+			"previous_addresses", prev,
+			"raft_index", atomic.LoadUint64(&g.lastFetchedIndex),
+		)
+	case len(prev) == 0 && len(next) > 0 && !emptiedAt.IsZero():
+		downtime := now.Sub(*emptiedAt)
+		*emptiedAt = time.Time{}
+		g.logger.Info("mesh gateway list recovered after being empty",
+			"list", list,
+			"downtime", downtime.Round(time.Second),
+		)
 	}
 }
 
-type serverDelegate interface {
-	blockingQuery(queryOpts structs.QueryOptionsCompat, queryMeta structs.QueryMetaCompat, fn queryFn) error
-	PrimaryGatewayFallbackAddresses() []string
-	IsLeader() bool
-	LeaderLastContact() time.Time
-}
+// shouldLogAddrUpdateLocked reports whether a gateway address change is worth
+// logging. An address set observed within the dampening window is a flap
+// revisiting a recent state, so its log line — but not the data update, which
+// has already happened by now — is suppressed. Continued flapping keeps the
+// suppression alive; logging resumes once a set has been quiet for the whole
+// window. Callers must hold gatewaysLock.
+func (g *GatewayLocator) shouldLogAddrUpdateLocked(primaryAddrs, localAddrs []string, now time.Time) bool {
+	sig := strings.Join(primaryAddrs, ",") + "|" + strings.Join(localAddrs, ",")
 
-func NewGatewayLocator(
-	logger hclog.Logger,
-	srv serverDelegate,
-	datacenter string,
-	primaryDatacenter string,
-) *GatewayLocator {
-	return &GatewayLocator{
-		logger:                 logger.Named(logging.GatewayLocator),
-		srv:                    srv,
-		datacenter:             datacenter,
-		primaryDatacenter:      primaryDatacenter,
-		primaryGatewaysReadyCh: make(chan struct{}),
+	if g.recentAddrSets == nil {
+		g.recentAddrSets = make(map[string]time.Time)
+	}
+	// Drop signatures that have aged out, so a cluster whose gateways move
+	// around over time does not accumulate every set it has ever seen.
+	for k, seen := range g.recentAddrSets {
+		if now.Sub(seen) > gatewayUpdateLogDampeningWindow {
+			delete(g.recentAddrSets, k)
+		}
 	}
+
+	_, flapping := g.recentAddrSets[sig]
+	g.recentAddrSets[sig] = now
+	return !flapping
 }
 
-var errGatewayLocalStateNotInitialized = errors.New("local state not initialized")
+// runCensusLoop maintains the per-datacenter mesh gateway count gauges. It
+// blocks on the full federation state list rather than the narrowed
+// local/primary query the main Run loop uses, since the gauges cover every
+// federated datacenter. Any federation state write wakes the blocking query
+// so the gauges update alongside updateFromState, and the query times out at
+// the configured interval so they are re-emitted even when nothing changes.
+func (g *GatewayLocator) runCensusLoop(stopCh <-chan struct{}) {
+	// Derive a context from the stop channel so the limiter wait below is
+	// interruptible at shutdown, as in the main Run loop.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-func (g *GatewayLocator) Run(stopCh <-chan struct{}) {
 	var lastFetchIndex uint64
-	retryLoopBackoff(stopCh, func() error {
-		idx, err := g.runOnce(lastFetchIndex)
-		if err != nil {
-			return err
+	limiter := rate.NewLimiter(loopRateLimit, retryBucketSize)
+	for {
+		if err := limiter.Wait(ctx); err != nil {
+			return
+		}
+		select {
+		case <-stopCh:
+			return
+		default:
 		}
 
-		lastFetchIndex = idx
+		g.emitRefreshLivenessGauge()
 
-		return nil
-	}, func(err error) {
-		if !errors.Is(err, errGatewayLocalStateNotInitialized) {
-			g.logger.Error("error tracking primary and local mesh gateways", "error", err)
+		idx, err := g.censusOnce(lastFetchIndex)
+		if err != nil {
+			if !errors.Is(err, errGatewayLocalStateNotInitialized) {
+				g.logger.Warn("error rebuilding mesh gateway count gauges", "error", err)
+			}
+			select {
+			case <-stopCh:
+				return
+			case <-time.After(g.metricsInterval):
+			}
+			continue
 		}
-	})
+		lastFetchIndex = idx
+	}
 }
 
-func (g *GatewayLocator) runOnce(lastFetchIndex uint64) (uint64, error) {
+func (g *GatewayLocator) censusOnce(lastFetchIndex uint64) (uint64, error) {
 	if err := g.checkLocalStateIsReady(); err != nil {
 		return 0, err
 	}
 
-	// NOTE: we can't do RPC here because we won't have a token so we'll just
-	// mostly assume that our FSM is caught up enough to answer locally.  If
-	// this has drifted it's no different than a cache that drifts or an
-	// inconsistent read.
 	queryOpts := &structs.QueryOptions{
 		MinQueryIndex:     lastFetchIndex,
 		RequireConsistent: false,
+		MaxQueryTime:      g.metricsInterval,
 	}
 
 	var (
@@ -195,10 +3558,6 @@ func (g *GatewayLocator) runOnce(lastFetchIndex uint64) (uint64, error) {
 		queryOpts,
 		&queryMeta,
 		func(ws memdb.WatchSet, state *state.Store) error {
-			// Get the existing stored version of this config that has replicated down.
-			// We could phone home to get this but that would incur extra WAN traffic
-			// when we already have enough information locally to figure it out
-			// (assuming that our replicator is still functioning).
 			idx, all, err := state.FederationStateList(ws)
 			if err != nil {
 				return err
@@ -213,104 +3572,687 @@ func (g *GatewayLocator) runOnce(lastFetchIndex uint64) (uint64, error) {
 		return 0, err
 	}
 
-	g.updateFromState(results)
+	g.reportGatewayCensus(results)
+	g.reportKnownGatewayGauges()
 
 	return queryMeta.Index, nil
 }
 
-// checkLocalStateIsReady is inlined a bit from (*Server).forward(). We need to
-// wait until our own state machine is safe to read from.
-func (g *GatewayLocator) checkLocalStateIsReady() error {
-	// Check if we can allow a stale read, ensure our local DB is initialized
-	if !g.srv.LeaderLastContact().IsZero() {
-		return nil // the raft leader talked to us
-	}
+// reportKnownGatewayGauges re-emits the gauges counting how many mesh
+// gateway addresses this server currently believes it can use. The same
+// gauges are set inline by updateFromState and
+// RefreshPrimaryGatewayFallbackAddresses; this re-emission keeps the series
+// alive across metric store restarts when the lists themselves are stable.
+func (g *GatewayLocator) reportKnownGatewayGauges() {
+	snap := g.snapshotAddresses()
+	reportCatalogGatewayGauges(len(snap.PrimaryGateways), len(snap.LocalGateways))
+	reportFallbackGatewayGauge(len(snap.FallbackAddresses))
+}
 
-	if g.srv.IsLeader() {
-		return nil // we are the leader
-	}
+// reportCatalogGatewayGauges sets the gauges counting the primary and local
+// mesh gateway addresses learned from replicated federation states.
+func reportCatalogGatewayGauges(primary, local int) {
+	metrics.SetGaugeWithLabels([]string{"wanfed", "mesh_gateways", "primary"},
+		float32(primary),
+		[]metrics.Label{{Name: "source", Value: "catalog"}})
+	metrics.SetGaugeWithLabels([]string{"wanfed", "mesh_gateways", "local"},
+		float32(local),
+		[]metrics.Label{{Name: "source", Value: "catalog"}})
+}
 
-	return errGatewayLocalStateNotInitialized
+// reportFallbackGatewayGauge sets the gauge counting the configured or
+// discovered fallback addresses available for dialing the primary when no
+// catalog-derived gateways are usable. Fallback addresses only ever point at
+// the primary, so there is no local series for this source.
+func reportFallbackGatewayGauge(n int) {
+	metrics.SetGaugeWithLabels([]string{"wanfed", "mesh_gateways", "primary"},
+		float32(n),
+		[]metrics.Label{{Name: "source", Value: "fallback"}})
 }
 
-func (g *GatewayLocator) updateFromState(results []*structs.FederationState) {
-	var (
-		local   structs.CheckServiceNodes
-		primary structs.CheckServiceNodes
-	)
-	for _, config := range results {
-		retained := retainGateways(config.MeshGateways)
-		if config.Datacenter == g.datacenter {
-			local = retained
+// reportGatewayCensus emits one mesh gateway count gauge per datacenter and
+// health class from the provided federation states. It works purely from its
+// argument so no locator locks are held while emitting. Classes with no
+// gateways are emitted as zero so dashboards see instances disappear rather
+// than the series going stale.
+func (g *GatewayLocator) reportGatewayCensus(results []*structs.FederationState) {
+	for _, fs := range results {
+		counts := countGatewaysByHealth(fs.MeshGateways, g.checkScope)
+		for _, status := range []string{api.HealthPassing, api.HealthWarning, api.HealthCritical} {
+			metrics.SetGaugeWithLabels([]string{"wanfed", "mesh_gateways"},
+				float32(counts[status]),
+				[]metrics.Label{
+					{Name: "datacenter", Value: fs.Datacenter},
+					{Name: "status", Value: status},
+				})
 		}
-		// NOT else-if because conditionals are not mutually exclusive
-		if config.Datacenter == g.primaryDatacenter {
-			primary = retained
+	}
+}
+
+// countGatewaysByHealth tallies a datacenter's wanfed-eligible mesh gateways
+// by collapsed health class. Gateways missing the wanfed meta are skipped
+// entirely since they can never carry transit. An instance with any in-scope
+// critical check counts as critical, one with any warning check as warning,
+// mirroring how retainGateways and gatewayHealthStatus classify instances for
+// selection.
+func countGatewaysByHealth(gateways structs.CheckServiceNodes, checkScope string) map[string]int {
+	counts := map[string]int{
+		api.HealthPassing:  0,
+		api.HealthWarning:  0,
+		api.HealthCritical: 0,
+	}
+	for _, csn := range gateways {
+		if csn.Service.Meta[structs.MetaWANFederationKey] != "1" {
+			continue
+		}
+		status := api.HealthPassing
+		for _, chk := range csn.Checks {
+			if gatewayCheckExcluded(chk) {
+				continue
+			}
+			switch chk.Status {
+			case api.HealthCritical:
+				if checkScope == GatewayCheckScopeService && !checkAppliesToGateway(chk, csn.Service.ID) {
+					continue
+				}
+				status = api.HealthCritical
+			case api.HealthWarning:
+				if status != api.HealthCritical {
+					status = api.HealthWarning
+				}
+			}
 		}
+		counts[status]++
 	}
+	return counts
+}
 
-	primaryAddrs := renderGatewayAddrs(primary, true)
-	localAddrs := renderGatewayAddrs(local, false)
+// retainGateways filters the full gateway list down to the instances usable
+// for wanfed transit: those carrying the wanfed meta (and the configured
+// service tag, when one is set) that are not critical. The second return
+// value is true when the tag filter rejected at least one gateway and the
+// result is empty, so the caller can log which tag eliminated everything.
+func retainGateways(full structs.CheckServiceNodes, warningMode, checkScope, tagFilter string) (structs.CheckServiceNodes, bool) {
+	out := make([]structs.CheckServiceNode, 0, len(full))
+	numPassing := 0
+	numTagRejected := 0
+	for _, csn := range full {
+		if csn.Service.Meta[structs.MetaWANFederationKey] != "1" {
+			continue
+		}
+		if tagFilter != "" && !lib.StrContains(csn.Service.Tags, tagFilter) {
+			numTagRejected++
+			continue
+		}
 
-	g.gatewaysLock.Lock()
-	defer g.gatewaysLock.Unlock()
+		// only keep healthy ones
+		ok := true
+		for _, chk := range csn.Checks {
+			if chk.Status != api.HealthCritical {
+				continue
+			}
+			if gatewayCheckExcluded(chk) {
+				continue
+			}
+			if checkScope == GatewayCheckScopeService && !checkAppliesToGateway(chk, csn.Service.ID) {
+				continue
+			}
+			ok = false
+		}
 
-	changed := false
-	primaryReady := false
-	if !lib.StringSliceEqual(g.primaryGateways, primaryAddrs) {
-		g.primaryGateways = primaryAddrs
-		primaryReady = len(g.primaryGateways) > 0
-		changed = true
+		if ok {
+			if gatewayHealthStatus(csn) == api.HealthPassing {
+				numPassing++
+			}
+			out = append(out, csn)
+		}
 	}
-	if !lib.StringSliceEqual(g.localGateways, localAddrs) {
-		g.localGateways = localAddrs
-		changed = true
+
+	switch warningMode {
+	case GatewayWarningModeExclude:
+		out = retainPassingGateways(out)
+	case GatewayWarningModePreferPassing:
+		// The decision is made per-datacenter list: if everything is
+		// warning we keep the warnings rather than filtering the list down
+		// to zero.
+		if numPassing > 0 {
+			out = retainPassingGateways(out)
+		}
 	}
+	return out, len(out) == 0 && numTagRejected > 0
+}
 
-	if changed {
-		g.logger.Info(
-			"new cached locations of mesh gateways",
-			"primary", primaryAddrs,
-			"local", localAddrs,
-		)
+// gatewayCheckExcluded reports whether a check is ignored entirely when
+// collapsing a mesh gateway's health for selection. The synthetic wanfed
+// availability check describes the node's view of the federation, not the
+// gateway's health; folding it in would let a server co-located with a mesh
+// gateway wedge itself permanently, since that check starts critical until a
+// gateway is selectable.
+func gatewayCheckExcluded(chk *structs.HealthCheck) bool {
+	return chk.CheckID == structs.WANFedGatewayAvailCheckID
+}
+
+// checkAppliesToGateway reports whether a check is in scope for excluding a
+// gateway under GatewayCheckScopeService: the built-in serfHealth node check
+// and any check bound to the gateway service itself.
+func checkAppliesToGateway(chk *structs.HealthCheck, serviceID string) bool {
+	if chk.CheckID == structs.SerfCheckID {
+		return true
 	}
+	return chk.ServiceID == serviceID
+}
 
-	if primaryReady {
-		g.primaryGatewaysReadyOnce.Do(func() {
-			close(g.primaryGatewaysReadyCh)
-		})
+// filterDrainingGateways removes gateways whose service meta marks them as
+// draining so that existing connections can finish before the gateway is
+// terminated. If every gateway is draining the list is returned unchanged —
+// we never filter a datacenter down to zero — and the second return value is
+// true so the caller can log a warning.
+func filterDrainingGateways(full structs.CheckServiceNodes) (structs.CheckServiceNodes, bool) {
+	out := make([]structs.CheckServiceNode, 0, len(full))
+	for _, csn := range full {
+		if csn.Service.Meta[structs.MetaWANFederationDrainKey] == "1" {
+			continue
+		}
+		out = append(out, csn)
+	}
+
+	if len(out) == 0 && len(full) > 0 {
+		return full, true
 	}
+	return out, false
 }
 
-func retainGateways(full structs.CheckServiceNodes) structs.CheckServiceNodes {
+// filterProtocolIncompatibleGateways removes gateways whose advertised wanfed
+// protocol range does not include the provided version. The second return
+// value is true when a non-empty input filtered down to nothing, so the
+// caller can log an explicit error instead of silently losing a datacenter.
+func filterProtocolIncompatibleGateways(full structs.CheckServiceNodes, version int) (structs.CheckServiceNodes, bool) {
 	out := make([]structs.CheckServiceNode, 0, len(full))
 	for _, csn := range full {
-		if csn.Service.Meta[structs.MetaWANFederationKey] != "1" {
+		min, max := gatewayProtocolRange(csn)
+		if version < min || version > max {
 			continue
 		}
+		out = append(out, csn)
+	}
+	return out, len(out) == 0 && len(full) > 0
+}
 
-		// only keep healthy ones
-		ok := true
-		for _, chk := range csn.Checks {
-			if chk.Status == api.HealthCritical {
-				ok = false
-			}
+// gatewayProtocolRange parses the inclusive protocol version range a mesh
+// gateway advertises via its service meta. Accepted forms are a single
+// version ("1") and a range ("1-2"); absent or malformed values are treated
+// as the default protocol version.
+func gatewayProtocolRange(csn structs.CheckServiceNode) (int, int) {
+	raw := csn.Service.Meta[structs.MetaWANFederationProtocolKey]
+	if raw == "" {
+		return defaultGatewayProtocolVersion, defaultGatewayProtocolVersion
+	}
+
+	parts := strings.SplitN(raw, "-", 2)
+	min, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || min < 1 {
+		return defaultGatewayProtocolVersion, defaultGatewayProtocolVersion
+	}
+
+	max := min
+	if len(parts) == 2 {
+		if v, err := strconv.Atoi(strings.TrimSpace(parts[1])); err == nil && v >= min {
+			max = v
 		}
+	}
+	return min, max
+}
 
-		if ok {
+func retainPassingGateways(full structs.CheckServiceNodes) structs.CheckServiceNodes {
+	out := make([]structs.CheckServiceNode, 0, len(full))
+	for _, csn := range full {
+		if gatewayHealthStatus(csn) == api.HealthPassing {
 			out = append(out, csn)
 		}
 	}
 	return out
 }
 
-func renderGatewayAddrs(gateways structs.CheckServiceNodes, wan bool) []string {
-	out := make([]string, 0, len(gateways))
+// gatewayHealthStatus collapses a gateway's checks down to either passing or
+// warning; critical instances never make it this far.
+func gatewayHealthStatus(csn structs.CheckServiceNode) string {
+	for _, chk := range csn.Checks {
+		if gatewayCheckExcluded(chk) {
+			continue
+		}
+		if chk.Status == api.HealthWarning {
+			return api.HealthWarning
+		}
+	}
+	return api.HealthPassing
+}
+
+// renderGatewayEntries returns the selection candidates for the provided
+// gateways, sorted by address. Each entry carries the gateway's collapsed
+// health status, its selection weight (the registered structs.Weights value
+// for its status, defaulting to 1 when zero or missing), and its node meta.
+// Misregistered gateways whose best address has an empty host or a zero port
+// are dropped with a warning, since dialing them can never succeed.
+//
+// When rendering LAN addresses for a server in a network segment, a gateway's
+// tagged service address for that segment is preferred over its default LAN
+// address, which may not be reachable from inside the segment.
+func renderGatewayEntries(logger hclog.Logger, gateways structs.CheckServiceNodes, wan bool, segment string) []gatewayEntry {
+	entries := make([]gatewayEntry, 0, len(gateways))
 	for _, csn := range gateways {
 		addr, port := csn.BestAddress(wan)
-		completeAddr := ipaddr.FormatAddressPort(addr, port)
-		out = append(out, completeAddr)
+		if !wan && segment != "" {
+			if tagged, ok := csn.Service.TaggedAddresses[segment]; ok && tagged.Address != "" {
+				addr = tagged.Address
+				if tagged.Port != 0 {
+					port = tagged.Port
+				}
+			}
+		}
+		overridePort := 0
+		if p, err := gatewayPortOverride(csn); err == nil && p != 0 {
+			port = p
+			overridePort = p
+		}
+		if addr == "" || port <= 0 {
+			if logger != nil {
+				logger.Warn("ignoring mesh gateway with malformed address; fix its registration",
+					"node", csn.Node.Node,
+					"service_id", csn.Service.ID,
+					"address", addr,
+					"port", port,
+				)
+			}
+			continue
+		}
+		joined := normalizeGatewayAddr(ipaddr.FormatAddressPort(addr, port))
+		if _, _, err := net.SplitHostPort(joined); err != nil {
+			if logger != nil {
+				logger.Warn("ignoring mesh gateway whose address does not render to a dialable host:port; fix its registration",
+					"node", csn.Node.Node,
+					"service_id", csn.Service.ID,
+					"address", addr,
+					"port", port,
+					"error", err,
+				)
+			}
+			continue
+		}
+		entries = append(entries, gatewayEntry{
+			addr:      joined,
+			node:      csn.Node.Node,
+			health:    gatewayHealthStatus(csn),
+			weight:    gatewaySelectionWeight(csn),
+			nodeMeta:  csn.Node.Meta,
+			tags:      csn.Service.Tags,
+			addrV4:    renderTaggedFamilyAddr(csn, wan, false, port, overridePort),
+			addrV6:    renderTaggedFamilyAddr(csn, wan, true, port, overridePort),
+			maxConns:  gatewayMaxConns(csn),
+			instances: 1,
+		})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].addr < entries[j].addr
+	})
+	return dedupeGatewayEntries(entries)
+}
+
+// dedupeGatewayEntries collapses adjacent entries sharing one host:port, as
+// happens when several gateway instances sit behind the same NAT or ingress
+// IP, so that the duplicated address is a single selection candidate instead
+// of being unintentionally favored. The collapsed entry keeps the summed
+// weight (so weighted selection still reflects the extra capacity), the
+// summed connection capacity, the best health status, and an instance count
+// for log lines. The input must already be sorted by address.
+func dedupeGatewayEntries(entries []gatewayEntry) []gatewayEntry {
+	out := entries[:0]
+	for _, e := range entries {
+		if n := len(out); n > 0 && out[n-1].addr == e.addr {
+			prev := &out[n-1]
+			prev.instances += e.instances
+			prev.weight += e.weight
+			if e.health == api.HealthPassing {
+				prev.health = api.HealthPassing
+			}
+			if prev.maxConns == 0 || e.maxConns == 0 {
+				prev.maxConns = 0
+			} else {
+				prev.maxConns += e.maxConns
+			}
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// formatGatewayAddrsForLog annotates addresses that collapsed multiple
+// catalog instances, rendering e.g. "10.0.0.1:443 (x3)".
+func formatGatewayAddrsForLog(entries []gatewayEntry) []string {
+	out := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.instances > 1 {
+			out = append(out, fmt.Sprintf("%s (x%d)", e.addr, e.instances))
+		} else {
+			out = append(out, e.addr)
+		}
+	}
+	return out
+}
+
+// gatewayPortOverride parses the wanfed transit port a mesh gateway
+// advertises via its service meta, for gateways whose wanfed ALPN listener is
+// not on the catalog port. It returns 0 when no override is present, and an
+// error for non-numeric or out-of-range values.
+func gatewayPortOverride(csn structs.CheckServiceNode) (int, error) {
+	raw := csn.Service.Meta[structs.MetaWANFederationPortKey]
+	if raw == "" {
+		return 0, nil
+	}
+	port, err := strconv.Atoi(raw)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q", raw)
+	}
+	return port, nil
+}
+
+// gatewayMaxConns parses the concurrent transit connection capacity a mesh
+// gateway advertises via its service meta. Missing or invalid values mean
+// unlimited (0).
+func gatewayMaxConns(csn structs.CheckServiceNode) int {
+	raw := csn.Service.Meta[structs.MetaWANFederationMaxConnsKey]
+	if raw == "" {
+		return 0
+	}
+	max, err := strconv.Atoi(raw)
+	if err != nil || max < 1 {
+		return 0
+	}
+	return max
+}
+
+// renderTaggedFamilyAddr returns the formatted address for the gateway's
+// IPv4 or IPv6 tagged service address, or "" when it did not register one.
+// A tagged address without a port inherits the provided default port; a
+// non-zero overridePort trumps both.
+func renderTaggedFamilyAddr(csn structs.CheckServiceNode, wan, ipv6 bool, defaultPort, overridePort int) string {
+	var key string
+	switch {
+	case wan && ipv6:
+		key = structs.TaggedAddressWANIPv6
+	case wan:
+		key = structs.TaggedAddressWANIPv4
+	case ipv6:
+		key = structs.TaggedAddressLANIPv6
+	default:
+		key = structs.TaggedAddressLANIPv4
+	}
+
+	tagged, ok := csn.Service.TaggedAddresses[key]
+	if !ok || tagged.Address == "" {
+		return ""
+	}
+	port := tagged.Port
+	if port == 0 {
+		port = defaultPort
+	}
+	if overridePort != 0 {
+		port = overridePort
+	}
+	return ipaddr.FormatAddressPort(tagged.Address, port)
+}
+
+// truncateGatewayEntries keeps a stable subset of at most limit entries,
+// chosen by hashing each address against the server's shuffle seed so that
+// the subset survives unrelated membership churn and different servers keep
+// different (collectively covering) subsets. The kept entries stay sorted by
+// address like the rest of the rendered lists. Truncation runs after health
+// filtering, so a healthy gateway is never dropped in favor of a critical
+// one.
+func truncateGatewayEntries(entries []gatewayEntry, limit int, seed uint64) []gatewayEntry {
+	if limit <= 0 || len(entries) <= limit {
+		return entries
+	}
+
+	scored := make([]gatewayEntry, len(entries))
+	copy(scored, entries)
+
+	score := func(addr string) uint64 {
+		h := fnv.New64a()
+		var seedBytes [8]byte
+		binary.BigEndian.PutUint64(seedBytes[:], seed)
+		h.Write(seedBytes[:])
+		h.Write([]byte(addr))
+		return h.Sum64()
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		si, sj := score(scored[i].addr), score(scored[j].addr)
+		if si != sj {
+			return si < sj
+		}
+		return scored[i].addr < scored[j].addr
+	})
+
+	kept := scored[:limit]
+	sort.Slice(kept, func(i, j int) bool {
+		return kept[i].addr < kept[j].addr
+	})
+	return kept
+}
+
+// gatewayAddrs flattens entries down to their addresses.
+func gatewayAddrs(entries []gatewayEntry) []string {
+	if len(entries) == 0 {
+		return nil
+	}
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		addrs = append(addrs, e.addr)
+	}
+	return addrs
+}
+
+// normalizeGatewayAddr lowercases a hostname-valued host so that sorting and
+// dedup treat differing capitalization of the same name as one gateway. DNS
+// names are case-insensitive, so this loses nothing; IP literals and
+// unparseable addresses pass through untouched.
+func normalizeGatewayAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if net.ParseIP(host) != nil {
+		return addr
+	}
+	lowered := strings.ToLower(host)
+	if lowered == host {
+		return addr
+	}
+	return net.JoinHostPort(lowered, port)
+}
+
+// entriesFromAddrs wraps bare addresses (such as the fallback addresses for
+// the primary datacenter, which have no catalog data behind them) in
+// default-weight passing entries.
+func entriesFromAddrs(addrs []string) []gatewayEntry {
+	if len(addrs) == 0 {
+		return nil
+	}
+	entries := make([]gatewayEntry, 0, len(addrs))
+	for _, addr := range addrs {
+		entries = append(entries, gatewayEntry{
+			addr:   addr,
+			health: api.HealthPassing,
+			weight: 1,
+		})
+	}
+	return entries
+}
+
+// filterEntriesForClass narrows the candidate entries to the requested
+// traffic class when a gossip tag filter is configured: gossip picks keep
+// only gateways carrying the tag, RPC picks keep only the rest. When the
+// class's subset would be empty (or no class or filter applies) the shared
+// list is used instead, so a partial rollout of tagged gateways never breaks
+// transit.
+func (g *GatewayLocator) filterEntriesForClass(entries []gatewayEntry, class string) []gatewayEntry {
+	if g.gossipTagFilter == "" || class == "" {
+		return entries
+	}
+
+	var gossip, rest []gatewayEntry
+	for _, e := range entries {
+		if lib.StrContains(e.tags, g.gossipTagFilter) {
+			gossip = append(gossip, e)
+		} else {
+			rest = append(rest, e)
+		}
+	}
+
+	switch class {
+	case gatewayTrafficClassGossip:
+		if len(gossip) > 0 {
+			return gossip
+		}
+	case gatewayTrafficClassRPC:
+		if len(rest) > 0 {
+			return rest
+		}
+	}
+	return entries
+}
+
+// applyAddressFamilyPreference rewrites each entry's dial address according to
+// the configured address family preference. Under the prefer modes an entry
+// missing the preferred family keeps its other address; under the require
+// modes it is dropped entirely, since an address of the wrong family is known
+// to be unroutable. Entries without per-family tagged addresses (fallback and
+// override addresses) are classified by parsing the address itself, and
+// hostnames pass through untouched.
+func applyAddressFamilyPreference(entries []gatewayEntry, family string) []gatewayEntry {
+	if family == "" {
+		return entries
+	}
+
+	out := make([]gatewayEntry, 0, len(entries))
+	for _, e := range entries {
+		v4, v6 := e.addrV4, e.addrV6
+		if v4 == "" && v6 == "" {
+			switch classifyAddressFamily(e.addr) {
+			case "v4":
+				v4 = e.addr
+			case "v6":
+				v6 = e.addr
+			default:
+				// hostname; assume it resolves appropriately
+				out = append(out, e)
+				continue
+			}
+		}
+
+		switch family {
+		case GatewayAddressFamilyPreferIPv4:
+			if v4 != "" {
+				e.addr = v4
+			} else if v6 != "" {
+				e.addr = v6
+			}
+		case GatewayAddressFamilyPreferIPv6:
+			if v6 != "" {
+				e.addr = v6
+			} else if v4 != "" {
+				e.addr = v4
+			}
+		case GatewayAddressFamilyRequireIPv4:
+			if v4 == "" {
+				continue
+			}
+			e.addr = v4
+		case GatewayAddressFamilyRequireIPv6:
+			if v6 == "" {
+				continue
+			}
+			e.addr = v6
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// classifyAddressFamily reports whether a host:port address has an IPv4 or
+// IPv6 host, or "" when the host is not an IP address.
+func classifyAddressFamily(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip := net.ParseIP(host)
+	switch {
+	case ip == nil:
+		return ""
+	case ip.To4() != nil:
+		return "v4"
+	default:
+		return "v6"
+	}
+}
+
+// deprioritizeWarningEntries rescales selection weights in place so that
+// warning gateways are drawn less often than passing ones: passing entries
+// keep their full weight (scaled to a base of 100) and warning entries are
+// reduced to the configured percentage of theirs, never below 1. When no
+// passing entry exists the list is left untouched so an all-warning list
+// serves at full weight.
+func deprioritizeWarningEntries(entries []gatewayEntry, percent int) {
+	hasPassing := false
+	for _, e := range entries {
+		if e.health == api.HealthPassing {
+			hasPassing = true
+			break
+		}
+	}
+	if !hasPassing {
+		return
+	}
+	for i := range entries {
+		if entries[i].health == api.HealthWarning {
+			if w := entries[i].weight * percent; w >= 1 {
+				entries[i].weight = w
+			} else {
+				entries[i].weight = 1
+			}
+		} else {
+			entries[i].weight *= 100
+		}
+	}
+}
+
+// filterSameZoneEntries returns the subset of entries whose node meta
+// locality value matches the provided zone. Gateways without the meta key are
+// never considered local.
+func filterSameZoneEntries(entries []gatewayEntry, metaKey, zone string) []gatewayEntry {
+	out := make([]gatewayEntry, 0, len(entries))
+	for _, e := range entries {
+		if e.nodeMeta[metaKey] == zone {
+			out = append(out, e)
+		}
 	}
-	sort.Strings(out)
 	return out
 }
+
+func gatewaySelectionWeight(csn structs.CheckServiceNode) int {
+	status := gatewayHealthStatus(csn)
+
+	weight := 1
+	if csn.Service.Weights != nil {
+		if status == api.HealthWarning {
+			weight = csn.Service.Weights.Warning
+		} else {
+			weight = csn.Service.Weights.Passing
+		}
+	}
+	if weight < 1 {
+		weight = 1
+	}
+	return weight
+}
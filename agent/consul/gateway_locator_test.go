@@ -1,13 +1,30 @@
 package consul
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	metrics "github.com/armon/go-metrics"
 	"github.com/hashicorp/consul/agent/consul/state"
+	"github.com/hashicorp/consul/agent/consul/wanfed"
 	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/api"
 	"github.com/hashicorp/consul/sdk/testutil"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+	"github.com/hashicorp/consul/types"
 	memdb "github.com/hashicorp/go-memdb"
 	"github.com/stretchr/testify/require"
 )
@@ -51,11 +68,10 @@ func TestGatewayLocator(t *testing.T) {
 		g := NewGatewayLocator(
 			logger,
 			tsd,
-			"dc1",
-			"dc1",
+			&Config{Datacenter: "dc1", PrimaryDatacenter: "dc1"},
 		)
 
-		idx, err := g.runOnce(0)
+		idx, err := g.runOnce(context.Background(), 0)
 		require.NoError(t, err)
 		require.Equal(t, uint64(2), idx)
 		require.Len(t, tsd.Calls, 1)
@@ -75,11 +91,10 @@ func TestGatewayLocator(t *testing.T) {
 		g := NewGatewayLocator(
 			logger,
 			tsd,
-			"dc2",
-			"dc1",
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
 		)
 
-		idx, err := g.runOnce(0)
+		idx, err := g.runOnce(context.Background(), 0)
 		require.NoError(t, err)
 		require.Equal(t, uint64(2), idx)
 		require.Len(t, tsd.Calls, 1)
@@ -94,14 +109,2675 @@ func TestGatewayLocator(t *testing.T) {
 	})
 }
 
+func TestGatewayLocator_Weights(t *testing.T) {
+	weighted := newTestMeshGatewayNode(
+		"dc1", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+	)
+	weighted.Service.Weights = &structs.Weights{Passing: 5, Warning: 2}
+
+	warning := newTestMeshGatewayNode(
+		"dc1", "gateway2", "4.3.2.1", 9999, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthWarning,
+	)
+	warning.Service.Weights = &structs.Weights{Passing: 5, Warning: 2}
+
+	unweighted := newTestMeshGatewayNode(
+		"dc1", "gateway3", "5.6.7.8", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+	)
+
+	t.Run("render computes per-gateway weights", func(t *testing.T) {
+		entries := renderGatewayEntries(nil, structs.CheckServiceNodes{weighted, warning, unweighted}, false, "")
+		require.Equal(t, []string{"1.2.3.4:5555", "4.3.2.1:9999", "5.6.7.8:5555"}, gatewayAddrs(entries))
+		require.Equal(t, 5, entries[0].weight)
+		require.Equal(t, 2, entries[1].weight)
+		require.Equal(t, 1, entries[2].weight)
+		require.Equal(t, api.HealthWarning, entries[1].health)
+	})
+
+	t.Run("zero weight defaults to 1", func(t *testing.T) {
+		zero := newTestMeshGatewayNode(
+			"dc1", "gateway4", "9.9.9.9", 1111, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+		)
+		zero.Service.Weights = &structs.Weights{Passing: 0, Warning: 0}
+		require.Equal(t, 1, gatewaySelectionWeight(zero))
+	})
+
+	t.Run("weighted pick never selects a zero-weight item", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc1", PrimaryDatacenter: "dc1"},
+		)
+		policy := weightedSelectionPolicy{intn: g.randIntn}
+		entries := []gatewayEntry{
+			{addr: "a", weight: 3},
+			{addr: "b", weight: 0},
+		}
+		for i := 0; i < 100; i++ {
+			require.Equal(t, "a", policy.Pick(entries))
+		}
+	})
+}
+
+func TestGatewayLocator_MarkGatewayFailed(t *testing.T) {
+	logger := testutil.Logger(t)
+	tsd := &testServerDelegate{isLeader: true}
+	g := NewGatewayLocator(
+		logger,
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+	g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999"}
+
+	t.Run("failed gateway is skipped while alternatives exist", func(t *testing.T) {
+		g.MarkGatewayFailed("5.6.7.8:5555", errors.New("connection refused"))
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "8.7.6.5:9999", g.PickGateway("dc3"))
+		}
+	})
+
+	t.Run("all gateways failed falls back to the full list", func(t *testing.T) {
+		g.MarkGatewayFailed("8.7.6.5:9999", errors.New("connection refused"))
+		require.NotEmpty(t, g.PickGateway("dc3"))
+	})
+
+	t.Run("failure records expire after the cooldown", func(t *testing.T) {
+		g.failedLock.Lock()
+		for addr := range g.failedGateways {
+			g.failedGateways[addr] = time.Now().Add(-2 * g.failureCooldown)
+		}
+		g.failedLock.Unlock()
+
+		addrs := g.listGateways(false)
+		require.Equal(t, []string{"5.6.7.8:5555", "8.7.6.5:9999"}, addrs)
+	})
+
+	t.Run("records for departed addresses are dropped on update", func(t *testing.T) {
+		g.MarkGatewayFailed("9.9.9.9:1111", errors.New("connection refused"))
+		g.updateFromState(nil)
+
+		g.failedLock.Lock()
+		defer g.failedLock.Unlock()
+		require.Empty(t, g.failedGateways)
+	})
+}
+
+func TestGatewayLocator_PickGatewayErr(t *testing.T) {
+	logger := testutil.Logger(t)
+	tsd := &testServerDelegate{isLeader: true}
+	g := NewGatewayLocator(
+		logger,
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	t.Run("no gateways at all", func(t *testing.T) {
+		_, err := g.PickGatewayErr("dc1")
+		require.Error(t, err)
+		require.Equal(t, NoMeshGatewaysAvailableError{Datacenter: "dc1", FallbackEmpty: true}, err)
+		require.Contains(t, err.Error(), "no mesh gateway available to reach dc1")
+		require.Contains(t, err.Error(), "fallback addresses are also empty")
+
+		_, err = g.PickGatewayErr("dc3")
+		require.Equal(t, NoMeshGatewaysAvailableError{Datacenter: "dc3"}, err)
+	})
+
+	t.Run("gateways known", func(t *testing.T) {
+		g.localGateways = []string{"5.6.7.8:5555"}
+		addr, err := g.PickGatewayErr("dc3")
+		require.NoError(t, err)
+		require.Equal(t, "5.6.7.8:5555", addr)
+	})
+}
+
+func TestGatewayLocator_PickGatewayContext(t *testing.T) {
+	logger := testutil.Logger(t)
+	tsd := &testServerDelegate{isLeader: true}
+	g := NewGatewayLocator(
+		logger,
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	t.Run("returns once an address arrives", func(t *testing.T) {
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			g.RefreshPrimaryGatewayFallbackAddresses([]string{"7.7.7.7:8443"})
+		}()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		addr, err := g.PickGatewayContext(ctx, "dc1")
+		require.NoError(t, err)
+		require.Equal(t, "7.7.7.7:8443", addr)
+	})
+
+	t.Run("deadline exceeded when nothing arrives", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+
+		_, err := g.PickGatewayContext(ctx, "dc3")
+		require.Equal(t, context.DeadlineExceeded, err)
+	})
+}
+
+func TestGatewayLocator_RandSource(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+	dc2fed := &structs.FederationState{
+		Datacenter: "dc2",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode("dc2", "gateway1", "5.6.7.8", 5555, meta, api.HealthPassing),
+			newTestMeshGatewayNode("dc2", "gateway2", "8.7.6.5", 9999, meta, api.HealthPassing),
+		},
+	}
+
+	pickSequence := func(seed int64, n int) []string {
+		g := newGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+			rand.NewSource(seed),
+		)
+		g.updateFromState([]*structs.FederationState{dc2fed})
+
+		out := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			out = append(out, g.PickGateway("dc2"))
+		}
+		return out
+	}
+
+	t.Run("same seed reproduces the same picks", func(t *testing.T) {
+		require.Equal(t, pickSequence(1, 50), pickSequence(1, 50))
+	})
+
+	t.Run("both gateways get picked", func(t *testing.T) {
+		seen := make(map[string]int)
+		for _, addr := range pickSequence(1, 50) {
+			seen[addr]++
+		}
+		require.Len(t, seen, 2)
+	})
+}
+
+func TestGatewayLocator_PickGatewayExcluding(t *testing.T) {
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+	g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999"}
+
+	t.Run("excluded address is skipped", func(t *testing.T) {
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "8.7.6.5:9999",
+				g.PickGatewayExcluding("dc3", []string{"5.6.7.8:5555"}))
+		}
+	})
+
+	t.Run("all excluded falls back to the full list", func(t *testing.T) {
+		addr := g.PickGatewayExcluding("dc3", []string{"5.6.7.8:5555", "8.7.6.5:9999"})
+		require.NotEmpty(t, addr)
+	})
+
+	t.Run("exclusion applies to fallback addresses too", func(t *testing.T) {
+		g.RefreshPrimaryGatewayFallbackAddresses([]string{"7.7.7.7:8443", "7.7.7.8:8443"})
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "7.7.7.8:8443",
+				g.PickGatewayExcluding("dc1", []string{"7.7.7.7:8443"}))
+		}
+	})
+}
+
+func TestGatewayLocator_ListGateways(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+
+	dc1 := &structs.FederationState{
+		Datacenter: "dc1",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc1", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+			newTestMeshGatewayNode(
+				"dc1", "gateway2", "4.3.2.1", 9999, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthWarning,
+			),
+		},
+		UpdatedAt: time.Now().UTC(),
+	}
+	require.NoError(t, state.FederationStateSet(1, dc1))
+
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{State: state, isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	t.Run("unknown datacenter", func(t *testing.T) {
+		require.Nil(t, g.ListGateways("dc3"))
+	})
+
+	t.Run("fallback addresses before federation state arrives", func(t *testing.T) {
+		g.RefreshPrimaryGatewayFallbackAddresses([]string{"7.7.7.7:8443"})
+
+		infos := g.ListGateways("dc1")
+		require.Len(t, infos, 1)
+		require.Equal(t, "7.7.7.7:8443", infos[0].Address)
+		require.Equal(t, "dc1", infos[0].Datacenter)
+		require.False(t, infos[0].FromFederationState)
+		require.False(t, infos[0].LastUpdated.IsZero())
+		require.Equal(t, GatewayListSourceFallback, infos[0].Source)
+		require.Zero(t, infos[0].RaftIndex)
+	})
+
+	t.Run("federation state gateways", func(t *testing.T) {
+		_, err := g.runOnce(context.Background(), 0)
+		require.NoError(t, err)
+
+		infos := g.ListGateways("dc1")
+		require.Len(t, infos, 2)
+		require.Equal(t, GatewayInfo{
+			Address:             "1.2.3.4:5555",
+			Datacenter:          "dc1",
+			NodeName:            "gateway1",
+			Health:              api.HealthPassing,
+			FromFederationState: true,
+			LastUpdated:         infos[0].LastUpdated,
+			Source:              GatewayListSourceFederationState,
+			RaftIndex:           1,
+		}, infos[0])
+		require.Equal(t, "4.3.2.1:9999", infos[1].Address)
+		require.Equal(t, api.HealthWarning, infos[1].Health)
+		require.False(t, infos[0].LastUpdated.IsZero())
+
+		// mutating the returned slice must not corrupt locator state
+		infos[0].Address = "bogus"
+		require.Equal(t, "1.2.3.4:5555", g.ListGateways("dc1")[0].Address)
+	})
+}
+
+func TestGatewayLocator_LeastConns(t *testing.T) {
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{
+			Datacenter:           "dc2",
+			PrimaryDatacenter:    "dc1",
+			GatewaySelectionMode: GatewaySelectionModeLeastConns,
+		},
+	)
+	g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999"}
+
+	t.Run("avoids the loaded gateway", func(t *testing.T) {
+		g.IncGatewayConns("5.6.7.8:5555")
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "8.7.6.5:9999", g.PickGateway("dc3"))
+		}
+	})
+
+	t.Run("follows the counts as they change", func(t *testing.T) {
+		g.IncGatewayConns("8.7.6.5:9999")
+		g.IncGatewayConns("8.7.6.5:9999")
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "5.6.7.8:5555", g.PickGateway("dc3"))
+		}
+
+		g.DecGatewayConns("8.7.6.5:9999")
+		g.DecGatewayConns("8.7.6.5:9999")
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "8.7.6.5:9999", g.PickGateway("dc3"))
+		}
+	})
+
+	t.Run("ties are broken across both gateways", func(t *testing.T) {
+		g.DecGatewayConns("5.6.7.8:5555")
+
+		seen := make(map[string]bool)
+		for i := 0; i < 100; i++ {
+			seen[g.PickGateway("dc3")] = true
+		}
+		require.Len(t, seen, 2)
+	})
+
+	t.Run("counts for departed gateways are dropped", func(t *testing.T) {
+		g.IncGatewayConns("5.6.7.8:5555")
+		g.updateFromState(nil)
+
+		g.connsLock.Lock()
+		defer g.connsLock.Unlock()
+		require.Empty(t, g.gatewayConns)
+	})
+}
+
+func TestGatewayLocator_TagFilter(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	tagged := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta, api.HealthPassing)
+	tagged.Service.Tags = []string{"wanfed", "ingress"}
+
+	untagged := newTestMeshGatewayNode("dc1", "gateway2", "4.3.2.1", 9999, meta, api.HealthPassing)
+
+	nodes := structs.CheckServiceNodes{tagged, untagged}
+
+	t.Run("no filter keeps everything", func(t *testing.T) {
+		out, allTagFiltered := retainGateways(nodes, GatewayWarningModeAllow, GatewayCheckScopeAll, "")
+		require.Len(t, out, 2)
+		require.False(t, allTagFiltered)
+	})
+
+	t.Run("filter keeps only tagged gateways", func(t *testing.T) {
+		out, allTagFiltered := retainGateways(nodes, GatewayWarningModeAllow, GatewayCheckScopeAll, "wanfed")
+		require.Len(t, out, 1)
+		require.Equal(t, "gateway1", out[0].Node.Node)
+		require.False(t, allTagFiltered)
+	})
+
+	t.Run("filter eliminating everything is reported", func(t *testing.T) {
+		out, allTagFiltered := retainGateways(nodes, GatewayWarningModeAllow, GatewayCheckScopeAll, "transit")
+		require.Empty(t, out)
+		require.True(t, allTagFiltered)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		require.NoError(t, ValidateGatewayTagFilter(""))
+		require.NoError(t, ValidateGatewayTagFilter("wanfed"))
+		require.Error(t, ValidateGatewayTagFilter("wan fed"))
+		require.Error(t, ValidateGatewayTagFilter("wanfed\t"))
+	})
+}
+
+func TestGatewayLocator_RenderIPv6Addresses(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	// Some registrations arrive with the brackets already on; rendering
+	// must not double them up.
+	bracketed := newTestMeshGatewayNode("dc1", "gateway1", "[2001:db8::1]", 5555, meta, api.HealthPassing)
+	plain := newTestMeshGatewayNode("dc1", "gateway2", "2001:db8::2", 5555, meta, api.HealthPassing)
+	zoned := newTestMeshGatewayNode("dc1", "gateway3", "fe80::1%eth0", 5555, meta, api.HealthPassing)
+	// An unbalanced bracket can never round-trip through
+	// net.SplitHostPort, so it is skipped rather than published.
+	mangled := newTestMeshGatewayNode("dc1", "gateway4", "2001:db8::3]", 5555, meta, api.HealthPassing)
+
+	entries := renderGatewayEntries(nil, structs.CheckServiceNodes{bracketed, plain, zoned, mangled}, true, "")
+	require.Equal(t, []string{
+		"[2001:db8::1]:5555",
+		"[2001:db8::2]:5555",
+		"[fe80::1%eth0]:5555",
+	}, gatewayAddrs(entries))
+}
+
+func TestGatewayLocator_HostnameAddresses(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	t.Run("capitalization variants dedup to one gateway", func(t *testing.T) {
+		upper := newTestMeshGatewayNode("dc1", "gateway1", "GW.Example.COM", 5555, meta, api.HealthPassing)
+		lower := newTestMeshGatewayNode("dc1", "gateway2", "gw.example.com", 5555, meta, api.HealthPassing)
+		ip := newTestMeshGatewayNode("dc1", "gateway3", "1.2.3.4", 5555, meta, api.HealthPassing)
+
+		entries := renderGatewayEntries(nil, structs.CheckServiceNodes{upper, lower, ip}, true, "")
+		require.Equal(t, []string{"1.2.3.4:5555", "gw.example.com:5555"}, gatewayAddrs(entries))
+		require.Equal(t, 2, entries[1].instances)
+	})
+
+	newLocator := func(t *testing.T, resolve bool, lookup func(string) ([]string, error)) *GatewayLocator {
+		state, err := state.NewStateStore(nil)
+		require.NoError(t, err)
+		for i, dc := range []string{"dc1", "dc2"} {
+			require.NoError(t, state.FederationStateSet(uint64(i+1), &structs.FederationState{
+				Datacenter: dc,
+				MeshGateways: []structs.CheckServiceNode{
+					newTestMeshGatewayNode(
+						dc, "gateway1", "gw.example.com", 5555, meta, api.HealthPassing,
+					),
+				},
+			}))
+		}
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{State: state, isLeader: true},
+			&Config{
+				Datacenter:              "dc2",
+				PrimaryDatacenter:       "dc1",
+				GatewayResolveHostnames: resolve,
+			},
+		)
+		if lookup != nil {
+			g.lookupHost = lookup
+		}
+		_, err = g.runOnce(context.Background(), 0)
+		require.NoError(t, err)
+		return g
+	}
+
+	t.Run("resolved at pick time when configured", func(t *testing.T) {
+		g := newLocator(t, true, func(host string) ([]string, error) {
+			require.Equal(t, "gw.example.com", host)
+			return []string{"10.1.1.1"}, nil
+		})
+		require.Equal(t, "10.1.1.1:5555", g.PickGateway("dc1"))
+	})
+
+	t.Run("resolution failure dials the hostname", func(t *testing.T) {
+		g := newLocator(t, true, func(host string) ([]string, error) {
+			return nil, fmt.Errorf("no such host")
+		})
+		require.Equal(t, "gw.example.com:5555", g.PickGateway("dc1"))
+	})
+
+	t.Run("disabled leaves hostnames alone", func(t *testing.T) {
+		g := newLocator(t, false, func(host string) ([]string, error) {
+			t.Fatal("lookup should not run when resolution is disabled")
+			return nil, nil
+		})
+		require.Equal(t, "gw.example.com:5555", g.PickGateway("dc1"))
+	})
+}
+
+func TestGatewayLocator_AddressFamily(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	dual := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta, api.HealthPassing)
+	dual.Service.TaggedAddresses = map[string]structs.ServiceAddress{
+		structs.TaggedAddressWANIPv4: {Address: "1.2.3.4", Port: 5555},
+		structs.TaggedAddressWANIPv6: {Address: "2001:db8::10"},
+	}
+
+	v4only := newTestMeshGatewayNode("dc1", "gateway2", "4.3.2.1", 9999, meta, api.HealthPassing)
+	v4only.Service.TaggedAddresses = map[string]structs.ServiceAddress{
+		structs.TaggedAddressWANIPv4: {Address: "4.3.2.1", Port: 9999},
+	}
+
+	entries := renderGatewayEntries(nil, structs.CheckServiceNodes{dual, v4only}, true, "")
+	require.Len(t, entries, 2)
+
+	t.Run("render keeps both families", func(t *testing.T) {
+		require.Equal(t, "1.2.3.4:5555", entries[0].addrV4)
+		require.Equal(t, "[2001:db8::10]:5555", entries[0].addrV6)
+		require.Equal(t, "4.3.2.1:9999", entries[1].addrV4)
+		require.Empty(t, entries[1].addrV6)
+	})
+
+	t.Run("prefer ipv6 falls back when missing", func(t *testing.T) {
+		out := applyAddressFamilyPreference(entries, GatewayAddressFamilyPreferIPv6)
+		require.Equal(t, []string{"[2001:db8::10]:5555", "4.3.2.1:9999"}, gatewayAddrs(out))
+	})
+
+	t.Run("prefer ipv4", func(t *testing.T) {
+		out := applyAddressFamilyPreference(entries, GatewayAddressFamilyPreferIPv4)
+		require.Equal(t, []string{"1.2.3.4:5555", "4.3.2.1:9999"}, gatewayAddrs(out))
+	})
+
+	t.Run("require ipv6 drops gateways without one", func(t *testing.T) {
+		out := applyAddressFamilyPreference(entries, GatewayAddressFamilyRequireIPv6)
+		require.Equal(t, []string{"[2001:db8::10]:5555"}, gatewayAddrs(out))
+	})
+
+	t.Run("bare addresses are classified by family", func(t *testing.T) {
+		bare := entriesFromAddrs([]string{"[2001:db8::99]:8443", "9.9.9.9:8443"})
+
+		out := applyAddressFamilyPreference(bare, GatewayAddressFamilyRequireIPv4)
+		require.Equal(t, []string{"9.9.9.9:8443"}, gatewayAddrs(out))
+
+		out = applyAddressFamilyPreference(bare, GatewayAddressFamilyRequireIPv6)
+		require.Equal(t, []string{"[2001:db8::99]:8443"}, gatewayAddrs(out))
+	})
+
+	t.Run("applies at pick time", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{
+				Datacenter:           "dc2",
+				PrimaryDatacenter:    "dc1",
+				GatewayAddressFamily: GatewayAddressFamilyRequireIPv6,
+			},
+		)
+		g.primaryGatewayEntries = entries
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "[2001:db8::10]:5555", g.PickGateway("dc1"))
+		}
+	})
+}
+
+func TestGatewayLocator_PortOverride(t *testing.T) {
+	meta := func(port string) map[string]string {
+		return map[string]string{
+			structs.MetaWANFederationKey:     "1",
+			structs.MetaWANFederationPortKey: port,
+		}
+	}
+
+	t.Run("override applies to wan and lan renderings", func(t *testing.T) {
+		gw := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta("8443"), api.HealthPassing)
+
+		wan := renderGatewayEntries(nil, structs.CheckServiceNodes{gw}, true, "")
+		require.Equal(t, []string{"1.2.3.4:8443"}, gatewayAddrs(wan))
+
+		lan := renderGatewayEntries(nil, structs.CheckServiceNodes{gw}, false, "")
+		require.Equal(t, []string{"1.2.3.4:8443"}, gatewayAddrs(lan))
+	})
+
+	t.Run("override applies to tagged family addresses", func(t *testing.T) {
+		gw := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta("8443"), api.HealthPassing)
+		gw.Service.TaggedAddresses = map[string]structs.ServiceAddress{
+			structs.TaggedAddressWANIPv6: {Address: "2001:db8::10", Port: 5555},
+		}
+
+		entries := renderGatewayEntries(nil, structs.CheckServiceNodes{gw}, true, "")
+		require.Equal(t, "[2001:db8::10]:8443", entries[0].addrV6)
+	})
+
+	t.Run("invalid values keep the catalog port", func(t *testing.T) {
+		for _, bad := range []string{"zero", "0", "-1", "70000"} {
+			gw := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta(bad), api.HealthPassing)
+
+			_, err := gatewayPortOverride(gw)
+			require.Error(t, err, bad)
+
+			entries := renderGatewayEntries(nil, structs.CheckServiceNodes{gw}, true, "")
+			require.Equal(t, []string{"1.2.3.4:5555"}, gatewayAddrs(entries))
+		}
+	})
+}
+
+func TestGatewayLocator_LastGood(t *testing.T) {
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{
+			Datacenter:           "dc2",
+			PrimaryDatacenter:    "dc1",
+			GatewaySelectionMode: GatewaySelectionModeLastGood,
+		},
+	)
+	g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999"}
+
+	t.Run("no success observed falls back to random", func(t *testing.T) {
+		require.Contains(t, []string{"5.6.7.8:5555", "8.7.6.5:9999"}, g.PickGateway("dc3"))
+	})
+
+	t.Run("sticks to the last reported success", func(t *testing.T) {
+		g.ReportGatewaySuccess("5.6.7.8:5555")
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "5.6.7.8:5555", g.PickGateway("dc3"))
+		}
+	})
+
+	t.Run("invalidated by a reported failure", func(t *testing.T) {
+		g.MarkGatewayFailed("5.6.7.8:5555", errors.New("connection refused"))
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "8.7.6.5:9999", g.PickGateway("dc3"))
+		}
+	})
+
+	t.Run("invalidated by catalog churn", func(t *testing.T) {
+		g.ReportGatewaySuccess("8.7.6.5:9999")
+
+		g.updateFromState(nil)
+		g.localGateways = []string{"5.6.7.8:5555"}
+
+		g.lastGoodLock.Lock()
+		defer g.lastGoodLock.Unlock()
+		require.Empty(t, g.lastGoodLocal)
+		require.Empty(t, g.lastGoodPrimary)
+	})
+}
+
+func TestGatewayLocator_ShuffledRoundRobin(t *testing.T) {
+	addrs := []string{"1.1.1.1:443", "2.2.2.2:443", "3.3.3.3:443", "4.4.4.4:443"}
+
+	newLocator := func(t *testing.T, nodeID string) *GatewayLocator {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{
+				Datacenter:           "dc2",
+				PrimaryDatacenter:    "dc1",
+				NodeID:               types.NodeID(nodeID),
+				GatewaySelectionMode: GatewaySelectionModeShuffledRoundRobin,
+			},
+		)
+		g.localGateways = addrs
+		return g
+	}
+
+	permutation := func(g *GatewayLocator) []string {
+		out := make([]string, 0, len(addrs))
+		for i := 0; i < len(addrs); i++ {
+			out = append(out, g.PickGateway("dc3"))
+		}
+		return out
+	}
+
+	t.Run("each cycle covers every gateway once", func(t *testing.T) {
+		g := newLocator(t, "c3ab8ff1-3725-40c9-a851-62f0f0f0f0f0")
+		perm := permutation(g)
+		require.ElementsMatch(t, addrs, perm)
+		require.Equal(t, perm, permutation(g))
+	})
+
+	t.Run("permutation is stable for the same node ID", func(t *testing.T) {
+		a := newLocator(t, "c3ab8ff1-3725-40c9-a851-62f0f0f0f0f0")
+		b := newLocator(t, "c3ab8ff1-3725-40c9-a851-62f0f0f0f0f0")
+		require.Equal(t, permutation(a), permutation(b))
+	})
+
+	t.Run("different node IDs walk different orders", func(t *testing.T) {
+		seen := make(map[string]bool)
+		for _, id := range []string{
+			"c3ab8ff1-3725-40c9-a851-62f0f0f0f0f0",
+			"13753e6f-bd9d-45a2-a4c6-50e7d63f6a70",
+			"b15c9f2c-09e0-4e02-b3e9-1ff34d20d1f0",
+			"8a2ae8fc-7f2f-4a33-96a1-7bb45db3bc57",
+		} {
+			perm := permutation(newLocator(t, id))
+			seen[strings.Join(perm, ",")] = true
+		}
+		require.True(t, len(seen) > 1, "expected differing permutations across node IDs")
+	})
+
+	t.Run("membership changes preserve relative order", func(t *testing.T) {
+		g := newLocator(t, "c3ab8ff1-3725-40c9-a851-62f0f0f0f0f0")
+		before := permutation(g)
+
+		g.localGateways = append([]string{}, addrs...)
+		g.localGateways = append(g.localGateways, "5.5.5.5:443")
+		after := make([]string, 0, 5)
+		for i := 0; i < 5; i++ {
+			after = append(after, g.PickGateway("dc3"))
+		}
+		require.ElementsMatch(t, append(append([]string{}, addrs...), "5.5.5.5:443"), after)
+
+		// strip the newcomer; the survivors keep their relative order,
+		// though the walk may start at a different offset
+		survivors := make([]string, 0, len(addrs))
+		for _, addr := range after {
+			if addr != "5.5.5.5:443" {
+				survivors = append(survivors, addr)
+			}
+		}
+		require.Equal(t, rotateToMatch(t, before, survivors[0]), survivors)
+	})
+}
+
+// rotateToMatch rotates perm so it starts at addr, for comparing round-robin
+// walks that begin at different offsets.
+func rotateToMatch(t *testing.T, perm []string, addr string) []string {
+	for i := range perm {
+		if perm[i] == addr {
+			return append(append([]string{}, perm[i:]...), perm[:i]...)
+		}
+	}
+	t.Fatalf("address %q not found in permutation %v", addr, perm)
+	return nil
+}
+
+func TestGatewayLocator_CapacityHints(t *testing.T) {
+	meta := func(maxConns string) map[string]string {
+		m := map[string]string{structs.MetaWANFederationKey: "1"}
+		if maxConns != "" {
+			m[structs.MetaWANFederationMaxConnsKey] = maxConns
+		}
+		return m
+	}
+
+	t.Run("parsing", func(t *testing.T) {
+		require.Equal(t, 10, gatewayMaxConns(newTestMeshGatewayNode("dc1", "gw", "1.2.3.4", 5555, meta("10"), api.HealthPassing)))
+		require.Equal(t, 0, gatewayMaxConns(newTestMeshGatewayNode("dc1", "gw", "1.2.3.4", 5555, meta(""), api.HealthPassing)))
+		require.Equal(t, 0, gatewayMaxConns(newTestMeshGatewayNode("dc1", "gw", "1.2.3.4", 5555, meta("lots"), api.HealthPassing)))
+		require.Equal(t, 0, gatewayMaxConns(newTestMeshGatewayNode("dc1", "gw", "1.2.3.4", 5555, meta("-1"), api.HealthPassing)))
+	})
+
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+	g.localGatewayEntries = []gatewayEntry{
+		{addr: "5.6.7.8:5555", health: api.HealthPassing, weight: 1, maxConns: 2},
+		{addr: "8.7.6.5:9999", health: api.HealthPassing, weight: 1, maxConns: 2},
+	}
+	g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999"}
+
+	t.Run("saturated gateway is skipped", func(t *testing.T) {
+		g.IncGatewayConns("5.6.7.8:5555")
+		g.IncGatewayConns("5.6.7.8:5555")
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "8.7.6.5:9999", g.PickGateway("dc3"))
+		}
+	})
+
+	t.Run("all saturated keeps the full list", func(t *testing.T) {
+		g.IncGatewayConns("8.7.6.5:9999")
+		g.IncGatewayConns("8.7.6.5:9999")
+		require.NotEmpty(t, g.PickGateway("dc3"))
+	})
+
+	t.Run("capacity frees up as connections close", func(t *testing.T) {
+		g.DecGatewayConns("5.6.7.8:5555")
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "5.6.7.8:5555", g.PickGateway("dc3"))
+		}
+	})
+}
+
+func TestGatewayLocator_MaxPerDatacenter(t *testing.T) {
+	entries := entriesFromAddrs([]string{
+		"1.1.1.1:443", "2.2.2.2:443", "3.3.3.3:443", "4.4.4.4:443", "5.5.5.5:443",
+	})
+
+	t.Run("under the limit is untouched", func(t *testing.T) {
+		require.Equal(t, entries, truncateGatewayEntries(entries, 5, 42))
+		require.Equal(t, entries, truncateGatewayEntries(entries, 0, 42))
+	})
+
+	t.Run("truncation is stable and sorted", func(t *testing.T) {
+		a := truncateGatewayEntries(entries, 3, 42)
+		require.Len(t, a, 3)
+		require.Equal(t, a, truncateGatewayEntries(entries, 3, 42))
+		require.True(t, sort.SliceIsSorted(a, func(i, j int) bool { return a[i].addr < a[j].addr }))
+	})
+
+	t.Run("membership churn keeps the surviving subset", func(t *testing.T) {
+		before := truncateGatewayEntries(entries, 3, 42)
+		after := truncateGatewayEntries(entries[:4], 3, 42)
+
+		beforeSet := make(map[string]bool)
+		for _, e := range before {
+			beforeSet[e.addr] = true
+		}
+		overlap := 0
+		for _, e := range after {
+			if beforeSet[e.addr] {
+				overlap++
+			}
+		}
+		require.True(t, overlap >= 2, "expected most of the subset to survive")
+	})
+
+	t.Run("different seeds keep different subsets", func(t *testing.T) {
+		seen := make(map[string]bool)
+		for seed := uint64(1); seed <= 8; seed++ {
+			subset := truncateGatewayEntries(entries, 2, seed)
+			seen[subset[0].addr+","+subset[1].addr] = true
+		}
+		require.True(t, len(seen) > 1, "expected differing subsets across seeds")
+	})
+
+	t.Run("applied by updateFromState", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{
+				Datacenter:              "dc1",
+				PrimaryDatacenter:       "dc1",
+				GatewayMaxPerDatacenter: 1,
+			},
+		)
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter: "dc1",
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing),
+				newTestMeshGatewayNode("dc1", "gateway2", "4.3.2.1", 9999, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing),
+			},
+		}})
+		require.Len(t, g.listGateways(false), 1)
+	})
+}
+
+func TestGatewayLocator_PickGatewayDetailed(t *testing.T) {
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	t.Run("no gateways", func(t *testing.T) {
+		require.Equal(t, PickedGateway{}, g.PickGatewayDetailed("dc1"))
+	})
+
+	t.Run("fallback addresses are flagged", func(t *testing.T) {
+		g.RefreshPrimaryGatewayFallbackAddresses([]string{"7.7.7.7:8443"})
+		require.Equal(t, PickedGateway{
+			Addr:           "7.7.7.7:8443",
+			Datacenter:     "dc1",
+			FromFallback:   true,
+			CandidateCount: 1,
+		}, g.PickGatewayDetailed("dc1"))
+	})
+
+	t.Run("catalog entries carry the node name", func(t *testing.T) {
+		g.localGatewayEntries = []gatewayEntry{
+			{addr: "5.6.7.8:5555", node: "gateway1", health: api.HealthPassing, weight: 1},
+		}
+		require.Equal(t, PickedGateway{
+			Addr:           "5.6.7.8:5555",
+			NodeName:       "gateway1",
+			Datacenter:     "dc2",
+			CandidateCount: 1,
+		}, g.PickGatewayDetailed("dc3"))
+
+		require.Equal(t, "5.6.7.8:5555", g.PickGateway("dc3"))
+	})
+}
+
+func TestGatewayLocator_UseWANAddressForLocalGateways(t *testing.T) {
+	gw := newTestMeshGatewayNode(
+		"dc2", "gateway1", "10.1.2.3", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+	)
+	gw.Service.TaggedAddresses = map[string]structs.ServiceAddress{
+		structs.TaggedAddressWAN: {Address: "203.0.113.9", Port: 443},
+	}
+	results := []*structs.FederationState{{
+		Datacenter:   "dc2",
+		MeshGateways: structs.CheckServiceNodes{gw},
+	}}
+
+	t.Run("disabled renders the LAN address", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+		)
+		g.updateFromState(results)
+		require.Equal(t, []string{"10.1.2.3:5555"}, g.listGateways(false))
+	})
+
+	t.Run("enabled renders the WAN address", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{
+				Datacenter:                           "dc2",
+				PrimaryDatacenter:                    "dc1",
+				GatewayUseWANAddressForLocalGateways: true,
+			},
+		)
+		g.updateFromState(results)
+		require.Equal(t, []string{"203.0.113.9:443"}, g.listGateways(false))
+	})
+}
+
+func TestGatewayLocator_NarrowBlockingQuery(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	newFedState := func(dc, ip string) *structs.FederationState {
+		return &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(dc, "gateway1", ip, 5555, meta, api.HealthPassing),
+			},
+			UpdatedAt: time.Now().UTC(),
+		}
+	}
+
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	require.NoError(t, state.FederationStateSet(1, newFedState("dc1", "1.2.3.4")))
+	require.NoError(t, state.FederationStateSet(2, newFedState("dc2", "5.6.7.8")))
+	require.NoError(t, state.FederationStateSet(3, newFedState("dc3", "9.9.9.9")))
+
+	t.Run("watches only the requested datacenters", func(t *testing.T) {
+		ws := memdb.NewWatchSet()
+		idx, results, err := state.FederationStateBatchGet(ws, []string{"dc2", "dc1"})
+		require.NoError(t, err)
+		require.Equal(t, uint64(3), idx)
+		require.Len(t, results, 2)
+		require.Equal(t, "dc2", results[0].Datacenter)
+		require.Equal(t, "dc1", results[1].Datacenter)
+
+		// churn in an unrelated datacenter must not fire the watch
+		require.NoError(t, state.FederationStateSet(4, newFedState("dc3", "9.9.9.10")))
+		require.True(t, ws.Watch(time.After(50*time.Millisecond)), "unexpected wakeup for dc3")
+
+		// a watched datacenter does
+		require.NoError(t, state.FederationStateSet(5, newFedState("dc2", "5.6.7.9")))
+		require.False(t, ws.Watch(time.After(time.Second)), "expected wakeup for dc2")
+	})
+
+	t.Run("missing entries install a watch", func(t *testing.T) {
+		ws := memdb.NewWatchSet()
+		_, results, err := state.FederationStateBatchGet(ws, []string{"dc4"})
+		require.NoError(t, err)
+		require.Empty(t, results)
+
+		require.NoError(t, state.FederationStateSet(6, newFedState("dc4", "2.2.2.2")))
+		require.False(t, ws.Watch(time.After(time.Second)), "expected wakeup for dc4 creation")
+	})
+
+	t.Run("runOnce sees local and primary only", func(t *testing.T) {
+		tsd := &testServerDelegate{State: state, isLeader: true}
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			tsd,
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+		)
+		idx, err := g.runOnce(context.Background(), 0)
+		require.NoError(t, err)
+		require.Equal(t, uint64(6), idx)
+		require.Equal(t, []string{"5.6.7.9:5555"}, g.listGateways(false))
+		require.Equal(t, []string{"1.2.3.4:5555"}, g.listGateways(true))
+	})
+}
+
+func TestGatewayLocator_FederationStateAge(t *testing.T) {
+	now := time.Now()
+
+	t.Run("age computation", func(t *testing.T) {
+		_, ok := federationStateAge(now, &structs.FederationState{})
+		require.False(t, ok)
+
+		age, ok := federationStateAge(now, &structs.FederationState{
+			UpdatedAt: now.Add(-90 * time.Second),
+		})
+		require.True(t, ok)
+		require.Equal(t, 90*time.Second, age)
+
+		// clock skew between datacenters must not yield a negative age
+		age, ok = federationStateAge(now, &structs.FederationState{
+			UpdatedAt: now.Add(5 * time.Second),
+		})
+		require.True(t, ok)
+		require.Equal(t, time.Duration(0), age)
+	})
+
+	t.Run("warn threshold defaults", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+		)
+		require.Equal(t, defaultGatewayFederationStateStaleThreshold, g.staleThreshold)
+	})
+}
+
+func TestGatewayLocator_WarningDeprioritize(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	passing := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta, api.HealthPassing)
+	warning := newTestMeshGatewayNode("dc1", "gateway2", "4.3.2.1", 9999, meta, api.HealthWarning)
+
+	newLocator := func(t *testing.T, percent int) *GatewayLocator {
+		return NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{
+				Datacenter:                  "dc1",
+				PrimaryDatacenter:           "dc1",
+				GatewayWarningMode:          GatewayWarningModeDeprioritize,
+				GatewayWarningWeightPercent: percent,
+			},
+		)
+	}
+
+	t.Run("warning weights are scaled down", func(t *testing.T) {
+		g := newLocator(t, 0) // default percent
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter:   "dc1",
+			MeshGateways: structs.CheckServiceNodes{passing, warning},
+		}})
+		require.Equal(t, []string{"1.2.3.4:5555", "4.3.2.1:9999"}, g.listGateways(false))
+		require.Equal(t, 100, g.localGatewayEntries[0].weight)
+		require.Equal(t, 10, g.localGatewayEntries[1].weight)
+	})
+
+	t.Run("configured percent applies", func(t *testing.T) {
+		g := newLocator(t, 50)
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter:   "dc1",
+			MeshGateways: structs.CheckServiceNodes{passing, warning},
+		}})
+		require.Equal(t, 100, g.localGatewayEntries[0].weight)
+		require.Equal(t, 50, g.localGatewayEntries[1].weight)
+	})
+
+	t.Run("all-warning list serves at full weight", func(t *testing.T) {
+		warning2 := newTestMeshGatewayNode("dc1", "gateway3", "5.6.7.8", 5555, meta, api.HealthWarning)
+		g := newLocator(t, 0)
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter:   "dc1",
+			MeshGateways: structs.CheckServiceNodes{warning, warning2},
+		}})
+		require.Equal(t, 1, g.localGatewayEntries[0].weight)
+		require.Equal(t, 1, g.localGatewayEntries[1].weight)
+	})
+
+	t.Run("distribution favors passing gateways", func(t *testing.T) {
+		policy := weightedSelectionPolicy{intn: rand.New(rand.NewSource(1)).Intn}
+		entries := []gatewayEntry{
+			{addr: "passing", health: api.HealthPassing, weight: 100},
+			{addr: "warning", health: api.HealthWarning, weight: 10},
+		}
+		counts := make(map[string]int)
+		for i := 0; i < 1100; i++ {
+			counts[policy.Pick(entries)]++
+		}
+		// expected split is roughly 1000/100
+		require.Greater(t, counts["passing"], 900)
+		require.Greater(t, counts["warning"], 0)
+		require.Less(t, counts["warning"], 300)
+	})
+}
+
+func TestGatewayLocator_ForceRefresh(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	require.NoError(t, state.FederationStateSet(2, &structs.FederationState{
+		Datacenter: "dc1",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc1", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+	}))
+
+	tsd := &testServerDelegate{State: state, isLeader: true}
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	// safe before Run has started; repeated calls coalesce into one request
+	g.ForceRefresh()
+	g.ForceRefresh()
+	require.Len(t, g.forceRefreshCh, 1)
+
+	stopCh := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		g.RunWithStopCh(stopCh)
+		close(done)
+	}()
+	defer func() {
+		close(stopCh)
+		<-done
+	}()
+
+	// wait for the loop to move past the initial fetch so later queries carry
+	// the fetched index
+	timer := &retry.Timer{Timeout: 10 * time.Second, Wait: 50 * time.Millisecond}
+	retry.RunWith(timer, t, func(r *retry.R) {
+		calls := tsd.CallList()
+		if len(calls) < 2 || calls[1] == 0 {
+			r.Fatal("waiting for a blocking fetch")
+		}
+	})
+
+	g.ForceRefresh()
+	retry.RunWith(timer, t, func(r *retry.R) {
+		for _, c := range tsd.CallList()[1:] {
+			if c == 0 {
+				return // the forced refresh dropped the query index
+			}
+		}
+		r.Fatal("no forced refresh observed")
+	})
+}
+
+func TestGatewayLocator_WatchPrimaryGatewayReadiness(t *testing.T) {
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch := g.WatchPrimaryGatewayReadiness(ctx)
+
+	recv := func(t *testing.T) bool {
+		t.Helper()
+		select {
+		case v := <-ch:
+			return v
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for a readiness transition")
+			return false
+		}
+	}
+	requireLatchClosed := func(t *testing.T) {
+		t.Helper()
+		select {
+		case <-g.PrimaryMeshGatewayAddressesReadyCh():
+		default:
+			t.Fatal("expected the once-closed readiness channel to be closed")
+		}
+	}
+
+	primary := []*structs.FederationState{{
+		Datacenter: "dc1",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc1", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+	}}
+
+	// the current state arrives first
+	require.False(t, recv(t))
+
+	g.updateFromState(primary)
+	require.True(t, recv(t))
+	requireLatchClosed(t)
+
+	// federation state wiped: the watch re-arms, the latch stays closed
+	g.updateFromState(nil)
+	require.False(t, recv(t))
+	requireLatchClosed(t)
+
+	g.updateFromState(primary)
+	require.True(t, recv(t))
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		require.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("watch channel not closed after cancellation")
+	}
+}
+
+func TestGatewayLocator_LocalFederationStateMissing(t *testing.T) {
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	local := &structs.FederationState{
+		Datacenter: "dc2",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc2", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+	}
+	primary := &structs.FederationState{Datacenter: "dc1"}
+
+	// absence before the first publication is normal during bootstrap
+	g.updateFromState([]*structs.FederationState{primary})
+	require.Len(t, g.localStateMissingCh, 0)
+
+	g.updateFromState([]*structs.FederationState{primary, local})
+	require.Len(t, g.localStateMissingCh, 0)
+
+	// the entry disappearing queues exactly one repair signal
+	g.updateFromState([]*structs.FederationState{primary})
+	require.Len(t, g.localStateMissingCh, 1)
+	g.updateFromState([]*structs.FederationState{primary})
+	require.Len(t, g.localStateMissingCh, 1)
+
+	<-g.LocalFederationStateMissingCh()
+
+	// a fresh disappearance after repair signals again
+	g.updateFromState([]*structs.FederationState{primary, local})
+	g.updateFromState([]*structs.FederationState{primary})
+	require.Len(t, g.localStateMissingCh, 1)
+}
+
+func TestGatewayLocator_PrimaryIsLocal(t *testing.T) {
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{Datacenter: "dc1", PrimaryDatacenter: "dc1"},
+	)
+	g.localGateways = []string{"1.2.3.4:5555"}
+
+	// a stale fallback configuration must not shadow the healthy local list
+	g.RefreshPrimaryGatewayFallbackAddresses([]string{"7.7.7.7:8443"})
+
+	t.Run("primary datacenter is served from the local list", func(t *testing.T) {
+		require.Empty(t, g.primaryGateways)
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "1.2.3.4:5555", g.PickGateway("dc1"))
+		}
+		picked := g.PickGatewayDetailed("dc1")
+		require.Equal(t, "1.2.3.4:5555", picked.Addr)
+		require.False(t, picked.FromFallback)
+	})
+
+	t.Run("secondaries still use the primary path", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+		)
+		g.RefreshPrimaryGatewayFallbackAddresses([]string{"7.7.7.7:8443"})
+		require.Equal(t, "7.7.7.7:8443", g.PickGateway("dc1"))
+	})
+}
+
+func TestGatewayLocator_DedupeAddresses(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	t.Run("instances behind one address collapse to one candidate", func(t *testing.T) {
+		gw1 := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta, api.HealthPassing)
+		gw2 := newTestMeshGatewayNode("dc1", "gateway2", "1.2.3.4", 5555, meta, api.HealthWarning)
+		gw3 := newTestMeshGatewayNode("dc1", "gateway3", "1.2.3.4", 5555, meta, api.HealthPassing)
+		other := newTestMeshGatewayNode("dc1", "gateway4", "5.6.7.8", 5555, meta, api.HealthPassing)
+
+		entries := renderGatewayEntries(nil, structs.CheckServiceNodes{gw1, gw2, gw3, other}, true, "")
+		require.Equal(t, []string{"1.2.3.4:5555", "5.6.7.8:5555"}, gatewayAddrs(entries))
+		require.Equal(t, 3, entries[0].instances)
+		require.Equal(t, api.HealthPassing, entries[0].health)
+		require.Equal(t, 1, entries[1].instances)
+	})
+
+	t.Run("duplicates translate into weight", func(t *testing.T) {
+		gw1 := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta, api.HealthPassing)
+		gw1.Service.Weights = &structs.Weights{Passing: 5}
+		gw2 := newTestMeshGatewayNode("dc1", "gateway2", "1.2.3.4", 5555, meta, api.HealthPassing)
+		gw2.Service.Weights = &structs.Weights{Passing: 2}
+
+		entries := renderGatewayEntries(nil, structs.CheckServiceNodes{gw1, gw2}, true, "")
+		require.Len(t, entries, 1)
+		require.Equal(t, 7, entries[0].weight)
+	})
+
+	t.Run("capacity hints combine", func(t *testing.T) {
+		capMeta := func(maxConns string) map[string]string {
+			return map[string]string{
+				structs.MetaWANFederationKey:         "1",
+				structs.MetaWANFederationMaxConnsKey: maxConns,
+			}
+		}
+		gw1 := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, capMeta("10"), api.HealthPassing)
+		gw2 := newTestMeshGatewayNode("dc1", "gateway2", "1.2.3.4", 5555, capMeta("15"), api.HealthPassing)
+		unlimited := newTestMeshGatewayNode("dc1", "gateway3", "1.2.3.4", 5555, meta, api.HealthPassing)
+
+		entries := renderGatewayEntries(nil, structs.CheckServiceNodes{gw1, gw2}, true, "")
+		require.Len(t, entries, 1)
+		require.Equal(t, 25, entries[0].maxConns)
+
+		entries = renderGatewayEntries(nil, structs.CheckServiceNodes{gw1, gw2, unlimited}, true, "")
+		require.Len(t, entries, 1)
+		require.Equal(t, 0, entries[0].maxConns)
+	})
+
+	t.Run("log formatting shows instance counts", func(t *testing.T) {
+		require.Equal(t, []string{"1.2.3.4:5555 (x3)", "5.6.7.8:5555"}, formatGatewayAddrsForLog([]gatewayEntry{
+			{addr: "1.2.3.4:5555", instances: 3},
+			{addr: "5.6.7.8:5555", instances: 1},
+		}))
+	})
+}
+
+func TestGatewayLocator_MalformedAddresses(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	t.Run("render drops gateways without a usable address", func(t *testing.T) {
+		good := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta, api.HealthPassing)
+		noPort := newTestMeshGatewayNode("dc1", "gateway2", "5.6.7.8", 0, meta, api.HealthPassing)
+		noAddr := newTestMeshGatewayNode("dc1", "gateway3", "", 5555, meta, api.HealthPassing)
+
+		entries := renderGatewayEntries(testutil.Logger(t), structs.CheckServiceNodes{good, noPort, noAddr}, true, "")
+		require.Equal(t, []string{"1.2.3.4:5555"}, gatewayAddrs(entries))
+	})
+
+	t.Run("fallback rejects malformed addresses", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{
+				Datacenter:        "dc2",
+				PrimaryDatacenter: "dc1",
+			},
+		)
+		g.RefreshPrimaryGatewayFallbackAddresses([]string{
+			"7.7.7.7:8443",
+			"garbage",
+			"8.8.8.8:0",
+			"9.9.9.9:notaport",
+			":8443",
+		})
+		require.Equal(t, []string{"7.7.7.7:8443"}, g.PrimaryGatewayFallbackAddresses())
+	})
+}
+
+func TestGatewayLocator_CheckScope(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	unrelatedCritical := newTestMeshGatewayNode("dc2", "gateway1", "5.6.7.8", 5555, meta, api.HealthPassing)
+	unrelatedCritical.Checks = append(unrelatedCritical.Checks, &structs.HealthCheck{
+		CheckID: "disk-usage",
+		Name:    "disk usage",
+		Status:  api.HealthCritical,
+	})
+
+	serfCritical := newTestMeshGatewayNode("dc2", "gateway2", "8.7.6.5", 9999, meta, api.HealthPassing)
+	serfCritical.Checks = append(serfCritical.Checks, &structs.HealthCheck{
+		CheckID: structs.SerfCheckID,
+		Name:    structs.SerfCheckName,
+		Status:  api.HealthCritical,
+	})
+
+	serviceCritical := newTestMeshGatewayNode("dc2", "gateway3", "9.9.9.9", 1111, meta, api.HealthCritical)
+
+	nodes := structs.CheckServiceNodes{unrelatedCritical, serfCritical, serviceCritical}
+
+	t.Run("all scope drops any critical check", func(t *testing.T) {
+		out, _ := retainGateways(nodes, GatewayWarningModeAllow, GatewayCheckScopeAll, "")
+		require.Empty(t, out)
+	})
+
+	t.Run("service scope ignores unrelated node checks", func(t *testing.T) {
+		out, _ := retainGateways(nodes, GatewayWarningModeAllow, GatewayCheckScopeService, "")
+		require.Len(t, out, 1)
+		require.Equal(t, "gateway1", out[0].Node.Node)
+	})
+
+	t.Run("synthetic wanfed availability check never collapses health", func(t *testing.T) {
+		// A gateway co-located with a server carries the server's synthetic
+		// availability check, which starts critical; counting it would keep
+		// the gateway unselectable forever.
+		colocated := newTestMeshGatewayNode("dc2", "gateway4", "4.4.4.4", 4444, meta, api.HealthPassing)
+		colocated.Checks = append(colocated.Checks, &structs.HealthCheck{
+			CheckID: structs.WANFedGatewayAvailCheckID,
+			Name:    "Mesh Gateway Availability",
+			Status:  api.HealthCritical,
+		})
+
+		out, _ := retainGateways(structs.CheckServiceNodes{colocated}, GatewayWarningModeAllow, GatewayCheckScopeAll, "")
+		require.Len(t, out, 1)
+		require.Equal(t, api.HealthPassing, gatewayHealthStatus(out[0]))
+	})
+}
+
+func TestGatewayLocator_PreferLocalNode(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	colocated := newTestMeshGatewayNode("dc2", "server1", "5.6.7.8", 5555, meta, api.HealthPassing)
+	other := newTestMeshGatewayNode("dc2", "gateway1", "8.7.6.5", 9999, meta, api.HealthPassing)
+
+	newLocator := func(preferLocal bool) *GatewayLocator {
+		return NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{
+				Datacenter:             "dc2",
+				PrimaryDatacenter:      "dc1",
+				NodeName:               "server1",
+				GatewayPreferLocalNode: preferLocal,
+			},
+		)
+	}
+
+	t.Run("co-located gateway wins when enabled", func(t *testing.T) {
+		g := newLocator(true)
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter:   "dc2",
+			MeshGateways: []structs.CheckServiceNode{colocated, other},
+		}})
+
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "5.6.7.8:5555", g.PickGateway("dc3"))
+		}
+	})
+
+	t.Run("normal selection when disabled", func(t *testing.T) {
+		g := newLocator(false)
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter:   "dc2",
+			MeshGateways: []structs.CheckServiceNode{colocated, other},
+		}})
+
+		seen := make(map[string]int)
+		for i := 0; i < 50; i++ {
+			seen[g.PickGateway("dc3")]++
+		}
+		require.Len(t, seen, 2)
+	})
+
+	t.Run("critical co-located gateway falls back to normal selection", func(t *testing.T) {
+		criticalColocated := newTestMeshGatewayNode("dc2", "server1", "5.6.7.8", 5555, meta, api.HealthCritical)
+
+		g := newLocator(true)
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter:   "dc2",
+			MeshGateways: []structs.CheckServiceNode{criticalColocated, other},
+		}})
+
+		require.Equal(t, []string{"8.7.6.5:9999"}, g.listGateways(false))
+	})
+}
+
+func TestGatewayLocator_ProtocolCompatibility(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+	v2Meta := map[string]string{
+		structs.MetaWANFederationKey:         "1",
+		structs.MetaWANFederationProtocolKey: "2",
+	}
+	rangeMeta := map[string]string{
+		structs.MetaWANFederationKey:         "1",
+		structs.MetaWANFederationProtocolKey: "1-2",
+	}
+
+	v1only := newTestMeshGatewayNode("dc2", "gateway1", "5.6.7.8", 5555, meta, api.HealthPassing)
+	v2only := newTestMeshGatewayNode("dc2", "gateway2", "8.7.6.5", 9999, v2Meta, api.HealthPassing)
+	ranged := newTestMeshGatewayNode("dc2", "gateway3", "9.9.9.9", 1111, rangeMeta, api.HealthPassing)
+
+	t.Run("range parsing", func(t *testing.T) {
+		min, max := gatewayProtocolRange(v1only)
+		require.Equal(t, 1, min)
+		require.Equal(t, 1, max)
+
+		min, max = gatewayProtocolRange(ranged)
+		require.Equal(t, 1, min)
+		require.Equal(t, 2, max)
+	})
+
+	t.Run("v1 server skips v2-only gateways", func(t *testing.T) {
+		out, allIncompatible := filterProtocolIncompatibleGateways(
+			structs.CheckServiceNodes{v1only, v2only, ranged}, 1)
+		require.False(t, allIncompatible)
+		require.Len(t, out, 2)
+	})
+
+	t.Run("all incompatible yields empty with flag", func(t *testing.T) {
+		out, allIncompatible := filterProtocolIncompatibleGateways(
+			structs.CheckServiceNodes{v2only}, 1)
+		require.True(t, allIncompatible)
+		require.Empty(t, out)
+	})
+
+	t.Run("locator filters on update", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1", GatewayProtocolVersion: 2},
+		)
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter:   "dc2",
+			MeshGateways: []structs.CheckServiceNode{v1only, v2only, ranged},
+		}})
+
+		require.Equal(t, []string{"8.7.6.5:9999", "9.9.9.9:1111"}, g.listGateways(false))
+	})
+}
+
+func TestGatewayLocator_NoImmediateRepeat(t *testing.T) {
+	t.Run("consecutive picks differ while alternatives exist", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+		)
+		g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999", "9.9.9.9:1111"}
+
+		prev := g.PickGateway("dc3")
+		for i := 0; i < 100; i++ {
+			next := g.PickGateway("dc3")
+			require.NotEqual(t, prev, next)
+			prev = next
+		}
+	})
+
+	t.Run("single gateway is returned repeatedly", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+		)
+		g.localGateways = []string{"5.6.7.8:5555"}
+
+		for i := 0; i < 10; i++ {
+			require.Equal(t, "5.6.7.8:5555", g.PickGateway("dc3"))
+		}
+	})
+}
+
+func TestGatewayLocator_SegmentAddresses(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	tagged := newTestMeshGatewayNode("dc2", "gateway1", "5.6.7.8", 5555, meta, api.HealthPassing)
+	tagged.Service.TaggedAddresses = map[string]structs.ServiceAddress{
+		"alpha": {Address: "192.168.5.1", Port: 8443},
+	}
+	untagged := newTestMeshGatewayNode("dc2", "gateway2", "8.7.6.5", 9999, meta, api.HealthPassing)
+
+	dc2fed := &structs.FederationState{
+		Datacenter:   "dc2",
+		MeshGateways: []structs.CheckServiceNode{tagged, untagged},
+	}
+
+	t.Run("segment tagged address preferred for local list", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1", Segment: "alpha"},
+		)
+		g.updateFromState([]*structs.FederationState{dc2fed})
+
+		require.Equal(t, []string{"192.168.5.1:8443", "8.7.6.5:9999"}, g.listGateways(false))
+	})
+
+	t.Run("default lan address without a segment", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+		)
+		g.updateFromState([]*structs.FederationState{dc2fed})
+
+		require.Equal(t, []string{"5.6.7.8:5555", "8.7.6.5:9999"}, g.listGateways(false))
+	})
+}
+
+func TestGatewayLocator_AddressOverrides(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+	dc2fed := &structs.FederationState{
+		Datacenter: "dc2",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode("dc2", "gateway1", "5.6.7.8", 5555, meta, api.HealthPassing),
+		},
+	}
+
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{
+			Datacenter:        "dc2",
+			PrimaryDatacenter: "dc1",
+			GatewayAddressOverrides: map[string][]string{
+				"dc2": {"10.0.0.1:443"},
+			},
+		},
+	)
+	g.updateFromState([]*structs.FederationState{dc2fed})
+
+	t.Run("override wins over the catalog", func(t *testing.T) {
+		require.Equal(t, []string{"10.0.0.1:443"}, g.listGateways(false))
+		require.Equal(t, "10.0.0.1:443", g.PickGateway("dc3"))
+	})
+
+	t.Run("primary list is unaffected without an override", func(t *testing.T) {
+		require.Empty(t, g.listGateways(true))
+	})
+
+	t.Run("overrides are reloadable", func(t *testing.T) {
+		g.SetGatewayAddressOverrides(map[string][]string{
+			"dc2": {"10.0.0.2:443", "10.0.0.1:443"},
+		})
+		require.Equal(t, []string{"10.0.0.1:443", "10.0.0.2:443"}, g.listGateways(false))
+	})
+
+	t.Run("removing the override restores catalog addresses", func(t *testing.T) {
+		g.SetGatewayAddressOverrides(nil)
+		require.Equal(t, []string{"5.6.7.8:5555"}, g.listGateways(false))
+	})
+}
+
+func TestGatewayLocator_DrainingGateways(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+	drainMeta := map[string]string{
+		structs.MetaWANFederationKey:      "1",
+		structs.MetaWANFederationDrainKey: "1",
+	}
+
+	active := newTestMeshGatewayNode("dc2", "gateway1", "5.6.7.8", 5555, meta, api.HealthPassing)
+	draining := newTestMeshGatewayNode("dc2", "gateway2", "8.7.6.5", 9999, drainMeta, api.HealthPassing)
+	draining2 := newTestMeshGatewayNode("dc2", "gateway3", "9.9.9.9", 1111, drainMeta, api.HealthPassing)
+
+	t.Run("draining gateways are skipped", func(t *testing.T) {
+		out, allDraining := filterDrainingGateways(structs.CheckServiceNodes{active, draining})
+		require.False(t, allDraining)
+		require.Len(t, out, 1)
+		require.Equal(t, "gateway1", out[0].Node.Node)
+	})
+
+	t.Run("all-draining list is kept intact", func(t *testing.T) {
+		out, allDraining := filterDrainingGateways(structs.CheckServiceNodes{draining, draining2})
+		require.True(t, allDraining)
+		require.Len(t, out, 2)
+	})
+
+	t.Run("locator excludes draining gateways on update", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+		)
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter:   "dc2",
+			MeshGateways: []structs.CheckServiceNode{active, draining},
+		}})
+
+		require.Equal(t, []string{"5.6.7.8:5555"}, g.listGateways(false))
+	})
+}
+
+func TestGatewayLocator_PickGatewayFor(t *testing.T) {
+	logger := testutil.Logger(t)
+	tsd := &testServerDelegate{isLeader: true}
+	g := NewGatewayLocator(
+		logger,
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+	g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999", "9.9.9.9:1111"}
+
+	t.Run("same key always gets the same gateway", func(t *testing.T) {
+		first := g.PickGatewayFor("dc3", "server-1.dc3")
+		require.NotEmpty(t, first)
+		for i := 0; i < 20; i++ {
+			require.Equal(t, first, g.PickGatewayFor("dc3", "server-1.dc3"))
+		}
+	})
+
+	t.Run("choice is stable when unrelated gateways churn", func(t *testing.T) {
+		chosen := g.PickGatewayFor("dc3", "server-1.dc3")
+
+		var remaining []string
+		for _, addr := range g.localGateways {
+			if addr != chosen {
+				remaining = append(remaining, addr)
+			}
+		}
+
+		// removing a non-chosen gateway must not move the key
+		g.localGateways = append([]string{chosen}, remaining[0])
+		require.Equal(t, chosen, g.PickGatewayFor("dc3", "server-1.dc3"))
+
+		// removing the chosen gateway falls back to the remaining set
+		g.localGateways = remaining
+		next := g.PickGatewayFor("dc3", "server-1.dc3")
+		require.Contains(t, remaining, next)
+	})
+}
+
+func TestGatewayLocator_WarningMode(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+	passing := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta, api.HealthPassing)
+	warning := newTestMeshGatewayNode("dc1", "gateway2", "4.3.2.1", 9999, meta, api.HealthWarning)
+	warning2 := newTestMeshGatewayNode("dc1", "gateway3", "5.6.7.8", 5555, meta, api.HealthWarning)
+
+	names := func(csns structs.CheckServiceNodes) []string {
+		var out []string
+		for _, csn := range csns {
+			out = append(out, csn.Node.Node)
+		}
+		return out
+	}
+
+	t.Run("allow keeps warning gateways", func(t *testing.T) {
+		out, _ := retainGateways(structs.CheckServiceNodes{passing, warning}, GatewayWarningModeAllow, GatewayCheckScopeAll, "")
+		require.Equal(t, []string{"gateway1", "gateway2"}, names(out))
+	})
+
+	t.Run("prefer_passing drops warnings when a passing gateway exists", func(t *testing.T) {
+		out, _ := retainGateways(structs.CheckServiceNodes{passing, warning}, GatewayWarningModePreferPassing, GatewayCheckScopeAll, "")
+		require.Equal(t, []string{"gateway1"}, names(out))
+	})
+
+	t.Run("prefer_passing keeps an all-warning list intact", func(t *testing.T) {
+		out, _ := retainGateways(structs.CheckServiceNodes{warning, warning2}, GatewayWarningModePreferPassing, GatewayCheckScopeAll, "")
+		require.Equal(t, []string{"gateway2", "gateway3"}, names(out))
+	})
+
+	t.Run("exclude always drops warnings", func(t *testing.T) {
+		out, _ := retainGateways(structs.CheckServiceNodes{warning, warning2}, GatewayWarningModeExclude, GatewayCheckScopeAll, "")
+		require.Empty(t, out)
+
+		out, _ = retainGateways(structs.CheckServiceNodes{passing, warning}, GatewayWarningModeExclude, GatewayCheckScopeAll, "")
+		require.Equal(t, []string{"gateway1"}, names(out))
+	})
+}
+
+func TestGatewayLocator_ZonePreference(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+
+	zoneA := newTestMeshGatewayNode(
+		"dc2", "gateway1", "5.6.7.8", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+	)
+	zoneA.Node.Meta = map[string]string{"zone": "zone-a"}
+
+	zoneB := newTestMeshGatewayNode(
+		"dc2", "gateway2", "8.7.6.5", 9999, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+	)
+	zoneB.Node.Meta = map[string]string{"zone": "zone-b"}
+
+	newLocator := func(t *testing.T) *GatewayLocator {
+		return NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{State: state, isLeader: true},
+			&Config{
+				Datacenter:             "dc2",
+				PrimaryDatacenter:      "dc1",
+				GatewayLocalityMetaKey: "zone",
+				GatewayLocality:        "zone-a",
+			},
+		)
+	}
+
+	t.Run("prefers same-zone gateways", func(t *testing.T) {
+		g := newLocator(t)
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter:   "dc2",
+			MeshGateways: []structs.CheckServiceNode{zoneA, zoneB},
+		}})
+
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "5.6.7.8:5555", g.PickGateway("dc3"))
+		}
+	})
+
+	t.Run("falls back to remote zones when no same-zone gateway is healthy", func(t *testing.T) {
+		g := newLocator(t)
+
+		criticalA := zoneA
+		criticalA.Checks = []*structs.HealthCheck{{
+			Name:      "web connectivity",
+			Status:    api.HealthCritical,
+			ServiceID: "mesh-gateway",
+		}}
+
+		g.updateFromState([]*structs.FederationState{{
+			Datacenter:   "dc2",
+			MeshGateways: []structs.CheckServiceNode{criticalA, zoneB},
+		}})
+
+		require.Equal(t, "8.7.6.5:9999", g.PickGateway("dc3"))
+	})
+}
+
+func TestGatewayLocator_Affinity(t *testing.T) {
+	logger := testutil.Logger(t)
+	tsd := &testServerDelegate{isLeader: true}
+	g := NewGatewayLocator(
+		logger,
+		tsd,
+		&Config{
+			Datacenter:           "dc2",
+			PrimaryDatacenter:    "dc1",
+			GatewaySelectionMode: GatewaySelectionModeAffinity,
+		},
+	)
+	g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999"}
+
+	t.Run("repeated picks stick to one gateway", func(t *testing.T) {
+		first := g.PickGateway("dc3")
+		require.NotEmpty(t, first)
+		for i := 0; i < 20; i++ {
+			require.Equal(t, first, g.PickGateway("dc3"))
+		}
+		require.Equal(t, map[string]string{"dc3": first}, g.GatewayAffinity())
+	})
+
+	t.Run("dial failure breaks the affinity", func(t *testing.T) {
+		remembered := g.GatewayAffinity()["dc3"]
+		g.MarkGatewayFailed(remembered, errors.New("connection refused"))
+		require.NotContains(t, g.GatewayAffinity(), "dc3")
+
+		next := g.PickGateway("dc3")
+		require.NotEmpty(t, next)
+		require.NotEqual(t, remembered, next)
+	})
+
+	t.Run("address leaving the healthy set breaks the affinity", func(t *testing.T) {
+		remembered := g.GatewayAffinity()["dc3"]
+		require.NotEmpty(t, remembered)
+
+		g.updateFromState(nil)
+		require.Empty(t, g.GatewayAffinity())
+
+		// and a pick-time check catches it even before an update lands
+		g.affinityLock.Lock()
+		g.affinity = map[string]string{"dc3": "9.9.9.9:1111"}
+		g.affinityLock.Unlock()
+		g.localGateways = []string{"5.6.7.8:5555"}
+		require.Equal(t, "5.6.7.8:5555", g.PickGateway("dc3"))
+	})
+}
+
+func TestGatewayLocator_CircuitBreaker(t *testing.T) {
+	logger := testutil.Logger(t)
+	tsd := &testServerDelegate{isLeader: true}
+	g := NewGatewayLocator(
+		logger,
+		tsd,
+		&Config{
+			Datacenter:              "dc2",
+			PrimaryDatacenter:       "dc1",
+			GatewayFailureCooldown:  time.Nanosecond,
+			GatewayBreakerThreshold: 3,
+		},
+	)
+	g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999"}
+
+	boom := errors.New("connection refused")
+
+	t.Run("opens after consecutive failures", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			g.MarkGatewayFailed("5.6.7.8:5555", boom)
+		}
+		g.breakerLock.Lock()
+		require.Equal(t, breakerOpen, g.breakers["5.6.7.8:5555"].state)
+		g.breakerLock.Unlock()
+
+		for i := 0; i < 20; i++ {
+			require.Equal(t, "8.7.6.5:9999", g.PickGateway("dc3"))
+		}
+	})
+
+	t.Run("half-open allows a single probe after cooldown", func(t *testing.T) {
+		g.breakerLock.Lock()
+		g.breakers["5.6.7.8:5555"].lastFailure = time.Now().Add(-2 * g.breakerCooldown)
+		g.breakerLock.Unlock()
+
+		addrs := g.listGateways(false)
+		require.Contains(t, addrs, "5.6.7.8:5555")
+
+		g.breakerLock.Lock()
+		require.Equal(t, breakerHalfOpen, g.breakers["5.6.7.8:5555"].state)
+		g.breakerLock.Unlock()
+
+		// the probe is outstanding so the address is excluded again
+		addrs = g.listGateways(false)
+		require.Equal(t, []string{"8.7.6.5:9999"}, addrs)
+	})
+
+	t.Run("failed probe re-opens", func(t *testing.T) {
+		g.MarkGatewayFailed("5.6.7.8:5555", boom)
+		g.breakerLock.Lock()
+		require.Equal(t, breakerOpen, g.breakers["5.6.7.8:5555"].state)
+		g.breakerLock.Unlock()
+	})
+
+	t.Run("successful probe closes", func(t *testing.T) {
+		g.breakerLock.Lock()
+		g.breakers["5.6.7.8:5555"].lastFailure = time.Now().Add(-2 * g.breakerCooldown)
+		g.breakerLock.Unlock()
+
+		addrs := g.listGateways(false)
+		require.Contains(t, addrs, "5.6.7.8:5555")
+
+		g.MarkGatewaySucceeded("5.6.7.8:5555")
+
+		g.breakerLock.Lock()
+		require.NotContains(t, g.breakers, "5.6.7.8:5555")
+		g.breakerLock.Unlock()
+
+		addrs = g.listGateways(false)
+		require.Equal(t, []string{"5.6.7.8:5555", "8.7.6.5:9999"}, addrs)
+	})
+}
+
+func TestGatewayLocator_RoundRobin(t *testing.T) {
+	logger := testutil.Logger(t)
+	tsd := &testServerDelegate{isLeader: true}
+	g := NewGatewayLocator(
+		logger,
+		tsd,
+		&Config{
+			Datacenter:           "dc2",
+			PrimaryDatacenter:    "dc1",
+			GatewaySelectionMode: GatewaySelectionModeRoundRobin,
+		},
+	)
+	g.primaryGateways = []string{"1.2.3.4:5555", "4.3.2.1:9999"}
+	g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999", "9.9.9.9:1111"}
+
+	t.Run("rotates through the list", func(t *testing.T) {
+		var picks []string
+		for i := 0; i < 6; i++ {
+			picks = append(picks, g.PickGateway("dc3"))
+		}
+		require.Equal(t, []string{
+			"5.6.7.8:5555", "8.7.6.5:9999", "9.9.9.9:1111",
+			"5.6.7.8:5555", "8.7.6.5:9999", "9.9.9.9:1111",
+		}, picks)
+	})
+
+	t.Run("multiple candidates rotate in preference order", func(t *testing.T) {
+		atomic.StoreUint64(&g.localRotor, 0)
+		require.Equal(t, []string{"5.6.7.8:5555", "8.7.6.5:9999"}, g.PickGateways("dc3", 2))
+		require.Equal(t, []string{"8.7.6.5:9999", "9.9.9.9:1111"}, g.PickGateways("dc3", 2))
+		// asking for more than exist returns them all
+		require.Equal(t, []string{"9.9.9.9:1111", "5.6.7.8:5555", "8.7.6.5:9999"}, g.PickGateways("dc3", 10))
+		require.Nil(t, g.PickGateways("dc3", 0))
+	})
+
+	t.Run("concurrent picks stay in range", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					require.NotEmpty(t, g.PickGateway("dc1"))
+				}
+			}()
+		}
+		wg.Wait()
+	})
+
+	t.Run("list shrink does not index out of range", func(t *testing.T) {
+		done := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				require.NotEmpty(t, g.PickGateway("dc3"))
+			}
+		}()
+
+		for i := 0; i < 100; i++ {
+			g.gatewaysLock.Lock()
+			if i%2 == 0 {
+				g.localGateways = []string{"5.6.7.8:5555"}
+			} else {
+				g.localGateways = []string{"5.6.7.8:5555", "8.7.6.5:9999", "9.9.9.9:1111"}
+			}
+			atomic.StoreUint64(&g.localRotor, 0)
+			g.gatewaysLock.Unlock()
+		}
+		close(done)
+		wg.Wait()
+	})
+}
+
+func TestGatewayLocator_Subscribe(t *testing.T) {
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub := g.Subscribe(ctx)
+
+	recv := func(t *testing.T) GatewayAddressSnapshot {
+		t.Helper()
+		select {
+		case snap, ok := <-sub:
+			require.True(t, ok, "subscription closed unexpectedly")
+			return snap
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for an address snapshot")
+			return GatewayAddressSnapshot{}
+		}
+	}
+
+	// the current (empty) snapshot arrives immediately
+	snap := recv(t)
+	require.Empty(t, snap.PrimaryGateways)
+	require.Empty(t, snap.LocalGateways)
+	require.Empty(t, snap.FallbackAddresses)
+
+	g.RefreshPrimaryGatewayFallbackAddresses([]string{"7.7.7.7:8443"})
+	snap = recv(t)
+	require.Equal(t, []string{"7.7.7.7:8443"}, snap.FallbackAddresses)
+
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+	g.updateFromState([]*structs.FederationState{
+		{
+			Datacenter: "dc1",
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta, api.HealthPassing),
+			},
+		},
+		{
+			Datacenter: "dc2",
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode("dc2", "gateway2", "5.6.7.8", 9999, meta, api.HealthPassing),
+			},
+		},
+	})
+	snap = recv(t)
+	require.Equal(t, []string{"1.2.3.4:5555"}, snap.PrimaryGateways)
+	require.Equal(t, []string{"5.6.7.8:9999"}, snap.LocalGateways)
+
+	// unsubscribing closes the channel
+	cancel()
+	retry.Run(t, func(r *retry.R) {
+		select {
+		case _, ok := <-sub:
+			require.False(r, ok)
+		default:
+			r.Fatal("subscription not closed yet")
+		}
+	})
+}
+
+func TestGatewayLocator_DiffGatewayAddrs(t *testing.T) {
+	for _, tc := range []struct {
+		name           string
+		prev, next     []string
+		added, removed []string
+	}{
+		{
+			name:  "add only",
+			prev:  []string{"1.1.1.1:443"},
+			next:  []string{"1.1.1.1:443", "2.2.2.2:443"},
+			added: []string{"2.2.2.2:443"},
+		},
+		{
+			name:    "remove only",
+			prev:    []string{"1.1.1.1:443", "2.2.2.2:443"},
+			next:    []string{"1.1.1.1:443"},
+			removed: []string{"2.2.2.2:443"},
+		},
+		{
+			name:    "replace",
+			prev:    []string{"1.1.1.1:443", "2.2.2.2:443"},
+			next:    []string{"2.2.2.2:443", "3.3.3.3:443"},
+			added:   []string{"3.3.3.3:443"},
+			removed: []string{"1.1.1.1:443"},
+		},
+		{
+			name: "no change",
+			prev: []string{"1.1.1.1:443"},
+			next: []string{"1.1.1.1:443"},
+		},
+		{
+			name:  "from empty",
+			next:  []string{"1.1.1.1:443"},
+			added: []string{"1.1.1.1:443"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			added, removed := diffGatewayAddrs(tc.prev, tc.next)
+			require.Equal(t, tc.added, added)
+			require.Equal(t, tc.removed, removed)
+		})
+	}
+}
+
+func TestGatewayLocator_PersistedGatewayCache(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+	dc1fed := &structs.FederationState{
+		Datacenter: "dc1",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta, api.HealthPassing),
+		},
+	}
+	dc2fed := &structs.FederationState{
+		Datacenter: "dc2",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode("dc2", "gateway2", "5.6.7.8", 9999, meta, api.HealthPassing),
+		},
+	}
+
+	newLocator := func(t *testing.T, dataDir string) *GatewayLocator {
+		return NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{
+				Datacenter:        "dc2",
+				PrimaryDatacenter: "dc1",
+				DataDir:           dataDir,
+			},
+		)
+	}
+
+	t.Run("persists and reloads last known addresses", func(t *testing.T) {
+		dataDir := testutil.TempDir(t, "gateway-cache")
+		defer os.RemoveAll(dataDir)
+
+		g := newLocator(t, dataDir)
+		g.updateFromState([]*structs.FederationState{dc1fed, dc2fed})
+		require.Equal(t, []string{"1.2.3.4:5555"}, g.listGateways(true))
+
+		// a fresh locator with no federation state in view falls back to
+		// the persisted addresses
+		g2 := newLocator(t, dataDir)
+		g2.loadPersistedGatewayAddresses()
+		require.Equal(t, []string{"1.2.3.4:5555"}, g2.listGateways(true))
+		require.Equal(t, []string{"5.6.7.8:9999"}, g2.listGateways(false))
+	})
+
+	t.Run("replicated state still wins over the cache", func(t *testing.T) {
+		dataDir := testutil.TempDir(t, "gateway-cache")
+		defer os.RemoveAll(dataDir)
+
+		g := newLocator(t, dataDir)
+		g.updateFromState([]*structs.FederationState{dc1fed, dc2fed})
+
+		g2 := newLocator(t, dataDir)
+		g2.loadPersistedGatewayAddresses()
+		g2.updateFromState([]*structs.FederationState{{
+			Datacenter: "dc1",
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode("dc1", "gateway3", "4.4.4.4", 4444, meta, api.HealthPassing),
+			},
+		}})
+		require.Equal(t, []string{"4.4.4.4:4444"}, g2.listGateways(true))
+	})
+
+	t.Run("stale cache files are ignored", func(t *testing.T) {
+		dataDir := testutil.TempDir(t, "gateway-cache")
+		defer os.RemoveAll(dataDir)
+
+		buf, err := json.Marshal(&persistedGatewayAddresses{
+			PrimaryGateways: []string{"1.2.3.4:5555"},
+			UpdatedAt:       time.Now().Add(-2 * defaultGatewayCacheTTL),
+		})
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dataDir, gatewayCacheFileName), buf, 0600))
+
+		g := newLocator(t, dataDir)
+		g.loadPersistedGatewayAddresses()
+		require.Empty(t, g.listGateways(true))
+	})
+
+	t.Run("corrupt cache files are ignored", func(t *testing.T) {
+		dataDir := testutil.TempDir(t, "gateway-cache")
+		defer os.RemoveAll(dataDir)
+
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dataDir, gatewayCacheFileName), []byte("{not json"), 0600))
+
+		g := newLocator(t, dataDir)
+		g.loadPersistedGatewayAddresses()
+		require.Empty(t, g.listGateways(true))
+	})
+}
+
+func TestGatewayLocator_FallbackReachabilityProbe(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		dead = map[string]bool{"7.7.7.8:8443": true}
+	)
+
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{
+			Datacenter:                  "dc2",
+			PrimaryDatacenter:           "dc1",
+			GatewayFallbackProbeEnabled: true,
+		},
+	)
+	g.probeDialFn = func(addr string, timeout time.Duration) error {
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, defaultGatewayFallbackProbeTimeout, timeout)
+		if dead[addr] {
+			return fmt.Errorf("connection refused")
+		}
+		return nil
+	}
+
+	g.RefreshPrimaryGatewayFallbackAddresses([]string{"7.7.7.7:8443", "7.7.7.8:8443"})
+
+	t.Run("unprobed addresses are all offered", func(t *testing.T) {
+		require.Equal(t, []string{"7.7.7.7:8443", "7.7.7.8:8443"}, g.listGateways(true))
+	})
+
+	t.Run("unreachable addresses are skipped", func(t *testing.T) {
+		g.probeFallbackAddrs()
+		require.Equal(t, []string{"7.7.7.7:8443"}, g.listGateways(true))
+
+		// but still reported for debug tooling, flagged as warning
+		infos := g.ListGateways("dc1")
+		require.Len(t, infos, 2)
+		require.Equal(t, api.HealthPassing, infos[0].Health)
+		require.Equal(t, api.HealthWarning, infos[1].Health)
+	})
+
+	t.Run("a fully unreachable set is offered anyway", func(t *testing.T) {
+		mu.Lock()
+		dead["7.7.7.7:8443"] = true
+		mu.Unlock()
+
+		g.probeFallbackAddrs()
+		require.Equal(t, []string{"7.7.7.7:8443", "7.7.7.8:8443"}, g.listGateways(true))
+	})
+
+	t.Run("recovered addresses come back", func(t *testing.T) {
+		mu.Lock()
+		dead = map[string]bool{}
+		mu.Unlock()
+
+		g.probeFallbackAddrs()
+		require.Equal(t, []string{"7.7.7.7:8443", "7.7.7.8:8443"}, g.listGateways(true))
+	})
+}
+
+func TestGatewayLocator_DampensFlappingUpdateLogs(t *testing.T) {
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	now := time.Now()
+	a := []string{"1.2.3.4:443"}
+	b := []string{"1.2.3.4:443", "4.3.2.1:443"}
+
+	// the first sighting of each set logs
+	require.True(t, g.shouldLogAddrUpdateLocked(a, nil, now))
+	require.True(t, g.shouldLogAddrUpdateLocked(b, nil, now.Add(1*time.Second)))
+
+	// toggling back to a recently seen set is a flap and stays quiet
+	require.False(t, g.shouldLogAddrUpdateLocked(a, nil, now.Add(2*time.Second)))
+	require.False(t, g.shouldLogAddrUpdateLocked(b, nil, now.Add(3*time.Second)))
+
+	// a genuinely new set still logs mid-flap
+	require.True(t, g.shouldLogAddrUpdateLocked(a, []string{"9.9.9.9:443"}, now.Add(4*time.Second)))
+
+	// once a set has been quiet for a full window it logs again
+	later := now.Add(4 * time.Second).Add(gatewayUpdateLogDampeningWindow + time.Second)
+	require.True(t, g.shouldLogAddrUpdateLocked(a, nil, later))
+}
+
+func TestGatewayLocator_CountGatewaysByHealth(t *testing.T) {
+	wanfed := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	withNodeCheck := func(csn structs.CheckServiceNode, checkID types.CheckID, status string) structs.CheckServiceNode {
+		csn.Checks = append(csn.Checks, &structs.HealthCheck{
+			Node:    csn.Node.Node,
+			CheckID: checkID,
+			Status:  status,
+		})
+		return csn
+	}
+
+	gateways := structs.CheckServiceNodes{
+		newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, wanfed, api.HealthPassing),
+		newTestMeshGatewayNode("dc1", "gateway2", "4.3.2.1", 9999, wanfed, api.HealthWarning),
+		newTestMeshGatewayNode("dc1", "gateway3", "6.7.8.9", 9999, wanfed, api.HealthCritical),
+		// not a wanfed gateway; never counted
+		newTestMeshGatewayNode("dc1", "other1", "9.9.9.9", 7777, nil, api.HealthPassing),
+		// passing service check but a critical unrelated node check
+		withNodeCheck(
+			newTestMeshGatewayNode("dc1", "gateway4", "5.5.5.5", 5555, wanfed, api.HealthPassing),
+			"unrelated", api.HealthCritical,
+		),
+	}
+
+	t.Run("all checks in scope", func(t *testing.T) {
+		require.Equal(t, map[string]int{
+			api.HealthPassing:  1,
+			api.HealthWarning:  1,
+			api.HealthCritical: 2,
+		}, countGatewaysByHealth(gateways, GatewayCheckScopeAll))
+	})
+
+	t.Run("service scope ignores unrelated node checks", func(t *testing.T) {
+		require.Equal(t, map[string]int{
+			api.HealthPassing:  2,
+			api.HealthWarning:  1,
+			api.HealthCritical: 1,
+		}, countGatewaysByHealth(gateways, GatewayCheckScopeService))
+	})
+
+	t.Run("serf check stays in scope", func(t *testing.T) {
+		serfFailed := structs.CheckServiceNodes{
+			withNodeCheck(
+				newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, wanfed, api.HealthPassing),
+				structs.SerfCheckID, api.HealthCritical,
+			),
+		}
+		require.Equal(t, 1, countGatewaysByHealth(serfFailed, GatewayCheckScopeService)[api.HealthCritical])
+	})
+}
+
+func TestGatewayLocator_PickGatewayMetrics(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("consul")
+	cfg.EnableHostname = false
+	_, err := metrics.NewGlobal(cfg, sink)
+	require.NoError(t, err)
+
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2"} {
+		require.NoError(t, state.FederationStateSet(uint64(i+1), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+
+	tsd := &testServerDelegate{State: state, isLeader: true}
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		tsd,
+		&Config{
+			Datacenter:                        "dc2",
+			PrimaryDatacenter:                 "dc1",
+			GatewayPickMetricAddrLabelEnabled: true,
+		},
+	)
+	_, err = g.runOnce(context.Background(), 0)
+	require.NoError(t, err)
+
+	require.Equal(t, "1.2.3.4:5555", g.PickGateway("dc1"))
+	require.Equal(t, "1.2.3.4:5555", g.PickGateway("dc2"))
+
+	// a locator with nothing loaded yields an empty pick
+	empty := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+	require.Equal(t, "", empty.PickGateway("dc1"))
+
+	counters := sink.Data()[0].Counters
+	for _, key := range []string{
+		"consul.wanfed.pick_gateway;datacenter=dc1;list=primary;empty=false;gateway=1.2.3.4:5555",
+		"consul.wanfed.pick_gateway;datacenter=dc2;list=local;empty=false;gateway=1.2.3.4:5555",
+		"consul.wanfed.pick_gateway;datacenter=dc1;list=primary;empty=true",
+	} {
+		sample, ok := counters[key]
+		require.True(t, ok, "missing counter %q; have %v", key, counters)
+		require.Equal(t, 1, sample.Count)
+	}
+}
+
+func TestGatewayLocator_PickDebugSampling(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2"} {
+		require.NoError(t, state.FederationStateSet(uint64(i+1), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+
+	var buf bytes.Buffer
+	logger := testutil.LoggerWithOutput(t, &buf)
+
+	tsd := &testServerDelegate{State: state, isLeader: true}
+	g := NewGatewayLocator(
+		logger,
+		tsd,
+		&Config{
+			Datacenter:                 "dc2",
+			PrimaryDatacenter:          "dc1",
+			GatewayPickDebugSampleRate: 2,
+		},
+	)
+	_, err = g.runOnce(context.Background(), 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		require.Equal(t, "1.2.3.4:5555", g.PickGateway("dc1"))
+	}
+	require.Equal(t, 2, strings.Count(buf.String(), "sampled mesh gateway pick"))
+
+	// Detailed picks also report how many candidates were eligible.
+	picked := g.PickGatewayDetailed("dc1")
+	require.Equal(t, 1, picked.CandidateCount)
+}
+
+func TestGatewayLocator_LoopTelemetry(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("consul")
+	cfg.EnableHostname = false
+	_, err := metrics.NewGlobal(cfg, sink)
+	require.NoError(t, err)
+
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2"} {
+		require.NoError(t, state.FederationStateSet(uint64(i+1), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+
+	tsd := &testServerDelegate{State: state, isLeader: true}
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	// Sum across every retained interval: the sink aligns intervals to wall
+	// clock minute boundaries, so a test run may straddle one.
+	counterCount := func(name string) int {
+		var count int
+		for _, intv := range sink.Data() {
+			if sample, ok := intv.Counters[name]; ok {
+				count += sample.Count
+			}
+		}
+		return count
+	}
+	sampleCount := func(name string) int {
+		var count int
+		for _, intv := range sink.Data() {
+			if sample, ok := intv.Samples[name]; ok {
+				count += sample.Count
+			}
+		}
+		return count
+	}
+
+	// The first pass wakes and changes the lists.
+	idx, err := g.runOnce(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, 1, counterCount("consul.wanfed.locator.wakeups"))
+	require.Equal(t, 1, counterCount("consul.wanfed.locator.updates"))
+
+	// A second pass over the same data is a wakeup without an update.
+	_, err = g.runOnce(context.Background(), idx)
+	require.NoError(t, err)
+	require.Equal(t, 2, counterCount("consul.wanfed.locator.wakeups"))
+	require.Equal(t, 1, counterCount("consul.wanfed.locator.updates"))
+
+	// Query duration is observed per pass.
+	require.Equal(t, 2, sampleCount("consul.wanfed.locator.query"))
+
+	// A locator whose local state is not initialized counts the occurrence.
+	uninit := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+	_, err = uninit.runOnce(context.Background(), 0)
+	require.Error(t, err)
+	require.Equal(t, 1, counterCount("consul.wanfed.locator.state_not_initialized"))
+}
+
+func TestGatewayLocator_CensusOnce(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2", "dc3"} {
+		require.NoError(t, state.FederationStateSet(uint64(i+1), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+
+	tsd := &testServerDelegate{State: state, isLeader: true}
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1", GatewayMetricsInterval: time.Minute},
+	)
+
+	// The census sees every datacenter's entry, unlike runOnce which only
+	// fetches the local and primary ones.
+	idx, err := g.censusOnce(0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), idx)
+	require.Len(t, tsd.Calls, 1)
+}
+
+func TestGatewayLocator_Status(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+
+	updatedAt := time.Now().UTC().Add(-90 * time.Second)
+	require.NoError(t, state.FederationStateSet(1, &structs.FederationState{
+		Datacenter: "dc1",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc1", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+		UpdatedAt: updatedAt,
+	}))
+	require.NoError(t, state.FederationStateSet(2, &structs.FederationState{
+		Datacenter: "dc2",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc2", "gateway1", "5.6.7.8", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+		UpdatedAt: time.Now().UTC(),
+	}))
+
+	logger := testutil.Logger(t)
+	tsd := &testServerDelegate{State: state, isLeader: true}
+	g := NewGatewayLocator(
+		logger,
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	// Before any federation state has been seen only the static fields are
+	// populated.
+	status := g.Status()
+	require.True(t, status.Enabled)
+	require.Equal(t, "dc1", status.PrimaryDatacenter)
+	require.Equal(t, GatewaySelectionModeWeighted, status.SelectionPolicy)
+	require.Equal(t, 0, status.LocalGatewayCount)
+	require.Equal(t, 0, status.PrimaryGatewayCount)
+	require.False(t, status.PrimaryGatewaysReady)
+	require.Empty(t, status.PrimaryFederationStateAge)
+
+	_, err = g.runOnce(context.Background(), 0)
+	require.NoError(t, err)
+
+	status = g.Status()
+	require.Equal(t, 1, status.LocalGatewayCount)
+	require.Equal(t, 1, status.PrimaryGatewayCount)
+	require.True(t, status.PrimaryGatewaysReady)
+	require.NotEmpty(t, status.PrimaryFederationStateAge)
+
+	age, err := time.ParseDuration(status.PrimaryFederationStateAge)
+	require.NoError(t, err)
+	require.True(t, age >= 90*time.Second, "age %s is implausibly low", age)
+}
+
+func TestGatewayLocator_EmptiedListTransitions(t *testing.T) {
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("consul")
+	cfg.EnableHostname = false
+	_, err := metrics.NewGlobal(cfg, sink)
+	require.NoError(t, err)
+
+	logger := testutil.Logger(t)
+	tsd := &testServerDelegate{isLeader: true}
+	g := NewGatewayLocator(
+		logger,
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	primary := &structs.FederationState{
+		Datacenter: "dc1",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc1", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+	}
+	local := &structs.FederationState{
+		Datacenter: "dc2",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc2", "gateway1", "5.6.7.8", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+	}
+
+	emptiedCount := func(list string) int {
+		key := "consul.wanfed.mesh_gateways.emptied;list=" + list
+		sample, ok := sink.Data()[0].Counters[key]
+		if !ok {
+			return 0
+		}
+		return sample.Count
+	}
+
+	// Lists beginning empty at startup is not a transition.
+	g.updateFromState(nil)
+	require.Equal(t, 0, emptiedCount("primary"))
+	require.Equal(t, 0, emptiedCount("local"))
+
+	g.updateFromState([]*structs.FederationState{primary, local})
+	require.Equal(t, 0, emptiedCount("primary"))
+	require.Equal(t, 0, emptiedCount("local"))
+	require.True(t, g.primaryEmptiedAt.IsZero())
+	require.True(t, g.localEmptiedAt.IsZero())
+
+	// Each populated list draining fires once.
+	g.updateFromState(nil)
+	require.Equal(t, 1, emptiedCount("primary"))
+	require.Equal(t, 1, emptiedCount("local"))
+	require.False(t, g.primaryEmptiedAt.IsZero())
+	require.False(t, g.localEmptiedAt.IsZero())
+
+	// Recovery clears the emptied marker without counting again.
+	g.updateFromState([]*structs.FederationState{primary, local})
+	require.Equal(t, 1, emptiedCount("primary"))
+	require.Equal(t, 1, emptiedCount("local"))
+	require.True(t, g.primaryEmptiedAt.IsZero())
+	require.True(t, g.localEmptiedAt.IsZero())
+
+	// A second outage fires again.
+	g.updateFromState(nil)
+	require.Equal(t, 2, emptiedCount("primary"))
+	require.Equal(t, 2, emptiedCount("local"))
+}
+
 type testServerDelegate struct {
 	State *state.Store
 
 	FallbackAddrs []string
-	Calls         []uint64
 
+	// callsLock guards Calls for tests that drive the locator's Run loop
+	// from another goroutine; single-threaded tests read Calls directly.
+	callsLock sync.Mutex
+	Calls     []uint64
+
+	// leaderLock guards isLeader and lastContact for tests that flip the
+	// leadership state while the locator's Run loop is going.
+	leaderLock  sync.Mutex
 	isLeader    bool
 	lastContact time.Time
+
+	// blocking makes blockingQuery park on a real watch set when nothing
+	// changed, like the server implementation, instead of returning
+	// immediately.
+	blocking bool
+}
+
+func (d *testServerDelegate) CallList() []uint64 {
+	d.callsLock.Lock()
+	defer d.callsLock.Unlock()
+	out := make([]uint64, len(d.Calls))
+	copy(out, d.Calls)
+	return out
 }
 
 // This is just enough to exercise the logic.
@@ -112,14 +2788,26 @@ func (d *testServerDelegate) blockingQuery(
 ) error {
 	minQueryIndex := queryOpts.GetMinQueryIndex()
 
+	d.callsLock.Lock()
 	d.Calls = append(d.Calls, minQueryIndex)
+	d.callsLock.Unlock()
 
 	var ws memdb.WatchSet
+	if d.blocking && minQueryIndex > 0 {
+		ws = memdb.NewWatchSet()
+	}
 
 	err := fn(ws, d.State)
 	if err == nil && queryMeta.GetIndex() < 1 {
 		queryMeta.SetIndex(1)
 	}
+	if err == nil && ws != nil && queryMeta.GetIndex() <= minQueryIndex {
+		timeout := 10 * time.Second
+		if d := queryOpts.GetMaxQueryTime(); d > 0 {
+			timeout = d
+		}
+		ws.Watch(time.After(timeout))
+	}
 
 	return err
 }
@@ -133,9 +2821,593 @@ func (d *testServerDelegate) PrimaryGatewayFallbackAddresses() []string {
 }
 
 func (d *testServerDelegate) IsLeader() bool {
+	d.leaderLock.Lock()
+	defer d.leaderLock.Unlock()
 	return d.isLeader
 }
 
 func (d *testServerDelegate) LeaderLastContact() time.Time {
+	d.leaderLock.Lock()
+	defer d.leaderLock.Unlock()
 	return d.lastContact
 }
+
+func (d *testServerDelegate) SetLastContact(t time.Time) {
+	d.leaderLock.Lock()
+	defer d.leaderLock.Unlock()
+	d.lastContact = t
+}
+
+type recordedSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) { s.attrs[key] = value }
+func (s *recordedSpan) SetError(err error)                         { s.err = err }
+func (s *recordedSpan) End()                                       {}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(name string) wanfed.Span {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	span := &recordedSpan{name: name, attrs: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+	return span
+}
+
+func (t *recordingTracer) named(name string) []*recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var out []*recordedSpan
+	for _, span := range t.spans {
+		if span.name == name {
+			out = append(out, span)
+		}
+	}
+	return out
+}
+
+func TestGatewayLocator_Tracing(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2"} {
+		require.NoError(t, state.FederationStateSet(uint64(i+1), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+
+	tracer := &recordingTracer{}
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{State: state, isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1", GatewayTracer: tracer},
+	)
+
+	t.Run("refresh span", func(t *testing.T) {
+		_, err := g.runOnce(context.Background(), 0)
+		require.NoError(t, err)
+
+		spans := tracer.named("wanfed.locator.refresh")
+		require.Len(t, spans, 1)
+		require.NoError(t, spans[0].err)
+		require.Equal(t, "dc2", spans[0].attrs["datacenter"])
+		require.Equal(t, "dc1", spans[0].attrs["primary_datacenter"])
+		require.Equal(t, uint64(2), spans[0].attrs["raft_index"])
+		require.Equal(t, true, spans[0].attrs["changed"])
+	})
+
+	t.Run("pick span", func(t *testing.T) {
+		require.Equal(t, "1.2.3.4:5555", g.PickGateway("dc1"))
+
+		spans := tracer.named("wanfed.gateway.pick")
+		require.Len(t, spans, 1)
+		require.NoError(t, spans[0].err)
+		require.Equal(t, "1.2.3.4:5555", spans[0].attrs["gateway"])
+		require.Equal(t, "dc1", spans[0].attrs["destination_datacenter"])
+		require.Equal(t, 1, spans[0].attrs["candidates"])
+		require.Equal(t, false, spans[0].attrs["from_fallback"])
+	})
+
+	t.Run("failed pick records the error", func(t *testing.T) {
+		empty := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1", GatewayTracer: tracer},
+		)
+		_, err := empty.PickGatewayErr("dc1")
+		require.Error(t, err)
+
+		spans := tracer.named("wanfed.gateway.pick")
+		require.Len(t, spans, 2)
+		require.Error(t, spans[1].err)
+		require.Equal(t, 0, spans[1].attrs["candidates"])
+	})
+}
+
+func TestGatewayLocator_RunContextCancel(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2"} {
+		require.NoError(t, state.FederationStateSet(uint64(i+1), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+
+	tsd := &testServerDelegate{State: state, isLeader: true, blocking: true}
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		g.Run(ctx)
+		close(done)
+	}()
+
+	// Wait until the loop has parked in a blocking query: the second fetch
+	// carries the index from the first and nothing else will change.
+	timer := &retry.Timer{Timeout: 10 * time.Second, Wait: 50 * time.Millisecond}
+	retry.RunWith(timer, t, func(r *retry.R) {
+		calls := tsd.CallList()
+		if len(calls) < 2 || calls[1] == 0 {
+			r.Fatalf("waiting for a blocking fetch: %v", calls)
+		}
+	})
+
+	// Cancellation must wake the blocking query rather than waiting out its
+	// max wait time.
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not exit promptly after context cancellation")
+	}
+}
+
+func TestGatewayLocator_WaitForDone(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+
+	tsd := &testServerDelegate{State: state, isLeader: true, blocking: true}
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+
+	runCtx, runCancel := context.WithCancel(context.Background())
+	defer runCancel()
+	go g.Run(runCtx)
+
+	// While Run is still going, a bounded wait times out.
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer waitCancel()
+	require.Equal(t, context.DeadlineExceeded, g.WaitForDone(waitCtx))
+
+	// Once cancelled, the wait completes promptly.
+	runCancel()
+	waitCtx2, waitCancel2 := context.WithTimeout(context.Background(), 2*time.Second)
+	defer waitCancel2()
+	require.NoError(t, g.WaitForDone(waitCtx2))
+}
+
+func TestGatewayLocator_IndexRegression(t *testing.T) {
+	oldState, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2"} {
+		require.NoError(t, oldState.FederationStateSet(uint64(i+10), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+
+	tsd := &testServerDelegate{State: oldState, isLeader: true}
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		tsd,
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1", GatewayUpdateCoalesceWindow: -1},
+	)
+
+	idx, err := g.runOnce(context.Background(), 0)
+	require.NoError(t, err)
+	require.Equal(t, uint64(11), idx)
+	require.Equal(t, "1.2.3.4:5555", g.PickGateway("dc1"))
+
+	// Simulate a snapshot restore: a rebuilt state store whose indexes are
+	// far behind what the locator already watched past.
+	newState, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2"} {
+		require.NoError(t, newState.FederationStateSet(uint64(i+1), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway2", "9.8.7.6", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+	tsd.State = newState
+
+	// The regressed index is detected and the watch index is handed back as
+	// zero so the next fetch cannot block on an unreachable index.
+	idx, err = g.runOnce(context.Background(), idx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(0), idx)
+
+	// The view still recovered to the restored data.
+	idx, err = g.runOnce(context.Background(), idx)
+	require.NoError(t, err)
+	require.Equal(t, uint64(2), idx)
+	require.Equal(t, "9.8.7.6:5555", g.PickGateway("dc1"))
+}
+
+func TestGatewayLocator_RefreshLiveness(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	require.NoError(t, state.FederationStateSet(1, &structs.FederationState{
+		Datacenter: "dc1",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc1", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+	}))
+
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{State: state, isLeader: true},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1", GatewayUpdateCoalesceWindow: -1},
+	)
+
+	lastAttempt, lastSuccess, errCount := g.RefreshLiveness()
+	require.True(t, lastAttempt.IsZero())
+	require.True(t, lastSuccess.IsZero())
+	require.Equal(t, 0, errCount)
+
+	idx, err := g.runOnce(context.Background(), 0)
+	require.NoError(t, err)
+
+	lastAttempt, lastSuccess, errCount = g.RefreshLiveness()
+	require.False(t, lastAttempt.IsZero())
+	require.False(t, lastSuccess.IsZero())
+	require.Equal(t, 0, errCount)
+
+	// A no-op pass over the same data still advances both timestamps.
+	_, err = g.runOnce(context.Background(), idx)
+	require.NoError(t, err)
+	nextAttempt, nextSuccess, errCount := g.RefreshLiveness()
+	require.True(t, nextAttempt.After(lastAttempt) || nextAttempt.Equal(lastAttempt))
+	require.True(t, nextSuccess.After(lastSuccess) || nextSuccess.Equal(lastSuccess))
+	require.Equal(t, 0, errCount)
+
+	st := g.Status()
+	require.Equal(t, nextAttempt, st.LastRefreshAttempt)
+	require.Equal(t, nextSuccess, st.LastSuccessfulRefresh)
+	require.Equal(t, 0, st.ConsecutiveRefreshErrors)
+
+	// Failed passes count up and leave the success timestamp alone.
+	uninit := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{},
+		&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1"},
+	)
+	for i := 1; i <= 3; i++ {
+		_, err := uninit.runOnce(context.Background(), 0)
+		require.Error(t, err)
+		lastAttempt, lastSuccess, errCount := uninit.RefreshLiveness()
+		require.False(t, lastAttempt.IsZero())
+		require.True(t, lastSuccess.IsZero())
+		require.Equal(t, i, errCount)
+	}
+}
+
+func TestGatewayLocator_MaxQueryTime(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2"} {
+		require.NoError(t, state.FederationStateSet(uint64(i+1), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+
+	t.Run("bounds the blocking fetch", func(t *testing.T) {
+		tsd := &testServerDelegate{State: state, isLeader: true, blocking: true}
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			tsd,
+			&Config{
+				Datacenter:                  "dc2",
+				PrimaryDatacenter:           "dc1",
+				GatewayMaxQueryTime:         100 * time.Millisecond,
+				GatewayUpdateCoalesceWindow: -1,
+			},
+		)
+
+		idx, err := g.runOnce(context.Background(), 0)
+		require.NoError(t, err)
+
+		// With nothing changing, the fetch returns once the configured max
+		// wait elapses rather than the delegate's much larger default.
+		start := time.Now()
+		_, err = g.runOnce(context.Background(), idx)
+		require.NoError(t, err)
+		elapsed := time.Since(start)
+		require.True(t, elapsed >= 100*time.Millisecond, "fetch returned after %s, before the configured wait", elapsed)
+		require.True(t, elapsed < 2*time.Second, "fetch took %s, well beyond the configured wait", elapsed)
+	})
+
+	t.Run("clamped to the server bound", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{State: state, isLeader: true},
+			&Config{
+				Datacenter:          "dc2",
+				PrimaryDatacenter:   "dc1",
+				MaxQueryTime:        time.Second,
+				GatewayMaxQueryTime: time.Hour,
+			},
+		)
+		require.Equal(t, time.Second, g.maxQueryTime)
+	})
+
+	t.Run("negative disables", func(t *testing.T) {
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{State: state, isLeader: true},
+			&Config{Datacenter: "dc2", PrimaryDatacenter: "dc1", GatewayMaxQueryTime: -1},
+		)
+		require.Equal(t, time.Duration(0), g.maxQueryTime)
+	})
+}
+
+func TestGatewayLocator_UpdateCoalescing(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2"} {
+		require.NoError(t, state.FederationStateSet(uint64(i+1), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		&testServerDelegate{State: state, isLeader: true},
+		&Config{
+			Datacenter:                  "dc2",
+			PrimaryDatacenter:           "dc1",
+			GatewayUpdateCoalesceWindow: 500 * time.Millisecond,
+		},
+	)
+
+	// Bootstrap is exempt: with nothing cached yet the first answer lands
+	// immediately despite the configured window.
+	start := time.Now()
+	idx, err := g.runOnce(context.Background(), 0)
+	require.NoError(t, err)
+	require.True(t, time.Since(start) < 250*time.Millisecond, "bootstrap pass lingered for the coalesce window")
+	require.Equal(t, "1.2.3.4:5555", g.PickGateway("dc1"))
+
+	// Later passes linger for the window, folding writes that land during
+	// it into the same recompute.
+	var (
+		nextIdx uint64
+		runErr  error
+		done    = make(chan struct{})
+	)
+	start = time.Now()
+	go func() {
+		defer close(done)
+		nextIdx, runErr = g.runOnce(context.Background(), idx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	require.NoError(t, state.FederationStateSet(10, &structs.FederationState{
+		Datacenter: "dc1",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc1", "gateway2", "9.8.7.6", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+	}))
+
+	<-done
+	require.NoError(t, runErr)
+	require.True(t, time.Since(start) >= 500*time.Millisecond, "pass returned before the coalesce window elapsed")
+	require.Equal(t, uint64(10), nextIdx)
+	require.Equal(t, "9.8.7.6:5555", g.PickGateway("dc1"))
+}
+
+func TestGatewayLocator_LocalStateReadyWatch(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+	for i, dc := range []string{"dc1", "dc2"} {
+		require.NoError(t, state.FederationStateSet(uint64(i+1), &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+		}))
+	}
+
+	tsd := &testServerDelegate{State: state}
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		tsd,
+		&Config{
+			Datacenter:        "dc2",
+			PrimaryDatacenter: "dc1",
+			// Large enough that only the ready-watch poke, not the error
+			// backoff running its course, can explain a prompt refresh once
+			// the leader makes contact below.
+			GatewayRetryInitialBackoff: 30 * time.Second,
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go g.Run(ctx)
+
+	// Neither a leader nor leader contact: the locator stays empty while
+	// the loop parks in its error backoff.
+	time.Sleep(500 * time.Millisecond)
+	require.Equal(t, "", g.PickGateway("dc1"))
+
+	// The raft leader talks to us; the ready watch should force a refresh
+	// well before the backoff would have retried.
+	tsd.SetLastContact(time.Now())
+	retry.Run(t, func(r *retry.R) {
+		if got := g.PickGateway("dc1"); got != "1.2.3.4:5555" {
+			r.Fatalf("gateway not picked up after leader contact, got %q", got)
+		}
+	})
+}
+
+func TestGatewayLocator_FallbackOnlyMode(t *testing.T) {
+	state, err := state.NewStateStore(nil)
+	require.NoError(t, err)
+
+	// Never a leader, never heard from one: every pass fails with
+	// errGatewayLocalStateNotInitialized.
+	tsd := &testServerDelegate{
+		State:         state,
+		FallbackAddrs: []string{"7.7.7.7:8443"},
+	}
+	g := NewGatewayLocator(
+		testutil.Logger(t),
+		tsd,
+		&Config{
+			Datacenter:                     "dc2",
+			PrimaryDatacenter:              "dc1",
+			GatewayRetryInitialBackoff:     100 * time.Millisecond,
+			GatewayFallbackOnlyModeTimeout: 200 * time.Millisecond,
+		},
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go g.Run(ctx)
+
+	// After the timeout the ready latch fires even though federation state
+	// never produced a gateway.
+	select {
+	case <-g.PrimaryMeshGatewayAddressesReadyCh():
+	case <-time.After(5 * time.Second):
+		t.Fatal("ready latch never fired in fallback-only mode")
+	}
+
+	// The fallback addresses were published as the primary list, with the
+	// provenance marking where they came from.
+	require.Equal(t, "7.7.7.7:8443", g.PickGateway("dc1"))
+	updated, meta := g.listProvenance(true)
+	require.False(t, updated.IsZero())
+	require.Equal(t, GatewayListSourceFallback, meta.source)
+}
+
+func TestGatewayLocator_TrafficClasses(t *testing.T) {
+	meta := map[string]string{structs.MetaWANFederationKey: "1"}
+
+	gossipGW := newTestMeshGatewayNode("dc1", "gateway1", "1.2.3.4", 5555, meta, api.HealthPassing)
+	gossipGW.Service.Tags = []string{"gossip-transit"}
+	rpcGW := newTestMeshGatewayNode("dc1", "gateway2", "4.3.2.1", 9999, meta, api.HealthPassing)
+
+	newLocator := func(t *testing.T, gossipFilter string, nodes ...structs.CheckServiceNode) *GatewayLocator {
+		state, err := state.NewStateStore(nil)
+		require.NoError(t, err)
+		require.NoError(t, state.FederationStateSet(1, &structs.FederationState{
+			Datacenter:   "dc1",
+			MeshGateways: nodes,
+		}))
+		require.NoError(t, state.FederationStateSet(2, &structs.FederationState{
+			Datacenter: "dc2",
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					"dc2", "gateway1", "5.6.7.8", 5555, meta, api.HealthPassing,
+				),
+			},
+		}))
+		g := NewGatewayLocator(
+			testutil.Logger(t),
+			&testServerDelegate{State: state, isLeader: true},
+			&Config{
+				Datacenter:             "dc2",
+				PrimaryDatacenter:      "dc1",
+				GatewayGossipTagFilter: gossipFilter,
+			},
+		)
+		_, err = g.runOnce(context.Background(), 0)
+		require.NoError(t, err)
+		return g
+	}
+
+	t.Run("filter splits gossip and rpc transit", func(t *testing.T) {
+		g := newLocator(t, "gossip-transit", gossipGW, rpcGW)
+		// Picks are randomized, so loop to prove the classes never bleed
+		// into each other's subset.
+		for i := 0; i < 20; i++ {
+			addr, err := g.PickGatewayErrForGossip("dc1")
+			require.NoError(t, err)
+			require.Equal(t, "1.2.3.4:5555", addr)
+
+			addr, err = g.PickGatewayErrForRPC("dc1")
+			require.NoError(t, err)
+			require.Equal(t, "4.3.2.1:9999", addr)
+		}
+	})
+
+	t.Run("no filter shares every gateway", func(t *testing.T) {
+		g := newLocator(t, "", gossipGW, rpcGW)
+		seen := make(map[string]struct{})
+		for i := 0; i < 20; i++ {
+			addr, err := g.PickGatewayErrForGossip("dc1")
+			require.NoError(t, err)
+			seen[addr] = struct{}{}
+		}
+		require.Len(t, seen, 2)
+	})
+
+	t.Run("empty class subset degrades to the shared list", func(t *testing.T) {
+		// Nothing carries the tag yet, so both classes keep working off
+		// the full list rather than starving gossip transit.
+		g := newLocator(t, "gossip-transit", rpcGW)
+		addr, err := g.PickGatewayErrForGossip("dc1")
+		require.NoError(t, err)
+		require.Equal(t, "4.3.2.1:9999", addr)
+	})
+}
@@ -0,0 +1,133 @@
+package consul
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/consul/acl"
+	"github.com/hashicorp/consul/agent/metadata"
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// WANFederationStatus aggregates the gateway locator view of every server in
+// the datacenter into one health summary, along with the replicated
+// federation state per known datacenter. Servers other than the answering
+// one are queried over the lightweight Operator.WANFederationGateways
+// endpoint; a server that cannot be reached is reported as unreachable
+// rather than failing the whole call.
+func (m *Internal) WANFederationStatus(args *structs.WANFederationStatusRequest, reply *structs.WANFederationStatusResponse) error {
+	if done, err := m.srv.forward("Internal.WANFederationStatus", args, args, reply); done {
+		return err
+	}
+
+	// This action requires operator read access.
+	rule, err := m.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if rule != nil && rule.OperatorRead(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	if m.srv.gatewayLocator == nil {
+		return fmt.Errorf("mesh gateway WAN federation is disabled")
+	}
+
+	// Summarize the replicated federation state per datacenter.
+	_, fedStates, err := m.srv.fsm.State().FederationStateList(nil)
+	if err != nil {
+		return err
+	}
+	for _, fs := range fedStates {
+		reply.Datacenters = append(reply.Datacenters, structs.WANFederationDatacenterStatus{
+			Datacenter:       fs.Datacenter,
+			MeshGatewayCount: len(fs.MeshGateways),
+			UpdatedAt:        fs.UpdatedAt,
+		})
+	}
+
+	// Collect one report per server. The answering server reads its own
+	// locator directly; the rest are queried in parallel.
+	var servers []*metadata.Server
+	for _, member := range m.srv.serfLAN.Members() {
+		if ok, parts := metadata.IsConsulServer(member); ok {
+			servers = append(servers, parts)
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool { return servers[i].Name < servers[j].Name })
+
+	reply.Servers = make([]structs.WANFederationServerStatus, len(servers))
+
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		status := &reply.Servers[i]
+		status.Server = server.Name
+		status.Address = server.Addr.String()
+
+		if server.Name == m.srv.config.NodeName {
+			m.fillLocalWANFederationStatus(status)
+			continue
+		}
+
+		wg.Add(1)
+		go func(server *metadata.Server, status *structs.WANFederationServerStatus) {
+			defer wg.Done()
+			m.fillRemoteWANFederationStatus(server, status, args.Token)
+		}(server, status)
+	}
+	wg.Wait()
+
+	reply.Healthy = len(reply.Servers) > 0
+	for _, status := range reply.Servers {
+		if !status.Reachable || !status.PrimaryReady {
+			reply.Healthy = false
+			break
+		}
+	}
+
+	return nil
+}
+
+// fillLocalWANFederationStatus answers a server report from this server's
+// own gateway locator.
+func (m *Internal) fillLocalWANFederationStatus(status *structs.WANFederationServerStatus) {
+	locator := m.srv.gatewayLocator
+
+	st := locator.Status()
+	status.Reachable = true
+	status.PrimaryReady = st.PrimaryGatewaysReady
+	status.PrimaryGatewayCount = st.PrimaryGatewayCount
+	status.LocalGatewayCount = st.LocalGatewayCount
+	status.FallbackAddressCount = len(locator.PrimaryGatewayFallbackAddresses())
+}
+
+// fillRemoteWANFederationStatus answers a server report by querying one
+// other server's locator view. A failed query marks the server unreachable
+// instead of propagating the error.
+func (m *Internal) fillRemoteWANFederationStatus(server *metadata.Server, status *structs.WANFederationServerStatus, token string) {
+	var gwArgs structs.WANFederationGatewaysRequest
+	gwArgs.Datacenter = m.srv.config.Datacenter
+	gwArgs.Token = token
+	// A stale query makes the contacted server answer from its own
+	// locator instead of forwarding to the leader.
+	gwArgs.AllowStale = true
+
+	var gwReply structs.WANFederationGatewaysResponse
+	err := m.srv.connPool.RPC(m.srv.config.Datacenter, server.ShortName, server.Addr, server.Version,
+		"Operator.WANFederationGateways", &gwArgs, &gwReply)
+	if err != nil {
+		m.logger.Warn("error getting wan federation status from server",
+			"server", server.Name,
+			"error", err,
+		)
+		status.Error = err.Error()
+		return
+	}
+
+	status.Reachable = true
+	status.PrimaryReady = gwReply.PrimaryReady
+	status.PrimaryGatewayCount = len(gwReply.PrimaryGateways)
+	status.LocalGatewayCount = len(gwReply.LocalGateways)
+	status.FallbackAddressCount = len(gwReply.FallbackAddresses)
+}
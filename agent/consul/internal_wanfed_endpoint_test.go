@@ -0,0 +1,93 @@
+package consul
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+	"github.com/hashicorp/consul/testrpc"
+	msgpackrpc "github.com/hashicorp/net-rpc-msgpackrpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInternal_WANFederationStatus(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+		c.DisableFederationStateAntiEntropy = true
+		c.ConnectMeshGatewayWANFederationEnabled = true
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	codec := rpcClient(t, s1)
+	defer codec.Close()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	// With no federation state present yet the single server cannot be
+	// primary-ready.
+	{
+		args := structs.WANFederationStatusRequest{Datacenter: "dc1"}
+		var out structs.WANFederationStatusResponse
+		require.NoError(t, msgpackrpc.CallWithCodec(codec, "Internal.WANFederationStatus", &args, &out))
+
+		require.False(t, out.Healthy)
+		require.Len(t, out.Servers, 1)
+		require.Equal(t, s1.config.NodeName, out.Servers[0].Server)
+		require.True(t, out.Servers[0].Reachable)
+		require.False(t, out.Servers[0].PrimaryReady)
+	}
+
+	updatedAt := time.Now().UTC()
+	federationStateUpsert(t, codec, "", &structs.FederationState{
+		Datacenter: "dc1",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc1", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+		UpdatedAt: updatedAt,
+	})
+
+	retry.Run(t, func(r *retry.R) {
+		args := structs.WANFederationStatusRequest{Datacenter: "dc1"}
+		var out structs.WANFederationStatusResponse
+		require.NoError(r, msgpackrpc.CallWithCodec(codec, "Internal.WANFederationStatus", &args, &out))
+
+		require.True(r, out.Healthy)
+
+		require.Len(r, out.Servers, 1)
+		server := out.Servers[0]
+		require.True(r, server.Reachable)
+		require.Empty(r, server.Error)
+		require.True(r, server.PrimaryReady)
+		require.Equal(r, 1, server.PrimaryGatewayCount)
+		require.Equal(r, 1, server.LocalGatewayCount)
+		require.Equal(r, 0, server.FallbackAddressCount)
+
+		require.Len(r, out.Datacenters, 1)
+		require.Equal(r, "dc1", out.Datacenters[0].Datacenter)
+		require.Equal(r, 1, out.Datacenters[0].MeshGatewayCount)
+		require.False(r, out.Datacenters[0].UpdatedAt.IsZero())
+	})
+}
+
+func TestInternal_WANFederationStatus_Disabled(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerDC(t, "dc1")
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	codec := rpcClient(t, s1)
+	defer codec.Close()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	args := structs.WANFederationStatusRequest{Datacenter: "dc1"}
+	var out structs.WANFederationStatusResponse
+	err := msgpackrpc.CallWithCodec(codec, "Internal.WANFederationStatus", &args, &out)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "disabled")
+}
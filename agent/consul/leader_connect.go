@@ -13,6 +13,7 @@ import (
 	"github.com/hashicorp/consul/agent/connect"
 	"github.com/hashicorp/consul/agent/connect/ca"
 	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/lib"
 	"github.com/hashicorp/consul/logging"
 	uuid "github.com/hashicorp/go-uuid"
 )
@@ -651,7 +652,7 @@ func (s *Server) secondaryIntermediateCertRenewalWatch(ctx context.Context) erro
 		case <-ctx.Done():
 			return nil
 		case <-time.After(structs.IntermediateCertRenewInterval):
-			retryLoopBackoff(ctx.Done(), func() error {
+			retryLoopBackoff(ctx, func() error {
 				s.caProviderReconfigurationLock.Lock()
 				defer s.caProviderReconfigurationLock.Unlock()
 
@@ -724,7 +725,7 @@ func (s *Server) secondaryCARootWatch(ctx context.Context) error {
 
 	connectLogger.Debug("starting Connect CA root replication from primary datacenter", "primary", s.config.PrimaryDatacenter)
 
-	retryLoopBackoff(ctx.Done(), func() error {
+	retryLoopBackoff(ctx, func() error {
 		var roots structs.IndexedCARoots
 		if err := s.forwardDC("ConnectCA.Roots", s.config.PrimaryDatacenter, &args, &roots); err != nil {
 			return fmt.Errorf("Error retrieving the primary datacenter's roots: %v", err)
@@ -780,7 +781,7 @@ func (s *Server) replicateIntentions(ctx context.Context) error {
 
 	connectLogger.Debug("starting Connect intention replication from primary datacenter", "primary", s.config.PrimaryDatacenter)
 
-	retryLoopBackoff(ctx.Done(), func() error {
+	retryLoopBackoff(ctx, func() error {
 		// Always use the latest replication token value in case it changed while looping.
 		args.QueryOptions.Token = s.tokens.ReplicationToken()
 
@@ -830,32 +831,96 @@ func (s *Server) replicateIntentions(ctx context.Context) error {
 	return nil
 }
 
+// backoffPolicy describes the retry schedule used between failed iterations
+// of a retry loop: start at initial, grow by multiplier per consecutive
+// failure, cap at max, and optionally add jitter so that servers that failed
+// together do not all retry in lockstep.
+type backoffPolicy struct {
+	// initial is the wait after the first failure.
+	initial time.Duration
+
+	// multiplier is the growth factor applied per consecutive failure.
+	multiplier float64
+
+	// max caps the computed wait.
+	max time.Duration
+
+	// jitter is the fraction of the computed wait added randomly on top of
+	// it; zero disables jitter.
+	jitter float64
+}
+
+// defaultBackoffPolicy matches the historical retryLoopBackoff schedule:
+// 2s doubling up to maxRetryBackoff seconds, with no jitter.
+func defaultBackoffPolicy() backoffPolicy {
+	return backoffPolicy{
+		initial:    2 * time.Second,
+		multiplier: 2,
+		max:        time.Duration(maxRetryBackoff) * time.Second,
+	}
+}
+
+// next returns the wait to use after one more consecutive failure, given the
+// previous wait. A zero previous wait restarts the schedule at initial, which
+// is how reset-on-success is expressed.
+func (p backoffPolicy) next(prev time.Duration) time.Duration {
+	next := p.initial
+	if prev > 0 {
+		next = time.Duration(float64(prev) * p.multiplier)
+	}
+	if next > p.max {
+		next = p.max
+	}
+	return next
+}
+
+// jittered returns the wait with this policy's jitter fraction applied.
+func (p backoffPolicy) jittered(d time.Duration) time.Duration {
+	if p.jitter <= 0 {
+		return d
+	}
+	return d + lib.RandomStagger(time.Duration(p.jitter*float64(d)))
+}
+
 // retryLoopBackoff loops a given function indefinitely, backing off exponentially
 // upon errors up to a maximum of maxRetryBackoff seconds.
-func retryLoopBackoff(stopCh <-chan struct{}, loopFn func() error, errFn func(error)) {
-	var failedAttempts uint
+func retryLoopBackoff(ctx context.Context, loopFn func() error, errFn func(error)) {
+	retryLoopBackoffPolicy(ctx, defaultBackoffPolicy(), loopFn, errFn, nil)
+}
+
+// retryLoopBackoffPolicy is retryLoopBackoff with a caller-supplied backoff
+// schedule and an optional hook invoked after each successful iteration, once
+// the backoff has been reset.
+func retryLoopBackoffPolicy(ctx context.Context, policy backoffPolicy, loopFn func() error, errFn func(error), onSuccessFn func()) {
+	var retryWait time.Duration
 	limiter := rate.NewLimiter(loopRateLimit, retryBucketSize)
 	for {
 		// Rate limit how often we run the loop
-		limiter.Wait(context.Background())
+		if err := limiter.Wait(ctx); err != nil {
+			return
+		}
 		select {
-		case <-stopCh:
+		case <-ctx.Done():
 			return
 		default:
 		}
-		if (1 << failedAttempts) < maxRetryBackoff {
-			failedAttempts++
-		}
-		retryTime := (1 << failedAttempts) * time.Second
+		retryWait = policy.next(retryWait)
 
 		if err := loopFn(); err != nil {
 			errFn(err)
-			time.Sleep(retryTime)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(policy.jittered(retryWait)):
+			}
 			continue
 		}
 
 		// Reset the failed attempts after a successful run.
-		failedAttempts = 0
+		retryWait = 0
+		if onSuccessFn != nil {
+			onSuccessFn()
+		}
 	}
 }
 
@@ -1,6 +1,7 @@
 package consul
 
 import (
+	"context"
 	"crypto/x509"
 	"fmt"
 	"io/ioutil"
@@ -1442,3 +1443,80 @@ func TestLeader_lessThanHalfTimePassed(t *testing.T) {
 
 	require.True(t, lessThanHalfTimePassed(now, now.Add(-10*time.Second), now.Add(20*time.Second)))
 }
+
+func TestBackoffPolicy(t *testing.T) {
+	t.Run("default schedule", func(t *testing.T) {
+		p := defaultBackoffPolicy()
+
+		var wait time.Duration
+		var waits []time.Duration
+		for i := 0; i < 10; i++ {
+			wait = p.next(wait)
+			waits = append(waits, wait)
+		}
+		require.Equal(t, []time.Duration{
+			2 * time.Second,
+			4 * time.Second,
+			8 * time.Second,
+			16 * time.Second,
+			32 * time.Second,
+			64 * time.Second,
+			128 * time.Second,
+			256 * time.Second,
+			256 * time.Second,
+			256 * time.Second,
+		}, waits)
+	})
+
+	t.Run("reset on success restarts at initial", func(t *testing.T) {
+		p := defaultBackoffPolicy()
+		wait := p.next(p.next(p.next(0)))
+		require.Equal(t, 8*time.Second, wait)
+		// A successful iteration zeroes the previous wait.
+		require.Equal(t, 2*time.Second, p.next(0))
+	})
+
+	t.Run("jitter bounds", func(t *testing.T) {
+		p := backoffPolicy{initial: time.Second, multiplier: 2, max: time.Minute, jitter: 0.5}
+		for i := 0; i < 100; i++ {
+			wait := p.jittered(10 * time.Second)
+			require.True(t, wait >= 10*time.Second, "wait %s below the un-jittered value", wait)
+			require.True(t, wait < 15*time.Second, "wait %s above the jitter bound", wait)
+		}
+	})
+
+	t.Run("no jitter is exact", func(t *testing.T) {
+		p := defaultBackoffPolicy()
+		require.Equal(t, 10*time.Second, p.jittered(10*time.Second))
+	})
+}
+
+func TestRetryLoopBackoffPolicy_ResetOnSuccess(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	policy := backoffPolicy{initial: time.Millisecond, multiplier: 2, max: 10 * time.Millisecond}
+
+	var calls int
+	var successes int
+	retryLoopBackoffPolicy(ctx,
+		policy,
+		func() error {
+			calls++
+			switch {
+			case calls < 3:
+				return fmt.Errorf("boom %d", calls)
+			case calls < 5:
+				return nil
+			default:
+				cancel()
+				return nil
+			}
+		},
+		func(error) {},
+		func() { successes++ },
+	)
+
+	require.Equal(t, 5, calls)
+	require.Equal(t, 3, successes)
+}
@@ -7,13 +7,27 @@ import (
 
 	"github.com/hashicorp/consul/agent/consul/state"
 	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/lib"
 	memdb "github.com/hashicorp/go-memdb"
+	"golang.org/x/time/rate"
 )
 
 const (
+	// defaultFederationStateAntiEntropyInterval is the longest the
+	// anti-entropy routine waits for a catalog or federation state change
+	// before re-verifying the published mesh gateway dump anyway, when no
+	// interval is configured.
+	defaultFederationStateAntiEntropyInterval = 2 * time.Minute
+
 	// federationStatePruneInterval is how often we check for stale federation
 	// states to remove should a datacenter be removed from the WAN.
 	federationStatePruneInterval = time.Hour
+
+	// federationStatePruneRateLimit is the maximum rate per second at which
+	// federation state deletions are applied through Raft, so that pruning a
+	// large number of departed datacenters at once does not create a write
+	// burst.
+	federationStatePruneRateLimit rate.Limit = 1.0
 )
 
 func (s *Server) startFederationStateAntiEntropy() {
@@ -24,7 +38,7 @@ func (s *Server) startFederationStateAntiEntropy() {
 
 	// If this is the primary, then also prune any stale datacenters from the
 	// list of federation states.
-	if s.config.PrimaryDatacenter == s.config.Datacenter {
+	if s.config.PrimaryDatacenter == s.config.Datacenter && !s.config.DisableFederationStatePruning {
 		s.leaderRoutineManager.Start(federationStatePruningRoutineName, s.federationStatePruning)
 	}
 }
@@ -34,34 +48,79 @@ func (s *Server) stopFederationStateAntiEntropy() {
 		return
 	}
 	s.leaderRoutineManager.Stop(federationStateAntiEntropyRoutineName)
-	if s.config.PrimaryDatacenter == s.config.Datacenter {
+	if s.config.PrimaryDatacenter == s.config.Datacenter && !s.config.DisableFederationStatePruning {
 		s.leaderRoutineManager.Stop(federationStatePruningRoutineName)
 	}
 }
 
+// federationStateAntiEntropySync is an open-coded variant of retryLoopBackoff
+// so that a repair signal from the gateway locator can interrupt the backoff
+// sleep and drop the blocking query index; the rate limiting and backoff
+// behavior on errors are the same.
 func (s *Server) federationStateAntiEntropySync(ctx context.Context) error {
 	var lastFetchIndex uint64
+	var failedAttempts uint
+
+	var localStateMissingCh <-chan struct{}
+	if s.gatewayLocator != nil {
+		localStateMissingCh = s.gatewayLocator.LocalFederationStateMissingCh()
+	}
+
+	limiter := rate.NewLimiter(loopRateLimit, retryBucketSize)
+	for {
+		// Rate limit how often we run the loop
+		if err := limiter.Wait(ctx); err != nil {
+			return nil
+		}
+
+		// The gateway locator noticed our own federation state entry is gone;
+		// drop the query index so the dump below re-publishes immediately
+		// instead of blocking for a change.
+		select {
+		case <-localStateMissingCh:
+			lastFetchIndex = 0
+		default:
+		}
+
+		if (1 << failedAttempts) < maxRetryBackoff {
+			failedAttempts++
+		}
+		retryTime := (1 << failedAttempts) * time.Second
 
-	retryLoopBackoff(ctx.Done(), func() error {
 		idx, err := s.federationStateAntiEntropyMaybeSync(ctx, lastFetchIndex)
 		if err != nil {
-			return err
+			s.logger.Error("error performing anti-entropy sync of federation state", "error", err)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-localStateMissingCh:
+				lastFetchIndex = 0
+			case <-time.After(retryTime):
+			}
+			continue
 		}
 
+		// Reset the failed attempts after a successful run.
+		failedAttempts = 0
 		lastFetchIndex = idx
-		return nil
-	}, func(err error) {
-		s.logger.Error("error performing anti-entropy sync of federation state", "error", err)
-	})
-
-	return nil
+	}
 }
 
 func (s *Server) federationStateAntiEntropyMaybeSync(ctx context.Context, lastFetchIndex uint64) (uint64, error) {
+	interval := s.config.FederationStateAntiEntropyInterval
+	if interval <= 0 {
+		interval = defaultFederationStateAntiEntropyInterval
+	}
+
 	queryOpts := &structs.QueryOptions{
 		MinQueryIndex:     lastFetchIndex,
 		RequireConsistent: true,
 		// This is just for a local blocking query so no token is needed.
+		//
+		// The wait is staggered so that secondaries whose leaders were all
+		// elected around the same time do not re-verify, and potentially
+		// write to the primary, in lockstep.
+		MaxQueryTime: interval + lib.RandomStagger(interval/4),
 	}
 	idx, prev, curr, err := s.fetchFederationStateAntiEntropyDetails(queryOpts)
 	if err != nil {
@@ -75,11 +134,38 @@ func (s *Server) federationStateAntiEntropyMaybeSync(ctx context.Context, lastFe
 	default:
 	}
 
-	if prev != nil && prev.IsSame(curr) {
+	curr.MeshGatewaysHash = curr.HashMeshGateways()
+	if federationStateDumpIsSame(prev, curr) {
 		s.logger.Trace("federation state anti-entropy sync skipped; already up to date")
 		return idx, nil
 	}
 
+	// The dump changed. A gateway whose health is flapping rapidly would
+	// otherwise turn into one Raft write per flap, so wait out a short
+	// debounce window and re-dump: changes inside the window coalesce into a
+	// single write, and a flap that settled back leaves nothing to write at
+	// all.
+	if debounce := s.config.FederationStateAntiEntropyDebounce; debounce > 0 {
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(debounce):
+		}
+
+		idx, prev, curr, err = s.fetchFederationStateAntiEntropyDetails(&structs.QueryOptions{
+			RequireConsistent: true,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		curr.MeshGatewaysHash = curr.HashMeshGateways()
+		if federationStateDumpIsSame(prev, curr) {
+			s.logger.Trace("federation state anti-entropy sync skipped; change settled during debounce")
+			return idx, nil
+		}
+	}
+
 	if err := s.updateOurFederationState(curr); err != nil {
 		return 0, fmt.Errorf("error performing federation state anti-entropy sync: %v", err)
 	}
@@ -89,6 +175,22 @@ func (s *Server) federationStateAntiEntropyMaybeSync(ctx context.Context, lastFe
 	return idx, nil
 }
 
+// federationStateDumpIsSame reports whether the stored federation state
+// already matches the current mesh gateway dump. It compares the stored
+// hashes when both exist — the hash ignores volatile fields like check output
+// text, so flapping output does not force a pointless Raft write that would
+// wake every secondary's locator loop — and falls back to a field comparison
+// for records written before hashes were stored.
+func federationStateDumpIsSame(prev, curr *structs.FederationState) bool {
+	if prev == nil {
+		return false
+	}
+	if prev.MeshGatewaysHash != 0 {
+		return prev.MeshGatewaysHash == curr.MeshGatewaysHash
+	}
+	return prev.IsSame(curr)
+}
+
 func (s *Server) updateOurFederationState(curr *structs.FederationState) error {
 	if curr.Datacenter != s.config.Datacenter { // sanity check
 		return fmt.Errorf("cannot use this mechanism to update federation states for other datacenters")
@@ -143,7 +245,11 @@ func (s *Server) fetchFederationStateAntiEntropyDetails(
 				return err
 			}
 
-			// Fetch our current list of all mesh gateways.
+			// Fetch our current list of all mesh gateways. The dump carries
+			// complete catalog entries: Weights, ServiceMeta, and tagged
+			// addresses (including the wan_ipv4/wan_ipv6 variants) must all
+			// survive into the federation state, since the locators in other
+			// datacenters rely on them for weighted and dual-stack selection.
 			entMeta := structs.WildcardEnterpriseMeta()
 			idx2, raw, err := state.ServiceDump(ws, structs.ServiceKindMeshGateway, true, entMeta)
 			if err != nil {
@@ -152,7 +258,7 @@ func (s *Server) fetchFederationStateAntiEntropyDetails(
 
 			curr := &structs.FederationState{
 				Datacenter:   s.config.Datacenter,
-				MeshGateways: raw,
+				MeshGateways: sanitizeMeshGatewayChecks(raw),
 			}
 
 			// Compute the maximum index seen.
@@ -174,6 +280,32 @@ func (s *Server) fetchFederationStateAntiEntropyDetails(
 	return queryMeta.Index, prevFedState, currFedState, nil
 }
 
+// sanitizeMeshGatewayChecks returns a copy of the mesh gateway dump with each
+// health check stripped down to the fields wanfed consumers actually read:
+// CheckID, Status, and ServiceID, plus Node for identification. Verbose
+// fields like Output and Definition can add kilobytes per gateway that would
+// otherwise be replicated to every datacenter and held in every server's
+// memdb. The catalog entries are shared with memdb, so the checks are copied
+// rather than mutated in place.
+func sanitizeMeshGatewayChecks(dump structs.CheckServiceNodes) structs.CheckServiceNodes {
+	out := make(structs.CheckServiceNodes, len(dump))
+	for i, csn := range dump {
+		checks := make(structs.HealthChecks, len(csn.Checks))
+		for j, chk := range csn.Checks {
+			checks[j] = &structs.HealthCheck{
+				Node:           chk.Node,
+				CheckID:        chk.CheckID,
+				Status:         chk.Status,
+				ServiceID:      chk.ServiceID,
+				EnterpriseMeta: chk.EnterpriseMeta,
+			}
+		}
+		csn.Checks = checks
+		out[i] = csn
+	}
+	return out
+}
+
 func (s *Server) federationStatePruning(ctx context.Context) error {
 	ticker := time.NewTicker(federationStatePruneInterval)
 	defer ticker.Stop()
@@ -191,18 +323,52 @@ func (s *Server) federationStatePruning(ctx context.Context) error {
 }
 
 func (s *Server) pruneStaleFederationStates() error {
+	if s.config.DisableFederationStatePruning {
+		return nil
+	}
+
 	state := s.fsm.State()
 	_, fedStates, err := state.FederationStateList(nil)
 	if err != nil {
 		return err
 	}
 
+	if s.fedStatePruneMissingSince == nil {
+		s.fedStatePruneMissingSince = make(map[string]time.Time)
+	}
+	if s.fedStatePruneLimiter == nil {
+		s.fedStatePruneLimiter = rate.NewLimiter(federationStatePruneRateLimit, 1)
+	}
+
+	now := time.Now()
+	present := make(map[string]struct{}, len(fedStates))
+
 	for _, fedState := range fedStates {
 		dc := fedState.Datacenter
+		present[dc] = struct{}{}
 		if s.router.HasDatacenter(dc) {
+			delete(s.fedStatePruneMissingSince, dc)
+			continue
+		}
+
+		// Give a departed datacenter the configured grace period before its
+		// federation state is deleted, in case it is merely partitioned from
+		// the WAN pool rather than decommissioned.
+		first, ok := s.fedStatePruneMissingSince[dc]
+		if !ok {
+			first = now
+			s.fedStatePruneMissingSince[dc] = now
+		}
+		// Decommissioned datacenters were removed deliberately, so a
+		// reappearing federation state is deleted without the grace period.
+		if now.Sub(first) < s.config.FederationStatePruneGracePeriod && !s.isDatacenterDecommissioned(dc) {
 			continue
 		}
 
+		if err := s.fedStatePruneLimiter.Wait(context.Background()); err != nil {
+			return err
+		}
+
 		s.logger.Info("pruning stale federation state", "datacenter", dc)
 
 		req := structs.FederationStateRequest{
@@ -218,7 +384,41 @@ func (s *Server) pruneStaleFederationStates() error {
 		if respErr, ok := resp.(error); ok && err != nil {
 			return fmt.Errorf("Failed to delete federation state %s: %v", dc, respErr)
 		}
+		delete(s.fedStatePruneMissingSince, dc)
+	}
+
+	// Forget absence bookkeeping for datacenters whose federation state is
+	// already gone.
+	for dc := range s.fedStatePruneMissingSince {
+		if _, ok := present[dc]; !ok {
+			delete(s.fedStatePruneMissingSince, dc)
+		}
 	}
 
 	return nil
 }
+
+// markDatacenterDecommissioned records that a datacenter was deliberately
+// removed from the federation via Operator.DecommissionDatacenter.
+//
+// The record is held in memory on the current leader only, so skipping the
+// prune grace period is best effort: after a leader failover or restart a
+// reappearing federation state waits out the grace period again before it is
+// pruned.
+func (s *Server) markDatacenterDecommissioned(dc string) {
+	s.decommissionedDCLock.Lock()
+	defer s.decommissionedDCLock.Unlock()
+	if s.decommissionedDCs == nil {
+		s.decommissionedDCs = make(map[string]struct{})
+	}
+	s.decommissionedDCs[dc] = struct{}{}
+}
+
+// isDatacenterDecommissioned reports whether the datacenter was removed via
+// Operator.DecommissionDatacenter.
+func (s *Server) isDatacenterDecommissioned(dc string) bool {
+	s.decommissionedDCLock.Lock()
+	defer s.decommissionedDCLock.Unlock()
+	_, ok := s.decommissionedDCs[dc]
+	return ok
+}
@@ -1,7 +1,9 @@
 package consul
 
 import (
+	"encoding/json"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -189,6 +191,341 @@ func TestLeader_FederationStateAntiEntropy_BlockingQuery(t *testing.T) {
 	checkSame(t, 2, 2)
 }
 
+func TestLeader_FederationStateAntiEntropy_PreservesGatewayFidelity(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	dir2, s2 := testServerWithConfig(t, func(c *Config) {
+		c.Datacenter = "dc2"
+		c.PrimaryDatacenter = "dc1"
+		c.FederationStateReplicationRate = 100
+		c.FederationStateReplicationBurst = 100
+		c.FederationStateReplicationApplyLimit = 1000000
+	})
+	testrpc.WaitForLeader(t, s2.RPC, "dc2")
+	defer os.RemoveAll(dir2)
+	defer s2.Shutdown()
+
+	// Try to join.
+	joinWAN(t, s2, s1)
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+	testrpc.WaitForLeader(t, s1.RPC, "dc2")
+
+	// Register a weighted dual-stack mesh gateway in the primary. Everything
+	// here has to survive the catalog dump, the federation state write, and
+	// replication to dc2: the locator there needs Weights for weighted
+	// selection, the wan_ipv4/wan_ipv6 tagged addresses for address family
+	// selection, and the service meta for locality affinity.
+	svc := &structs.NodeService{
+		Kind:    structs.ServiceKindMeshGateway,
+		ID:      "mesh-gateway",
+		Service: "mesh-gateway",
+		Address: "10.0.0.5",
+		Port:    443,
+		Weights: &structs.Weights{Passing: 5, Warning: 1},
+		Meta: map[string]string{
+			structs.MetaWANFederationKey: "1",
+			"zone":                       "z1",
+		},
+		TaggedAddresses: map[string]structs.ServiceAddress{
+			structs.TaggedAddressWAN:     {Address: "203.0.113.5", Port: 8443},
+			structs.TaggedAddressWANIPv4: {Address: "203.0.113.5", Port: 8443},
+			structs.TaggedAddressWANIPv6: {Address: "2001:db8::5", Port: 8443},
+		},
+	}
+	arg := structs.RegisterRequest{
+		Datacenter: "dc1",
+		Node:       "gateway1",
+		Address:    "10.0.0.5",
+		Service:    svc,
+		Checks: structs.HealthChecks{
+			&structs.HealthCheck{
+				Node:      "gateway1",
+				ServiceID: "mesh-gateway",
+				Name:      "mesh-gateway check",
+				Status:    api.HealthPassing,
+			},
+		},
+	}
+	var out struct{}
+	require.NoError(t, s1.RPC("Catalog.Register", &arg, &out))
+
+	retry.Run(t, func(r *retry.R) {
+		_, fedState, err := s2.fsm.State().FederationStateGet(nil, "dc1")
+		require.NoError(r, err)
+		require.NotNil(r, fedState)
+		require.Len(r, fedState.MeshGateways, 1)
+
+		got := fedState.MeshGateways[0].Service
+		require.Equal(r, svc.Weights, got.Weights)
+		require.Equal(r, svc.TaggedAddresses, got.TaggedAddresses)
+		require.Equal(r, "z1", got.Meta["zone"])
+		require.Equal(r, svc.Address, got.Address)
+		require.Equal(r, svc.Port, got.Port)
+	})
+}
+
+func TestLeader_FederationStateAntiEntropy_RepairsDeletedLocalState(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	// wait for the anti-entropy routine's initial publication
+	var origIndex uint64
+	retry.Run(t, func(r *retry.R) {
+		_, fedState, err := s1.fsm.State().FederationStateGet(nil, "dc1")
+		require.NoError(r, err)
+		require.NotNil(r, fedState)
+		origIndex = fedState.ModifyIndex
+	})
+
+	// delete our own entry, simulating operator error or a bad restore
+	arg := structs.FederationStateRequest{
+		Datacenter: "dc1",
+		Op:         structs.FederationStateDelete,
+		State:      &structs.FederationState{Datacenter: "dc1"},
+	}
+	out := false
+	require.NoError(t, s1.RPC("FederationState.Apply", &arg, &out))
+
+	// the dump routine should notice and re-publish without waiting on a timer
+	retry.Run(t, func(r *retry.R) {
+		_, fedState, err := s1.fsm.State().FederationStateGet(nil, "dc1")
+		require.NoError(r, err)
+		require.NotNil(r, fedState)
+		require.True(r, fedState.ModifyIndex > origIndex)
+	})
+}
+
+func TestLeader_FederationStateAntiEntropy_SkipsNoOpWrites(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	register := func(t *testing.T, csn structs.CheckServiceNode) {
+		t.Helper()
+		arg := structs.RegisterRequest{
+			Datacenter: csn.Node.Datacenter,
+			Node:       csn.Node.Node,
+			Address:    csn.Node.Address,
+			Service:    csn.Service,
+			Checks:     csn.Checks,
+		}
+		var out struct{}
+		require.NoError(t, s1.RPC("Catalog.Register", &arg, &out))
+	}
+
+	gateway := newTestMeshGatewayNode(
+		"dc1", "gateway1", "1.2.3.4", 443, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+	)
+	register(t, gateway)
+
+	// wait for the dump to pick up the gateway
+	var fedStateIndex uint64
+	retry.Run(t, func(r *retry.R) {
+		_, fedState, err := s1.fsm.State().FederationStateGet(nil, "dc1")
+		require.NoError(r, err)
+		require.NotNil(r, fedState)
+		require.Len(r, fedState.MeshGateways, 1)
+		require.NotZero(r, fedState.MeshGatewaysHash)
+		fedStateIndex = fedState.ModifyIndex
+	})
+
+	// Change only the check output. The hash ignores it, so the catalog
+	// change must not produce another federation state write.
+	gateway.Checks[0].Output = "HTTP GET http://localhost: 200 OK"
+	register(t, gateway)
+
+	retry.Run(t, func(r *retry.R) {
+		_, checks, err := s1.fsm.State().NodeChecks(nil, "gateway1", nil)
+		require.NoError(r, err)
+		require.Len(r, checks, 1)
+		require.Equal(r, gateway.Checks[0].Output, checks[0].Output)
+	})
+
+	// Give the anti-entropy routine a moment to observe the catalog change.
+	time.Sleep(500 * time.Millisecond)
+
+	_, fedState, err := s1.fsm.State().FederationStateGet(nil, "dc1")
+	require.NoError(t, err)
+	require.NotNil(t, fedState)
+	require.Equal(t, fedStateIndex, fedState.ModifyIndex)
+
+	// A real change still gets written.
+	gateway2 := newTestMeshGatewayNode(
+		"dc1", "gateway2", "4.3.2.1", 443, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+	)
+	register(t, gateway2)
+
+	retry.Run(t, func(r *retry.R) {
+		_, fedState, err := s1.fsm.State().FederationStateGet(nil, "dc1")
+		require.NoError(r, err)
+		require.NotNil(r, fedState)
+		require.Len(r, fedState.MeshGateways, 2)
+		require.True(r, fedState.ModifyIndex > fedStateIndex)
+	})
+}
+
+func TestLeader_FederationStateAntiEntropy_SanitizesChecks(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	register := func(t *testing.T, csn structs.CheckServiceNode) {
+		t.Helper()
+		arg := structs.RegisterRequest{
+			Datacenter: csn.Node.Datacenter,
+			Node:       csn.Node.Node,
+			Address:    csn.Node.Address,
+			Service:    csn.Service,
+			Checks:     csn.Checks,
+		}
+		var out struct{}
+		require.NoError(t, s1.RPC("Catalog.Register", &arg, &out))
+	}
+
+	gateway := newTestMeshGatewayNode(
+		"dc1", "gateway1", "1.2.3.4", 443, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+	)
+	gateway.Checks[0].Name = "mesh gateway reachability"
+	gateway.Checks[0].Output = strings.Repeat("HTTP GET http://localhost: 200 OK\n", 100)
+	gateway.Checks[0].Notes = "per-node operational notes"
+	register(t, gateway)
+
+	critical := newTestMeshGatewayNode(
+		"dc1", "gateway2", "4.3.2.1", 443, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthCritical,
+	)
+	register(t, critical)
+
+	retry.Run(t, func(r *retry.R) {
+		_, fedState, err := s1.fsm.State().FederationStateGet(nil, "dc1")
+		require.NoError(r, err)
+		require.NotNil(r, fedState)
+		require.Len(r, fedState.MeshGateways, 2)
+
+		// the bulky fields are gone but everything consumers read survives
+		for _, csn := range fedState.MeshGateways {
+			require.Len(r, csn.Checks, 1)
+			chk := csn.Checks[0]
+			require.Empty(r, chk.Output)
+			require.Empty(r, chk.Notes)
+			require.Empty(r, chk.Name)
+			require.Equal(r, structs.HealthCheckDefinition{}, chk.Definition)
+			require.Equal(r, "mesh-gateway", chk.ServiceID)
+			require.NotEmpty(r, chk.Status)
+		}
+
+		// the stored checks still filter the way the locator expects
+		retained, _ := retainGateways(fedState.MeshGateways, GatewayWarningModeAllow, GatewayCheckScopeAll, "")
+		require.Len(r, retained, 1)
+		require.Equal(r, "gateway1", retained[0].Node.Node)
+	})
+}
+
+func TestLeader_FederationState_SanitizeMeshGatewayChecks(t *testing.T) {
+	gateway := newTestMeshGatewayNode(
+		"dc1", "gateway1", "1.2.3.4", 443, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+	)
+	gateway.Checks[0].Output = strings.Repeat("HTTP GET http://localhost: 200 OK\n", 100)
+	gateway.Checks[0].Notes = "per-node operational notes"
+	dump := structs.CheckServiceNodes{gateway}
+
+	clean := sanitizeMeshGatewayChecks(dump)
+
+	// the original catalog entries are untouched
+	require.NotEmpty(t, dump[0].Checks[0].Output)
+
+	rawSize, err := json.Marshal(dump)
+	require.NoError(t, err)
+	cleanSize, err := json.Marshal(clean)
+	require.NoError(t, err)
+	require.Less(t, len(cleanSize), len(rawSize))
+
+	chk := clean[0].Checks[0]
+	require.Equal(t, gateway.Checks[0].CheckID, chk.CheckID)
+	require.Equal(t, gateway.Checks[0].Status, chk.Status)
+	require.Equal(t, gateway.Checks[0].ServiceID, chk.ServiceID)
+	require.Empty(t, chk.Output)
+}
+
+func TestLeader_FederationStateAntiEntropy_DebouncesFlaps(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+		c.FederationStateAntiEntropyDebounce = 1 * time.Second
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	register := func(t *testing.T, csn structs.CheckServiceNode) {
+		t.Helper()
+		arg := structs.RegisterRequest{
+			Datacenter: csn.Node.Datacenter,
+			Node:       csn.Node.Node,
+			Address:    csn.Node.Address,
+			Service:    csn.Service,
+			Checks:     csn.Checks,
+		}
+		var out struct{}
+		require.NoError(t, s1.RPC("Catalog.Register", &arg, &out))
+	}
+
+	gateway := newTestMeshGatewayNode(
+		"dc1", "gateway1", "1.2.3.4", 443, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+	)
+	register(t, gateway)
+
+	// wait for the dump to pick up the gateway
+	var fedStateIndex uint64
+	retry.Run(t, func(r *retry.R) {
+		_, fedState, err := s1.fsm.State().FederationStateGet(nil, "dc1")
+		require.NoError(r, err)
+		require.NotNil(r, fedState)
+		require.Len(r, fedState.MeshGateways, 1)
+		fedStateIndex = fedState.ModifyIndex
+	})
+
+	// Flap the gateway critical and immediately back to passing. The
+	// anti-entropy routine wakes on the first write but sits out the
+	// debounce window, by the end of which the dump matches what is already
+	// published again, so no new federation state write happens.
+	gateway.Checks[0].Status = api.HealthCritical
+	register(t, gateway)
+	gateway.Checks[0].Status = api.HealthPassing
+	register(t, gateway)
+
+	time.Sleep(1500 * time.Millisecond)
+
+	_, fedState, err := s1.fsm.State().FederationStateGet(nil, "dc1")
+	require.NoError(t, err)
+	require.NotNil(t, fedState)
+	require.Equal(t, fedStateIndex, fedState.ModifyIndex)
+	require.Len(t, fedState.MeshGateways, 1)
+}
+
 func TestLeader_FederationStateAntiEntropyPruning(t *testing.T) {
 	t.Parallel()
 
@@ -262,6 +599,74 @@ func TestLeader_FederationStateAntiEntropyPruning(t *testing.T) {
 	})
 }
 
+func TestLeader_FederationStateAntiEntropyPruning_GracePeriod(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+		c.FederationStatePruneGracePeriod = time.Hour
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+	client := rpcClient(t, s1)
+	defer client.Close()
+
+	dir2, s2 := testServerWithConfig(t, func(c *Config) {
+		c.Datacenter = "dc2"
+		c.PrimaryDatacenter = "dc1"
+	})
+	testrpc.WaitForLeader(t, s2.RPC, "dc2")
+	defer os.RemoveAll(dir2)
+	defer s2.Shutdown()
+
+	// Try to join.
+	joinWAN(t, s2, s1)
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+	testrpc.WaitForLeader(t, s1.RPC, "dc2")
+
+	// Wait for both federation states to exist.
+	retry.Run(t, func(r *retry.R) {
+		_, mine, err := s1.fsm.State().FederationStateList(nil)
+		require.NoError(r, err)
+		require.Len(r, mine, 2)
+	})
+
+	// Now leave and shutdown dc2.
+	require.NoError(t, s2.Leave())
+	require.NoError(t, s2.Shutdown())
+
+	// Wait until we know the router is updated.
+	retry.Run(t, func(r *retry.R) {
+		dcs := s1.router.GetDatacenters()
+		require.Len(r, dcs, 1)
+		require.Equal(r, "dc1", dcs[0])
+	})
+
+	// The first pass only records the absence; dc2 is still inside the
+	// grace period so its federation state survives.
+	require.NoError(t, s1.pruneStaleFederationStates())
+	_, mine, err := s1.fsm.State().FederationStateList(nil)
+	require.NoError(t, err)
+	require.Len(t, mine, 2)
+
+	// The kill switch prevents pruning entirely.
+	s1.config.DisableFederationStatePruning = true
+	require.NoError(t, s1.pruneStaleFederationStates())
+	s1.config.DisableFederationStatePruning = false
+
+	// Backdate the absence beyond the grace period and prune for real.
+	s1.fedStatePruneMissingSince["dc2"] = time.Now().Add(-2 * time.Hour)
+	require.NoError(t, s1.pruneStaleFederationStates())
+
+	retry.Run(t, func(r *retry.R) {
+		_, mine, err := s1.fsm.State().FederationStateList(nil)
+		require.NoError(r, err)
+		require.Len(r, mine, 1)
+		require.Equal(r, "dc1", mine[0].Datacenter)
+	})
+}
+
 func TestLeader_FederationStateAntiEntropyPruning_ACLDeny(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,90 @@
+package consul
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul/acl"
+	"github.com/hashicorp/consul/agent/metadata"
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/serf/serf"
+)
+
+// DecommissionDatacenter removes a departed datacenter from the WAN
+// federation in one step: it deletes the datacenter's federation state,
+// force-leaves any of its servers still lingering in the WAN serf pool, and
+// records the decommission so the pruning routine deletes a reappearing
+// federation state without waiting out the usual grace period. That record is
+// best effort: it lives in memory on the current leader, so after a leader
+// failover or restart a reappearing state is pruned after the grace period
+// instead of immediately. The reply argument is not used, but is required to
+// fulfill the RPC interface.
+func (op *Operator) DecommissionDatacenter(args *structs.DecommissionDatacenterRequest, reply *struct{}) error {
+	dc := args.DecommissionDatacenter
+	if dc == "" {
+		return fmt.Errorf("invalid request: missing datacenter to decommission")
+	}
+	if dc == op.srv.config.PrimaryDatacenter {
+		return fmt.Errorf("cannot decommission the primary datacenter %q", dc)
+	}
+	if dc == op.srv.config.Datacenter {
+		return fmt.Errorf("cannot decommission the local datacenter %q", dc)
+	}
+
+	// Decommissions execute in the primary datacenter, where federation
+	// state writes must happen.
+	args.Datacenter = op.srv.config.PrimaryDatacenter
+
+	if done, err := op.srv.forward("Operator.DecommissionDatacenter", args, args, reply); done {
+		return err
+	}
+
+	// This is a destructive operation that requires operator write access.
+	rule, err := op.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if rule != nil && rule.OperatorWrite(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	// Delete the federation state so the locators stop handing out the
+	// datacenter's mesh gateways.
+	req := structs.FederationStateRequest{
+		Op:    structs.FederationStateDelete,
+		State: &structs.FederationState{Datacenter: dc},
+	}
+	resp, err := op.srv.raftApply(structs.FederationStateRequestType, &req)
+	if err != nil {
+		return fmt.Errorf("failed to delete federation state for %q: %v", dc, err)
+	}
+	if respErr, ok := resp.(error); ok {
+		return respErr
+	}
+
+	op.srv.markDatacenterDecommissioned(dc)
+
+	// Force-leave any of the datacenter's servers still lingering in the
+	// WAN pool so the routers drop the datacenter instead of waiting on
+	// serf reaping.
+	if op.srv.serfWAN != nil {
+		for _, member := range op.srv.serfWAN.Members() {
+			valid, parts := metadata.IsConsulServer(member)
+			if !valid || parts.Datacenter != dc {
+				continue
+			}
+			if member.Status == serf.StatusLeft {
+				continue
+			}
+			op.logger.Info("force-leaving WAN member of decommissioned datacenter",
+				"member", member.Name,
+				"datacenter", dc,
+			)
+			if err := op.srv.serfWAN.RemoveFailedNode(member.Name); err != nil {
+				return fmt.Errorf("failed to remove WAN member %q: %v", member.Name, err)
+			}
+		}
+	}
+
+	op.logger.Warn("datacenter decommissioned", "datacenter", dc)
+	return nil
+}
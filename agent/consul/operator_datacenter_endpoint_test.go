@@ -0,0 +1,108 @@
+package consul
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/testrpc"
+	msgpackrpc "github.com/hashicorp/net-rpc-msgpackrpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperator_DecommissionDatacenter(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+		c.DisableFederationStateAntiEntropy = true
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	codec := rpcClient(t, s1)
+	defer codec.Close()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	dir2, s2 := testServerWithConfig(t, func(c *Config) {
+		c.Datacenter = "dc2"
+		c.PrimaryDatacenter = "dc1"
+		c.DisableFederationStateAntiEntropy = true
+	})
+	defer os.RemoveAll(dir2)
+	defer s2.Shutdown()
+	codec2 := rpcClient(t, s2)
+	defer codec2.Close()
+	testrpc.WaitForLeader(t, s2.RPC, "dc2")
+
+	joinWAN(t, s2, s1)
+	testrpc.WaitForLeader(t, s2.RPC, "dc1")
+
+	// seed federation states for dc2 and a datacenter that has already left
+	// the WAN entirely
+	for _, dc := range []string{"dc2", "dc3"} {
+		federationStateUpsert(t, codec, "", &structs.FederationState{
+			Datacenter: dc,
+			MeshGateways: []structs.CheckServiceNode{
+				newTestMeshGatewayNode(
+					dc, "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+				),
+			},
+			UpdatedAt: time.Now().UTC(),
+		})
+	}
+
+	t.Run("refuses the primary datacenter", func(t *testing.T) {
+		args := structs.DecommissionDatacenterRequest{DecommissionDatacenter: "dc1"}
+		var out struct{}
+		err := msgpackrpc.CallWithCodec(codec, "Operator.DecommissionDatacenter", &args, &out)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "primary datacenter")
+	})
+
+	t.Run("refuses a missing datacenter name", func(t *testing.T) {
+		args := structs.DecommissionDatacenterRequest{}
+		var out struct{}
+		err := msgpackrpc.CallWithCodec(codec, "Operator.DecommissionDatacenter", &args, &out)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "missing datacenter")
+	})
+
+	t.Run("refuses the caller's own datacenter", func(t *testing.T) {
+		args := structs.DecommissionDatacenterRequest{DecommissionDatacenter: "dc2"}
+		var out struct{}
+		err := msgpackrpc.CallWithCodec(codec2, "Operator.DecommissionDatacenter", &args, &out)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "local datacenter")
+	})
+
+	t.Run("decommissions a departed datacenter", func(t *testing.T) {
+		args := structs.DecommissionDatacenterRequest{DecommissionDatacenter: "dc3"}
+		var out struct{}
+		require.NoError(t, msgpackrpc.CallWithCodec(codec, "Operator.DecommissionDatacenter", &args, &out))
+
+		_, fedState, err := s1.fsm.State().FederationStateGet(nil, "dc3")
+		require.NoError(t, err)
+		require.Nil(t, fedState)
+		require.True(t, s1.isDatacenterDecommissioned("dc3"))
+	})
+
+	t.Run("pruning skips the grace period after decommission", func(t *testing.T) {
+		// Simulate the decommissioned datacenter's state reappearing, e.g.
+		// via a lagging replica or a server that was not shut down yet.
+		federationStateUpsert(t, codec, "", &structs.FederationState{
+			Datacenter: "dc3",
+			UpdatedAt:  time.Now().UTC(),
+		})
+
+		// Even with a long grace period configured, a single pruning pass
+		// deletes the decommissioned datacenter's state immediately.
+		s1.config.FederationStatePruneGracePeriod = time.Hour
+		require.NoError(t, s1.pruneStaleFederationStates())
+
+		_, fedState, err := s1.fsm.State().FederationStateGet(nil, "dc3")
+		require.NoError(t, err)
+		require.Nil(t, fedState)
+	})
+}
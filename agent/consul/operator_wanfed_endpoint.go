@@ -0,0 +1,65 @@
+package consul
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/consul/acl"
+	"github.com/hashicorp/consul/agent/structs"
+)
+
+// WANFederationGateways returns the answering server's cached view of the
+// mesh gateways usable for WAN federation transit: the local and primary
+// gateway lists, the raw fallback addresses, and whether the primary-ready
+// latch has fired. The view is inherently per-server state rather than
+// replicated data, so by default the query forwards to the datacenter's
+// leader and a stale query reports whichever server was contacted.
+func (op *Operator) WANFederationGateways(args *structs.WANFederationGatewaysRequest, reply *structs.WANFederationGatewaysResponse) error {
+	if done, err := op.srv.forward("Operator.WANFederationGateways", args, args, reply); done {
+		return err
+	}
+
+	// This action requires operator read access.
+	rule, err := op.srv.ResolveToken(args.Token)
+	if err != nil {
+		return err
+	}
+	if rule != nil && rule.OperatorRead(nil) != acl.Allow {
+		return acl.ErrPermissionDenied
+	}
+
+	locator := op.srv.gatewayLocator
+	if locator == nil {
+		return fmt.Errorf("mesh gateway WAN federation is disabled")
+	}
+
+	reply.LocalGateways = convertGatewayInfos(locator.ListGateways(op.srv.config.Datacenter))
+	reply.PrimaryGateways = convertGatewayInfos(locator.ListGateways(op.srv.config.PrimaryDatacenter))
+	reply.FallbackAddresses = locator.PrimaryGatewayFallbackAddresses()
+	reply.FailureCounts = locator.GatewayFailureCounts()
+	reply.LastRefreshAttempt, reply.LastSuccessfulRefresh, reply.ConsecutiveRefreshErrors = locator.RefreshLiveness()
+
+	select {
+	case <-locator.PrimaryMeshGatewayAddressesReadyCh():
+		reply.PrimaryReady = true
+	default:
+	}
+
+	return nil
+}
+
+func convertGatewayInfos(infos []GatewayInfo) []structs.WANFederationGateway {
+	out := make([]structs.WANFederationGateway, 0, len(infos))
+	for _, info := range infos {
+		out = append(out, structs.WANFederationGateway{
+			Address:             info.Address,
+			Datacenter:          info.Datacenter,
+			NodeName:            info.NodeName,
+			Health:              info.Health,
+			FromFederationState: info.FromFederationState,
+			LastUpdated:         info.LastUpdated,
+			Source:              info.Source,
+			RaftIndex:           info.RaftIndex,
+		})
+	}
+	return out
+}
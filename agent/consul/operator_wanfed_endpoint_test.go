@@ -0,0 +1,77 @@
+package consul
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/agent/structs"
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/sdk/testutil/retry"
+	"github.com/hashicorp/consul/testrpc"
+	msgpackrpc "github.com/hashicorp/net-rpc-msgpackrpc"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOperator_WANFederationGateways(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerWithConfig(t, func(c *Config) {
+		c.PrimaryDatacenter = "dc1"
+		c.DisableFederationStateAntiEntropy = true
+		c.ConnectMeshGatewayWANFederationEnabled = true
+	})
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	codec := rpcClient(t, s1)
+	defer codec.Close()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	federationStateUpsert(t, codec, "", &structs.FederationState{
+		Datacenter: "dc1",
+		MeshGateways: []structs.CheckServiceNode{
+			newTestMeshGatewayNode(
+				"dc1", "gateway1", "1.2.3.4", 5555, map[string]string{structs.MetaWANFederationKey: "1"}, api.HealthPassing,
+			),
+		},
+		UpdatedAt: time.Now().UTC(),
+	})
+
+	// The locator learns the gateway via its blocking query, so wait for
+	// the view to fill in.
+	retry.Run(t, func(r *retry.R) {
+		args := structs.WANFederationGatewaysRequest{Datacenter: "dc1"}
+		var out structs.WANFederationGatewaysResponse
+		require.NoError(r, msgpackrpc.CallWithCodec(codec, "Operator.WANFederationGateways", &args, &out))
+
+		require.True(r, out.PrimaryReady)
+		require.Len(r, out.PrimaryGateways, 1)
+		require.Equal(r, "1.2.3.4:5555", out.PrimaryGateways[0].Address)
+		require.Equal(r, "gateway1", out.PrimaryGateways[0].NodeName)
+		require.True(r, out.PrimaryGateways[0].FromFederationState)
+		require.Equal(r, GatewayListSourceFederationState, out.PrimaryGateways[0].Source)
+		require.NotZero(r, out.PrimaryGateways[0].RaftIndex)
+		require.Len(r, out.LocalGateways, 1)
+		require.Empty(r, out.FallbackAddresses)
+		require.False(r, out.LastRefreshAttempt.IsZero())
+		require.False(r, out.LastSuccessfulRefresh.IsZero())
+		require.Equal(r, 0, out.ConsecutiveRefreshErrors)
+	})
+}
+
+func TestOperator_WANFederationGateways_Disabled(t *testing.T) {
+	t.Parallel()
+
+	dir1, s1 := testServerDC(t, "dc1")
+	defer os.RemoveAll(dir1)
+	defer s1.Shutdown()
+	codec := rpcClient(t, s1)
+	defer codec.Close()
+	testrpc.WaitForLeader(t, s1.RPC, "dc1")
+
+	args := structs.WANFederationGatewaysRequest{Datacenter: "dc1"}
+	var out structs.WANFederationGatewaysResponse
+	err := msgpackrpc.CallWithCodec(codec, "Operator.WANFederationGateways", &args, &out)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "disabled")
+}
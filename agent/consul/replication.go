@@ -50,6 +50,8 @@ type Replicator struct {
 	delegate         ReplicatorDelegate
 	logger           hclog.Logger
 	lastRemoteIndex  uint64
+	lastSuccess      int64 // unix nano, accessed atomically
+	lastError        int64 // unix nano, accessed atomically
 	suppressErrorLog func(err error) bool
 }
 
@@ -107,12 +109,14 @@ func (r *Replicator) Run(ctx context.Context) error {
 			// reset the lastRemoteIndex when there is an RPC failure. This should cause a full sync to be done during
 			// the next round of replication
 			atomic.StoreUint64(&r.lastRemoteIndex, 0)
+			atomic.StoreInt64(&r.lastError, time.Now().UnixNano())
 
 			if r.suppressErrorLog != nil && !r.suppressErrorLog(err) {
 				r.logger.Warn("replication error (will retry if still leader)", "error", err)
 			}
 		} else {
 			atomic.StoreUint64(&r.lastRemoteIndex, index)
+			atomic.StoreInt64(&r.lastSuccess, time.Now().UnixNano())
 			r.logger.Debug("replication completed through remote index", "index", index)
 		}
 
@@ -130,6 +134,25 @@ func (r *Replicator) Index() uint64 {
 	return atomic.LoadUint64(&r.lastRemoteIndex)
 }
 
+// LastSuccess returns when a replication round last completed successfully,
+// or the zero time if one never has.
+func (r *Replicator) LastSuccess() time.Time {
+	return nanoTime(atomic.LoadInt64(&r.lastSuccess))
+}
+
+// LastError returns when a replication round last failed, or the zero time if
+// one never has.
+func (r *Replicator) LastError() time.Time {
+	return nanoTime(atomic.LoadInt64(&r.lastError))
+}
+
+func nanoTime(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns).UTC()
+}
+
 type ReplicatorFunc func(ctx context.Context, lastRemoteIndex uint64, logger hclog.Logger) (index uint64, exit bool, err error)
 
 type FunctionReplicator struct {
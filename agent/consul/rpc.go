@@ -276,6 +276,9 @@ func (s *Server) handleNativeTLS(conn net.Conn) {
 			)
 		}
 
+	case pool.ALPN_WANGossipStreamMulti:
+		s.handleWANGossipStreamMultiplex(tlsConn)
+
 	default:
 		if !s.handleEnterpriseNativeTLSConn(nextProto, conn) {
 			s.rpcLogger().Error(
@@ -346,6 +349,39 @@ func (s *Server) handleMultiplexV2(conn net.Conn) {
 	}
 }
 
+// handleWANGossipStreamMultiplex accepts yamux streams over a shared wan
+// federation tunnel and hands each one to memberlist as an independent gossip
+// stream. Streams are ingested synchronously so that yamux's flow control
+// provides backpressure when memberlist falls behind, instead of accepting an
+// unbounded number of streams.
+func (s *Server) handleWANGossipStreamMultiplex(conn net.Conn) {
+	defer conn.Close()
+	conf := yamux.DefaultConfig()
+	conf.LogOutput = s.config.LogOutput
+	server, _ := yamux.Server(conn, conf)
+	for {
+		sub, err := server.Accept()
+		if err != nil {
+			if err != io.EOF {
+				s.rpcLogger().Error("wan-gossip multiplex conn accept failed",
+					"conn", logConn(conn),
+					"error", err,
+				)
+			}
+			return
+		}
+
+		// No need to defer the sub.Close() here, the Ingest methods do that.
+		if err := s.memberlistTransportWAN.IngestStream(sub); err != nil {
+			s.rpcLogger().Error(
+				"failed to ingest multiplexed wan-gossip stream",
+				"conn", logConn(conn),
+				"error", err,
+			)
+		}
+	}
+}
+
 // handleConsulConn is used to service a single Consul RPC connection
 func (s *Server) handleConsulConn(conn net.Conn) {
 	defer conn.Close()
@@ -1,6 +1,7 @@
 package consul
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -161,6 +162,11 @@ type Server struct {
 	// federation states
 	federationStateReplicator *Replicator
 
+	// federationStateReplicatorDelegate retains the concrete delegate behind
+	// federationStateReplicator so the replication status RPC can read the
+	// primary's index from the most recent fetch.
+	federationStateReplicatorDelegate *FederationStateReplicator
+
 	// tokens holds ACL tokens initially from the configuration, but can
 	// be updated at runtime, so should always be used instead of going to
 	// the configuration directly.
@@ -252,6 +258,22 @@ type Server struct {
 	memberlistTransportWAN memberlist.IngestionAwareTransport
 	gatewayLocator         *GatewayLocator
 
+	// fedStatePruneMissingSince tracks when each federation state datacenter
+	// was first observed missing from the WAN pool, and
+	// fedStatePruneLimiter rate-limits the resulting Raft deletions. Both
+	// are only touched by the federation state pruning leader routine.
+	fedStatePruneMissingSince map[string]time.Time
+	fedStatePruneLimiter      *rate.Limiter
+
+	// decommissionedDCs records datacenters removed from the federation via
+	// Operator.DecommissionDatacenter, so the pruning routine deletes a
+	// reappearing federation state without waiting out the grace period.
+	// In-memory only and so best effort; it does not survive a leader
+	// failover or restart. Guarded by decommissionedDCLock since the RPC and
+	// the pruning routine run on different goroutines.
+	decommissionedDCLock sync.Mutex
+	decommissionedDCs    map[string]struct{}
+
 	// serverLookup tracks server consuls in the local datacenter.
 	// Used to do leader forwarding and provide fast lookup by server id and address
 	serverLookup *ServerLookup
@@ -376,6 +398,10 @@ func NewServerLogger(config *Config, logger hclog.InterceptLogger, tokens *token
 		TLSConfigurator: tlsConfigurator,
 		ForceTLS:        config.VerifyOutgoing,
 		Datacenter:      config.Datacenter,
+		GatewayDialRetryBudget: pool.DialRetryBudget{
+			MaxTime:     config.GatewayDialRetryMaxTime,
+			MaxAttempts: config.GatewayDialRetryMaxAttempts,
+		},
 	}
 
 	serverLogger := logger.NamedIntercept(logging.ConsulServer)
@@ -409,10 +435,13 @@ func NewServerLogger(config *Config, logger hclog.InterceptLogger, tokens *token
 		s.gatewayLocator = NewGatewayLocator(
 			s.logger,
 			s,
-			s.config.Datacenter,
-			s.config.PrimaryDatacenter,
+			s.config,
 		)
-		s.connPool.GatewayResolver = s.gatewayLocator.PickGateway
+		s.connPool.GatewayResolver = s.gatewayLocator.PickGatewayErrForRPC
+		s.connPool.GatewayFailedNotifier = s.gatewayLocator.MarkGatewayFailed
+		s.connPool.GatewaySucceededNotifier = s.gatewayLocator.ReportGatewaySuccess
+		s.connPool.GatewayConnOpenedNotifier = s.gatewayLocator.IncGatewayConns
+		s.connPool.GatewayConnClosedNotifier = s.gatewayLocator.DecGatewayConns
 	}
 
 	// Initialize enterprise specific server functionality
@@ -436,10 +465,11 @@ func NewServerLogger(config *Config, logger hclog.InterceptLogger, tokens *token
 		return nil, err
 	}
 
+	s.federationStateReplicatorDelegate = &FederationStateReplicator{srv: s}
 	federationStateReplicatorConfig := ReplicatorConfig{
 		Name: logging.FederationState,
 		Delegate: &IndexReplicator{
-			Delegate: &FederationStateReplicator{srv: s},
+			Delegate: s.federationStateReplicatorDelegate,
 			Logger:   s.logger,
 		},
 		Rate:   s.config.FederationStateReplicationRate,
@@ -495,7 +525,7 @@ func NewServerLogger(config *Config, logger hclog.InterceptLogger, tokens *token
 	}
 
 	if s.gatewayLocator != nil {
-		go s.gatewayLocator.Run(s.shutdownCh)
+		go s.gatewayLocator.RunWithStopCh(s.shutdownCh)
 	}
 
 	// Serf and dynamic bind ports
@@ -871,6 +901,18 @@ func (s *Server) Shutdown() error {
 	s.shutdown = true
 	close(s.shutdownCh)
 
+	// The gateway locator's Run goroutine watches shutdownCh; wait briefly
+	// for it to unwind so it doesn't log errors against a half-torn-down
+	// server. Cancellation wakes its in-flight blocking query, so this
+	// normally completes in milliseconds.
+	if s.gatewayLocator != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := s.gatewayLocator.WaitForDone(ctx); err != nil {
+			s.logger.Warn("timed out waiting for the gateway locator to stop")
+		}
+		cancel()
+	}
+
 	// ensure that any leader routines still running get canceled
 	if s.leaderRoutineManager != nil {
 		s.leaderRoutineManager.StopAll()
@@ -1067,6 +1109,17 @@ func (s *Server) PrimaryMeshGatewayAddressesReadyCh() <-chan struct{} {
 	return s.gatewayLocator.PrimaryMeshGatewayAddressesReadyCh()
 }
 
+// RefreshGatewayLocator makes the gateway locator re-query mesh gateway
+// locations immediately, skipping any backoff it may be sleeping through.
+// Called on config reload so operators can force the locator to notice a
+// repaired gateway registration, and usable by operator endpoints as well.
+func (s *Server) RefreshGatewayLocator() {
+	if s.gatewayLocator == nil {
+		return
+	}
+	s.gatewayLocator.ForceRefresh()
+}
+
 // PickRandomMeshGatewaySuitableForDialing is a convenience function used for writing tests.
 func (s *Server) PickRandomMeshGatewaySuitableForDialing(dc string) string {
 	if s.gatewayLocator == nil {
@@ -1083,6 +1136,26 @@ func (s *Server) RefreshPrimaryGatewayFallbackAddresses(addrs []string) {
 	}
 }
 
+// SubscribeMeshGatewayAddresses returns a channel carrying snapshots of the
+// effective mesh gateway address sets whenever they change, or nil when WAN
+// federation via mesh gateways is disabled. See GatewayLocator.Subscribe.
+func (s *Server) SubscribeMeshGatewayAddresses(ctx context.Context) <-chan GatewayAddressSnapshot {
+	if s.gatewayLocator == nil {
+		return nil
+	}
+	return s.gatewayLocator.Subscribe(ctx)
+}
+
+// WANFederationStatus returns a point-in-time summary of the mesh gateway
+// WAN federation machinery on this server, or nil when it is disabled.
+func (s *Server) WANFederationStatus() *WANFederationStatus {
+	if s.gatewayLocator == nil {
+		return nil
+	}
+	status := s.gatewayLocator.Status()
+	return &status
+}
+
 // PrimaryGatewayFallbackAddresses returns the current set of discovered
 // fallback addresses for the mesh gateways in the primary datacenter.
 func (s *Server) PrimaryGatewayFallbackAddresses() []string {
@@ -1353,6 +1426,8 @@ func (s *Server) ReloadConfig(config *Config) error {
 		MaxConnsPerClientIP: config.RPCMaxConnsPerClient,
 	})
 
+	s.RefreshGatewayLocator()
+
 	if s.IsLeader() {
 		// only bootstrap the config entries if we are the leader
 		// this will error if we lose leadership while bootstrapping here.
@@ -9,6 +9,7 @@ import (
 
 	"github.com/hashicorp/consul/agent/consul/wanfed"
 	"github.com/hashicorp/consul/agent/metadata"
+	"github.com/hashicorp/consul/agent/pool"
 	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/lib"
 	"github.com/hashicorp/consul/logging"
@@ -127,7 +128,28 @@ func (s *Server) setupSerf(conf *serf.Config, ch chan serf.Event, path string, w
 				s.tlsConfigurator,
 				nt,
 				s.config.Datacenter,
-				s.gatewayLocator.PickGateway,
+				s.config.GatewayTLSServerNames,
+				s.gatewayLocator.PickGatewayErrForGossip,
+				func(dc string, exclude []string) (string, error) {
+					return s.gatewayLocator.PickGatewayExcluding(dc, exclude), nil
+				},
+				func(dc string) []string {
+					return s.gatewayLocator.PickGateways(dc, wanfed.MaxDialCandidates)
+				},
+				s.gatewayLocator.MarkGatewayFailed,
+				s.gatewayLocator.ReportGatewaySuccess,
+				s.config.GatewayTracer,
+				s.config.GatewayDialMetricAddrLabelEnabled,
+				s.config.GatewayStreamMultiplexEnabled,
+				pool.DialRetryBudget{
+					MaxTime:     s.config.GatewayDialRetryMaxTime,
+					MaxAttempts: s.config.GatewayDialRetryMaxAttempts,
+				},
+				wanfed.PoolConfig{
+					MaxIdleTime:       s.config.GatewayPoolIdleTimeout,
+					MaxIdlePerKey:     s.config.GatewayPoolMaxIdleConnsPerKey,
+					KeepaliveInterval: s.config.GatewayTunnelKeepaliveInterval,
+				},
 			)
 			if err != nil {
 				return nil, err
@@ -159,6 +159,31 @@ func (s *Store) federationStateGetTxn(tx *memdb.Txn, ws memdb.WatchSet, datacent
 	return idx, config, nil
 }
 
+// FederationStateBatchGet is called to get a selection of federation states
+// by datacenter. Unlike FederationStateList it installs watches only on the
+// requested entries, so a blocking query over a handful of datacenters is not
+// woken by changes to unrelated ones. Datacenters without a federation state
+// are omitted from the result, which preserves the request order.
+func (s *Store) FederationStateBatchGet(ws memdb.WatchSet, datacenters []string) (uint64, []*structs.FederationState, error) {
+	tx := s.db.Txn(false)
+	defer tx.Abort()
+
+	// Get the index
+	idx := maxIndexTxn(tx, federationStateTableName)
+
+	var results []*structs.FederationState
+	for _, datacenter := range datacenters {
+		_, config, err := s.federationStateGetTxn(tx, ws, datacenter)
+		if err != nil {
+			return 0, nil, err
+		}
+		if config != nil {
+			results = append(results, config)
+		}
+	}
+	return idx, results, nil
+}
+
 // FederationStateList is called to get all federation state objects.
 func (s *Store) FederationStateList(ws memdb.WatchSet) (uint64, []*structs.FederationState, error) {
 	tx := s.db.Txn(false)
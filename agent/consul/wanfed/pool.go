@@ -5,33 +5,53 @@ import (
 	"net"
 	"sync"
 	"time"
+
+	metrics "github.com/armon/go-metrics"
 )
 
+// DefaultMaxIdleConnsPerKey bounds how many idle tunnel connections are
+// retained per pool key when no explicit bound is configured.
+const DefaultMaxIdleConnsPerKey = 2
+
 // connPool pools idle negotiated ALPN_WANGossipPacket flavored connections to
 // remote servers. Idle connections only remain pooled for up to maxTime after
-// they were last acquired.
+// they were last acquired, and at most maxIdlePerKey of them are retained per
+// key.
 type connPool struct {
 	// maxTime is the maximum time to keep a connection open.
 	maxTime time.Duration
 
-	// mu protects pool and shutdown
+	// maxIdlePerKey caps the idle connections retained per key; returns
+	// beyond the cap close the connection instead of pooling it.
+	maxIdlePerKey int
+
+	// mu protects pool, shutdown, and the stats counters below.
 	mu       sync.Mutex
 	pool     map[string][]*conn
 	shutdown bool
 
+	// running stats, also emitted as metrics from the reap loop.
+	active     int
+	dials      uint64
+	dialErrors uint64
+
 	shutdownCh chan struct{}
 	reapWg     sync.WaitGroup
 }
 
-func newConnPool(maxTime time.Duration) (*connPool, error) {
+func newConnPool(maxTime time.Duration, maxIdlePerKey int) (*connPool, error) {
 	if maxTime == 0 {
 		return nil, fmt.Errorf("wanfed: conn pool needs a max time configured")
 	}
+	if maxIdlePerKey == 0 {
+		maxIdlePerKey = DefaultMaxIdleConnsPerKey
+	}
 
 	p := &connPool{
-		maxTime:    maxTime,
-		pool:       make(map[string][]*conn),
-		shutdownCh: make(chan struct{}),
+		maxTime:       maxTime,
+		maxIdlePerKey: maxIdlePerKey,
+		pool:          make(map[string][]*conn),
+		shutdownCh:    make(chan struct{}),
 	}
 
 	p.reapWg.Add(1)
@@ -63,8 +83,10 @@ func (p *connPool) Close() error {
 }
 
 // AcquireOrDial either removes an idle connection from the pool or
-// estabilishes a new one using the provided dialer function.
-func (p *connPool) AcquireOrDial(key string, dialer func() (net.Conn, error)) (*conn, error) {
+// estabilishes a new one using the provided dialer function. The dialer also
+// reports which gateway address the connection ended up tunneling through, so
+// the pool can later drop every connection behind a failed gateway.
+func (p *connPool) AcquireOrDial(key string, dialer func() (net.Conn, string, error)) (*conn, error) {
 	c, err := p.maybeAcquire(key)
 	if err != nil {
 		return nil, err
@@ -74,21 +96,71 @@ func (p *connPool) AcquireOrDial(key string, dialer func() (net.Conn, error)) (*
 		return c, nil
 	}
 
-	nc, err := dialer()
+	metrics.IncrCounter([]string{"wanfed", "pool", "dials"}, 1)
+	p.mu.Lock()
+	p.dials++
+	p.mu.Unlock()
+
+	nc, gwAddr, err := dialer()
 	if err != nil {
+		metrics.IncrCounter([]string{"wanfed", "pool", "dial_errors"}, 1)
+		p.mu.Lock()
+		p.dialErrors++
+		p.mu.Unlock()
 		return nil, err
 	}
 
 	c = &conn{
-		key:  key,
-		pool: p,
-		Conn: nc,
+		key:    key,
+		gwAddr: gwAddr,
+		pool:   p,
+		Conn:   nc,
 	}
 	c.markForUse()
 
 	return c, nil
 }
 
+// Stats returns a snapshot of the pool's counters: connections currently in
+// use, idle connections parked for reuse, and cumulative dials and dial
+// errors.
+func (p *connPool) Stats() (active, idle int, dials, dialErrors uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, conns := range p.pool {
+		idle += len(conns)
+	}
+	return p.active, idle, p.dials, p.dialErrors
+}
+
+// closeForGateway closes every pooled idle connection that tunnels through
+// the provided gateway address, so a gateway reported failed or removed is
+// not quietly reused.
+func (p *connPool) closeForGateway(gwAddr string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.shutdown {
+		return
+	}
+
+	for key, conns := range p.pool {
+		var retain []*conn
+		for _, c := range conns {
+			if c.gwAddr == gwAddr {
+				c.Conn.Close()
+			} else {
+				retain = append(retain, c)
+			}
+		}
+		if len(retain) == 0 {
+			delete(p.pool, key)
+		} else if len(retain) != len(conns) {
+			p.pool[key] = retain
+		}
+	}
+}
+
 var errPoolClosed = fmt.Errorf("wanfed: connection pool is closed")
 
 // maybeAcquire removes an idle connection from the pool if possible otherwise
@@ -105,25 +177,35 @@ func (p *connPool) maybeAcquire(key string) (*conn, error) {
 		return nil, nil
 	}
 
-	switch len(conns) {
-	case 0:
-		delete(p.pool, key) // stray cleanup
-		return nil, nil
+	// Pop from the end, discarding any connection that has already sat
+	// idle past maxTime: the reaper only runs periodically and an
+	// intermediary load balancer may have silently dropped the connection
+	// in the meantime, so a fresh dial beats handing out a dead tunnel.
+	now := time.Now()
+	for len(conns) > 0 {
+		sz := len(conns)
+		c := conns[sz-1]
+		conns = conns[:sz-1]
 
-	case 1:
-		c := conns[0]
-		delete(p.pool, key)
-		return c, nil
+		if now.Sub(c.lastUsed) >= p.maxTime {
+			c.Conn.Close()
+			continue
+		}
 
-	default:
-		sz := len(conns)
-		remaining, last := conns[0:sz-1], conns[sz-1]
-		p.pool[key] = remaining
-		return last, nil
+		if len(conns) == 0 {
+			delete(p.pool, key)
+		} else {
+			p.pool[key] = conns
+		}
+		return c, nil
 	}
+
+	delete(p.pool, key) // stray cleanup
+	return nil, nil
 }
 
-// returnConn puts the connection back into the idle pool for reuse.
+// returnConn puts the connection back into the idle pool for reuse, unless
+// the per-key idle bound is already met, in which case it is closed.
 func (p *connPool) returnConn(c *conn) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -132,11 +214,22 @@ func (p *connPool) returnConn(c *conn) error {
 		return c.Conn.Close() // actual shutdown
 	}
 
+	if p.maxIdlePerKey > 0 && len(p.pool[c.key]) >= p.maxIdlePerKey {
+		return c.Conn.Close()
+	}
+
 	p.pool[c.key] = append(p.pool[c.key], c)
 
 	return nil
 }
 
+// adjustActive tracks how many acquired connections are currently in use.
+func (p *connPool) adjustActive(delta int) {
+	p.mu.Lock()
+	p.active += delta
+	p.mu.Unlock()
+}
+
 // reap periodically scans the idle pool for connections that have not been
 // used recently and closes them.
 func (p *connPool) reap() {
@@ -193,15 +286,27 @@ func (p *connPool) reapOnce() {
 	for _, key := range removedKeys {
 		delete(p.pool, key)
 	}
+
+	var idle int
+	for _, conns := range p.pool {
+		idle += len(conns)
+	}
+	metrics.SetGauge([]string{"wanfed", "pool", "conns_idle"}, float32(idle))
+	metrics.SetGauge([]string{"wanfed", "pool", "conns_active"}, float32(p.active))
 }
 
 type conn struct {
 	key string
 
+	// gwAddr is the gateway address the connection tunnels through, for
+	// closeForGateway.
+	gwAddr string
+
 	mu       sync.Mutex
 	lastUsed time.Time
 	failed   bool
 	closed   bool
+	active   bool
 
 	pool *connPool
 
@@ -215,11 +320,16 @@ func (c *conn) ReturnOrClose() error {
 	if failed {
 		c.closed = true
 	}
+	wasActive := c.active
+	c.active = false
 	c.mu.Unlock()
 
 	if closed {
 		return nil
 	}
+	if wasActive {
+		c.pool.adjustActive(-1)
+	}
 
 	if failed {
 		return c.Conn.Close()
@@ -232,11 +342,16 @@ func (c *conn) Close() error {
 	c.mu.Lock()
 	closed := c.closed
 	c.closed = true
+	wasActive := c.active
+	c.active = false
 	c.mu.Unlock()
 
 	if closed {
 		return nil
 	}
+	if wasActive {
+		c.pool.adjustActive(-1)
+	}
 
 	return c.Conn.Close()
 }
@@ -245,7 +360,13 @@ func (c *conn) markForUse() {
 	c.mu.Lock()
 	c.lastUsed = time.Now()
 	c.failed = false
+	wasActive := c.active
+	c.active = true
 	c.mu.Unlock()
+
+	if !wasActive {
+		c.pool.adjustActive(1)
+	}
 }
 
 func (c *conn) MarkFailed() {
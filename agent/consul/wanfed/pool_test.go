@@ -0,0 +1,186 @@
+package wanfed
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testConnPair(t *testing.T) (net.Conn, net.Conn) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+
+	connCh := make(chan net.Conn, 1)
+	go func() {
+		server, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		connCh <- server
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	require.NoError(t, err)
+	server := <-connCh
+	t.Cleanup(func() {
+		client.Close()
+		server.Close()
+	})
+	return client, server
+}
+
+func testDialer(t *testing.T, gwAddr string) func() (net.Conn, string, error) {
+	return func() (net.Conn, string, error) {
+		client, _ := testConnPair(t)
+		return client, gwAddr, nil
+	}
+}
+
+func TestConnPool_ReuseAndStats(t *testing.T) {
+	p, err := newConnPool(time.Minute, 0)
+	require.NoError(t, err)
+	defer p.Close()
+
+	c1, err := p.AcquireOrDial("node1.dc2", testDialer(t, "gw1:8443"))
+	require.NoError(t, err)
+
+	active, idle, dials, dialErrors := p.Stats()
+	require.Equal(t, 1, active)
+	require.Equal(t, 0, idle)
+	require.Equal(t, uint64(1), dials)
+	require.Equal(t, uint64(0), dialErrors)
+
+	require.NoError(t, c1.ReturnOrClose())
+
+	active, idle, _, _ = p.Stats()
+	require.Equal(t, 0, active)
+	require.Equal(t, 1, idle)
+
+	// Re-acquiring the same key reuses the pooled connection: no new dial.
+	c2, err := p.AcquireOrDial("node1.dc2", testDialer(t, "gw1:8443"))
+	require.NoError(t, err)
+	require.Same(t, c1, c2)
+
+	_, _, dials, _ = p.Stats()
+	require.Equal(t, uint64(1), dials)
+	require.NoError(t, c2.ReturnOrClose())
+}
+
+func TestConnPool_IdleBoundPerKey(t *testing.T) {
+	p, err := newConnPool(time.Minute, 1)
+	require.NoError(t, err)
+	defer p.Close()
+
+	c1, err := p.AcquireOrDial("node1.dc2", testDialer(t, "gw1:8443"))
+	require.NoError(t, err)
+	c2, err := p.AcquireOrDial("node1.dc2", testDialer(t, "gw1:8443"))
+	require.NoError(t, err)
+
+	require.NoError(t, c1.ReturnOrClose())
+	// The bound is one idle connection per key, so the second return closes
+	// its connection instead of pooling it.
+	require.NoError(t, c2.ReturnOrClose())
+
+	_, idle, _, _ := p.Stats()
+	require.Equal(t, 1, idle)
+}
+
+func TestConnPool_CloseForGateway(t *testing.T) {
+	p, err := newConnPool(time.Minute, 0)
+	require.NoError(t, err)
+	defer p.Close()
+
+	c1, err := p.AcquireOrDial("node1.dc2", testDialer(t, "gw1:8443"))
+	require.NoError(t, err)
+	c2, err := p.AcquireOrDial("node2.dc2", testDialer(t, "gw2:8443"))
+	require.NoError(t, err)
+	require.NoError(t, c1.ReturnOrClose())
+	require.NoError(t, c2.ReturnOrClose())
+
+	p.closeForGateway("gw1:8443")
+
+	// Only the connection behind the other gateway survives.
+	_, idle, _, _ := p.Stats()
+	require.Equal(t, 1, idle)
+
+	c3, err := p.AcquireOrDial("node2.dc2", testDialer(t, "gw2:8443"))
+	require.NoError(t, err)
+	require.Same(t, c2, c3)
+	require.NoError(t, c3.ReturnOrClose())
+}
+
+func TestConnPool_IdleTimeoutBeatsSilentDrop(t *testing.T) {
+	// A proxy standing in for a cloud load balancer: it relays bytes to a
+	// recorder, but once a connection sits idle too long it silently stops
+	// relaying without closing the client side.
+	const proxyIdleDrop = 150 * time.Millisecond
+
+	received := make(chan string, 10)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				buf := make([]byte, 64)
+				for {
+					conn.SetReadDeadline(time.Now().Add(proxyIdleDrop))
+					n, err := conn.Read(buf)
+					if n > 0 {
+						received <- string(buf[:n])
+					}
+					if err != nil {
+						// Idle too long: drop silently, leaving the
+						// client side open.
+						return
+					}
+				}
+			}(conn)
+		}
+	}()
+
+	// The pool's idle bound sits below the proxy's, so a tunnel is never
+	// reused after the proxy may have dropped it.
+	p, err := newConnPool(100*time.Millisecond, 0)
+	require.NoError(t, err)
+	defer p.Close()
+
+	dialer := func() (net.Conn, string, error) {
+		nc, err := net.Dial("tcp", ln.Addr().String())
+		return nc, "gw1:8443", err
+	}
+
+	send := func(msg string) {
+		c, err := p.AcquireOrDial("node1.dc2", dialer)
+		require.NoError(t, err)
+		_, err = c.Write([]byte(msg))
+		require.NoError(t, err)
+		require.NoError(t, c.ReturnOrClose())
+
+		select {
+		case got := <-received:
+			require.Equal(t, msg, got)
+		case <-time.After(2 * time.Second):
+			t.Fatalf("message %q never arrived; a dead tunnel was reused", msg)
+		}
+	}
+
+	send("one")
+
+	// Wait long enough that the proxy has silently dropped the first
+	// tunnel. The pool's reaper may not have run yet, so this relies on
+	// the acquire-time idle check dialing a fresh tunnel.
+	time.Sleep(120 * time.Millisecond)
+	send("two")
+
+	_, _, dials, _ := p.Stats()
+	require.Equal(t, uint64(2), dials)
+}
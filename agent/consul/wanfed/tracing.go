@@ -0,0 +1,61 @@
+package wanfed
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// Tracer is a minimal tracing hook for the WAN federation path. The repo
+// deliberately carries no tracer dependency here; embedders that run
+// distributed tracing can adapt their tracer (e.g. OpenTelemetry) to this
+// interface and inject it, while everything else gets the no-op default.
+type Tracer interface {
+	// StartSpan begins a span with the given operation name. The returned
+	// span must be ended exactly once.
+	StartSpan(name string) Span
+}
+
+// Span is one traced operation. Implementations must tolerate attribute
+// writes after an error has been recorded.
+type Span interface {
+	// SetAttribute records a key/value attribute on the span.
+	SetAttribute(key string, value interface{})
+
+	// SetError marks the span as failed and records the error.
+	SetError(err error)
+
+	// End finishes the span.
+	End()
+}
+
+// NoopTracer is the default Tracer: it records nothing.
+type NoopTracer struct{}
+
+// StartSpan implements Tracer.
+func (NoopTracer) StartSpan(string) Span { return noopSpan{} }
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(string, interface{}) {}
+func (noopSpan) SetError(error)                   {}
+func (noopSpan) End()                             {}
+
+// ErrorClass buckets an error into a coarse class suitable for a span
+// attribute or metric label, so traces can be aggregated by failure kind
+// without exploding cardinality on raw error strings.
+func ErrorClass(err error) string {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.Is(err, syscall.ECONNREFUSED):
+		return "connection-refused"
+	case errors.Is(err, syscall.ECONNRESET):
+		return "connection-reset"
+	default:
+		return "other"
+	}
+}
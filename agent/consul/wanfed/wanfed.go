@@ -1,17 +1,21 @@
 package wanfed
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
+	metrics "github.com/armon/go-metrics"
 	"github.com/hashicorp/consul/agent/pool"
 	"github.com/hashicorp/consul/agent/structs"
 	"github.com/hashicorp/consul/tlsutil"
 	"github.com/hashicorp/memberlist"
+	"github.com/hashicorp/yamux"
 )
 
 const (
@@ -25,15 +29,80 @@ const (
 	// forwarded via wanfed. This is 4MB which should be way bigger than serf
 	// or memberlist allow practically so it should never be hit in practice.
 	GossipPacketMaxByteSize = 4 * 1024 * 1024
+
+	// MaxStreamsPerMuxTunnel caps how many logical gossip streams ride over
+	// one multiplexed gateway tunnel before an additional tunnel is dialed.
+	//
+	// Conceptually similar to: agent/consul/server.go:serverMaxStreams
+	MaxStreamsPerMuxTunnel = 64
+
+	// muxUnsupportedRecheckInterval is how long a destination datacenter is
+	// remembered as not speaking ALPN_WANGossipStreamMulti before it is
+	// probed again, so upgraded peers eventually get multiplexed tunnels
+	// without restarting this side.
+	muxUnsupportedRecheckInterval = 10 * time.Minute
 )
 
-type MeshGatewayResolver func(datacenter string) string
+type MeshGatewayResolver func(datacenter string) (string, error)
+
+// MeshGatewayExcludingResolver is an optional resolver variant that skips the
+// provided addresses, used to pick a different gateway when retrying after a
+// dial failure.
+type MeshGatewayExcludingResolver func(datacenter string, exclude []string) (string, error)
+
+// MeshGatewayListResolver is an optional resolver variant returning an
+// ordered list of candidate gateway addresses, so that a failed transit dial
+// fails over across every listed gateway instead of retrying just once.
+// When set it takes precedence over MeshGatewayExcludingResolver.
+type MeshGatewayListResolver func(datacenter string) []string
+
+// MaxDialCandidates is how many distinct gateway addresses one transit dial
+// may try, counting the initial pick, before returning a combined error.
+const MaxDialCandidates = 3
+
+// MeshGatewayFailedNotifier is an optional callback invoked when a dial
+// through a mesh gateway address fails, so that the resolver can deprioritize
+// the address on subsequent picks.
+type MeshGatewayFailedNotifier func(addr string, err error)
+
+// MeshGatewaySucceededNotifier is an optional callback invoked when a dial
+// through a mesh gateway address succeeds, so that the resolver can clear any
+// failure tracking for the address.
+type MeshGatewaySucceededNotifier func(addr string)
+
+// PoolConfig tunes the transit connection pool; the zero value selects the
+// defaults.
+type PoolConfig struct {
+	// MaxIdleTime is how long pooled tunnel connections may sit unused
+	// before the reaper closes them. Zero uses GossipPacketMaxIdleTime.
+	MaxIdleTime time.Duration
+
+	// MaxIdlePerKey bounds how many idle connections are retained per pool
+	// key. Zero uses DefaultMaxIdleConnsPerKey; negative removes the bound.
+	MaxIdlePerKey int
+
+	// KeepaliveInterval overrides the TCP keepalive period on tunnel
+	// connections, so tunnels crossing load balancers that silently drop
+	// idle connections get noticed and torn down proactively. Zero keeps
+	// the operating system default.
+	KeepaliveInterval time.Duration
+}
 
 func NewTransport(
 	tlsConfigurator *tlsutil.Configurator,
 	transport memberlist.NodeAwareTransport,
 	datacenter string,
+	tlsServerNames map[string]string,
 	gwResolver MeshGatewayResolver,
+	gwExcludingResolver MeshGatewayExcludingResolver,
+	gwListResolver MeshGatewayListResolver,
+	gwFailedNotifier MeshGatewayFailedNotifier,
+	gwSucceededNotifier MeshGatewaySucceededNotifier,
+	tracer Tracer,
+	dialMetricAddrLabel bool,
+	streamMuxEnabled bool,
+	dialRetryBudget pool.DialRetryBudget,
+	poolCfg PoolConfig,
 ) (*Transport, error) {
 	if tlsConfigurator == nil {
 		return nil, errors.New("wanfed: tlsConfigurator is nil")
@@ -41,18 +110,41 @@ func NewTransport(
 	if gwResolver == nil {
 		return nil, errors.New("wanfed: gwResolver is nil")
 	}
+	for dc, name := range tlsServerNames {
+		if err := ValidateTLSServerName(name); err != nil {
+			return nil, fmt.Errorf("wanfed: invalid TLS server name for datacenter %q: %v", dc, err)
+		}
+	}
+	if tracer == nil {
+		tracer = NoopTracer{}
+	}
+
+	maxIdleTime := poolCfg.MaxIdleTime
+	if maxIdleTime <= 0 {
+		maxIdleTime = GossipPacketMaxIdleTime
+	}
 
-	cp, err := newConnPool(GossipPacketMaxIdleTime)
+	cp, err := newConnPool(maxIdleTime, poolCfg.MaxIdlePerKey)
 	if err != nil {
 		return nil, err
 	}
 
 	t := &Transport{
-		NodeAwareTransport: transport,
-		tlsConfigurator:    tlsConfigurator,
-		datacenter:         datacenter,
-		gwResolver:         gwResolver,
-		pool:               cp,
+		NodeAwareTransport:  transport,
+		tlsConfigurator:     tlsConfigurator,
+		datacenter:          datacenter,
+		tlsServerNames:      tlsServerNames,
+		gwResolver:          gwResolver,
+		gwExcludingResolver: gwExcludingResolver,
+		gwListResolver:      gwListResolver,
+		gwFailedNotifier:    gwFailedNotifier,
+		gwSucceededNotifier: gwSucceededNotifier,
+		tracer:              tracer,
+		dialMetricAddrLabel: dialMetricAddrLabel,
+		streamMuxEnabled:    streamMuxEnabled,
+		dialRetryBudget:     dialRetryBudget,
+		keepalivePeriod:     poolCfg.KeepaliveInterval,
+		pool:                cp,
 	}
 	return t, nil
 }
@@ -62,14 +154,66 @@ type Transport struct {
 
 	tlsConfigurator *tlsutil.Configurator
 	datacenter      string
-	gwResolver      MeshGatewayResolver
-	pool            *connPool
+
+	// tlsServerNames overrides, per destination datacenter, the TLS server
+	// name presented when dialing through a mesh gateway, for topologies
+	// where a shared gateway routes on a custom SNI. Datacenters absent
+	// from the map use the standard computed name.
+	tlsServerNames map[string]string
+
+	gwResolver          MeshGatewayResolver
+	gwExcludingResolver MeshGatewayExcludingResolver
+	gwListResolver      MeshGatewayListResolver
+	gwFailedNotifier    MeshGatewayFailedNotifier
+	gwSucceededNotifier MeshGatewaySucceededNotifier
+	tracer              Tracer
+
+	// dialMetricAddrLabel adds the dialed gateway address as a label on the
+	// dial metrics; off by default for cardinality reasons.
+	dialMetricAddrLabel bool
+
+	// dialRetryBudget bounds retries of gossip stream dials; the zero
+	// value selects the defaults.
+	dialRetryBudget pool.DialRetryBudget
+
+	// keepalivePeriod overrides the TCP keepalive period on tunnel
+	// connections; zero keeps the operating system default.
+	keepalivePeriod time.Duration
+
+	// streamMuxEnabled multiplexes gossip streams to one destination over
+	// shared long-lived gateway tunnels instead of dialing one tunnel per
+	// stream. Destinations whose servers do not speak the multiplexed
+	// protocol automatically fall back to one connection per stream.
+	streamMuxEnabled bool
+
+	// muxMu guards muxSessions and muxUnsupportedUntil.
+	muxMu sync.Mutex
+
+	// muxSessions holds the live multiplexed tunnels, keyed by the
+	// destination node name as represented in the WAN pool.
+	muxSessions map[string][]*yamux.Session
+
+	// muxUnsupportedUntil remembers, per destination datacenter, when to
+	// next probe a peer that failed ALPN negotiation for the multiplexed
+	// protocol.
+	muxUnsupportedUntil map[string]time.Time
+
+	pool *connPool
 }
 
 var _ memberlist.NodeAwareTransport = (*Transport)(nil)
 
 // Shutdown implements memberlist.Transport.
 func (t *Transport) Shutdown() error {
+	t.muxMu.Lock()
+	for _, sessions := range t.muxSessions {
+		for _, session := range sessions {
+			session.Close()
+		}
+	}
+	t.muxSessions = nil
+	t.muxMu.Unlock()
+
 	err1 := t.pool.Close()
 	err2 := t.NodeAwareTransport.Shutdown()
 	if err2 != nil {
@@ -90,13 +234,16 @@ func (t *Transport) WriteToAddress(b []byte, addr memberlist.Address) (time.Time
 	}
 
 	if dc != t.datacenter {
-		gwAddr := t.gwResolver(dc)
+		gwAddr, err := t.gwResolver(dc)
+		if err != nil {
+			return time.Time{}, err
+		}
 		if gwAddr == "" {
 			return time.Time{}, structs.ErrDCNotAvailable
 		}
 
-		dialFunc := func() (net.Conn, error) {
-			return t.dial(dc, node, pool.ALPN_WANGossipPacket, gwAddr)
+		dialFunc := func() (net.Conn, string, error) {
+			return t.dialAcrossGateways(dc, node, pool.ALPN_WANGossipPacket, gwAddr, t.dial)
 		}
 		conn, err := t.pool.AcquireOrDial(addr.Name, dialFunc)
 		if err != nil {
@@ -129,44 +276,384 @@ func (t *Transport) DialAddressTimeout(addr memberlist.Address, timeout time.Dur
 	}
 
 	if dc != t.datacenter {
-		gwAddr := t.gwResolver(dc)
-		if gwAddr == "" {
-			return nil, structs.ErrDCNotAvailable
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		if t.streamMuxEnabled && !t.muxFallbackActive(dc) {
+			stream, err := t.openMuxStream(ctx, dc, node)
+			switch {
+			case err == nil:
+				return stream, nil
+			case isALPNProtocolUnsupported(err):
+				// The destination's servers predate the multiplexed
+				// stream protocol; remember that for a while and fall
+				// back to one connection per stream.
+				t.markMuxUnsupported(dc)
+			default:
+				return nil, err
+			}
 		}
 
-		return t.dial(dc, node, pool.ALPN_WANGossipStream, gwAddr)
+		return t.dialStreamConn(ctx, dc, node, pool.ALPN_WANGossipStream)
 	}
 
 	return t.NodeAwareTransport.DialAddressTimeout(addr, timeout)
 }
 
+// dialStreamConn runs one budgeted stream-flavored tunnel dial. Each attempt
+// resolves a fresh gateway and then fails over across the remaining
+// candidates, so a dead gateway costs a bounded amount of time instead of
+// failing the stream dial.
+func (t *Transport) dialStreamConn(ctx context.Context, dc, node, nextProto string) (net.Conn, error) {
+	conn, _, err := pool.DialWithRetryBudget(ctx, dc, t.dialRetryBudget, func() (net.Conn, pool.HalfCloser, error) {
+		gwAddr, err := t.gwResolver(dc)
+		if err != nil {
+			return nil, nil, err
+		}
+		if gwAddr == "" {
+			return nil, nil, structs.ErrDCNotAvailable
+		}
+		conn, _, err := t.dialAcrossGateways(dc, node, nextProto, gwAddr, t.dial)
+		if err != nil && isALPNProtocolUnsupported(err) {
+			// Redialing cannot make the remote side accept the protocol;
+			// stop the budget so the caller can fall back right away.
+			return nil, nil, &pool.PermanentDialError{Err: err}
+		}
+		return conn, nil, err
+	})
+	return conn, err
+}
+
+// openMuxStream returns one logical gossip stream to the destination node,
+// riding over a shared multiplexed tunnel. An existing tunnel with stream
+// capacity is reused; otherwise a new tunnel is dialed with
+// ALPN_WANGossipStreamMulti, so older peers that do not list that protocol
+// surface an ALPN negotiation error the caller can fall back on.
+func (t *Transport) openMuxStream(ctx context.Context, dc, node string) (net.Conn, error) {
+	key := node + "." + dc
+
+	if stream := t.openCachedMuxStream(key); stream != nil {
+		return stream, nil
+	}
+
+	conn, err := t.dialStreamConn(ctx, dc, node, pool.ALPN_WANGossipStreamMulti)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := yamux.Client(conn, yamux.DefaultConfig())
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	stream, err := session.Open()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+
+	t.muxMu.Lock()
+	if t.muxSessions == nil {
+		t.muxSessions = make(map[string][]*yamux.Session)
+	}
+	t.muxSessions[key] = append(t.muxSessions[key], session)
+	t.muxMu.Unlock()
+
+	return stream, nil
+}
+
+// openCachedMuxStream opens a stream over an already established multiplexed
+// tunnel to the destination, pruning dead tunnels as it goes. It returns nil
+// when every live tunnel is at its stream cap, in which case the caller
+// dials an additional tunnel rather than queueing behind the cap.
+func (t *Transport) openCachedMuxStream(key string) net.Conn {
+	t.muxMu.Lock()
+	defer t.muxMu.Unlock()
+
+	var (
+		stream net.Conn
+		retain []*yamux.Session
+	)
+	for _, session := range t.muxSessions[key] {
+		if session.IsClosed() {
+			continue
+		}
+		if stream == nil && session.NumStreams() < MaxStreamsPerMuxTunnel {
+			sub, err := session.Open()
+			if err != nil {
+				session.Close()
+				continue
+			}
+			stream = sub
+		}
+		retain = append(retain, session)
+	}
+
+	if len(retain) == 0 {
+		delete(t.muxSessions, key)
+	} else {
+		t.muxSessions[key] = retain
+	}
+	return stream
+}
+
+// muxFallbackActive reports whether the destination datacenter recently
+// failed ALPN negotiation for the multiplexed stream protocol and should be
+// dialed one-connection-per-stream for now.
+func (t *Transport) muxFallbackActive(dc string) bool {
+	t.muxMu.Lock()
+	defer t.muxMu.Unlock()
+	until, ok := t.muxUnsupportedUntil[dc]
+	if !ok {
+		return false
+	}
+	if time.Now().After(until) {
+		delete(t.muxUnsupportedUntil, dc)
+		return false
+	}
+	return true
+}
+
+func (t *Transport) markMuxUnsupported(dc string) {
+	t.muxMu.Lock()
+	defer t.muxMu.Unlock()
+	if t.muxUnsupportedUntil == nil {
+		t.muxUnsupportedUntil = make(map[string]time.Time)
+	}
+	t.muxUnsupportedUntil[dc] = time.Now().Add(muxUnsupportedRecheckInterval)
+}
+
+// isALPNProtocolUnsupported reports whether the dial error means the remote
+// side did not accept the offered ALPN protocol, as opposed to the gateway or
+// server being unreachable. The check is textual because the TLS alert comes
+// back as an opaque handshake error, possibly wrapped by the retry budget's
+// multi-error.
+func isALPNProtocolUnsupported(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "no application protocol") ||
+		strings.Contains(msg, "could not negotiate ALPN protocol")
+}
+
+// dialAcrossGateways runs one transit dial: the provided address first, then
+// each remaining failover candidate in order, returning the first working
+// tunnel (and the gateway address it runs through) or a combined error naming
+// every address tried. The dial function is a parameter so tests can exercise
+// the failover order without a full TLS setup.
+func (t *Transport) dialAcrossGateways(
+	dc, nodeName, nextProto, addr string,
+	dialFn func(dc, nodeName, nextProto, addr string) (net.Conn, error),
+) (net.Conn, string, error) {
+	span := t.tracer.StartSpan("wanfed.gateway.dial")
+	defer span.End()
+	span.SetAttribute("destination_datacenter", dc)
+	span.SetAttribute("gateway", addr)
+	span.SetAttribute("next_proto", nextProto)
+	span.SetAttribute("tls_server_name", t.effectiveServerName(dc, nodeName))
+
+	conn, err := dialFn(dc, nodeName, nextProto, addr)
+	if err == nil {
+		return conn, addr, nil
+	}
+
+	if isALPNProtocolUnsupported(err) {
+		// Every gateway fronts the same destination servers, so a rejected
+		// ALPN protocol fails identically through all of them; skip failover.
+		span.SetAttribute("error_class", ErrorClass(err))
+		span.SetError(err)
+		return nil, "", err
+	}
+
+	candidates := t.failoverCandidates(dc, addr)
+	if len(candidates) == 0 {
+		span.SetAttribute("error_class", ErrorClass(err))
+		span.SetError(err)
+		return nil, "", err
+	}
+
+	span.SetAttribute("retried", true)
+	tried := []string{fmt.Sprintf("%s: %v", addr, err)}
+	for _, next := range candidates {
+		span.SetAttribute("retry_gateway", next)
+		conn, err = dialFn(dc, nodeName, nextProto, next)
+		if err == nil {
+			return conn, next, nil
+		}
+		tried = append(tried, fmt.Sprintf("%s: %v", next, err))
+	}
+
+	combined := fmt.Errorf("wanfed: failed to reach datacenter %q through every candidate mesh gateway (%s)",
+		dc, strings.Join(tried, "; "))
+	span.SetAttribute("error_class", ErrorClass(err))
+	span.SetError(combined)
+	return nil, "", combined
+}
+
+// failoverCandidates returns the remaining gateway addresses to try after a
+// failed dial: the ordered list resolver's candidates minus the address that
+// already failed, or a single alternative from the excluding resolver when no
+// list resolver is wired up.
+func (t *Transport) failoverCandidates(dc, failed string) []string {
+	if t.gwListResolver != nil {
+		var out []string
+		for _, addr := range t.gwListResolver(dc) {
+			if addr != "" && addr != failed {
+				out = append(out, addr)
+			}
+		}
+		if len(out) > MaxDialCandidates-1 {
+			out = out[:MaxDialCandidates-1]
+		}
+		return out
+	}
+
+	if t.gwExcludingResolver != nil {
+		retryAddr, err := t.gwExcludingResolver(dc, []string{failed})
+		if err == nil && retryAddr != "" && retryAddr != failed {
+			return []string{retryAddr}
+		}
+	}
+	return nil
+}
+
+// ValidateTLSServerName checks that the provided TLS server name override is
+// something a certificate could plausibly carry and an SNI-routing gateway
+// could match on, so that a typo fails at startup instead of failing every
+// handshake. The empty string is rejected; leave the datacenter out of the
+// override map to use the standard computed name.
+func ValidateTLSServerName(name string) error {
+	if name == "" {
+		return errors.New("TLS server name must not be empty")
+	}
+	for _, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z',
+			r >= 'A' && r <= 'Z',
+			r >= '0' && r <= '9',
+			r == '-', r == '.', r == '*':
+		default:
+			return fmt.Errorf("TLS server name contains invalid character %q: %q", r, name)
+		}
+	}
+	return nil
+}
+
+// effectiveServerName returns the TLS server name a dial to the given
+// destination will present: the configured per-datacenter override, or the
+// standard computed name.
+func (t *Transport) effectiveServerName(dc, nodeName string) string {
+	if name, ok := t.tlsServerNames[dc]; ok {
+		return name
+	}
+	if t.tlsConfigurator != nil {
+		return t.tlsConfigurator.ServerSNI(dc, nodeName)
+	}
+	return ""
+}
+
+// Dial metric names are preallocated because dial sits on the transit hot
+// path.
+var (
+	dialDurationMetricName         = []string{"wanfed", "dial", "duration"}
+	dialFailureMetricName          = []string{"wanfed", "dial", "failures"}
+	dialHandshakeFailureMetricName = []string{"wanfed", "dial", "handshake_failures"}
+)
+
+// dialMetricLabels builds the label set for the dial metrics. The gateway
+// address is only attached when dialMetricAddrLabel opted in, since it
+// multiplies the series cardinality by the gateway count.
+func (t *Transport) dialMetricLabels(dc, gwAddr string) []metrics.Label {
+	labels := make([]metrics.Label, 1, 2)
+	labels[0] = metrics.Label{Name: "datacenter", Value: dc}
+	if t.dialMetricAddrLabel {
+		labels = append(labels, metrics.Label{Name: "gateway", Value: gwAddr})
+	}
+	return labels
+}
+
 // NOTE: There is a close mirror of this method in agent/pool/pool.go:DialTimeoutWithRPCType
 func (t *Transport) dial(dc, nodeName, nextProto, addr string) (net.Conn, error) {
-	wrapper := t.tlsConfigurator.OutgoingALPNRPCWrapper()
+	var wrapper tlsutil.ALPNWrapper
+	if name, ok := t.tlsServerNames[dc]; ok {
+		wrapper = t.tlsConfigurator.OutgoingALPNRPCWrapperWithServerName(name)
+	} else {
+		wrapper = t.tlsConfigurator.OutgoingALPNRPCWrapper()
+	}
 	if wrapper == nil {
 		return nil, fmt.Errorf("wanfed: cannot dial via a mesh gateway when outgoing TLS is disabled")
 	}
 
 	dialer := &net.Dialer{Timeout: 10 * time.Second}
 
+	// The failure counters below fire at the same points that feed
+	// markGatewayFailed, so dashboards and gateway selection see the same
+	// events.
+	labels := t.dialMetricLabels(dc, addr)
+	start := time.Now()
+
 	rawConn, err := dialer.Dial("tcp", addr)
 	if err != nil {
+		metrics.IncrCounterWithLabels(dialFailureMetricName, 1, labels)
+		t.markGatewayFailed(addr, err)
 		return nil, err
 	}
 
 	if tcp, ok := rawConn.(*net.TCPConn); ok {
 		_ = tcp.SetKeepAlive(true)
+		if t.keepalivePeriod > 0 {
+			_ = tcp.SetKeepAlivePeriod(t.keepalivePeriod)
+		}
 		_ = tcp.SetNoDelay(true)
 	}
 
 	tlsConn, err := wrapper(dc, nodeName, nextProto, rawConn)
 	if err != nil {
+		err = fmt.Errorf("wanfed: TLS handshake with gateway %s failed (server name %q): %v",
+			addr, t.effectiveServerName(dc, nodeName), err)
+		if isALPNProtocolUnsupported(err) {
+			// The gateway transited the handshake fine; the destination
+			// servers just do not list the offered protocol. Closing pooled
+			// tunnels or feeding the failure notifier here would penalize a
+			// healthy gateway every time we probe an older datacenter.
+			rawConn.Close()
+			return nil, err
+		}
+		metrics.IncrCounterWithLabels(dialHandshakeFailureMetricName, 1, labels)
+		t.markGatewayFailed(addr, err)
 		return nil, err
 	}
 
+	metrics.MeasureSinceWithLabels(dialDurationMetricName, start, labels)
+
+	if t.gwSucceededNotifier != nil {
+		t.gwSucceededNotifier(addr)
+	}
+
 	return tlsConn, nil
 }
 
+func (t *Transport) markGatewayFailed(addr string, err error) {
+	// Idle tunnels through a gateway that just failed a dial are unlikely
+	// to be healthy either; drop them so they cannot be quietly reused.
+	t.pool.closeForGateway(addr)
+	if t.gwFailedNotifier != nil {
+		t.gwFailedNotifier(addr, err)
+	}
+}
+
+// DropGatewayConns closes any pooled tunnel connections established through
+// the provided gateway address. Dial failures trigger this automatically;
+// callers that learn a gateway was removed can invoke it directly.
+func (t *Transport) DropGatewayConns(addr string) {
+	t.pool.closeForGateway(addr)
+}
+
 // SplitNodeName splits a node name as it would be represented in
 // serf/memberlist in the WAN pool of the form "<short-node-name>.<datacenter>"
 // like "nyc-web42.dc5" => "nyc-web42" & "dc5"
@@ -1,8 +1,22 @@
 package wanfed
 
 import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
+	metrics "github.com/armon/go-metrics"
+	"github.com/hashicorp/consul/agent/pool"
+	"github.com/hashicorp/consul/tlsutil"
+	"github.com/hashicorp/memberlist"
+	"github.com/hashicorp/yamux"
 	"github.com/stretchr/testify/require"
 )
 
@@ -41,3 +55,484 @@ func TestSplitNodeName(t *testing.T) {
 		})
 	}
 }
+
+func TestErrorClass(t *testing.T) {
+	require.Equal(t, "", ErrorClass(nil))
+	require.Equal(t, "timeout", ErrorClass(&net.OpError{Err: &timeoutError{}}))
+	require.Equal(t, "connection-refused", ErrorClass(&net.OpError{Err: syscall.ECONNREFUSED}))
+	require.Equal(t, "connection-reset", ErrorClass(&net.OpError{Err: syscall.ECONNRESET}))
+	require.Equal(t, "other", ErrorClass(errors.New("boom")))
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestTransport_DialFailover(t *testing.T) {
+	// A listener that accepts and immediately forgets connections stands in
+	// for a working mesh gateway.
+	listen := func(t *testing.T) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { ln.Close() })
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+		return ln.Addr().String()
+	}
+
+	// A freshly closed listener's address stands in for a dead gateway.
+	deadAddr := func(t *testing.T) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		addr := ln.Addr().String()
+		require.NoError(t, ln.Close())
+		return addr
+	}
+
+	dialFn := func(dc, nodeName, nextProto, addr string) (net.Conn, error) {
+		d := net.Dialer{Timeout: time.Second}
+		return d.Dial("tcp", addr)
+	}
+
+	t.Run("second candidate succeeds", func(t *testing.T) {
+		good := listen(t)
+		bad := deadAddr(t)
+
+		tr := &Transport{
+			tracer: NoopTracer{},
+			gwListResolver: func(dc string) []string {
+				return []string{bad, good}
+			},
+		}
+
+		conn, gw, err := tr.dialAcrossGateways("dc2", "node1", "test", bad, dialFn)
+		require.NoError(t, err)
+		require.Equal(t, good, gw)
+		require.Equal(t, good, conn.RemoteAddr().String())
+		conn.Close()
+	})
+
+	t.Run("all candidates fail", func(t *testing.T) {
+		bad1 := deadAddr(t)
+		bad2 := deadAddr(t)
+
+		tr := &Transport{
+			tracer: NoopTracer{},
+			gwListResolver: func(dc string) []string {
+				return []string{bad1, bad2}
+			},
+		}
+
+		_, _, err := tr.dialAcrossGateways("dc2", "node1", "test", bad1, dialFn)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "every candidate mesh gateway")
+		require.Contains(t, err.Error(), bad1)
+		require.Contains(t, err.Error(), bad2)
+	})
+
+	t.Run("no resolver keeps the single error", func(t *testing.T) {
+		bad := deadAddr(t)
+
+		tr := &Transport{tracer: NoopTracer{}}
+
+		_, _, err := tr.dialAcrossGateways("dc2", "node1", "test", bad, dialFn)
+		require.Error(t, err)
+		require.NotContains(t, err.Error(), "every candidate mesh gateway")
+	})
+}
+
+func TestTransport_DialMetrics(t *testing.T) {
+	// The test CA is SHA-1 signed, which modern Go rejects by default.
+	godebug := os.Getenv("GODEBUG")
+	os.Setenv("GODEBUG", "x509sha1=1")
+	t.Cleanup(func() { os.Setenv("GODEBUG", godebug) })
+
+	sink := metrics.NewInmemSink(time.Minute, time.Minute)
+	cfg := metrics.DefaultConfig("consul")
+	cfg.EnableHostname = false
+	_, err := metrics.NewGlobal(cfg, sink)
+	require.NoError(t, err)
+
+	tlsConf, err := tlsutil.NewConfigurator(tlsutil.Config{
+		CAFile:   "../../../test/hostname/CertAuth.crt",
+		CertFile: "../../../test/hostname/Bob.crt",
+		KeyFile:  "../../../test/hostname/Bob.key",
+		Domain:   "consul",
+	}, nil)
+	require.NoError(t, err)
+
+	// A TLS listener standing in for a mesh gateway; the delay is injected
+	// before the handshake so it shows up in the measured dial duration.
+	startGateway := func(t *testing.T, delay time.Duration) string {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { ln.Close() })
+
+		serverTLS := tlsConf.IncomingALPNRPCConfig([]string{"test"})
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func(conn net.Conn) {
+					time.Sleep(delay)
+					tlsServer := tls.Server(conn, serverTLS)
+					if err := tlsServer.Handshake(); err != nil {
+						conn.Close()
+						return
+					}
+					io.Copy(ioutil.Discard, tlsServer)
+					tlsServer.Close()
+				}(conn)
+			}
+		}()
+		return ln.Addr().String()
+	}
+
+	p, err := newConnPool(time.Minute, 0)
+	require.NoError(t, err)
+	defer p.Close()
+
+	var failedAddrs []string
+	tr := &Transport{
+		tlsConfigurator:     tlsConf,
+		datacenter:          "dc2",
+		tracer:              NoopTracer{},
+		dialMetricAddrLabel: true,
+		gwFailedNotifier: func(addr string, err error) {
+			failedAddrs = append(failedAddrs, addr)
+		},
+		pool: p,
+	}
+
+	t.Run("successful dial records latency", func(t *testing.T) {
+		gw := startGateway(t, 50*time.Millisecond)
+
+		conn, err := tr.dial("dc1", "bob", "test", gw)
+		require.NoError(t, err)
+		conn.Close()
+
+		key := "consul.wanfed.dial.duration;datacenter=dc1;gateway=" + gw
+		sample, ok := sink.Data()[0].Samples[key]
+		require.True(t, ok, "missing sample %q; have %v", key, sink.Data()[0].Samples)
+		require.Equal(t, 1, sample.Count)
+		require.True(t, sample.Sum >= 50, "expected at least the injected 50ms delay, got %fms", sample.Sum)
+	})
+
+	t.Run("unreachable gateway counts a dial failure", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		gw := ln.Addr().String()
+		require.NoError(t, ln.Close())
+
+		_, err = tr.dial("dc1", "bob", "test", gw)
+		require.Error(t, err)
+
+		key := "consul.wanfed.dial.failures;datacenter=dc1;gateway=" + gw
+		sample, ok := sink.Data()[0].Counters[key]
+		require.True(t, ok, "missing counter %q; have %v", key, sink.Data()[0].Counters)
+		require.Equal(t, 1, sample.Count)
+		require.Contains(t, failedAddrs, gw)
+	})
+
+	t.Run("handshake failure counts separately", func(t *testing.T) {
+		// Accepting and immediately closing the connection fails the TLS
+		// handshake after the TCP dial succeeded.
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { ln.Close() })
+		gw := ln.Addr().String()
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				conn.Close()
+			}
+		}()
+
+		_, err = tr.dial("dc1", "bob", "test", gw)
+		require.Error(t, err)
+
+		key := "consul.wanfed.dial.handshake_failures;datacenter=dc1;gateway=" + gw
+		sample, ok := sink.Data()[0].Counters[key]
+		require.True(t, ok, "missing counter %q; have %v", key, sink.Data()[0].Counters)
+		require.Equal(t, 1, sample.Count)
+		require.Contains(t, failedAddrs, gw)
+	})
+}
+
+func TestTransport_StreamMultiplex(t *testing.T) {
+	// The test CA is SHA-1 signed, which modern Go rejects by default.
+	godebug := os.Getenv("GODEBUG")
+	os.Setenv("GODEBUG", "x509sha1=1")
+	t.Cleanup(func() { os.Setenv("GODEBUG", godebug) })
+
+	tlsConf, err := tlsutil.NewConfigurator(tlsutil.Config{
+		CAFile:   "../../../test/hostname/CertAuth.crt",
+		CertFile: "../../../test/hostname/Bob.crt",
+		KeyFile:  "../../../test/hostname/Bob.key",
+		Domain:   "consul",
+	}, nil)
+	require.NoError(t, err)
+
+	// A TLS listener standing in for bob's server behind a gateway. It
+	// echoes every gossip stream it is handed, multiplexed or not, and
+	// counts how many TLS tunnels were actually established.
+	startServer := func(t *testing.T, protos []string) (string, *int32) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		t.Cleanup(func() { ln.Close() })
+
+		var conns int32
+		serverTLS := tlsConf.IncomingALPNRPCConfig(protos)
+		go func() {
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					return
+				}
+				go func(conn net.Conn) {
+					tlsServer := tls.Server(conn, serverTLS)
+					if err := tlsServer.Handshake(); err != nil {
+						conn.Close()
+						return
+					}
+					atomic.AddInt32(&conns, 1)
+
+					switch tlsServer.ConnectionState().NegotiatedProtocol {
+					case pool.ALPN_WANGossipStreamMulti:
+						session, err := yamux.Server(tlsServer, nil)
+						if err != nil {
+							tlsServer.Close()
+							return
+						}
+						for {
+							sub, err := session.Accept()
+							if err != nil {
+								return
+							}
+							go func(sub net.Conn) {
+								io.Copy(sub, sub)
+								sub.Close()
+							}(sub)
+						}
+					default:
+						io.Copy(tlsServer, tlsServer)
+						tlsServer.Close()
+					}
+				}(conn)
+			}
+		}()
+		return ln.Addr().String(), &conns
+	}
+
+	newMuxTransport := func(t *testing.T, gw string) *Transport {
+		p, err := newConnPool(time.Minute, 0)
+		require.NoError(t, err)
+		t.Cleanup(func() { p.Close() })
+
+		return &Transport{
+			tlsConfigurator:  tlsConf,
+			datacenter:       "dc2",
+			tracer:           NoopTracer{},
+			streamMuxEnabled: true,
+			gwResolver:       func(dc string) (string, error) { return gw, nil },
+			dialRetryBudget:  pool.DialRetryBudget{MaxAttempts: 1},
+			pool:             p,
+		}
+	}
+
+	roundtrip := func(t *testing.T, conn net.Conn, msg string) {
+		_, err := conn.Write([]byte(msg))
+		require.NoError(t, err)
+		buf := make([]byte, len(msg))
+		_, err = io.ReadFull(conn, buf)
+		require.NoError(t, err)
+		require.Equal(t, msg, string(buf))
+	}
+
+	addr := memberlist.Address{Name: "bob.dc1"}
+
+	t.Run("streams share one tunnel", func(t *testing.T) {
+		gw, conns := startServer(t, pool.RPCNextProtos)
+		tr := newMuxTransport(t, gw)
+		t.Cleanup(func() {
+			tr.muxMu.Lock()
+			for _, sessions := range tr.muxSessions {
+				for _, session := range sessions {
+					session.Close()
+				}
+			}
+			tr.muxMu.Unlock()
+		})
+
+		c1, err := tr.DialAddressTimeout(addr, 2*time.Second)
+		require.NoError(t, err)
+		defer c1.Close()
+
+		c2, err := tr.DialAddressTimeout(addr, 2*time.Second)
+		require.NoError(t, err)
+		defer c2.Close()
+
+		// Both logical streams work concurrently over one TLS tunnel.
+		roundtrip(t, c1, "ping-1")
+		roundtrip(t, c2, "ping-2")
+		roundtrip(t, c1, "ping-3")
+
+		require.Equal(t, int32(1), atomic.LoadInt32(conns))
+	})
+
+	t.Run("old peer falls back to one connection per stream", func(t *testing.T) {
+		// A server that predates the multiplexed protocol only lists the
+		// original ALPN protocols.
+		gw, conns := startServer(t, []string{pool.ALPN_WANGossipStream})
+		tr := newMuxTransport(t, gw)
+
+		// Use the default multi-attempt budget and watch the gateway
+		// feedback channels: the ALPN probe failing must not burn retry
+		// attempts or mark the (healthy) gateway as failed.
+		var resolves, gwFailures int32
+		tr.dialRetryBudget = pool.DialRetryBudget{}
+		tr.gwResolver = func(dc string) (string, error) {
+			atomic.AddInt32(&resolves, 1)
+			return gw, nil
+		}
+		tr.gwFailedNotifier = func(addr string, err error) {
+			atomic.AddInt32(&gwFailures, 1)
+		}
+
+		c1, err := tr.DialAddressTimeout(addr, 2*time.Second)
+		require.NoError(t, err)
+		defer c1.Close()
+
+		c2, err := tr.DialAddressTimeout(addr, 2*time.Second)
+		require.NoError(t, err)
+		defer c2.Close()
+
+		roundtrip(t, c1, "ping-1")
+		roundtrip(t, c2, "ping-2")
+
+		// The first dial's multiplex probe died during ALPN negotiation,
+		// so both streams got their own tunnel, and the failure was
+		// remembered so the second dial skipped the probe entirely.
+		require.True(t, tr.muxFallbackActive("dc1"))
+		require.Equal(t, int32(2), atomic.LoadInt32(conns))
+
+		// One resolve for the probe, one per fallback tunnel.
+		require.Equal(t, int32(3), atomic.LoadInt32(&resolves))
+		require.Equal(t, int32(0), atomic.LoadInt32(&gwFailures))
+	})
+}
+
+func TestValidateTLSServerName(t *testing.T) {
+	require.NoError(t, ValidateTLSServerName("gateway.example.com"))
+	require.NoError(t, ValidateTLSServerName("*.server.dc2.consul"))
+	require.Error(t, ValidateTLSServerName(""))
+	require.Error(t, ValidateTLSServerName("bad name"))
+	require.Error(t, ValidateTLSServerName("bad\tname"))
+	require.Error(t, ValidateTLSServerName("under_score"))
+}
+
+func TestTransport_TLSServerNameOverride(t *testing.T) {
+	// The test CA is SHA-1 signed, which modern Go rejects by default.
+	godebug := os.Getenv("GODEBUG")
+	os.Setenv("GODEBUG", "x509sha1=1")
+	t.Cleanup(func() { os.Setenv("GODEBUG", godebug) })
+
+	tlsConf, err := tlsutil.NewConfigurator(tlsutil.Config{
+		CAFile:   "../../../test/hostname/CertAuth.crt",
+		CertFile: "../../../test/hostname/Bob.crt",
+		KeyFile:  "../../../test/hostname/Bob.key",
+		Domain:   "consul",
+	}, nil)
+	require.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+	gw := ln.Addr().String()
+
+	serverTLS := tlsConf.IncomingALPNRPCConfig([]string{"test"})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				tlsServer := tls.Server(conn, serverTLS)
+				if err := tlsServer.Handshake(); err != nil {
+					conn.Close()
+					return
+				}
+				io.Copy(ioutil.Discard, tlsServer)
+				tlsServer.Close()
+			}(conn)
+		}
+	}()
+
+	p, err := newConnPool(time.Minute, 0)
+	require.NoError(t, err)
+	defer p.Close()
+
+	t.Run("override presents the configured name", func(t *testing.T) {
+		// The gateway only has key material for bob; dialing any other
+		// node through it works once the override pins the SNI to the
+		// name the certificate actually carries.
+		tr := &Transport{
+			tlsConfigurator: tlsConf,
+			datacenter:      "dc2",
+			tlsServerNames:  map[string]string{"dc1": "bob.server.dc1.consul"},
+			tracer:          NoopTracer{},
+			pool:            p,
+		}
+		conn, err := tr.dial("dc1", "alice", "test", gw)
+		require.NoError(t, err)
+		conn.Close()
+	})
+
+	t.Run("computed name fails and is named in the error", func(t *testing.T) {
+		tr := &Transport{
+			tlsConfigurator: tlsConf,
+			datacenter:      "dc2",
+			tracer:          NoopTracer{},
+			pool:            p,
+		}
+		_, err := tr.dial("dc1", "alice", "test", gw)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), `server name "alice.server.dc1.consul"`)
+	})
+
+	t.Run("invalid override is rejected up front", func(t *testing.T) {
+		_, err := NewTransport(
+			tlsConf,
+			nil,
+			"dc2",
+			map[string]string{"dc1": "bad name"},
+			func(dc string) (string, error) { return "", nil },
+			nil,
+			nil,
+			nil,
+			nil,
+			nil,
+			false,
+			false,
+			pool.DialRetryBudget{},
+			PoolConfig{},
+		)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid TLS server name")
+	})
+}
@@ -2,9 +2,11 @@ package agent
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/hashicorp/consul/agent/structs"
+	bexpr "github.com/hashicorp/go-bexpr"
 )
 
 // GET /v1/internal/federation-state/<datacenter>
@@ -37,7 +39,7 @@ func (s *HTTPServer) FederationStateGet(resp http.ResponseWriter, req *http.Requ
 
 // GET /v1/internal/federation-states
 func (s *HTTPServer) FederationStateList(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
-	var args structs.DCSpecificRequest
+	var args structs.FederationStateListRequest
 	if done := s.parse(resp, req, &args.Datacenter, &args.QueryOptions); done {
 		return nil, nil
 	}
@@ -46,6 +48,24 @@ func (s *HTTPServer) FederationStateList(resp http.ResponseWriter, req *http.Req
 		args.Datacenter = s.agent.config.Datacenter
 	}
 
+	// Pagination is opt-in via ?limit= and ?next-token=.
+	if limitStr := req.URL.Query().Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			return nil, BadRequestError{Reason: "Invalid limit value"}
+		}
+		args.Limit = limit
+	}
+	args.NextToken = req.URL.Query().Get("next-token")
+
+	// Validate the filter expression up front so a malformed one yields a 400
+	// instead of surfacing as an opaque RPC error.
+	if args.Filter != "" {
+		if _, err := bexpr.CreateFilter(args.Filter, nil, structs.FederationStates{}); err != nil {
+			return nil, BadRequestError{Reason: err.Error()}
+		}
+	}
+
 	var out structs.IndexedFederationStates
 	defer setMeta(resp, &out.QueryMeta)
 	if err := s.agent.RPC("FederationState.List", &args, &out); err != nil {
@@ -57,9 +77,29 @@ func (s *HTTPServer) FederationStateList(resp http.ResponseWriter, req *http.Req
 		out.States = make(structs.FederationStates, 0)
 	}
 
+	if out.NextToken != "" {
+		resp.Header().Set("X-Consul-NextToken", out.NextToken)
+	}
+
 	return out.States, nil
 }
 
+// GET /v1/internal/federation-states/replication
+func (s *HTTPServer) FederationStateReplicationStatus(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	// Note that we do not forward to the primary DC here. This is a query
+	// for any DC that's doing replication.
+	var args structs.DCSpecificRequest
+	if done := s.parse(resp, req, &args.Datacenter, &args.QueryOptions); done {
+		return nil, nil
+	}
+
+	var out structs.FederationStateReplicationStatus
+	if err := s.agent.RPC("FederationState.ReplicationStatus", &args, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // GET /v1/internal/federation-states/mesh-gateways
 func (s *HTTPServer) FederationStateListMeshGateways(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
 	var args structs.DCSpecificRequest
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hashicorp/consul/agent/consul/autopilot"
@@ -29,6 +30,24 @@ func (s *HTTPServer) OperatorRaftConfiguration(resp http.ResponseWriter, req *ht
 	return reply, nil
 }
 
+// OperatorWANFederationGateways returns the contacted server's cached view
+// of the mesh gateways usable for WAN federation transit. The view is
+// per-server state: the default query is answered by the datacenter's
+// leader, and the stale query mode reports whichever server answered.
+func (s *HTTPServer) OperatorWANFederationGateways(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	var args structs.WANFederationGatewaysRequest
+	if done := s.parse(resp, req, &args.Datacenter, &args.QueryOptions); done {
+		return nil, nil
+	}
+
+	var reply structs.WANFederationGatewaysResponse
+	if err := s.agent.RPC("Operator.WANFederationGateways", &args, &reply); err != nil {
+		return nil, err
+	}
+
+	return reply, nil
+}
+
 // OperatorRaftPeer supports actions on Raft peers. Currently we only support
 // removing peers by address.
 func (s *HTTPServer) OperatorRaftPeer(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
@@ -65,6 +84,27 @@ func (s *HTTPServer) OperatorRaftPeer(resp http.ResponseWriter, req *http.Reques
 	return nil, nil
 }
 
+// OperatorDecommissionDatacenter removes a departed datacenter from the WAN
+// federation: DELETE /v1/operator/datacenter/<name>.
+func (s *HTTPServer) OperatorDecommissionDatacenter(resp http.ResponseWriter, req *http.Request) (interface{}, error) {
+	datacenterName := strings.TrimPrefix(req.URL.Path, "/v1/operator/datacenter/")
+	if datacenterName == "" {
+		return nil, BadRequestError{Reason: "Missing datacenter name"}
+	}
+
+	var args structs.DecommissionDatacenterRequest
+	s.parseDC(req, &args.Datacenter)
+	s.parseToken(req, &args.Token)
+	args.DecommissionDatacenter = datacenterName
+
+	var reply struct{}
+	if err := s.agent.RPC("Operator.DecommissionDatacenter", &args, &reply); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
 type keyringArgs struct {
 	Key         string
 	Token       string
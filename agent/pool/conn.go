@@ -69,6 +69,10 @@ const (
 	// wan federation additions
 	ALPN_WANGossipPacket = "consul/wan-gossip/packet"
 	ALPN_WANGossipStream = "consul/wan-gossip/stream"
+	// ALPN_WANGossipStreamMulti carries many logical wan-gossip streams
+	// multiplexed with yamux over one long-lived gateway tunnel. Peers that
+	// do not list it fall back to one connection per stream.
+	ALPN_WANGossipStreamMulti = "consul/wan-gossip/stream-multi"
 )
 
 var RPCNextProtos = []string{
@@ -79,4 +83,5 @@ var RPCNextProtos = []string{
 	ALPN_RPCGossip,
 	ALPN_WANGossipPacket,
 	ALPN_WANGossipStream,
+	ALPN_WANGossipStreamMulti,
 }
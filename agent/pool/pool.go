@@ -2,6 +2,7 @@ package pool
 
 import (
 	"container/list"
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -142,7 +143,29 @@ type ConnPool struct {
 	// GatewayResolver is a function that returns a suitable random mesh
 	// gateway address for dialing servers in a given DC. This is only
 	// needed if wan federation via mesh gateways is enabled.
-	GatewayResolver func(string) string
+	GatewayResolver func(string) (string, error)
+
+	// GatewayFailedNotifier is an optional function invoked when a dial
+	// through a mesh gateway address fails, so that the resolver can
+	// deprioritize the address on subsequent picks.
+	GatewayFailedNotifier func(addr string, err error)
+
+	// GatewaySucceededNotifier is an optional function invoked when a dial
+	// through a mesh gateway address succeeds, so that the resolver can
+	// clear any failure tracking for the address.
+	GatewaySucceededNotifier func(addr string)
+
+	// GatewayConnOpenedNotifier and GatewayConnClosedNotifier are optional
+	// functions invoked when a connection through a mesh gateway address is
+	// established and closed, so that the resolver can track per-gateway
+	// outstanding connection counts.
+	GatewayConnOpenedNotifier func(addr string)
+	GatewayConnClosedNotifier func(addr string)
+
+	// GatewayDialRetryBudget bounds retries of dials through mesh gateways
+	// when forwarding RPCs to other datacenters. The zero value selects the
+	// defaults.
+	GatewayDialRetryBudget DialRetryBudget
 
 	// Datacenter is the datacenter of the current agent.
 	Datacenter string
@@ -297,22 +320,37 @@ func (p *ConnPool) DialTimeout(
 	p.once.Do(p.init)
 
 	if p.Server && p.GatewayResolver != nil && p.TLSConfigurator != nil && dc != p.Datacenter {
-		// NOTE: TLS is required on this branch.
-		return DialTimeoutWithRPCTypeViaMeshGateway(
-			dc,
-			nodeName,
-			addr,
-			p.SrcAddr,
-			timeout,
-			p.TLSConfigurator.OutgoingALPNRPCWrapper(),
-			actualRPCType,
-			RPCTLS,
-			// gateway stuff
-			p.Server,
-			p.TLSConfigurator,
-			p.GatewayResolver,
-			p.Datacenter,
-		)
+		ctx := context.Background()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		// NOTE: TLS is required on this branch. Each attempt resolves a
+		// fresh gateway, so the retries walk distinct gateways when more
+		// than one is known.
+		return DialWithRetryBudget(ctx, dc, p.GatewayDialRetryBudget, func() (net.Conn, HalfCloser, error) {
+			return DialTimeoutWithRPCTypeViaMeshGateway(
+				dc,
+				nodeName,
+				addr,
+				p.SrcAddr,
+				timeout,
+				p.TLSConfigurator.OutgoingALPNRPCWrapper(),
+				actualRPCType,
+				RPCTLS,
+				// gateway stuff
+				p.Server,
+				p.TLSConfigurator,
+				p.GatewayResolver,
+				p.GatewayFailedNotifier,
+				p.GatewaySucceededNotifier,
+				p.GatewayConnOpenedNotifier,
+				p.GatewayConnClosedNotifier,
+				p.Datacenter,
+			)
+		})
 	}
 
 	return DialTimeoutWithRPCTypeDirectly(
@@ -442,7 +480,11 @@ func DialTimeoutWithRPCTypeViaMeshGateway(
 	// gateway stuff
 	dialingFromServer bool,
 	tlsConfigurator *tlsutil.Configurator,
-	gatewayResolver func(string) string,
+	gatewayResolver func(string) (string, error),
+	gatewayFailedNotifier func(string, error),
+	gatewaySucceededNotifier func(string),
+	gatewayConnOpenedNotifier func(string),
+	gatewayConnClosedNotifier func(string),
 	thisDatacenter string,
 ) (net.Conn, HalfCloser, error) {
 	if !dialingFromServer {
@@ -462,7 +504,10 @@ func DialTimeoutWithRPCTypeViaMeshGateway(
 		return nil, nil, fmt.Errorf("rpc type %d cannot be routed through a mesh gateway", actualRPCType)
 	}
 
-	gwAddr := gatewayResolver(dc)
+	gwAddr, err := gatewayResolver(dc)
+	if err != nil {
+		return nil, nil, err
+	}
 	if gwAddr == "" {
 		return nil, nil, structs.ErrDCNotAvailable
 	}
@@ -471,6 +516,9 @@ func DialTimeoutWithRPCTypeViaMeshGateway(
 
 	rawConn, err := dialer.Dial("tcp", gwAddr)
 	if err != nil {
+		if gatewayFailedNotifier != nil {
+			gatewayFailedNotifier(gwAddr, err)
+		}
 		return nil, nil, err
 	}
 
@@ -482,9 +530,16 @@ func DialTimeoutWithRPCTypeViaMeshGateway(
 	// NOTE: now we wrap the connection in a TLS client.
 	tlsConn, err := wrapper(dc, nodeName, nextProto, rawConn)
 	if err != nil {
+		if gatewayFailedNotifier != nil {
+			gatewayFailedNotifier(gwAddr, err)
+		}
 		return nil, nil, err
 	}
 
+	if gatewaySucceededNotifier != nil {
+		gatewaySucceededNotifier(gwAddr)
+	}
+
 	var conn net.Conn = tlsConn
 
 	var hc HalfCloser
@@ -493,9 +548,37 @@ func DialTimeoutWithRPCTypeViaMeshGateway(
 		hc = tlsConn
 	}
 
+	if gatewayConnOpenedNotifier != nil && gatewayConnClosedNotifier != nil {
+		gatewayConnOpenedNotifier(gwAddr)
+		conn = &gatewayConn{
+			Conn:     conn,
+			gwAddr:   gwAddr,
+			onClosed: gatewayConnClosedNotifier,
+		}
+	}
+
 	return conn, hc, nil
 }
 
+// gatewayConn wraps a connection established through a mesh gateway so that
+// closing it reports back to the gateway resolver exactly once, keeping
+// per-gateway outstanding connection counts accurate.
+type gatewayConn struct {
+	net.Conn
+
+	gwAddr    string
+	onClosed  func(string)
+	closeOnce sync.Once
+}
+
+func (c *gatewayConn) Close() error {
+	err := c.Conn.Close()
+	c.closeOnce.Do(func() {
+		c.onClosed(c.gwAddr)
+	})
+	return err
+}
+
 // getNewConn is used to return a new connection
 func (p *ConnPool) getNewConn(dc string, nodeName string, addr net.Addr, version int, useTLS bool) (*Conn, error) {
 	if nodeName == "" {
@@ -0,0 +1,151 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+const (
+	// DefaultDialRetryMaxTime caps the total time one budgeted gateway dial
+	// may spend across attempts and backoff.
+	DefaultDialRetryMaxTime = 5 * time.Second
+
+	// DefaultDialRetryMaxAttempts caps how many dial attempts one budgeted
+	// gateway dial may make.
+	DefaultDialRetryMaxAttempts = 3
+
+	// DefaultDialRetryInitialBackoff and DefaultDialRetryMaxBackoff bound
+	// the exponential backoff between attempts.
+	DefaultDialRetryInitialBackoff = 100 * time.Millisecond
+	DefaultDialRetryMaxBackoff     = 1 * time.Second
+)
+
+// DialRetryBudget bounds how many times and for how long a dial through mesh
+// gateways may be retried before the error is surfaced to the caller. The
+// zero value selects the defaults.
+type DialRetryBudget struct {
+	// MaxTime caps the total time spent across all attempts, including the
+	// backoff between them. Zero or negative uses DefaultDialRetryMaxTime.
+	MaxTime time.Duration
+
+	// MaxAttempts caps how many dial attempts are made. Zero or negative
+	// uses DefaultDialRetryMaxAttempts; one disables retrying.
+	MaxAttempts int
+
+	// InitialBackoff and MaxBackoff bound the exponential backoff between
+	// attempts. Zero or negative uses the defaults.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (b DialRetryBudget) withDefaults() DialRetryBudget {
+	if b.MaxTime <= 0 {
+		b.MaxTime = DefaultDialRetryMaxTime
+	}
+	if b.MaxAttempts <= 0 {
+		b.MaxAttempts = DefaultDialRetryMaxAttempts
+	}
+	if b.InitialBackoff <= 0 {
+		b.InitialBackoff = DefaultDialRetryInitialBackoff
+	}
+	if b.MaxBackoff <= 0 {
+		b.MaxBackoff = DefaultDialRetryMaxBackoff
+	}
+	return b
+}
+
+// DialBudgetExhaustedError reports a gateway dial that used up its whole
+// retry budget without reaching the destination, carrying every per-attempt
+// failure.
+type DialBudgetExhaustedError struct {
+	Datacenter string
+	Attempts   int
+	Elapsed    time.Duration
+	Errors     *multierror.Error
+}
+
+func (e *DialBudgetExhaustedError) Error() string {
+	return fmt.Sprintf("retry budget exhausted dialing datacenter %q after %d attempts over %s: %v",
+		e.Datacenter, e.Attempts, e.Elapsed.Round(time.Millisecond), e.Errors)
+}
+
+// PermanentDialError wraps an error returned by a dial attempt to tell
+// DialWithRetryBudget that further attempts cannot succeed — for example the
+// remote side rejected the offered ALPN protocol, which no amount of
+// redialing will change. The budget stops immediately and surfaces the
+// wrapped error unchanged.
+type PermanentDialError struct {
+	Err error
+}
+
+func (e *PermanentDialError) Error() string { return e.Err.Error() }
+
+// DialWithRetryBudget runs the provided dial attempt under the budget:
+// attempts are separated by exponential backoff and stop at the attempt cap,
+// the time cap, or cancellation of ctx, whichever comes first. The dial
+// function is expected to resolve a fresh gateway on each call so that the
+// attempts walk distinct gateways rather than hammering one. Both RPC
+// forwarding and the wanfed gossip transport route their gateway dials
+// through here, so a dead gateway costs a bounded amount of time instead of
+// failing the operation outright.
+func DialWithRetryBudget(
+	ctx context.Context,
+	dc string,
+	budget DialRetryBudget,
+	dial func() (net.Conn, HalfCloser, error),
+) (net.Conn, HalfCloser, error) {
+	budget = budget.withDefaults()
+
+	var (
+		start    = time.Now()
+		errs     *multierror.Error
+		backoff  = budget.InitialBackoff
+		attempts int
+	)
+	for {
+		if err := ctx.Err(); err != nil {
+			errs = multierror.Append(errs, err)
+			break
+		}
+
+		conn, hc, err := dial()
+		if err == nil {
+			return conn, hc, nil
+		}
+		if perm, ok := err.(*PermanentDialError); ok {
+			return nil, nil, perm.Err
+		}
+		attempts++
+		errs = multierror.Append(errs, err)
+
+		if attempts >= budget.MaxAttempts {
+			break
+		}
+		if time.Since(start)+backoff >= budget.MaxTime {
+			break
+		}
+
+		// If ctx is canceled mid-backoff the next loop iteration notices
+		// and stops.
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+		}
+
+		backoff *= 2
+		if backoff > budget.MaxBackoff {
+			backoff = budget.MaxBackoff
+		}
+	}
+
+	return nil, nil, &DialBudgetExhaustedError{
+		Datacenter: dc,
+		Attempts:   attempts,
+		Elapsed:    time.Since(start),
+		Errors:     errs,
+	}
+}
@@ -0,0 +1,120 @@
+package pool
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialWithRetryBudget(t *testing.T) {
+	budget := DialRetryBudget{
+		MaxTime:        time.Second,
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+
+	t.Run("retries until an attempt succeeds", func(t *testing.T) {
+		client, server := net.Pipe()
+		defer client.Close()
+		defer server.Close()
+
+		attempts := 0
+		conn, _, err := DialWithRetryBudget(context.Background(), "dc2", budget, func() (net.Conn, HalfCloser, error) {
+			attempts++
+			if attempts < 3 {
+				return nil, nil, errors.New("gateway unreachable")
+			}
+			return client, nil, nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, client, conn)
+		require.Equal(t, 3, attempts)
+	})
+
+	t.Run("attempt cap surfaces a structured multi-error", func(t *testing.T) {
+		attempts := 0
+		_, _, err := DialWithRetryBudget(context.Background(), "dc2", budget, func() (net.Conn, HalfCloser, error) {
+			attempts++
+			return nil, nil, errors.New("gateway unreachable")
+		})
+		require.Equal(t, 3, attempts)
+
+		exhausted, ok := err.(*DialBudgetExhaustedError)
+		require.True(t, ok, "expected *DialBudgetExhaustedError, got %T: %v", err, err)
+		require.Equal(t, "dc2", exhausted.Datacenter)
+		require.Equal(t, 3, exhausted.Attempts)
+		require.Len(t, exhausted.Errors.Errors, 3)
+		require.Contains(t, err.Error(), `datacenter "dc2"`)
+	})
+
+	t.Run("an attempt cap of one disables retrying", func(t *testing.T) {
+		single := budget
+		single.MaxAttempts = 1
+
+		attempts := 0
+		_, _, err := DialWithRetryBudget(context.Background(), "dc2", single, func() (net.Conn, HalfCloser, error) {
+			attempts++
+			return nil, nil, errors.New("gateway unreachable")
+		})
+		require.Error(t, err)
+		require.Equal(t, 1, attempts)
+	})
+
+	t.Run("a permanent error stops immediately", func(t *testing.T) {
+		inner := errors.New("remote rejected the protocol")
+
+		attempts := 0
+		_, _, err := DialWithRetryBudget(context.Background(), "dc2", budget, func() (net.Conn, HalfCloser, error) {
+			attempts++
+			return nil, nil, &PermanentDialError{Err: inner}
+		})
+		require.Equal(t, 1, attempts)
+		require.Equal(t, inner, err)
+	})
+
+	t.Run("time cap stops further attempts", func(t *testing.T) {
+		capped := DialRetryBudget{
+			MaxTime:        10 * time.Millisecond,
+			MaxAttempts:    100,
+			InitialBackoff: 20 * time.Millisecond,
+		}
+
+		attempts := 0
+		_, _, err := DialWithRetryBudget(context.Background(), "dc2", capped, func() (net.Conn, HalfCloser, error) {
+			attempts++
+			return nil, nil, errors.New("gateway unreachable")
+		})
+		require.Error(t, err)
+		require.Equal(t, 1, attempts)
+	})
+
+	t.Run("context cancellation aborts promptly", func(t *testing.T) {
+		slow := DialRetryBudget{
+			MaxTime:        time.Minute,
+			MaxAttempts:    100,
+			InitialBackoff: 10 * time.Second,
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		start := time.Now()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+
+		_, _, err := DialWithRetryBudget(ctx, "dc2", slow, func() (net.Conn, HalfCloser, error) {
+			return nil, nil, errors.New("gateway unreachable")
+		})
+		require.Error(t, err)
+		require.True(t, time.Since(start) < time.Second, "cancellation did not abort the backoff promptly")
+
+		exhausted, ok := err.(*DialBudgetExhaustedError)
+		require.True(t, ok, "expected *DialBudgetExhaustedError, got %T: %v", err, err)
+		require.Contains(t, exhausted.Errors.Error(), context.Canceled.Error())
+	})
+}
@@ -1,10 +1,15 @@
 package agent
 
 import (
+	"bytes"
 	"fmt"
+	"net"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/hashicorp/consul/agent/exec"
 	"github.com/hashicorp/consul/lib"
 	discover "github.com/hashicorp/go-discover"
 	discoverk8s "github.com/hashicorp/go-discover/provider/k8s"
@@ -84,11 +89,15 @@ func (a *Agent) retryJoinWAN() {
 
 func (a *Agent) refreshPrimaryGatewayFallbackAddresses() {
 	r := &retryJoiner{
-		variant:     retryJoinMeshGatewayVariant,
-		cluster:     "primary",
-		addrs:       a.config.PrimaryGateways,
-		maxAttempts: 0,
-		interval:    a.config.PrimaryGatewaysInterval,
+		variant:       retryJoinMeshGatewayVariant,
+		cluster:       "primary",
+		addrs:         a.config.PrimaryGateways,
+		maxAttempts:   0,
+		interval:      a.config.PrimaryGatewaysInterval,
+		discoverPort:  a.config.PrimaryGatewaysPort,
+		reloadAddrsCh: a.primaryGatewaysReloadCh,
+		execArgs:      a.config.PrimaryGatewaysExec,
+		execTimeout:   a.config.PrimaryGatewaysExecTimeout,
 		join: func(addrs []string) (int, error) {
 			if err := a.RefreshPrimaryGatewayFallbackAddresses(addrs); err != nil {
 				return 0, err
@@ -159,6 +168,249 @@ func retryJoinAddrs(disco *discover.Discover, variant, cluster string, retryJoin
 	return addrs
 }
 
+// discoverMeshGatewayAddrs expands the configured primary gateway entries
+// into concrete addresses for one refresh pass. Unlike retryJoinAddrs it
+// re-resolves host:port entries on every call so that DNS changes behind a
+// load balancer show up in later refreshes, and it retains the previous
+// answer for any entry that fails to resolve so a transient failure cannot
+// shrink the fallback set.
+func (r *retryJoiner) discoverMeshGatewayAddrs(disco *discover.Discover) []string {
+	if r.prevDiscovered == nil {
+		r.prevDiscovered = make(map[string][]string)
+	}
+
+	anyFailed := false
+	var out []string
+	for _, addr := range r.addrs {
+		servers, err := r.resolveFallbackEntry(disco, addr)
+		if err != nil {
+			anyFailed = true
+			servers = r.prevDiscovered[addr]
+			r.logger.Warn("Cannot discover mesh gateway address, retaining previous answer",
+				"address", addr,
+				"error", err,
+			)
+		} else {
+			r.prevDiscovered[addr] = servers
+		}
+		out = append(out, servers...)
+	}
+	if len(r.execArgs) > 0 {
+		servers, err := r.execFallbackDiscovery()
+		if err != nil {
+			anyFailed = true
+			servers = r.prevDiscovered[fallbackExecCacheKey]
+			r.logger.Warn("Cannot discover mesh gateway addresses from command, retaining previous answer",
+				"command", r.execArgs[0],
+				"error", err,
+			)
+		} else {
+			r.prevDiscovered[fallbackExecCacheKey] = servers
+		}
+		out = append(out, servers...)
+	}
+	r.lastDiscoverFailed = anyFailed
+	return out
+}
+
+// fallbackExecCacheKey keys the exec source's last successful answer in
+// prevDiscovered alongside the configured entries.
+const fallbackExecCacheKey = "exec"
+
+// execFallbackDiscovery runs the operator supplied executable and parses
+// one gateway host:port per stdout line. Stderr goes to the log, and a
+// non-zero exit, timeout, or malformed address fails the whole pass so the
+// previous answer is retained rather than delivering a partial set.
+func (r *retryJoiner) execFallbackDiscovery() ([]string, error) {
+	cmd, err := exec.Subprocess(r.execArgs)
+	if err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	exec.SetSysProcAttr(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- cmd.Wait()
+	}()
+
+	timeout := 30 * time.Second
+	if r.execTimeout > 0 {
+		timeout = r.execTimeout
+	}
+	select {
+	case <-time.After(timeout):
+		if err := exec.KillCommandSubtree(cmd); err != nil {
+			r.logger.Warn("Failed to kill mesh gateway discovery command after timeout",
+				"command", r.execArgs[0],
+				"error", err,
+			)
+		}
+		// Wait for the process to exit so we never run two instances
+		// concurrently.
+		<-waitCh
+		return nil, fmt.Errorf("command timed out after %s", timeout)
+	case err = <-waitCh:
+	}
+
+	if stderr.Len() > 0 {
+		r.logger.Warn("Mesh gateway discovery command wrote to stderr",
+			"command", r.execArgs[0],
+			"stderr", strings.TrimSpace(stderr.String()),
+		)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out []string
+	for _, line := range strings.Split(stdout.String(), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if err := lib.ValidateDialAddress(line); err != nil {
+			return nil, fmt.Errorf("invalid address %q in command output: %s", line, err)
+		}
+		out = append(out, line)
+	}
+	return out, nil
+}
+
+// resolveFallbackEntry expands one primary gateway entry. Raw ip:port
+// entries pass through unchanged, go-discover strings run provider
+// discovery, srv+ entries resolve an SRV record carrying per-instance
+// ports, and host:port entries resolve the host to one address per
+// A/AAAA record.
+func (r *retryJoiner) resolveFallbackEntry(disco *discover.Discover, addr string) ([]string, error) {
+	switch {
+	case strings.HasPrefix(addr, "srv+"):
+		return r.resolveSRVFallbackEntry(strings.TrimPrefix(addr, "srv+"))
+
+	case strings.Contains(addr, "provider="):
+		if disco == nil {
+			return nil, fmt.Errorf("no discovery providers available")
+		}
+		servers, err := disco.Addrs(addr, r.logger.StandardLogger(&hclog.StandardLoggerOptions{
+			InferLevels: true,
+		}))
+		if err != nil {
+			return nil, err
+		}
+		if r.discoverPort > 0 {
+			// The providers hand back bare IPs so they need the gateway
+			// port attached before the locator can dial them.
+			port := strconv.Itoa(r.discoverPort)
+			for i, server := range servers {
+				if _, _, err := net.SplitHostPort(server); err != nil {
+					servers[i] = net.JoinHostPort(server, port)
+				}
+			}
+		}
+		sort.Strings(servers)
+		return servers, nil
+
+	default:
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			if r.discoverPort <= 0 {
+				// not something we can pick apart here; let the gateway
+				// locator use it verbatim
+				return []string{addr}, nil
+			}
+			// a bare host with no port; attach the configured gateway port
+			host = addr
+			port = strconv.Itoa(r.discoverPort)
+		}
+		if net.ParseIP(host) != nil {
+			return []string{net.JoinHostPort(host, port)}, nil
+		}
+		lookup := r.lookupIP
+		if lookup == nil {
+			lookup = net.LookupIP
+		}
+		ips, err := lookup(host)
+		if err != nil {
+			return nil, err
+		}
+		servers := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			servers = append(servers, net.JoinHostPort(ip.String(), port))
+		}
+		sort.Strings(servers)
+		return servers, nil
+	}
+}
+
+// resolveSRVFallbackEntry expands an srv+ entry by resolving the SRV record
+// and then each target, combining target addresses with the per-record SRV
+// port. Records are ordered by priority and then descending weight so the
+// locator tries the preferred gateways first.
+func (r *retryJoiner) resolveSRVFallbackEntry(name string) ([]string, error) {
+	lookupSRV := r.lookupSRV
+	if lookupSRV == nil {
+		lookupSRV = func(name string) ([]*net.SRV, error) {
+			_, srvs, err := net.LookupSRV("", "", name)
+			return srvs, err
+		}
+	}
+	srvs, err := lookupSRV(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// LookupSRV shuffles records of equal priority by weight, so sort
+	// deterministically to keep an unchanged record set from looking like
+	// a new one on every refresh.
+	sort.SliceStable(srvs, func(i, j int) bool {
+		if srvs[i].Priority != srvs[j].Priority {
+			return srvs[i].Priority < srvs[j].Priority
+		}
+		if srvs[i].Weight != srvs[j].Weight {
+			return srvs[i].Weight > srvs[j].Weight
+		}
+		if srvs[i].Target != srvs[j].Target {
+			return srvs[i].Target < srvs[j].Target
+		}
+		return srvs[i].Port < srvs[j].Port
+	})
+
+	lookup := r.lookupIP
+	if lookup == nil {
+		lookup = net.LookupIP
+	}
+
+	var out []string
+	for _, srv := range srvs {
+		port := strconv.Itoa(int(srv.Port))
+		target := strings.TrimSuffix(srv.Target, ".")
+		if net.ParseIP(target) != nil {
+			out = append(out, net.JoinHostPort(target, port))
+			continue
+		}
+		ips, err := lookup(target)
+		if err != nil {
+			// Erroring out here keeps the whole entry's previous answer
+			// in place rather than delivering a partial gateway set.
+			return nil, err
+		}
+		servers := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			servers = append(servers, net.JoinHostPort(ip.String(), port))
+		}
+		sort.Strings(servers)
+		out = append(out, servers...)
+	}
+	return out, nil
+}
+
 const (
 	retryJoinSerfVariant        = "serf"
 	retryJoinMeshGatewayVariant = "mesh-gateway"
@@ -193,11 +445,75 @@ type retryJoiner struct {
 
 	// logger is the agent logger.
 	logger hclog.Logger
+
+	// prevDiscovered retains the last successful resolution of each
+	// configured entry so a transient discovery failure does not shrink
+	// the refreshed address set. Only used for the mesh-gateway variant.
+	prevDiscovered map[string][]string
+
+	// discoverPort is appended to any bare IPs returned by go-discover
+	// providers. Only used for the mesh-gateway variant.
+	discoverPort int
+
+	// execArgs optionally names an operator supplied executable, plus its
+	// arguments, that prints one gateway host:port per stdout line. It runs
+	// on every discovery pass alongside the configured entries. Only used
+	// for the mesh-gateway variant.
+	execArgs []string
+
+	// execTimeout bounds each run of execArgs. Defaults to 30s.
+	execTimeout time.Duration
+
+	// reloadAddrsCh optionally delivers a replacement for addrs, typically
+	// from a config reload, and triggers an immediate discovery pass. Only
+	// used for the mesh-gateway variant.
+	reloadAddrsCh <-chan []string
+
+	// failedAttempts and lastDiscoverFailed drive the exponential backoff
+	// applied to failing discovery passes in the mesh-gateway variant.
+	failedAttempts     uint
+	lastDiscoverFailed bool
+
+	// lookupIP overrides DNS resolution of host:port entries for tests.
+	// Defaults to net.LookupIP.
+	lookupIP func(host string) ([]net.IP, error)
+
+	// lookupSRV overrides DNS resolution of srv+ entries for tests.
+	// Defaults to net.LookupSRV on the bare record name.
+	lookupSRV func(name string) ([]*net.SRV, error)
+}
+
+// validatePrimaryGatewayEntries sanity checks a primary_gateways list before
+// it replaces a working one at config reload time. provider= and srv+ entries
+// are validated by their resolvers on each discovery pass; static entries must
+// at least look dialable.
+func validatePrimaryGatewayEntries(entries []string) error {
+	for _, entry := range entries {
+		if strings.Contains(entry, "provider=") || strings.HasPrefix(entry, "srv+") {
+			continue
+		}
+		if err := lib.ValidateDialAddressOptionalPort(entry); err != nil {
+			return fmt.Errorf("invalid primary gateway address %q: %s", entry, err)
+		}
+	}
+	return nil
 }
 
 func (r *retryJoiner) retryJoin() error {
-	if len(r.addrs) == 0 {
-		return nil
+	if len(r.addrs) == 0 && len(r.execArgs) == 0 {
+		if r.variant == retryJoinMeshGatewayVariant && r.reloadAddrsCh != nil {
+			// No entries configured yet, but a config reload may add some
+			// later, so wait for one instead of exiting and leaving nothing
+			// listening for it.
+			select {
+			case addrs := <-r.reloadAddrsCh:
+				r.addrs = addrs
+			case <-r.stopCh:
+				return nil
+			}
+		} else {
+			return nil
+		}
 	}
 
 	disco, err := newDiscover()
@@ -219,15 +535,24 @@ func (r *retryJoiner) retryJoin() error {
 
 	attempt := 0
 	for {
-		addrs := retryJoinAddrs(disco, r.variant, r.cluster, r.addrs, r.logger)
+		var addrs []string
+		if r.variant == retryJoinMeshGatewayVariant {
+			addrs = r.discoverMeshGatewayAddrs(disco)
+		} else {
+			addrs = retryJoinAddrs(disco, r.variant, r.cluster, r.addrs, r.logger)
+		}
 		if len(addrs) > 0 {
 			n, err := r.join(addrs)
 			if err == nil {
 				if r.variant == retryJoinMeshGatewayVariant {
 					r.logger.Info("Refreshing mesh gateways completed")
-				} else {
-					r.logger.Info("Join cluster completed. Synced with initial agents", "num_agents", n)
+					// Keep re-resolving in the background. Blocking here
+					// would keep retryJoinWAN from ever star-joining the
+					// primary through the gateways just discovered.
+					go r.refreshLoop(disco, addrs)
+					return nil
 				}
+				r.logger.Info("Join cluster completed. Synced with initial agents", "num_agents", n)
 				return nil
 			}
 		} else if len(addrs) == 0 {
@@ -247,9 +572,11 @@ func (r *retryJoiner) retryJoin() error {
 			}
 		}
 
+		wait := r.interval
 		if r.variant == retryJoinMeshGatewayVariant {
+			wait = r.backoffWait()
 			r.logger.Warn("Refreshing mesh gateways failed, will retry",
-				"retry_interval", r.interval,
+				"retry_interval", wait,
 				"error", err,
 			)
 		} else {
@@ -260,9 +587,87 @@ func (r *retryJoiner) retryJoin() error {
 		}
 
 		select {
-		case <-time.After(r.interval):
+		case <-time.After(wait):
+		case addrs := <-r.reloadAddrsCh:
+			r.addrs = addrs
 		case <-r.stopCh:
 			return nil
 		}
 	}
 }
+
+// maxMeshGatewayRefreshBackoff caps the exponential backoff applied to
+// failing fallback discovery passes.
+const maxMeshGatewayRefreshBackoff = 5 * time.Minute
+
+// backoffWait returns how long to sleep after a failed discovery pass: the
+// configured interval doubled per consecutive failure with jitter, capped at
+// maxMeshGatewayRefreshBackoff. A successful pass resets the progression.
+func (r *retryJoiner) backoffWait() time.Duration {
+	wait := r.interval << r.failedAttempts
+	if wait > 0 && wait < maxMeshGatewayRefreshBackoff {
+		r.failedAttempts++
+	}
+	if wait <= 0 || wait > maxMeshGatewayRefreshBackoff {
+		wait = maxMeshGatewayRefreshBackoff
+	}
+	return wait + lib.RandomStagger(wait/4)
+}
+
+// refreshLoop keeps a successfully refreshed mesh gateway address set up to
+// date by re-running discovery on the configured interval. A new set is only
+// pushed, and logged, when it differs from the last one delivered, so a
+// stable DNS answer stays quiet in the logs.
+func (r *retryJoiner) refreshLoop(disco *discover.Discover, lastAddrs []string) error {
+	r.failedAttempts = 0
+	for {
+		wait := r.interval
+		if r.lastDiscoverFailed {
+			wait = r.backoffWait()
+		} else {
+			r.failedAttempts = 0
+		}
+
+		select {
+		case <-time.After(wait):
+		case addrs := <-r.reloadAddrsCh:
+			// a config reload changed the configured entries; rediscover
+			// immediately
+			r.addrs = addrs
+			r.logger.Info("Reloaded mesh gateway discovery configuration",
+				"entries", strings.Join(addrs, " "),
+			)
+		case <-r.stopCh:
+			return nil
+		}
+
+		addrs := r.discoverMeshGatewayAddrs(disco)
+		if len(addrs) == 0 || stringSliceEqual(addrs, lastAddrs) {
+			continue
+		}
+
+		if _, err := r.join(addrs); err != nil {
+			r.logger.Warn("Refreshing mesh gateways failed, will retry",
+				"retry_interval", r.interval,
+				"error", err,
+			)
+			continue
+		}
+		r.logger.Info("Refreshed mesh gateways",
+			"mesh_gateways", strings.Join(addrs, " "),
+		)
+		lastAddrs = addrs
+	}
+}
+
+func stringSliceEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -2,7 +2,11 @@ package agent
 
 import (
 	"bytes"
+	"fmt"
+	"net"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/consul/sdk/testutil"
 	"github.com/stretchr/testify/require"
@@ -60,3 +64,320 @@ func TestAgentRetryJoinAddrs(t *testing.T) {
 		require.Equal(t, []string{}, retryJoinAddrs(nil, retryJoinSerfVariant, "LAN", []string{"a"}, nil))
 	})
 }
+
+func TestAgentRetryJoin_MeshGatewayDiscovery(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		ips    = []net.IP{net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.1")}
+		failed = false
+	)
+
+	r := &retryJoiner{
+		variant: retryJoinMeshGatewayVariant,
+		cluster: "primary",
+		addrs:   []string{"192.0.2.1:8443", "gw.example.com:8443"},
+		logger:  testutil.Logger(t),
+		lookupIP: func(host string) ([]net.IP, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			require.Equal(t, "gw.example.com", host)
+			if failed {
+				return nil, fmt.Errorf("dns unavailable")
+			}
+			return ips, nil
+		},
+	}
+
+	// hostname entries resolve to one address per record, static entries
+	// pass through untouched
+	require.Equal(t,
+		[]string{"192.0.2.1:8443", "10.0.0.1:8443", "10.0.0.2:8443"},
+		r.discoverMeshGatewayAddrs(nil),
+	)
+
+	// resolution failures retain the previous answer
+	mu.Lock()
+	failed = true
+	mu.Unlock()
+	require.Equal(t,
+		[]string{"192.0.2.1:8443", "10.0.0.1:8443", "10.0.0.2:8443"},
+		r.discoverMeshGatewayAddrs(nil),
+	)
+
+	// new records show up on the next pass
+	mu.Lock()
+	failed = false
+	ips = []net.IP{net.ParseIP("10.0.0.3")}
+	mu.Unlock()
+	require.Equal(t,
+		[]string{"192.0.2.1:8443", "10.0.0.3:8443"},
+		r.discoverMeshGatewayAddrs(nil),
+	)
+}
+
+func TestAgentRetryJoin_SRVFallbackEntry(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		failed = false
+	)
+
+	r := &retryJoiner{
+		variant: retryJoinMeshGatewayVariant,
+		cluster: "primary",
+		addrs:   []string{"srv+_wanfed._tcp.example.com"},
+		logger:  testutil.Logger(t),
+		lookupSRV: func(name string) ([]*net.SRV, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			require.Equal(t, "_wanfed._tcp.example.com", name)
+			if failed {
+				return nil, fmt.Errorf("dns unavailable")
+			}
+			// delivered in weight-shuffled order on purpose
+			return []*net.SRV{
+				{Target: "gw2.example.com.", Port: 8444, Priority: 2, Weight: 50},
+				{Target: "gw1.example.com.", Port: 8443, Priority: 1, Weight: 10},
+				{Target: "192.0.2.9.", Port: 9999, Priority: 3, Weight: 1},
+			}, nil
+		},
+		lookupIP: func(host string) ([]net.IP, error) {
+			switch host {
+			case "gw1.example.com":
+				return []net.IP{net.ParseIP("10.0.0.1")}, nil
+			case "gw2.example.com":
+				return []net.IP{net.ParseIP("10.0.0.2")}, nil
+			default:
+				return nil, fmt.Errorf("unknown host %q", host)
+			}
+		},
+	}
+
+	// targets combine with per-record ports and come back in priority order
+	expect := []string{"10.0.0.1:8443", "10.0.0.2:8444", "192.0.2.9:9999"}
+	require.Equal(t, expect, r.discoverMeshGatewayAddrs(nil))
+
+	// a failed SRV lookup retains the previous answer
+	mu.Lock()
+	failed = true
+	mu.Unlock()
+	require.Equal(t, expect, r.discoverMeshGatewayAddrs(nil))
+}
+
+func TestAgentRetryJoin_ExecFallbackDiscovery(t *testing.T) {
+	newJoiner := func(args ...string) *retryJoiner {
+		return &retryJoiner{
+			variant:     retryJoinMeshGatewayVariant,
+			cluster:     "primary",
+			execArgs:    args,
+			execTimeout: 5 * time.Second,
+			logger:      testutil.Logger(t),
+		}
+	}
+
+	t.Run("parses one address per line", func(t *testing.T) {
+		r := newJoiner("sh", "-c", "echo 10.0.0.1:8443; echo '  10.0.0.2:8443  '; echo")
+		require.Equal(t,
+			[]string{"10.0.0.1:8443", "10.0.0.2:8443"},
+			r.discoverMeshGatewayAddrs(nil),
+		)
+		require.False(t, r.lastDiscoverFailed)
+	})
+
+	t.Run("non-zero exit retains the previous answer", func(t *testing.T) {
+		r := newJoiner("sh", "-c", "echo 10.0.0.1:8443")
+		require.Equal(t, []string{"10.0.0.1:8443"}, r.discoverMeshGatewayAddrs(nil))
+
+		r.execArgs = []string{"sh", "-c", "echo 'cmdb unavailable' >&2; exit 1"}
+		require.Equal(t, []string{"10.0.0.1:8443"}, r.discoverMeshGatewayAddrs(nil))
+		require.True(t, r.lastDiscoverFailed)
+	})
+
+	t.Run("invalid address fails the whole pass", func(t *testing.T) {
+		r := newJoiner("sh", "-c", "echo 10.0.0.1:8443; echo not-an-address")
+		require.Empty(t, r.discoverMeshGatewayAddrs(nil))
+		require.True(t, r.lastDiscoverFailed)
+	})
+
+	t.Run("timeout fails the pass", func(t *testing.T) {
+		r := newJoiner("sh", "-c", "sleep 10")
+		r.execTimeout = 50 * time.Millisecond
+		require.Empty(t, r.discoverMeshGatewayAddrs(nil))
+		require.True(t, r.lastDiscoverFailed)
+	})
+}
+
+func TestAgentRetryJoin_BackoffWait(t *testing.T) {
+	r := &retryJoiner{
+		variant:  retryJoinMeshGatewayVariant,
+		interval: 30 * time.Second,
+	}
+
+	inRange := func(t *testing.T, wait, base time.Duration) {
+		t.Helper()
+		require.GreaterOrEqual(t, int64(wait), int64(base))
+		require.LessOrEqual(t, int64(wait), int64(base+base/4))
+	}
+
+	// doubles per consecutive failure
+	inRange(t, r.backoffWait(), 30*time.Second)
+	inRange(t, r.backoffWait(), 60*time.Second)
+	inRange(t, r.backoffWait(), 120*time.Second)
+	inRange(t, r.backoffWait(), 240*time.Second)
+
+	// capped
+	inRange(t, r.backoffWait(), maxMeshGatewayRefreshBackoff)
+	inRange(t, r.backoffWait(), maxMeshGatewayRefreshBackoff)
+
+	// a success resets the progression
+	r.failedAttempts = 0
+	inRange(t, r.backoffWait(), 30*time.Second)
+}
+
+func TestAgentRetryJoin_RefreshLoopReloadTrigger(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	reloadCh := make(chan []string, 1)
+	joinedCh := make(chan []string, 5)
+
+	r := &retryJoiner{
+		variant: retryJoinMeshGatewayVariant,
+		cluster: "primary",
+		addrs:   []string{"10.0.0.1:8443"},
+		// long enough that only the reload trigger can wake the loop
+		interval: time.Hour,
+		join: func(addrs []string) (int, error) {
+			joinedCh <- addrs
+			return len(addrs), nil
+		},
+		logger:        testutil.Logger(t),
+		stopCh:        stopCh,
+		reloadAddrsCh: reloadCh,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- r.refreshLoop(nil, r.discoverMeshGatewayAddrs(nil))
+	}()
+
+	reloadCh <- []string{"10.0.0.2:8443"}
+
+	select {
+	case addrs := <-joinedCh:
+		require.Equal(t, []string{"10.0.0.2:8443"}, addrs)
+	case <-time.After(time.Second):
+		t.Fatal("reload trigger never produced a refresh")
+	}
+}
+
+func TestAgentRetryJoin_RefreshLoopPushesOnChange(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		ips = []net.IP{net.ParseIP("10.0.0.1")}
+	)
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	joinedCh := make(chan []string, 5)
+
+	r := &retryJoiner{
+		variant:  retryJoinMeshGatewayVariant,
+		cluster:  "primary",
+		addrs:    []string{"gw.example.com:8443"},
+		interval: 5 * time.Millisecond,
+		join: func(addrs []string) (int, error) {
+			joinedCh <- addrs
+			return len(addrs), nil
+		},
+		logger: testutil.Logger(t),
+		stopCh: stopCh,
+		lookupIP: func(host string) ([]net.IP, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			return ips, nil
+		},
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- r.refreshLoop(nil, r.discoverMeshGatewayAddrs(nil))
+	}()
+
+	// an unchanged answer never triggers a push
+	select {
+	case addrs := <-joinedCh:
+		t.Fatalf("unexpected refresh of %v", addrs)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mu.Lock()
+	ips = []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")}
+	mu.Unlock()
+
+	select {
+	case addrs := <-joinedCh:
+		require.Equal(t, []string{"10.0.0.1:8443", "10.0.0.2:8443"}, addrs)
+	case <-time.After(time.Second):
+		t.Fatal("refresh loop never pushed the new address set")
+	}
+}
+
+func TestAgentRetryJoin_ValidatePrimaryGatewayEntries(t *testing.T) {
+	require.NoError(t, validatePrimaryGatewayEntries(nil))
+	require.NoError(t, validatePrimaryGatewayEntries([]string{
+		"1.2.3.4:8443",
+		"gw.example.com:8443",
+		"gw.example.com",
+		"srv+_wanfed._tcp.example.com",
+		"provider=aws tag_key=x tag_value=y",
+	}))
+
+	require.Error(t, validatePrimaryGatewayEntries([]string{"1.2.3.4:notaport"}))
+	require.Error(t, validatePrimaryGatewayEntries([]string{"1.2.3.4.5:8443"}))
+	require.Error(t, validatePrimaryGatewayEntries([]string{":8443"}))
+}
+
+func TestAgentRetryJoin_EmptyListWaitsForReload(t *testing.T) {
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+
+	reloadCh := make(chan []string, 1)
+	joinedCh := make(chan []string, 5)
+
+	r := &retryJoiner{
+		variant:  retryJoinMeshGatewayVariant,
+		cluster:  "primary",
+		addrs:    nil,
+		interval: time.Hour,
+		join: func(addrs []string) (int, error) {
+			joinedCh <- addrs
+			return len(addrs), nil
+		},
+		logger:        testutil.Logger(t),
+		stopCh:        stopCh,
+		reloadAddrsCh: reloadCh,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- r.retryJoin()
+	}()
+
+	// Nothing configured, so nothing should happen until a reload delivers
+	// entries.
+	select {
+	case addrs := <-joinedCh:
+		t.Fatalf("unexpected refresh of %v", addrs)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	reloadCh <- []string{"10.0.0.9:8443"}
+
+	select {
+	case addrs := <-joinedCh:
+		require.Equal(t, []string{"10.0.0.9:8443"}, addrs)
+	case <-time.After(time.Second):
+		t.Fatal("reloaded entries never produced a refresh")
+	}
+}
@@ -20,6 +20,13 @@ const (
 	ConsulServiceName = "consul"
 )
 
+// WANFedGatewayAvailCheckID is the ID of the synthetic node-level health
+// check maintained on wan-federated servers to reflect whether any path to
+// the primary datacenter's mesh gateways is known. The gateway locator
+// ignores it when collapsing mesh gateway health, since it describes the
+// node's view of the federation rather than the gateway itself.
+const WANFedGatewayAvailCheckID types.CheckID = "wanfed-mesh-gateway-availability"
+
 var (
 	ConsulCompoundServiceID = NewServiceID(ConsulServiceID, nil)
 	SerfCompoundCheckID     = NewCheckID(SerfCheckID, nil)
@@ -1,7 +1,10 @@
 package structs
 
 import (
+	"fmt"
+	"hash/fnv"
 	"sort"
+	"strconv"
 	"time"
 )
 
@@ -11,6 +14,11 @@ type FederationStateOp string
 const (
 	FederationStateUpsert FederationStateOp = "upsert"
 	FederationStateDelete FederationStateOp = "delete"
+
+	// FederationStateBatchUpsert applies several federation state upserts in
+	// a single raft log entry, for callers applying updates for many
+	// datacenters at once.
+	FederationStateBatchUpsert FederationStateOp = "batch-upsert"
 )
 
 // FederationStateRequest is used to upsert and delete federation states.
@@ -25,6 +33,10 @@ type FederationStateRequest struct {
 	// only the State.Datacenter field should be set.
 	State *FederationState
 
+	// States is the set of federation states to upsert together when Op is
+	// FederationStateBatchUpsert; State is ignored for that operation.
+	States FederationStates `json:",omitempty"`
+
 	// WriteRequest is a common struct containing ACL tokens and other
 	// write-related common elements for requests.
 	WriteRequest
@@ -56,6 +68,13 @@ type FederationState struct {
 	// this datacenter.
 	MeshGateways CheckServiceNodes `json:",omitempty"`
 
+	// MeshGatewaysHash is a stable hash of the mesh gateway snapshot above,
+	// covering only the fields that matter for wanfed transit, so that the
+	// periodic dump can skip re-persisting an unchanged snapshot. See
+	// HashMeshGateways. May be zero for records written before hashes were
+	// stored.
+	MeshGatewaysHash uint64 `json:",omitempty"`
+
 	// UpdatedAt keeps track of when this record was modified.
 	UpdatedAt time.Time
 
@@ -113,6 +132,155 @@ func (c *FederationState) IsSame(other *FederationState) bool {
 	return true
 }
 
+// ValidateMeshGateways checks that every mesh gateway in the snapshot renders
+// to a non-empty host and a valid port for both its LAN and WAN views, so
+// that one datacenter shipping a garbage registration cannot poison the
+// gateway caches of every other datacenter. The returned error names the
+// offending node.
+func (c *FederationState) ValidateMeshGateways() error {
+	for _, csn := range c.MeshGateways {
+		node := "<unknown>"
+		if csn.Node != nil {
+			node = csn.Node.Node
+		}
+		if csn.Service == nil {
+			return fmt.Errorf("mesh gateway on node %q is missing its service registration", node)
+		}
+		for _, wan := range []bool{false, true} {
+			rendering := "LAN"
+			if wan {
+				rendering = "WAN"
+			}
+			addr, port := csn.BestAddress(wan)
+			if addr == "" {
+				return fmt.Errorf("mesh gateway on node %q has an empty %s address", node, rendering)
+			}
+			if port < 1 || port > 65535 {
+				return fmt.Errorf("mesh gateway on node %q has an invalid %s port %d", node, rendering, port)
+			}
+		}
+	}
+	return nil
+}
+
+// HashMeshGateways returns a stable hash of the mesh gateway snapshot
+// covering the fields that matter for wanfed transit: addresses, ports,
+// tagged addresses, metadata, weights, and check status. Volatile fields like
+// check output text are deliberately left out so that flapping output does
+// not make an unchanged snapshot look different. The hash is insensitive to
+// the ordering of gateways, checks, and map keys.
+func (c *FederationState) HashMeshGateways() uint64 {
+	h := fnv.New64a()
+
+	writeString := func(s string) {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	writeInt := func(i int) {
+		writeString(strconv.Itoa(i))
+	}
+	writeMap := func(m map[string]string) {
+		keys := make([]string, 0, len(m))
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		writeInt(len(keys))
+		for _, k := range keys {
+			writeString(k)
+			writeString(m[k])
+		}
+	}
+
+	// These structs arrive over RPC, so a nil Node or Service hashes a
+	// sentinel instead of panicking, mirroring ValidateMeshGateways.
+	nodeName := func(csn CheckServiceNode) string {
+		if csn.Node == nil {
+			return ""
+		}
+		return csn.Node.Node
+	}
+	serviceID := func(csn CheckServiceNode) string {
+		if csn.Service == nil {
+			return ""
+		}
+		return csn.Service.ID
+	}
+
+	gateways := make([]CheckServiceNode, len(c.MeshGateways))
+	copy(gateways, c.MeshGateways)
+	sort.Slice(gateways, func(i, j int) bool {
+		if nodeName(gateways[i]) != nodeName(gateways[j]) {
+			return nodeName(gateways[i]) < nodeName(gateways[j])
+		}
+		return serviceID(gateways[i]) < serviceID(gateways[j])
+	})
+
+	for _, csn := range gateways {
+		if csn.Node != nil {
+			writeString(csn.Node.Node)
+			writeString(csn.Node.Address)
+			writeString(csn.Node.Datacenter)
+			writeMap(csn.Node.Meta)
+			writeMap(csn.Node.TaggedAddresses)
+		} else {
+			writeString("no-node")
+		}
+
+		if csn.Service != nil {
+			writeString(csn.Service.ID)
+			writeString(csn.Service.Service)
+			writeString(csn.Service.Address)
+			writeInt(csn.Service.Port)
+			writeMap(csn.Service.Meta)
+
+			tags := make([]string, len(csn.Service.Tags))
+			copy(tags, csn.Service.Tags)
+			sort.Strings(tags)
+			writeInt(len(tags))
+			for _, tag := range tags {
+				writeString(tag)
+			}
+
+			taggedKeys := make([]string, 0, len(csn.Service.TaggedAddresses))
+			for k := range csn.Service.TaggedAddresses {
+				taggedKeys = append(taggedKeys, k)
+			}
+			sort.Strings(taggedKeys)
+			writeInt(len(taggedKeys))
+			for _, k := range taggedKeys {
+				tagged := csn.Service.TaggedAddresses[k]
+				writeString(k)
+				writeString(tagged.Address)
+				writeInt(tagged.Port)
+			}
+
+			if csn.Service.Weights != nil {
+				writeInt(csn.Service.Weights.Passing)
+				writeInt(csn.Service.Weights.Warning)
+			} else {
+				writeString("no-weights")
+			}
+		} else {
+			writeString("no-service")
+		}
+
+		checks := make(HealthChecks, len(csn.Checks))
+		copy(checks, csn.Checks)
+		sort.Slice(checks, func(i, j int) bool {
+			return checks[i].CheckID < checks[j].CheckID
+		})
+		writeInt(len(checks))
+		for _, chk := range checks {
+			writeString(string(chk.CheckID))
+			writeString(chk.Status)
+			writeString(chk.ServiceID)
+		}
+	}
+
+	return h.Sum64()
+}
+
 // FederationStateQuery is used to query federation states.
 type FederationStateQuery struct {
 	// Datacenter is the target this request is intended for.
@@ -130,6 +298,34 @@ func (c *FederationStateQuery) RequestDatacenter() string {
 	return c.TargetDatacenter
 }
 
+// FederationStateListRequest is used to list federation states, optionally a
+// page at a time. It is wire-compatible with the DCSpecificRequest that the
+// replicator and older clients send: the pagination fields are simply absent
+// there, which selects the unpaginated behavior.
+type FederationStateListRequest struct {
+	// Datacenter is the target this request is intended for.
+	Datacenter string
+
+	// Limit caps the number of federation states returned per page. Zero
+	// returns everything.
+	Limit int
+
+	// NextToken resumes listing after the datacenter with this name, as
+	// returned in IndexedFederationStates.NextToken by the previous page.
+	// Keying pages on the datacenter name rather than an offset keeps the
+	// token stable across blocking query wakeups and across entries being
+	// added or removed between pages.
+	NextToken string
+
+	// Options for queries
+	QueryOptions
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (c *FederationStateListRequest) RequestDatacenter() string {
+	return c.Datacenter
+}
+
 // FederationStateResponse is the response to a FederationStateQuery request.
 type FederationStateResponse struct {
 	State *FederationState
@@ -139,5 +335,45 @@ type FederationStateResponse struct {
 // IndexedFederationStates represents the list of all federation states.
 type IndexedFederationStates struct {
 	States FederationStates
+
+	// NextToken is set when a Limit truncated the results; passing it back
+	// as FederationStateListRequest.NextToken resumes listing after the
+	// last entry returned.
+	NextToken string `json:",omitempty"`
+
 	QueryMeta
 }
+
+// FederationStateReplicationStatus provides information about the health of
+// the federation state replication running in a secondary datacenter, so a
+// single query can answer how stale this datacenter's view of the primary's
+// mesh gateways is.
+type FederationStateReplicationStatus struct {
+	// Enabled reports whether federation state replication runs in this
+	// datacenter at all. It is false in the primary datacenter, which is
+	// the source of truth and has nothing to replicate.
+	Enabled bool
+
+	// SourceDatacenter is the primary datacenter being replicated from.
+	SourceDatacenter string
+
+	// ReplicatedIndex is the primary's raft index through which replication
+	// has been applied locally.
+	ReplicatedIndex uint64
+
+	// PrimaryIndex is the primary's federation state index as of the most
+	// recent fetch, so PrimaryIndex minus ReplicatedIndex is the
+	// replication lag in indexes.
+	PrimaryIndex uint64
+
+	// LastSuccess and LastError are when a replication round last completed
+	// successfully or failed, respectively. Either may be the zero time.
+	LastSuccess time.Time
+	LastError   time.Time
+
+	// PrimaryGatewaysActive is how many primary mesh gateway addresses the
+	// gateway locator currently tracks, and PrimaryGatewaysUpdated is when
+	// that list last changed.
+	PrimaryGatewaysActive  int
+	PrimaryGatewaysUpdated time.Time
+}
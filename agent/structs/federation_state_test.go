@@ -0,0 +1,112 @@
+package structs
+
+import (
+	"testing"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFederationState_HashMeshGateways(t *testing.T) {
+	newCSN := func(node, ip string, port int, checkOutput string) CheckServiceNode {
+		return CheckServiceNode{
+			Node: &Node{
+				Node:       node,
+				Datacenter: "dc1",
+				Address:    ip,
+			},
+			Service: &NodeService{
+				ID:      "mesh-gateway",
+				Service: "mesh-gateway",
+				Kind:    ServiceKindMeshGateway,
+				Port:    port,
+				Meta:    map[string]string{MetaWANFederationKey: "1"},
+			},
+			Checks: HealthChecks{
+				{
+					Node:      node,
+					CheckID:   "mesh-gateway",
+					Name:      "web connectivity",
+					Status:    api.HealthPassing,
+					ServiceID: "mesh-gateway",
+					Output:    checkOutput,
+				},
+			},
+		}
+	}
+
+	newFedState := func(gateways ...CheckServiceNode) *FederationState {
+		return &FederationState{
+			Datacenter:   "dc1",
+			MeshGateways: gateways,
+		}
+	}
+
+	gw1 := newCSN("gateway1", "1.2.3.4", 443, "")
+	gw2 := newCSN("gateway2", "4.3.2.1", 443, "")
+
+	t.Run("identical dumps hash identically", func(t *testing.T) {
+		require.Equal(t,
+			newFedState(gw1, gw2).HashMeshGateways(),
+			newFedState(gw1, gw2).HashMeshGateways(),
+		)
+	})
+
+	t.Run("ordering does not matter", func(t *testing.T) {
+		require.Equal(t,
+			newFedState(gw1, gw2).HashMeshGateways(),
+			newFedState(gw2, gw1).HashMeshGateways(),
+		)
+	})
+
+	t.Run("volatile check output is ignored", func(t *testing.T) {
+		noisy := newCSN("gateway1", "1.2.3.4", 443, "HTTP GET http://localhost: 200 OK in 53ms")
+		require.Equal(t,
+			newFedState(gw1, gw2).HashMeshGateways(),
+			newFedState(noisy, gw2).HashMeshGateways(),
+		)
+	})
+
+	t.Run("address changes matter", func(t *testing.T) {
+		moved := newCSN("gateway1", "9.9.9.9", 443, "")
+		require.NotEqual(t,
+			newFedState(gw1, gw2).HashMeshGateways(),
+			newFedState(moved, gw2).HashMeshGateways(),
+		)
+	})
+
+	t.Run("port changes matter", func(t *testing.T) {
+		moved := newCSN("gateway1", "1.2.3.4", 8443, "")
+		require.NotEqual(t,
+			newFedState(gw1, gw2).HashMeshGateways(),
+			newFedState(moved, gw2).HashMeshGateways(),
+		)
+	})
+
+	t.Run("check status changes matter", func(t *testing.T) {
+		failing := newCSN("gateway1", "1.2.3.4", 443, "")
+		failing.Checks[0].Status = api.HealthCritical
+		require.NotEqual(t,
+			newFedState(gw1, gw2).HashMeshGateways(),
+			newFedState(failing, gw2).HashMeshGateways(),
+		)
+	})
+
+	t.Run("membership changes matter", func(t *testing.T) {
+		require.NotEqual(t,
+			newFedState(gw1, gw2).HashMeshGateways(),
+			newFedState(gw1).HashMeshGateways(),
+		)
+	})
+
+	t.Run("nil node or service does not panic", func(t *testing.T) {
+		noNode := newCSN("gateway1", "1.2.3.4", 443, "")
+		noNode.Node = nil
+		noService := newCSN("gateway2", "4.3.2.1", 443, "")
+		noService.Service = nil
+		require.NotEqual(t,
+			newFedState(noNode, gw2).HashMeshGateways(),
+			newFedState(gw1, noService).HashMeshGateways(),
+		)
+	})
+}
@@ -2,6 +2,7 @@ package structs
 
 import (
 	"net"
+	"time"
 
 	"github.com/hashicorp/consul/agent/consul/autopilot"
 	"github.com/hashicorp/raft"
@@ -65,6 +66,192 @@ func (op *RaftRemovePeerRequest) RequestDatacenter() string {
 	return op.Datacenter
 }
 
+// DecommissionDatacenterRequest is used by the Operator endpoint to remove a
+// departed datacenter from the WAN federation in one step.
+type DecommissionDatacenterRequest struct {
+	// Datacenter is the target this request is intended for. Decommissions
+	// always execute in the primary datacenter, so this is fixed before
+	// forwarding.
+	Datacenter string
+
+	// DecommissionDatacenter is the name of the federated datacenter to
+	// decommission.
+	DecommissionDatacenter string
+
+	// WriteRequest holds the ACL token to go along with this request.
+	WriteRequest
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (op *DecommissionDatacenterRequest) RequestDatacenter() string {
+	return op.Datacenter
+}
+
+// WANFederationGatewaysRequest is used by the Operator endpoint to query a
+// server's cached view of the mesh gateways usable for WAN federation
+// transit.
+type WANFederationGatewaysRequest struct {
+	// Datacenter is the target this request is intended for.
+	Datacenter string
+
+	// QueryOptions holds the ACL token and consistency controls. The view
+	// is per-server state, so a stale query returns the contacted server's
+	// own cache while the default forwards to the datacenter's leader.
+	QueryOptions
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (op *WANFederationGatewaysRequest) RequestDatacenter() string {
+	return op.Datacenter
+}
+
+// WANFederationGateway is one mesh gateway in a server's cached view.
+type WANFederationGateway struct {
+	// Address is the host:port the server would dial for this gateway.
+	Address string
+
+	// Datacenter is the datacenter the gateway provides transit into.
+	Datacenter string
+
+	// NodeName is the catalog node the gateway is registered on. Empty for
+	// fallback addresses, which have no catalog context.
+	NodeName string
+
+	// Health is the gateway's collapsed health status.
+	Health string
+
+	// FromFederationState is true when the address came from replicated
+	// federation state, and false when it came from the fallback addresses
+	// configured or discovered for the primary datacenter.
+	FromFederationState bool
+
+	// LastUpdated is when the list containing this gateway was last
+	// replaced.
+	LastUpdated time.Time
+
+	// Source names where the list containing this gateway came from:
+	// "federation-state", "fallback", or "persisted-cache".
+	Source string
+
+	// RaftIndex is the federation state index the list was derived from.
+	// Zero for fallback addresses and lists restored from the persisted
+	// cache.
+	RaftIndex uint64
+}
+
+// WANFederationGatewaysResponse is the answering server's cached mesh
+// gateway view. It carries no raft index because the view is per-server
+// state maintained by that server's gateway locator, not replicated data.
+type WANFederationGatewaysResponse struct {
+	// LocalGateways are the gateways providing transit into the answering
+	// server's own datacenter.
+	LocalGateways []WANFederationGateway
+
+	// PrimaryGateways are the gateways usable for reaching the primary
+	// datacenter, including fallback-derived entries when nothing has
+	// arrived via federation state yet.
+	PrimaryGateways []WANFederationGateway
+
+	// FallbackAddresses is the raw configured or discovered fallback list
+	// for the primary datacenter.
+	FallbackAddresses []string
+
+	// PrimaryReady is true once the answering server has learned at least
+	// one primary mesh gateway from replicated federation state.
+	PrimaryReady bool
+
+	// FailureCounts is the consecutive dial failure count per gateway
+	// address as tracked by the answering server's circuit breakers.
+	// Addresses without recent failures are absent.
+	FailureCounts map[string]int
+
+	// LastRefreshAttempt and LastSuccessfulRefresh report the liveness of
+	// the answering server's gateway refresh loop. Both advance on every
+	// pass even when nothing changed; stale timestamps mean the loop is
+	// stuck rather than quiet.
+	LastRefreshAttempt    time.Time
+	LastSuccessfulRefresh time.Time
+
+	// ConsecutiveRefreshErrors is how many refresh passes in a row have
+	// failed on the answering server.
+	ConsecutiveRefreshErrors int
+}
+
+// WANFederationStatusRequest is used by the Internal endpoint to ask for an
+// aggregated WAN federation health summary across the local server set.
+type WANFederationStatusRequest struct {
+	// Datacenter is the target this request is intended for.
+	Datacenter string
+
+	// QueryOptions holds the ACL token.
+	QueryOptions
+}
+
+// RequestDatacenter returns the datacenter for a given request.
+func (op *WANFederationStatusRequest) RequestDatacenter() string {
+	return op.Datacenter
+}
+
+// WANFederationServerStatus is one local server's gateway locator view
+// within an aggregated WAN federation status report.
+type WANFederationServerStatus struct {
+	// Server is the node name of the server.
+	Server string
+
+	// Address is the server's RPC address.
+	Address string
+
+	// Reachable is false when the server could not be queried; the
+	// remaining fields are zero in that case and Error says why.
+	Reachable bool
+
+	// Error is the failure querying an unreachable server.
+	Error string
+
+	// PrimaryReady is true once the server has learned at least one
+	// primary mesh gateway via federation state replication.
+	PrimaryReady bool
+
+	// PrimaryGatewayCount and LocalGatewayCount are the sizes of the
+	// server's tracked gateway lists.
+	PrimaryGatewayCount int
+	LocalGatewayCount   int
+
+	// FallbackAddressCount is how many configured or discovered fallback
+	// addresses for the primary datacenter the server holds.
+	FallbackAddressCount int
+}
+
+// WANFederationDatacenterStatus summarizes the replicated federation state
+// entry for one datacenter.
+type WANFederationDatacenterStatus struct {
+	// Datacenter is the datacenter the entry describes.
+	Datacenter string
+
+	// MeshGatewayCount is how many mesh gateways the entry advertises.
+	MeshGatewayCount int
+
+	// UpdatedAt is when the entry was last updated in its source
+	// datacenter, for judging replication staleness.
+	UpdatedAt time.Time
+}
+
+// WANFederationStatusResponse is an aggregated WAN federation health summary
+// for one datacenter's server set. It carries no raft index because the
+// per-server reports are point-in-time state, not replicated data.
+type WANFederationStatusResponse struct {
+	// Healthy is true when every server was reachable and reported primary
+	// mesh gateways learned via federation state replication.
+	Healthy bool
+
+	// Servers holds one report per server in the datacenter.
+	Servers []WANFederationServerStatus
+
+	// Datacenters summarizes the replicated federation state per known
+	// datacenter.
+	Datacenters []WANFederationDatacenterStatus
+}
+
 // AutopilotSetConfigRequest is used by the Operator endpoint to update the
 // current Autopilot configuration of the cluster.
 type AutopilotSetConfigRequest struct {
@@ -103,6 +103,28 @@ const (
 	// mesh gateway is usable for wan federation.
 	MetaWANFederationKey = "consul-wan-federation"
 
+	// MetaWANFederationDrainKey is the mesh gateway metadata key that
+	// indicates a mesh gateway is draining and should not be chosen for new
+	// wan federation transit, without yanking its catalog registration.
+	MetaWANFederationDrainKey = "consul-wan-federation-drain"
+
+	// MetaWANFederationProtocolKey is the mesh gateway metadata key that
+	// advertises the wan federation transit protocol versions a mesh
+	// gateway supports, either as a single version ("1") or an inclusive
+	// range ("1-2"). Absent means version 1.
+	MetaWANFederationProtocolKey = "consul-wan-federation-protocol"
+
+	// MetaWANFederationPortKey is the mesh gateway metadata key that
+	// overrides the port used for wan federation transit dialing, for
+	// gateways whose wanfed ALPN listener is not on the catalog port.
+	MetaWANFederationPortKey = "consul-wan-federation-port"
+
+	// MetaWANFederationMaxConnsKey is the mesh gateway metadata key that
+	// advertises the maximum number of concurrent wan federation transit
+	// connections the gateway wants to carry. Absent or invalid means
+	// unlimited.
+	MetaWANFederationMaxConnsKey = "consul-wan-federation-max-conns"
+
 	// MaxLockDelay provides a maximum LockDelay value for
 	// a session. Any value above this will not be respected.
 	MaxLockDelay = 60 * time.Second
@@ -120,7 +142,13 @@ const (
 	WildcardSpecifier = "*"
 )
 
-var allowedConsulMetaKeysForMeshGateway = map[string]struct{}{MetaWANFederationKey: struct{}{}}
+var allowedConsulMetaKeysForMeshGateway = map[string]struct{}{
+	MetaWANFederationKey:         struct{}{},
+	MetaWANFederationDrainKey:    struct{}{},
+	MetaWANFederationProtocolKey: struct{}{},
+	MetaWANFederationPortKey:     struct{}{},
+	MetaWANFederationMaxConnsKey: struct{}{},
+}
 
 var (
 	NodeMaintCheckID = NewCheckID(NodeMaint, nil)
@@ -0,0 +1,20 @@
+package api
+
+// DecommissionDatacenter removes a departed datacenter from the WAN
+// federation: it deletes the datacenter's federation state and force-leaves
+// any of its servers still lingering in the WAN pool. A federation state that
+// reappears afterwards is pruned without the usual grace period, though only
+// on a best-effort basis (the marker does not survive a leader change). The
+// primary datacenter cannot be decommissioned.
+func (op *Operator) DecommissionDatacenter(datacenter string, q *WriteOptions) error {
+	r := op.c.newRequest("DELETE", "/v1/operator/datacenter/"+datacenter)
+	r.setWriteOptions(q)
+
+	_, resp, err := requireOK(op.c.doRequest(r))
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+	return nil
+}
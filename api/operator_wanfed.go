@@ -0,0 +1,94 @@
+package api
+
+import "time"
+
+// WANFederationGateway is one mesh gateway in a server's cached view of the
+// gateways usable for WAN federation transit.
+type WANFederationGateway struct {
+	// Address is the host:port the server would dial for this gateway.
+	Address string
+
+	// Datacenter is the datacenter the gateway provides transit into.
+	Datacenter string
+
+	// NodeName is the catalog node the gateway is registered on. Empty for
+	// fallback addresses, which have no catalog context.
+	NodeName string
+
+	// Health is the gateway's collapsed health status.
+	Health string
+
+	// FromFederationState is true when the address came from replicated
+	// federation state rather than fallback discovery.
+	FromFederationState bool
+
+	// LastUpdated is when the list containing this gateway was last
+	// replaced.
+	LastUpdated time.Time
+
+	// Source names where the list containing this gateway came from:
+	// "federation-state", "fallback", or "persisted-cache".
+	Source string
+
+	// RaftIndex is the federation state index the list was derived from.
+	// Zero for fallback addresses and lists restored from the persisted
+	// cache.
+	RaftIndex uint64
+}
+
+// WANFederationGatewaysResponse is a server's cached mesh gateway view.
+type WANFederationGatewaysResponse struct {
+	// LocalGateways provide transit into the answering server's own
+	// datacenter.
+	LocalGateways []WANFederationGateway
+
+	// PrimaryGateways are usable for reaching the primary datacenter,
+	// including fallback-derived entries when nothing has arrived via
+	// federation state yet.
+	PrimaryGateways []WANFederationGateway
+
+	// FallbackAddresses is the raw configured or discovered fallback list
+	// for the primary datacenter.
+	FallbackAddresses []string
+
+	// PrimaryReady is true once the answering server has learned at least
+	// one primary mesh gateway from replicated federation state.
+	PrimaryReady bool
+
+	// FailureCounts is the consecutive dial failure count per gateway
+	// address as tracked by the answering server's circuit breakers.
+	// Addresses without recent failures are absent.
+	FailureCounts map[string]int
+
+	// LastRefreshAttempt and LastSuccessfulRefresh report the liveness of
+	// the answering server's gateway refresh loop. Both advance on every
+	// pass even when nothing changed; stale timestamps mean the loop is
+	// stuck rather than quiet.
+	LastRefreshAttempt    time.Time
+	LastSuccessfulRefresh time.Time
+
+	// ConsecutiveRefreshErrors is how many refresh passes in a row have
+	// failed on the answering server.
+	ConsecutiveRefreshErrors int
+}
+
+// WANFederationGateways returns the answering server's cached view of the
+// mesh gateways usable for WAN federation transit. The view is per-server
+// state: by default the datacenter's leader answers, while the stale query
+// mode reports whichever server was contacted.
+func (op *Operator) WANFederationGateways(q *QueryOptions) (*WANFederationGatewaysResponse, error) {
+	r := op.c.newRequest("GET", "/v1/operator/wan-federation/mesh-gateways")
+	r.setQueryOptions(q)
+
+	_, resp, err := requireOK(op.c.doRequest(r))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var out WANFederationGatewaysResponse
+	if err := decodeBody(resp, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
@@ -84,9 +84,13 @@ import (
 	operauto "github.com/hashicorp/consul/command/operator/autopilot"
 	operautoget "github.com/hashicorp/consul/command/operator/autopilot/get"
 	operautoset "github.com/hashicorp/consul/command/operator/autopilot/set"
+	operdc "github.com/hashicorp/consul/command/operator/datacenter"
+	operdcdecommission "github.com/hashicorp/consul/command/operator/datacenter/decommission"
 	operraft "github.com/hashicorp/consul/command/operator/raft"
 	operraftlist "github.com/hashicorp/consul/command/operator/raft/listpeers"
 	operraftremove "github.com/hashicorp/consul/command/operator/raft/removepeer"
+	operwanfed "github.com/hashicorp/consul/command/operator/wanfederation"
+	operwanfedgw "github.com/hashicorp/consul/command/operator/wanfederation/gateways"
 	"github.com/hashicorp/consul/command/reload"
 	"github.com/hashicorp/consul/command/rtt"
 	"github.com/hashicorp/consul/command/services"
@@ -200,9 +204,13 @@ func init() {
 	Register("operator autopilot", func(cli.Ui) (cli.Command, error) { return operauto.New(), nil })
 	Register("operator autopilot get-config", func(ui cli.Ui) (cli.Command, error) { return operautoget.New(ui), nil })
 	Register("operator autopilot set-config", func(ui cli.Ui) (cli.Command, error) { return operautoset.New(ui), nil })
+	Register("operator datacenter", func(cli.Ui) (cli.Command, error) { return operdc.New(), nil })
+	Register("operator datacenter decommission", func(ui cli.Ui) (cli.Command, error) { return operdcdecommission.New(ui), nil })
 	Register("operator raft", func(cli.Ui) (cli.Command, error) { return operraft.New(), nil })
 	Register("operator raft list-peers", func(ui cli.Ui) (cli.Command, error) { return operraftlist.New(ui), nil })
 	Register("operator raft remove-peer", func(ui cli.Ui) (cli.Command, error) { return operraftremove.New(ui), nil })
+	Register("operator wan-federation", func(cli.Ui) (cli.Command, error) { return operwanfed.New(), nil })
+	Register("operator wan-federation gateways", func(ui cli.Ui) (cli.Command, error) { return operwanfedgw.New(ui), nil })
 	Register("reload", func(ui cli.Ui) (cli.Command, error) { return reload.New(ui), nil })
 	Register("rtt", func(ui cli.Ui) (cli.Command, error) { return rtt.New(ui), nil })
 	Register("services", func(cli.Ui) (cli.Command, error) { return services.New(), nil })
@@ -191,7 +191,7 @@ func (c *cmd) Run(args []string) int {
 	}
 
 	// Capture dynamic information from the target agent, blocking for duration
-	if c.configuredTarget("metrics") || c.configuredTarget("logs") || c.configuredTarget("pprof") {
+	if c.configuredTarget("metrics") || c.configuredTarget("logs") || c.configuredTarget("pprof") || c.configuredTarget("wanfed") {
 		err = c.captureDynamic()
 		if err != nil {
 			c.UI.Error(fmt.Sprintf("Error encountered during collection: %v", err))
@@ -261,7 +261,8 @@ func (c *cmd) prepare() (version string, err error) {
 
 	// If none are specified we will collect information from
 	// all by default
-	if len(c.capture) == 0 {
+	explicitTargets := len(c.capture) != 0
+	if !explicitTargets {
 		c.capture = c.defaultTargets()
 	}
 
@@ -276,6 +277,24 @@ func (c *cmd) prepare() (version string, err error) {
 		c.UI.Warn("[WARN] Unable to capture pprof. Set enable_debug to true on target agent to enable profiling.")
 	}
 
+	// Only servers federated over mesh gateways can answer the wanfed
+	// capture, so drop the target everywhere else rather than logging an
+	// error on every capture interval. Stay quiet unless the operator
+	// asked for the target by name, since most agents are not federated.
+	wanfedEnabled, _ := self["DebugConfig"]["ConnectMeshGatewayWANFederationEnabled"].(bool)
+	if !wanfedEnabled && c.configuredTarget("wanfed") {
+		cs := c.capture
+		for i := 0; i < len(cs); i++ {
+			if cs[i] == "wanfed" {
+				c.capture = append(cs[:i], cs[i+1:]...)
+				i--
+			}
+		}
+		if explicitTargets {
+			c.UI.Warn("[WARN] Unable to capture wanfed. The target agent is not federated via mesh gateways.")
+		}
+	}
+
 	for _, t := range c.capture {
 		if !c.allowedTarget(t) {
 			return version, fmt.Errorf("target not found: %s", t)
@@ -474,6 +493,32 @@ func (c *cmd) captureDynamic() error {
 			}()
 		}
 
+		// Capture the server's cached wan federation mesh gateway view.
+		// AllowStale makes the contacted server answer from its own
+		// locator, which is the state we are debugging.
+		if c.configuredTarget("wanfed") {
+			wg.Add(1)
+
+			go func() {
+				wanfed, err := c.client.Operator().WANFederationGateways(&api.QueryOptions{AllowStale: true})
+				if err != nil {
+					errCh <- err
+				}
+
+				marshaled, err := json.MarshalIndent(wanfed, "", "\t")
+				if err != nil {
+					errCh <- err
+				}
+
+				err = ioutil.WriteFile(fmt.Sprintf("%s/%s.json", timestampDir, "wanfed"), marshaled, 0644)
+				if err != nil {
+					errCh <- err
+				}
+
+				wg.Done()
+			}()
+		}
+
 		// Capture logs
 		if c.configuredTarget("logs") {
 			wg.Add(1)
@@ -690,7 +735,7 @@ func (c *cmd) defaultTargets() []string {
 // dynamicTargets returns all the supported targets
 // that are retrieved at the interval specified
 func (c *cmd) dynamicTargets() []string {
-	return []string{"metrics", "logs", "pprof"}
+	return []string{"metrics", "logs", "pprof", "wanfed"}
 }
 
 // staticTargets returns all the supported targets
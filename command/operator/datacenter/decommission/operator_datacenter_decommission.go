@@ -0,0 +1,85 @@
+package decommission
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/hashicorp/consul/command/flags"
+	"github.com/mitchellh/cli"
+)
+
+func New(ui cli.Ui) *cmd {
+	c := &cmd{UI: ui}
+	c.init()
+	return c
+}
+
+type cmd struct {
+	UI    cli.Ui
+	flags *flag.FlagSet
+	http  *flags.HTTPFlags
+	help  string
+}
+
+func (c *cmd) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.http = &flags.HTTPFlags{}
+	flags.Merge(c.flags, c.http.ClientFlags())
+	flags.Merge(c.flags, c.http.ServerFlags())
+	c.help = flags.Usage(help, c.flags)
+}
+
+func (c *cmd) Run(args []string) int {
+	if err := c.flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		c.UI.Error(fmt.Sprintf("Failed to parse args: %v", err))
+		return 1
+	}
+
+	if len(c.flags.Args()) != 1 {
+		c.UI.Error("A single datacenter name is required")
+		return 1
+	}
+	datacenter := c.flags.Args()[0]
+
+	// Set up a client.
+	client, err := c.http.APIClient()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	if err := client.Operator().DecommissionDatacenter(datacenter, nil); err != nil {
+		c.UI.Error(fmt.Sprintf("Error decommissioning datacenter: %v", err))
+		return 1
+	}
+	c.UI.Output(fmt.Sprintf("Decommissioned datacenter %q", datacenter))
+
+	return 0
+}
+
+func (c *cmd) Synopsis() string {
+	return synopsis
+}
+
+func (c *cmd) Help() string {
+	return c.help
+}
+
+const synopsis = "Remove a departed datacenter from the WAN federation"
+const help = `
+Usage: consul operator datacenter decommission [options] DATACENTER
+
+  Remove the given datacenter from the WAN federation. This deletes the
+  datacenter's federation state, force-leaves any of its servers still
+  lingering in the WAN pool, and marks the datacenter so a reappearing
+  federation state is pruned without the usual grace period. The marker is
+  held in memory by the primary's current leader, so after a leader change a
+  reappearing state is instead pruned once the grace period expires.
+
+  The request is executed in the primary datacenter, which cannot itself be
+  decommissioned. This is a destructive operation intended for datacenters
+  that have already been shut down or removed from the federation.
+`
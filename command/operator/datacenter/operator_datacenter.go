@@ -0,0 +1,32 @@
+package datacenter
+
+import (
+	"github.com/hashicorp/consul/command/flags"
+	"github.com/mitchellh/cli"
+)
+
+func New() *cmd {
+	return &cmd{}
+}
+
+type cmd struct{}
+
+func (c *cmd) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+func (c *cmd) Synopsis() string {
+	return synopsis
+}
+
+func (c *cmd) Help() string {
+	return flags.Usage(help, nil)
+}
+
+const synopsis = "Provides tools for managing WAN federated datacenters"
+const help = `
+Usage: consul operator datacenter <subcommand> [options]
+
+The datacenter operator command is used to manage datacenters joined in a WAN
+federation, such as decommissioning a datacenter that has been removed.
+`
@@ -0,0 +1,132 @@
+package gateways
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/hashicorp/consul/command/flags"
+	"github.com/mitchellh/cli"
+	"github.com/ryanuber/columnize"
+)
+
+func New(ui cli.Ui) *cmd {
+	c := &cmd{UI: ui}
+	c.init()
+	return c
+}
+
+type cmd struct {
+	UI    cli.Ui
+	flags *flag.FlagSet
+	http  *flags.HTTPFlags
+	help  string
+
+	detailed bool
+}
+
+func (c *cmd) init() {
+	c.flags = flag.NewFlagSet("", flag.ContinueOnError)
+	c.flags.BoolVar(&c.detailed, "detailed", false,
+		"Dump the server's full mesh gateway view as JSON instead of a table.")
+	c.http = &flags.HTTPFlags{}
+	flags.Merge(c.flags, c.http.ClientFlags())
+	flags.Merge(c.flags, c.http.ServerFlags())
+	c.help = flags.Usage(help, c.flags)
+}
+
+func (c *cmd) Run(args []string) int {
+	if err := c.flags.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		c.UI.Error(fmt.Sprintf("Failed to parse args: %v", err))
+		return 1
+	}
+
+	// Set up a client.
+	client, err := c.http.APIClient()
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error initializing client: %s", err))
+		return 1
+	}
+
+	q := &api.QueryOptions{
+		AllowStale: c.http.Stale(),
+	}
+	reply, err := client.Operator().WANFederationGateways(q)
+	if err != nil {
+		c.UI.Error(fmt.Sprintf("Error getting mesh gateways: %v", err))
+		return 1
+	}
+
+	if c.detailed {
+		out, err := json.MarshalIndent(reply, "", "   ")
+		if err != nil {
+			c.UI.Error(fmt.Sprintf("Error formatting response: %v", err))
+			return 1
+		}
+		c.UI.Output(string(out))
+	} else {
+		c.UI.Output(formatGatewaysTable(reply, time.Now()))
+	}
+
+	if len(reply.PrimaryGateways) == 0 {
+		c.UI.Error("The server reports no usable mesh gateways for reaching the primary datacenter")
+		return 1
+	}
+	return 0
+}
+
+// formatGatewaysTable renders one row per known gateway. Ages are computed
+// against the provided now so tests can pin them.
+func formatGatewaysTable(reply *api.WANFederationGatewaysResponse, now time.Time) string {
+	rows := []string{"Datacenter\x1fAddress\x1fSource\x1fHealth\x1fAge"}
+	appendRows := func(gateways []api.WANFederationGateway) {
+		for _, gw := range gateways {
+			source := "federation-state"
+			if !gw.FromFederationState {
+				source = "fallback"
+			}
+			age := "-"
+			if !gw.LastUpdated.IsZero() {
+				age = now.Sub(gw.LastUpdated).Round(time.Second).String()
+			}
+			rows = append(rows, fmt.Sprintf("%s\x1f%s\x1f%s\x1f%s\x1f%s",
+				gw.Datacenter, gw.Address, source, gw.Health, age))
+		}
+	}
+	appendRows(reply.PrimaryGateways)
+	// In the primary datacenter the local and primary lists cover the same
+	// gateways, so only print them once.
+	samedc := len(reply.PrimaryGateways) > 0 && len(reply.LocalGateways) > 0 &&
+		reply.PrimaryGateways[0].Datacenter == reply.LocalGateways[0].Datacenter
+	if !samedc {
+		appendRows(reply.LocalGateways)
+	}
+	return columnize.Format(rows, &columnize.Config{Delim: string([]byte{0x1f})})
+}
+
+func (c *cmd) Synopsis() string {
+	return synopsis
+}
+
+func (c *cmd) Help() string {
+	return c.help
+}
+
+const synopsis = "Display the mesh gateways a server knows about"
+const help = `
+Usage: consul operator wan-federation gateways [options]
+
+  Displays the mesh gateways the target server currently knows about for WAN
+  federation transit, including whether each came from replicated federation
+  state or from fallback discovery. The view is per-server state: use -stale
+  to inspect the specific server answering rather than the datacenter's
+  leader.
+
+  The command exits non-zero when the server reports no usable gateways for
+  reaching the primary datacenter.
+`
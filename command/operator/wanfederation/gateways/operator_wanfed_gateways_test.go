@@ -0,0 +1,85 @@
+package gateways
+
+import (
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+	"github.com/mitchellh/cli"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func TestOperatorWanfedGatewaysCommand_noTabs(t *testing.T) {
+	t.Parallel()
+	if strings.ContainsRune(New(cli.NewMockUi()).Help(), '\t') {
+		t.Fatal("help has tabs")
+	}
+}
+
+func TestFormatGatewaysTable(t *testing.T) {
+	now := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		name  string
+		reply *api.WANFederationGatewaysResponse
+	}{
+		{
+			name: "federation-state",
+			reply: &api.WANFederationGatewaysResponse{
+				PrimaryGateways: []api.WANFederationGateway{
+					{Address: "1.2.3.4:4443", Datacenter: "dc1", NodeName: "gateway1", Health: "passing", FromFederationState: true, LastUpdated: now.Add(-90 * time.Second)},
+					{Address: "4.3.2.1:4443", Datacenter: "dc1", NodeName: "gateway2", Health: "warning", FromFederationState: true, LastUpdated: now.Add(-90 * time.Second)},
+				},
+				LocalGateways: []api.WANFederationGateway{
+					{Address: "5.6.7.8:4443", Datacenter: "dc2", NodeName: "gateway1", Health: "passing", FromFederationState: true, LastUpdated: now.Add(-30 * time.Second)},
+				},
+				PrimaryReady: true,
+			},
+		},
+		{
+			name: "fallback",
+			reply: &api.WANFederationGatewaysResponse{
+				PrimaryGateways: []api.WANFederationGateway{
+					{Address: "10.0.0.1:8443", Datacenter: "dc1", Health: "passing", LastUpdated: now.Add(-5 * time.Minute)},
+					{Address: "10.0.0.2:8443", Datacenter: "dc1", Health: "warning"},
+				},
+				FallbackAddresses: []string{"10.0.0.1:8443", "10.0.0.2:8443"},
+			},
+		},
+		{
+			// a server in the primary datacenter has identical primary and
+			// local lists, which the table prints only once
+			name: "same-datacenter",
+			reply: &api.WANFederationGatewaysResponse{
+				PrimaryGateways: []api.WANFederationGateway{
+					{Address: "1.2.3.4:4443", Datacenter: "dc1", NodeName: "gateway1", Health: "passing", FromFederationState: true, LastUpdated: now.Add(-time.Hour)},
+				},
+				LocalGateways: []api.WANFederationGateway{
+					{Address: "1.2.3.4:4443", Datacenter: "dc1", NodeName: "gateway1", Health: "passing", FromFederationState: true, LastUpdated: now.Add(-time.Hour)},
+				},
+				PrimaryReady: true,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual := formatGatewaysTable(tc.reply, now) + "\n"
+
+			golden := filepath.Join("testdata", tc.name+".golden")
+			if *update {
+				require.NoError(t, ioutil.WriteFile(golden, []byte(actual), 0644))
+			}
+
+			expected, err := ioutil.ReadFile(golden)
+			require.NoError(t, err)
+			require.Equal(t, string(expected), actual)
+		})
+	}
+}
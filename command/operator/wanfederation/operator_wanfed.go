@@ -0,0 +1,33 @@
+package wanfederation
+
+import (
+	"github.com/hashicorp/consul/command/flags"
+	"github.com/mitchellh/cli"
+)
+
+func New() *cmd {
+	return &cmd{}
+}
+
+type cmd struct{}
+
+func (c *cmd) Run(args []string) int {
+	return cli.RunResultHelp
+}
+
+func (c *cmd) Synopsis() string {
+	return synopsis
+}
+
+func (c *cmd) Help() string {
+	return flags.Usage(help, nil)
+}
+
+const synopsis = "Provides tools for inspecting WAN federation via mesh gateways"
+const help = `
+Usage: consul operator wan-federation <subcommand> [options]
+
+The wan-federation operator command is used to inspect datacenters federated
+over mesh gateways, such as listing the gateways a server currently knows
+about.
+`
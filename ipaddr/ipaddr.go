@@ -7,8 +7,14 @@ import (
 	"strconv"
 )
 
-// FormatAddressPort Helper for net.JoinHostPort that takes int for port
+// FormatAddressPort Helper for net.JoinHostPort that takes int for port.
+// Addresses that arrive already bracketed ("[2001:db8::1]") are unwrapped
+// first so the result is never double-bracketed, and zoned IPv6 literals
+// ("fe80::1%eth0") come out bracketed the way net.Dial expects.
 func FormatAddressPort(address string, port int) string {
+	if len(address) >= 2 && address[0] == '[' && address[len(address)-1] == ']' {
+		address = address[1 : len(address)-1]
+	}
 	return net.JoinHostPort(address, strconv.Itoa(port))
 }
 
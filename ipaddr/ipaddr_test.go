@@ -54,3 +54,31 @@ func TestIsIPv6(t *testing.T) {
 		})
 	}
 }
+
+func TestFormatAddressPort(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+	}{
+		// IPv4 and hostnames pass straight through
+		{"1.2.3.4", "1.2.3.4:1234"},
+		{"example.com", "example.com:1234"},
+
+		// plain IPv6 gets bracketed
+		{"2001:db8::1", "[2001:db8::1]:1234"},
+
+		// already-bracketed IPv6 is not double-bracketed
+		{"[2001:db8::1]", "[2001:db8::1]:1234"},
+
+		// link-local addresses keep their zone, bracketed or not
+		{"fe80::1%eth0", "[fe80::1%eth0]:1234"},
+		{"[fe80::1%eth0]", "[fe80::1%eth0]:1234"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			if got := FormatAddressPort(tt.address, 1234); got != tt.want {
+				t.Fatalf("FormatAddressPort(%q, 1234) = %q, want %q", tt.address, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package lib
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ValidateDialAddress checks that an address is a dialable host:port: the
+// port must be in range, a literal IP host must parse, and a hostname must at
+// least be syntactically plausible. It exists so a typo in a configured
+// gateway address surfaces at configuration time rather than much later as an
+// unexplained dial error.
+func ValidateDialAddress(addr string) error {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		return fmt.Errorf("missing host")
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return fmt.Errorf("invalid port %q", portStr)
+	}
+	return validateDialHost(host)
+}
+
+// ValidateDialAddressOptionalPort is like ValidateDialAddress for
+// configuration entries where the port may be omitted and supplied
+// separately.
+func ValidateDialAddressOptionalPort(addr string) error {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return validateDialHost(addr)
+	}
+	return ValidateDialAddress(addr)
+}
+
+func validateDialHost(host string) error {
+	if h := strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"); h != host {
+		host = h
+	}
+	if net.ParseIP(host) != nil {
+		return nil
+	}
+
+	// An all-numeric host or one containing colons is a failed IP literal,
+	// not a resolvable name.
+	if strings.Trim(host, "0123456789.") == "" || strings.Contains(host, ":") {
+		return fmt.Errorf("invalid ip address %q", host)
+	}
+
+	for _, label := range strings.Split(strings.TrimSuffix(host, "."), ".") {
+		if label == "" {
+			return fmt.Errorf("malformed hostname %q", host)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateDialAddress(t *testing.T) {
+	for _, tc := range []struct {
+		addr string
+		ok   bool
+	}{
+		{"10.0.0.5:443", true},
+		{"[2001:db8::5]:8443", true},
+		{"gateway.example.com:443", true},
+		{"gateway.example.com.:443", true},
+		{"10.0.0.5", false},           // missing port
+		{"10.0.0.5:84443", false},     // port out of range
+		{"10.0.0.5:0", false},         // port out of range
+		{"10.0.0.300:443", false},     // failed IP literal
+		{"[2001:zz8::5]:8443", false}, // failed IP literal
+		{"gateway..example.com:443", false},
+		{".example.com:443", false},
+		{":443", false}, // missing host
+	} {
+		t.Run(tc.addr, func(t *testing.T) {
+			err := ValidateDialAddress(tc.addr)
+			if tc.ok {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateDialAddressOptionalPort(t *testing.T) {
+	for _, tc := range []struct {
+		addr string
+		ok   bool
+	}{
+		{"10.0.0.5", true},
+		{"gateway.example.com", true},
+		{"10.0.0.5:443", true},
+		{"10.0.0.300", false},
+		{"10.0.0.5:84443", false},
+		{"gateway..example.com", false},
+	} {
+		t.Run(tc.addr, func(t *testing.T) {
+			err := ValidateDialAddressOptionalPort(tc.addr)
+			if tc.ok {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+// ThrottledLogger rate-limits a recurring error log line. A retry loop that
+// hits the same failure every iteration logs it once immediately and then
+// collapses further repeats into one periodic summary line per window,
+// carrying the repeat count and the first and last occurrence times. A
+// distinct error (judged by its message) always logs immediately and starts
+// a fresh window.
+//
+// It is safe for concurrent use.
+type ThrottledLogger struct {
+	logger hclog.Logger
+	window time.Duration
+
+	// timeNow is a shim for tests.
+	timeNow func() time.Time
+
+	mu         sync.Mutex
+	key        string
+	firstSeen  time.Time
+	lastEmit   time.Time
+	suppressed int
+}
+
+// NewThrottledLogger returns a ThrottledLogger emitting through the given
+// logger, summarizing repeats at most once per window.
+func NewThrottledLogger(logger hclog.Logger, window time.Duration) *ThrottledLogger {
+	return &ThrottledLogger{
+		logger:  logger,
+		window:  window,
+		timeNow: time.Now,
+	}
+}
+
+// Error logs msg and err at error level, suppressing repeats of an
+// identical msg/error pair within the window.
+func (tl *ThrottledLogger) Error(msg string, err error) {
+	now := tl.timeNow()
+	key := msg + "\x00" + err.Error()
+
+	tl.mu.Lock()
+	defer tl.mu.Unlock()
+
+	if key != tl.key {
+		tl.key = key
+		tl.firstSeen = now
+		tl.lastEmit = now
+		tl.suppressed = 0
+		tl.logger.Error(msg, "error", err)
+		return
+	}
+
+	tl.suppressed++
+	if now.Sub(tl.lastEmit) < tl.window {
+		return
+	}
+
+	tl.logger.Error(msg,
+		"error", err,
+		"repeated", tl.suppressed,
+		"first_occurrence", tl.firstSeen,
+		"last_occurrence", now,
+	)
+	tl.suppressed = 0
+	tl.lastEmit = now
+}
@@ -0,0 +1,65 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/go-hclog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottledLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := hclog.New(&hclog.LoggerOptions{
+		Level:  hclog.Error,
+		Output: &buf,
+	})
+
+	now := time.Date(2020, 4, 1, 12, 0, 0, 0, time.UTC)
+	tl := NewThrottledLogger(logger, time.Minute)
+	tl.timeNow = func() time.Time { return now }
+
+	lines := func() int {
+		return strings.Count(buf.String(), "boom failed")
+	}
+
+	errBoom := errors.New("boom")
+
+	// The first occurrence logs immediately.
+	tl.Error("boom failed", errBoom)
+	require.Equal(t, 1, lines())
+
+	// Repeats inside the window are suppressed.
+	for i := 0; i < 10; i++ {
+		now = now.Add(time.Second)
+		tl.Error("boom failed", errBoom)
+	}
+	require.Equal(t, 1, lines())
+
+	// Once the window elapses a single summary line is emitted with the
+	// repeat count.
+	now = now.Add(time.Minute)
+	tl.Error("boom failed", errBoom)
+	require.Equal(t, 2, lines())
+	require.Contains(t, buf.String(), "repeated=11")
+	require.Contains(t, buf.String(), "first_occurrence=")
+
+	// Suppression resumes within the next window.
+	now = now.Add(time.Second)
+	tl.Error("boom failed", errBoom)
+	require.Equal(t, 2, lines())
+
+	// A distinct error logs immediately and resets the window.
+	now = now.Add(time.Second)
+	tl.Error("boom failed", errors.New("other boom"))
+	require.Equal(t, 3, lines())
+	require.Contains(t, buf.String(), "other boom")
+
+	// And the original error is once again treated as new.
+	now = now.Add(time.Second)
+	tl.Error("boom failed", errBoom)
+	require.Equal(t, 4, lines())
+}
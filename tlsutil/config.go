@@ -783,7 +783,22 @@ func (c *Configurator) OutgoingALPNRPCWrapper() ALPNWrapper {
 	}
 
 	return func(dc, nodeName, alpnProto string, conn net.Conn) (net.Conn, error) {
-		return c.wrapALPNTLSClient(dc, nodeName, alpnProto, conn)
+		return c.wrapALPNTLSClient(dc, nodeName, alpnProto, "", conn)
+	}
+}
+
+// OutgoingALPNRPCWrapperWithServerName is OutgoingALPNRPCWrapper except that
+// the TLS ServerName presented (and verified) is the provided override
+// instead of the name computed from the datacenter and node. This is used
+// when a shared mesh gateway routes on a custom SNI.
+func (c *Configurator) OutgoingALPNRPCWrapperWithServerName(serverName string) ALPNWrapper {
+	c.log("OutgoingALPNRPCWrapperWithServerName")
+	if !c.mutualTLSCapable() {
+		return nil
+	}
+
+	return func(dc, nodeName, alpnProto string, conn net.Conn) (net.Conn, error) {
+		return c.wrapALPNTLSClient(dc, nodeName, alpnProto, serverName, conn)
 	}
 }
 
@@ -885,7 +900,7 @@ func (c *Configurator) wrapTLSClient(dc string, conn net.Conn) (net.Conn, error)
 
 // Wrap a net.Conn into a client tls connection suitable for secure ALPN-RPC,
 // performing any additional verification as needed.
-func (c *Configurator) wrapALPNTLSClient(dc, nodeName, alpnProto string, conn net.Conn) (net.Conn, error) {
+func (c *Configurator) wrapALPNTLSClient(dc, nodeName, alpnProto, serverName string, conn net.Conn) (net.Conn, error) {
 	if dc == "" {
 		return nil, fmt.Errorf("cannot dial using ALPN-RPC without a target datacenter")
 	} else if nodeName == "" {
@@ -903,7 +918,10 @@ func (c *Configurator) wrapALPNTLSClient(dc, nodeName, alpnProto string, conn ne
 	// mesh gateways we force mTLS and full hostname validation (forcing
 	// verify_server_hostname and verify_outgoing to be effectively true).
 
-	config.ServerName = c.ServerSNI(dc, nodeName)
+	if serverName == "" {
+		serverName = c.ServerSNI(dc, nodeName)
+	}
+	config.ServerName = serverName
 	config.NextProtos = []string{alpnProto}
 
 	tlsConn := tls.Client(conn, config)